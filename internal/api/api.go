@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"MQTTmicroService/internal/auth"
@@ -16,10 +21,13 @@ import (
 	"MQTTmicroService/internal/database"
 	"MQTTmicroService/internal/logger"
 	"MQTTmicroService/internal/metrics"
+	"MQTTmicroService/internal/models"
 	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/utils"
 
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
 // Server represents the HTTP API server
@@ -32,24 +40,85 @@ type Server struct {
 	db          database.Database
 	server      *http.Server
 	config      *config.Config
+	// requestTimeout bounds the duration of each request; zero disables it
+	requestTimeout time.Duration
+	// deliveryStop stops the webhook delivery worker
+	deliveryStop chan struct{}
+	// webhookPool delivers webhook notifications with a bounded number of workers
+	webhookPool *webhookPool
+	// webhookIndex finds the webhooks matching a received message
+	webhookIndex *webhookIndex
+	// webhookBreaker short-circuits deliveries to receivers that keep failing
+	webhookBreaker *webhookBreaker
+	// publicWebhookTransport delivers to database webhooks, refusing non-public destinations
+	publicWebhookTransport *http.Transport
+	// restoredBrokers records the brokers whose stored subscriptions were restored
+	restoredBrokers sync.Map
+	// buildInfo identifies the running build
+	buildInfo BuildInfo
+	// scheduleStop stops the scheduled message worker
+	scheduleStop chan struct{}
+	// rateLimiter throttles API requests per client; nil disables rate limiting
+	rateLimiter *rateLimiter
+	// idempotency records the outcome of requests made with an idempotency key
+	idempotency *idempotency
 }
 
 // PublishRequest represents a request to publish a message
 type PublishRequest struct {
-	Topic    string      `json:"topic"`
-	Payload  interface{} `json:"payload"`
-	QoS      byte        `json:"qos"`
-	Retained bool        `json:"retained"`
-	Broker   string      `json:"broker,omitempty"`
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload"`
+	// PayloadEncoding is how the payload is encoded in the request: base64 for binary payloads, or empty to publish
+	// the payload as it is
+	PayloadEncoding string `json:"payload_encoding,omitempty"`
+	// QoS defaults to DEFAULT_PUBLISH_QOS when omitted
+	QoS *byte `json:"qos,omitempty"`
+	// Retained defaults to DEFAULT_RETAINED when omitted
+	Retained *bool  `json:"retained,omitempty"`
+	Broker   string `json:"broker,omitempty"`
+	// Brokers publishes the message to several brokers instead of one, ["*"] to every configured broker
+	Brokers []string `json:"brokers,omitempty"`
+	// IdempotencyKey deduplicates retries of the request; the Idempotency-Key header takes precedence
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	mqtt5Options
+}
+
+// RetainedClearRequest represents a request to clear the retained message of a topic
+type RetainedClearRequest struct {
+	Topic  string `json:"topic"`
+	Broker string `json:"broker,omitempty"`
 }
 
 // SubscribeRequest represents a request to subscribe to a topic
 type SubscribeRequest struct {
-	Topic  string `json:"topic"`
-	QoS    byte   `json:"qos"`
+	Topic string `json:"topic"`
+	// QoS defaults to DEFAULT_SUBSCRIBE_QOS when omitted
+	QoS    *byte  `json:"qos,omitempty"`
 	Broker string `json:"broker,omitempty"`
 }
 
+// BatchSubscribeRequest represents a request to subscribe to several topics on one broker
+type BatchSubscribeRequest struct {
+	Broker        string              `json:"broker,omitempty"`
+	Subscriptions []TopicSubscription `json:"subscriptions"`
+}
+
+// TopicSubscription is a single topic of a batch subscribe request
+type TopicSubscription struct {
+	Topic string `json:"topic"`
+	// QoS defaults to DEFAULT_SUBSCRIBE_QOS when omitted
+	QoS *byte `json:"qos,omitempty"`
+}
+
+// BatchSubscribeResult is the outcome of subscribing to a single topic of a batch
+type BatchSubscribeResult struct {
+	Topic      string `json:"topic"`
+	Status     string `json:"status"`
+	GrantedQoS *byte  `json:"granted_qos,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
 // StatusResponse represents the status of MQTT connections
 type StatusResponse struct {
 	Status    string                  `json:"status"`
@@ -59,21 +128,114 @@ type StatusResponse struct {
 
 // BrokerStatus represents the status of a single MQTT broker
 type BrokerStatus struct {
-	Connected     bool     `json:"connected"`
-	Subscriptions []string `json:"subscriptions"`
+	Connected           bool                 `json:"connected"`
+	Subscriptions       []string             `json:"subscriptions"`
+	SharedSubscriptions []SharedSubscription `json:"shared_subscriptions,omitempty"`
+	LastError           *ConnectionError     `json:"last_error,omitempty"`
+	Health              *BrokerHealth        `json:"health,omitempty"`
+}
+
+// BrokerHealth is the connection quality of a broker, reported by GET /status?detail=full
+type BrokerHealth struct {
+	// Latency is the round trip of a probe message, set for connected brokers that acknowledged it
+	Latency string `json:"latency,omitempty"`
+	// ProbeError is set for connected brokers that didn't acknowledge the probe
+	ProbeError string `json:"probe_error,omitempty"`
+	// CheckedAt is when the probe was made, which may be up to statusProbeMaxAge ago
+	CheckedAt string `json:"checked_at,omitempty"`
+	// LastConnectedAt is when the broker was last connected, including automatic reconnects
+	LastConnectedAt string `json:"last_connected_at,omitempty"`
+}
+
+// Latency probes made for GET /status?detail=full
+const (
+	// statusProbeTimeout is how long a probe waits for the broker's acknowledgement
+	statusProbeTimeout = 2 * time.Second
+	// statusProbeMaxAge is how long a probe result is reused, so frequent polling doesn't flood brokers
+	statusProbeMaxAge = 5 * time.Second
+)
+
+// SharedSubscription describes a shared subscription of a broker
+type SharedSubscription struct {
+	Topic  string `json:"topic"`
+	Group  string `json:"group"`
+	Filter string `json:"filter"`
+}
+
+// Broker connection states reported by GET /brokers
+const (
+	BrokerStateConnected      = "connected"
+	BrokerStateDisconnected   = "disconnected"
+	BrokerStateNeverConnected = "never_connected"
+)
+
+// BrokerInfo describes a configured MQTT broker; credentials are never included
+type BrokerInfo struct {
+	Name            string           `json:"name"`
+	Host            string           `json:"host"`
+	Port            int              `json:"port"`
+	TLS             bool             `json:"tls"`
+	ClientID        string           `json:"client_id"`
+	ProtocolVersion int              `json:"protocol_version,omitempty"`
+	Default         bool             `json:"default"`
+	State           string           `json:"state"`
+	LastError       *ConnectionError `json:"last_error,omitempty"`
+}
+
+// ReadinessResponse represents the result of a readiness check
+type ReadinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// ComponentStatus represents the health of a single dependency
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ConnectionError describes a failed broker connection attempt
+type ConnectionError struct {
+	Message    string `json:"message"`
+	Reason     string `json:"reason"`
+	ReturnCode byte   `json:"return_code"`
 }
 
 // WebhookPayload represents the payload sent to the webhook
 type WebhookPayload struct {
+	// Event is set on notifications of events other than received messages, such as WebhookEventMessageConfirmed
+	Event string `json:"event,omitempty"`
+	// MessageID is the ID of the stored message an event is about
+	MessageID string      `json:"message_id,omitempty"`
 	Topic     string      `json:"topic"`
 	Payload   interface{} `json:"payload"`
 	QoS       byte        `json:"qos"`
 	Timestamp string      `json:"timestamp"`
 	Broker    string      `json:"broker"`
+	// RequestID is the correlation ID of the API request that created the subscription
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Default timeouts of the HTTP server
+const (
+	DefaultHTTPReadTimeout  = 15 * time.Second
+	DefaultHTTPWriteTimeout = 15 * time.Second
+	DefaultHTTPIdleTimeout  = 60 * time.Second
+)
+
+// HTTPTimeouts are the timeouts of the HTTP server's connections, with the semantics of http.Server: zero
+// disables a timeout. Streaming responses are exempt from the read and write timeouts.
+type HTTPTimeouts struct {
+	// Read is the maximum duration for reading a request, including its body
+	Read time.Duration
+	// Write is the maximum duration from the end of reading the request headers to the end of the response
+	Write time.Duration
+	// Idle is how long keep-alive connections wait for the next request; zero uses Read
+	Idle time.Duration
 }
 
 // NewServer creates a new HTTP API server
-func NewServer(mqttManager *mqtt.Manager, log *logger.Logger, metricsCollector *metrics.Metrics, authService *auth.Auth, db database.Database, cfg *config.Config, addr string) *Server {
+func NewServer(mqttManager *mqtt.Manager, log *logger.Logger, metricsCollector *metrics.Metrics, authService *auth.Auth, db database.Database, cfg *config.Config, addr string, timeouts HTTPTimeouts) *Server {
 	router := mux.NewRouter()
 
 	server := &Server{
@@ -87,56 +249,148 @@ func NewServer(mqttManager *mqtt.Manager, log *logger.Logger, metricsCollector *
 		server: &http.Server{
 			Addr:         addr,
 			Handler:      router,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
-			IdleTimeout:  60 * time.Second,
+			ReadTimeout:  timeouts.Read,
+			WriteTimeout: timeouts.Write,
+			IdleTimeout:  timeouts.Idle,
 		},
 	}
 
+	idempotencyTTL := defaultIdempotencyTTL
+	var webhookConfig *config.WebhookConfig
+	if cfg != nil {
+		webhookConfig = cfg.Webhook
+
+		server.requestTimeout = time.Duration(cfg.APIRequestTimeout) * time.Second
+
+		if cfg.IdempotencyTTL > 0 {
+			idempotencyTTL = time.Duration(cfg.IdempotencyTTL) * time.Second
+		}
+
+		if cfg.RateLimitRPS > 0 {
+			server.rateLimiter = newRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+		}
+
+		// Handle CORS in front of the router so preflight requests never reach authentication
+		if len(cfg.CORSAllowedOrigins) > 0 {
+			server.server.Handler = server.corsMiddleware(router)
+		}
+	}
+
+	server.idempotency = newIdempotency(db, idempotencyTTL)
+	server.webhookPool = newWebhookPool(webhookConfig)
+	server.webhookIndex = newWebhookIndex()
+	server.webhookBreaker = newWebhookBreaker(webhookConfig, log)
+	server.publicWebhookTransport = newPublicWebhookTransport()
+
+	// Restore stored subscriptions once each broker is connected
+	if db != nil && mqttManager != nil {
+		mqttManager.AddConnectHook(server.restoreSubscriptions)
+	}
+
 	server.setupRoutes()
 	return server
 }
 
 // setupRoutes sets up the HTTP routes
 func (s *Server) setupRoutes() {
+	// Assign every request a correlation ID first so all later middleware can log it
+	s.router.Use(s.requestIDMiddleware)
+
 	// Add metrics middleware if metrics collector is initialized
 	if s.metrics != nil {
 		s.router.Use(s.metricsMiddleware)
 	}
 
+	// Compress responses inside the metrics middleware so it still sees the real status codes
+	if s.config != nil && s.config.APIGzipEnabled {
+		s.router.Use(s.gzipMiddleware)
+	}
+
+	// Reject sources outside the IP allowlist before they reach authentication
+	if s.config != nil && len(s.config.IPAllowlist) > 0 {
+		s.router.Use(s.ipFilterMiddleware)
+	}
+
 	// Add authentication middleware if auth service is initialized
 	if s.auth != nil {
 		s.logger.WithFields(map[string]interface{}{
 			"auth":         s.auth != nil,
 			"enableAPIKey": s.auth.GetEnableAPIKey(),
 		}).Info("Adding authentication middleware to router")
+		// Throttle sources that keep failing authentication, which the rate limiter below never sees
+		if s.rateLimiter != nil {
+			s.router.Use(s.authFailureLimitMiddleware)
+		}
 		s.router.Use(s.auth.AuthMiddleware)
 	}
 
-	s.router.HandleFunc("/publish", s.handlePublish).Methods("POST")
-	s.router.HandleFunc("/subscribe", s.handleSubscribe).Methods("POST")
-	s.router.HandleFunc("/unsubscribe", s.handleUnsubscribe).Methods("POST")
-	s.router.HandleFunc("/status", s.handleStatus).Methods("GET")
+	// Throttle clients once they are identified by authentication
+	if s.rateLimiter != nil {
+		s.router.Use(s.rateLimitMiddleware)
+	}
+
+	// Bound every request with the configured timeout
+	s.router.Use(s.timeoutMiddleware)
+
+	s.router.HandleFunc("/publish", s.requireScope(auth.ScopePublish, s.handlePublish)).Methods("POST")
+	s.router.HandleFunc("/publish/batch", s.requireScope(auth.ScopePublish, s.handleBatchPublish)).Methods("POST")
+	s.router.HandleFunc("/retained/clear", s.requireScope(auth.ScopePublish, s.handleRetainedClear)).Methods("POST")
+	s.router.HandleFunc("/subscribe", s.requireScope(auth.ScopeSubscribe, s.handleSubscribe)).Methods("POST")
+	s.router.HandleFunc("/subscribe/batch", s.requireScope(auth.ScopeSubscribe, s.handleBatchSubscribe)).Methods("POST")
+	s.router.HandleFunc("/unsubscribe", s.requireScope(auth.ScopeSubscribe, s.handleUnsubscribe)).Methods("POST")
+	s.router.HandleFunc("/status", s.requireScope(auth.ScopeRead, s.handleStatus)).Methods("GET")
+	s.router.HandleFunc("/subscriptions", s.requireScope(auth.ScopeAdmin, s.handleGetSubscriptions)).Methods("GET")
+	s.router.HandleFunc("/brokers", s.requireScope(auth.ScopeRead, s.handleBrokers)).Methods("GET")
+	s.router.HandleFunc("/brokers/{name}/connect", s.requireScope(auth.ScopeAdmin, s.handleBrokerConnect)).Methods("POST")
+	s.router.HandleFunc("/brokers/{name}/disconnect", s.requireScope(auth.ScopeAdmin, s.handleBrokerDisconnect)).Methods("POST")
 	s.router.HandleFunc("/healthz", s.handleHealthCheck).Methods("GET")
-	s.router.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
-	s.router.HandleFunc("/logs", s.handleLogs).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadinessCheck).Methods("GET")
+	s.router.HandleFunc("/openapi.json", s.handleOpenAPI).Methods("GET")
+	s.router.HandleFunc("/version", s.handleVersion).Methods("GET")
+	s.router.HandleFunc("/metrics", s.requireScope(auth.ScopeRead, s.handleMetrics)).Methods("GET")
+	s.router.HandleFunc("/metrics/stream", s.requireScope(auth.ScopeRead, s.handleMetricsStream)).Methods("GET")
+	if s.metrics != nil {
+		s.router.HandleFunc("/metrics/reset", s.requireScope(auth.ScopeAdmin, s.handleMetricsReset)).Methods("POST")
+	}
+	s.router.HandleFunc("/ratelimit", s.requireScope(auth.ScopeAdmin, s.handleRateLimit)).Methods("GET")
+	s.router.HandleFunc("/config", s.requireScope(auth.ScopeAdmin, s.handleGetConfig)).Methods("GET")
+	s.router.HandleFunc("/logs", s.requireScope(auth.ScopeRead, s.handleLogs)).Methods("GET")
+	// Registered before /messages/{id} so it isn't taken for a message ID
+	s.router.HandleFunc("/messages/recent", s.requireScope(auth.ScopeRead, s.handleGetRecentMessages)).Methods("GET")
 
 	// Database-related endpoints
 	if s.db != nil {
 		// Message endpoints
-		s.router.HandleFunc("/messages", s.handleGetMessages).Methods("GET")
-		s.router.HandleFunc("/messages/{id}", s.handleGetMessage).Methods("GET")
-		s.router.HandleFunc("/messages/{id}/confirm", s.handleConfirmMessage).Methods("POST")
-		s.router.HandleFunc("/messages/{id}", s.handleDeleteMessage).Methods("DELETE")
-		s.router.HandleFunc("/messages/confirmed", s.handleDeleteConfirmedMessages).Methods("DELETE")
+		s.router.HandleFunc("/messages", s.requireScope(auth.ScopeRead, s.handleGetMessages)).Methods("GET")
+		s.router.HandleFunc("/messages/export", s.requireScope(auth.ScopeRead, s.handleExportMessages)).Methods("GET")
+		s.router.HandleFunc("/messages/import", s.requireScope(auth.ScopeAdmin, s.handleImportMessages)).Methods("POST")
+		s.router.HandleFunc("/messages/{id}", s.requireScope(auth.ScopeRead, s.handleGetMessage)).Methods("GET")
+		s.router.HandleFunc("/messages/{id}/confirm", s.requireScope(auth.ScopeAdmin, s.handleConfirmMessage)).Methods("POST")
+		s.router.HandleFunc("/messages/{id}", s.requireScope(auth.ScopeAdmin, s.handleDeleteMessage)).Methods("DELETE")
+		s.router.HandleFunc("/messages/confirmed", s.requireScope(auth.ScopeAdmin, s.handleDeleteConfirmedMessages)).Methods("DELETE")
+
+		// Scheduled publish endpoints
+		s.router.HandleFunc("/publish/schedule", s.requireScope(auth.ScopePublish, s.handleSchedulePublish)).Methods("POST")
+		s.router.HandleFunc("/publish/scheduled", s.requireScope(auth.ScopeRead, s.handleGetScheduledMessages)).Methods("GET")
+		s.router.HandleFunc("/publish/scheduled/{id}", s.requireScope(auth.ScopePublish, s.handleCancelScheduledMessage)).Methods("DELETE")
 
 		// Webhook endpoints
-		s.router.HandleFunc("/webhooks", s.handleGetWebhooks).Methods("GET")
-		s.router.HandleFunc("/webhooks", s.handleCreateWebhook).Methods("POST")
-		s.router.HandleFunc("/webhooks/{id}", s.handleGetWebhook).Methods("GET")
-		s.router.HandleFunc("/webhooks/{id}", s.handleUpdateWebhook).Methods("PUT")
-		s.router.HandleFunc("/webhooks/{id}", s.handleDeleteWebhook).Methods("DELETE")
+		s.router.HandleFunc("/webhooks", s.requireScope(auth.ScopeRead, s.handleGetWebhooks)).Methods("GET")
+		s.router.HandleFunc("/webhooks", s.requireScope(auth.ScopeAdmin, s.handleCreateWebhook)).Methods("POST")
+		s.router.HandleFunc("/webhooks/{id}", s.requireScope(auth.ScopeRead, s.handleGetWebhook)).Methods("GET")
+		s.router.HandleFunc("/webhooks/{id}", s.requireScope(auth.ScopeAdmin, s.handleUpdateWebhook)).Methods("PUT")
+		s.router.HandleFunc("/webhooks/{id}", s.requireScope(auth.ScopeAdmin, s.handleDeleteWebhook)).Methods("DELETE")
+		s.router.HandleFunc("/webhooks/{id}/deliveries", s.requireScope(auth.ScopeRead, s.handleGetWebhookDeliveries)).Methods("GET")
+		s.router.HandleFunc("/webhooks/deliveries/{id}/retry", s.requireScope(auth.ScopeAdmin, s.handleRetryWebhookDelivery)).Methods("POST")
+	}
+}
+
+// requireScope restricts a handler to callers holding the given scope when authentication is configured
+func (s *Server) requireScope(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	if s.auth == nil {
+		return handler
 	}
+	return s.auth.RequireScope(scope, handler)
 }
 
 // metricsMiddleware is middleware that tracks API requests and errors
@@ -173,40 +427,123 @@ func (rww *responseWriterWrapper) WriteHeader(statusCode int) {
 	rww.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Flush flushes the underlying ResponseWriter if it supports flushing
+func (rww *responseWriterWrapper) Flush() {
+	if flusher, ok := rww.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rww *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rww.ResponseWriter
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	s.logger.WithField("addr", s.server.Addr).Info("Starting HTTP server")
-	return s.server.ListenAndServe()
+	s.startWebhookWorkers()
+	s.startDeliveryWorker()
+	s.startScheduleWorker()
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
-// Stop stops the HTTP server
-func (s *Server) Stop() error {
+// Stop gracefully stops the HTTP server, letting in-flight requests finish until the context expires,
+// after which remaining connections are closed
+func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping HTTP server")
-	return s.server.Close()
+	s.stopDeliveryWorker()
+	s.stopScheduleWorker()
+
+	var err error
+	if err = s.server.Shutdown(ctx); err != nil {
+		s.logger.WithError(err).Warn("Graceful shutdown timed out, closing remaining connections")
+		err = s.server.Close()
+	}
+
+	// Deliver the queued webhook notifications in the time left
+	s.stopWebhookWorkers(ctx)
+	return err
 }
 
 // handlePublish handles requests to publish messages
 func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	// Reject oversized payloads before reading them into memory
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxPublishBytes())
+
 	var req PublishRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if isRawPublish(r) {
+		rawReq, ok := s.decodeRawPublish(w, r)
+		if !ok {
+			return
+		}
+		req = *rawReq
+	} else if err := newPayloadDecoder(r.Body).Decode(&req); err != nil {
+		s.writePublishDecodeError(w, err)
 		return
 	}
 
+	// Replay retried requests instead of publishing them again
+	if key := idempotencyKey(r, req.IdempotencyKey); key != "" {
+		s.withIdempotency(w, r, key, req, func(w http.ResponseWriter) {
+			s.publish(w, r, &req)
+		})
+		return
+	}
+
+	s.publish(w, r, &req)
+}
+
+// publish validates and publishes a message, writing the outcome to the response
+func (s *Server) publish(w http.ResponseWriter, r *http.Request, req *PublishRequest) {
 	if req.Topic == "" {
-		s.writeError(w, http.StatusBadRequest, "Topic is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required")
+		return
+	}
+
+	if err := utils.ValidatePublishTopic(req.Topic); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic: %v", err))
+		return
+	}
+
+	if err := req.unsupportedOption(); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	if req.Payload == nil && s.publishRetained(req.Retained) {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, missingRetainedPayload)
+		return
+	}
+
+	payload, err := decodePayload(req.Payload, req.PayloadEncoding)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	req.Payload = payload
+
+	if !s.checkPayloadSchema(w, s.tenantNamespace(r), req.Topic, req.Payload) {
+		return
+	}
+
+	if len(req.Brokers) > 0 {
+		s.publishToBrokers(w, r, req)
 		return
 	}
 
 	client, err := s.mqttManager.GetClient(req.Broker)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeUnknownBroker, fmt.Sprintf("Failed to get MQTT client: %v", err))
 		return
 	}
 
 	if !client.IsConnected() {
 		if err := client.Connect(); err != nil {
-			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to connect to MQTT broker: %v", err))
+			s.writeConnectError(w, err)
 			return
 		}
 	}
@@ -214,24 +551,97 @@ func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
 	// Start timing for latency measurement
 	startTime := time.Now()
 
-	if err := client.Publish(req.Topic, req.QoS, req.Retained, req.Payload); err != nil {
+	// Confine tenants to their own namespace
+	topic := utils.ApplyNamespace(s.tenantNamespace(r), req.Topic)
+
+	// Stop waiting for the broker once the request times out or the caller goes away
+	result, err := client.PublishMessageContext(r.Context(), topic, s.publishQoS(req.QoS), s.publishRetained(req.Retained), req.Payload)
+	if err != nil {
 		// Increment failed publishes counter
 		if s.metrics != nil {
-			s.metrics.IncrementFailedPublishes()
+			s.metrics.IncrementFailedPublishesForBroker(s.brokerName(req.Broker))
 		}
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to publish message: %v", err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "The broker didn't acknowledge the message in time")
+			return
+		}
+		if errors.Is(err, context.Canceled) {
+			s.writeError(w, http.StatusServiceUnavailable, ErrCodeCancelled, "Request cancelled")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, ErrCodePublishFailed, fmt.Sprintf("Failed to publish message: %v", err))
 		return
 	}
 
 	// Calculate and record latency
 	if s.metrics != nil {
-		s.metrics.IncrementPublishedMessages()
+		s.metrics.IncrementPublishedMessagesForTopic(topic, s.brokerName(req.Broker))
 		s.metrics.AddPublishLatency(time.Since(startTime))
 	}
 
+	// The ID of the stored message lets clients look it up or confirm it later
+	response := map[string]interface{}{
+		"status":    "success",
+		"message":   "Message published successfully",
+		"timestamp": result.Timestamp,
+	}
+	if result.ID != "" {
+		response["id"] = result.ID
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleRetainedClear handles requests to clear the retained message of a topic
+func (s *Server) handleRetainedClear(w http.ResponseWriter, r *http.Request) {
+	var req RetainedClearRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if req.Topic == "" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required")
+		return
+	}
+
+	// Retained messages can only be cleared one topic at a time
+	if err := utils.ValidatePublishTopic(req.Topic); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic: %v", err))
+		return
+	}
+
+	client, err := s.mqttManager.GetClient(req.Broker)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeUnknownBroker, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		return
+	}
+
+	if !client.IsConnected() {
+		if err := client.Connect(); err != nil {
+			s.writeConnectError(w, err)
+			return
+		}
+	}
+
+	// Confine tenants to their own namespace
+	topic := utils.ApplyNamespace(s.tenantNamespace(r), req.Topic)
+
+	// A zero-length retained message removes the broker's retained value for the topic
+	if err := client.Publish(topic, 1, true, []byte{}); err != nil {
+		if s.metrics != nil {
+			s.metrics.IncrementFailedPublishes()
+		}
+		s.writeError(w, http.StatusInternalServerError, ErrCodePublishFailed, fmt.Sprintf("Failed to clear retained message: %v", err))
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.IncrementPublishedMessagesForTopic(topic, s.brokerName(req.Broker))
+	}
+
 	s.writeJSON(w, http.StatusOK, map[string]string{
 		"status":  "success",
-		"message": "Message published successfully",
+		"message": fmt.Sprintf("Retained message on %s cleared", req.Topic),
 	})
 }
 
@@ -239,24 +649,163 @@ func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
 	var req SubscribeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	if req.Topic == "" {
-		s.writeError(w, http.StatusBadRequest, "Topic is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required")
+		return
+	}
+
+	req.Topic = s.normalizeTopic(req.Topic)
+	if err := utils.ValidateFilter(req.Topic); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic filter: %v", err))
+		return
+	}
+
+	client, err := s.mqttManager.GetClient(req.Broker)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeUnknownBroker, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		return
+	}
+
+	if !client.IsConnected() {
+		if err := client.Connect(); err != nil {
+			s.writeConnectError(w, err)
+			return
+		}
+	}
+
+	// Start timing for latency measurement
+	startTime := time.Now()
+
+	// Confine tenants to their own namespace
+	topic := utils.ApplyNamespace(s.tenantNamespace(r), req.Topic)
+
+	// Notifications for messages on this subscription carry the subscribing request's ID
+	messageHandler := s.newMessageHandler(req.Broker, RequestIDFromContext(r.Context()))
+
+	qos := s.subscribeQoS(req.QoS)
+	granted, err := client.SubscribeGranted(topic, qos, messageHandler)
+	if errors.Is(err, mqtt.ErrSubscriptionRefused) {
+		// Broker-side ACL denials are reported with the SUBACK failure code
+		s.writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"status":      "error",
+			"code":        ErrCodeSubscriptionRefused,
+			"message":     fmt.Sprintf("Subscription to topic %s was refused by the broker", req.Topic),
+			"granted_qos": granted,
+		})
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeSubscribeFailed, fmt.Sprintf("Failed to subscribe to topic: %v", err))
 		return
 	}
 
+	// Calculate and record latency
+	if s.metrics != nil {
+		s.metrics.AddSubscribeLatency(time.Since(startTime))
+	}
+	s.updateSubscriptionCount()
+	s.storeSubscription(r.Context(), req.Broker, topic, qos)
+
+	response := map[string]interface{}{
+		"status":      "success",
+		"message":     fmt.Sprintf("Subscribed to topic %s", req.Topic),
+		"granted_qos": granted,
+	}
+	if warning := qosDowngradeWarning(qos, granted); warning != "" {
+		response["warning"] = warning
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// publishQoS returns the QoS of a publish request, or DEFAULT_PUBLISH_QOS if the request omits it
+func (s *Server) publishQoS(qos *byte) byte {
+	if qos != nil {
+		return *qos
+	}
+	if s.config != nil {
+		return s.config.DefaultPublishQoS
+	}
+	return 0
+}
+
+// publishRetained returns the retained flag of a publish request, or DEFAULT_RETAINED if the request omits it
+func (s *Server) publishRetained(retained *bool) bool {
+	if retained != nil {
+		return *retained
+	}
+	return s.config != nil && s.config.DefaultRetained
+}
+
+// subscribeQoS returns the QoS of a subscribe request, or DEFAULT_SUBSCRIBE_QOS if the request omits it
+func (s *Server) subscribeQoS(qos *byte) byte {
+	if qos != nil {
+		return *qos
+	}
+	if s.config != nil {
+		return s.config.DefaultSubscribeQoS
+	}
+	return 0
+}
+
+// qosDowngradeWarning describes a subscription the broker granted a lower QoS than requested, or returns an empty string
+func qosDowngradeWarning(requested, granted byte) string {
+	if granted >= requested {
+		return ""
+	}
+	return fmt.Sprintf("Broker granted QoS %d, lower than the requested QoS %d", granted, requested)
+}
+
+// handleBatchSubscribe handles requests to subscribe to several topics in a single round-trip
+func (s *Server) handleBatchSubscribe(w http.ResponseWriter, r *http.Request) {
+	var req BatchSubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Subscriptions) == 0 {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "At least one subscription is required")
+		return
+	}
+
+	// Normalize the topics first, so the results report the topics subscribed to
+	for i := range req.Subscriptions {
+		req.Subscriptions[i].Topic = s.normalizeTopic(req.Subscriptions[i].Topic)
+	}
+
+	// Confine tenants to their own namespace
+	namespace := s.tenantNamespace(r)
+	filters := make(map[string]byte, len(req.Subscriptions))
+	for _, subscription := range req.Subscriptions {
+		if subscription.Topic == "" {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required for every subscription")
+			return
+		}
+		if err := utils.ValidateFilter(subscription.Topic); err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic filter %s: %v", subscription.Topic, err))
+			return
+		}
+		qos := s.subscribeQoS(subscription.QoS)
+		if qos > 2 {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidQoS, fmt.Sprintf("Invalid QoS %d for topic %s", qos, subscription.Topic))
+			return
+		}
+		filters[utils.ApplyNamespace(namespace, subscription.Topic)] = qos
+	}
+
 	client, err := s.mqttManager.GetClient(req.Broker)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeUnknownBroker, fmt.Sprintf("Failed to get MQTT client: %v", err))
 		return
 	}
 
 	if !client.IsConnected() {
 		if err := client.Connect(); err != nil {
-			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to connect to MQTT broker: %v", err))
+			s.writeConnectError(w, err)
 			return
 		}
 	}
@@ -264,91 +813,147 @@ func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
 	// Start timing for latency measurement
 	startTime := time.Now()
 
-	// Create a message handler that logs received messages, updates metrics, and sends webhook notifications
-	messageHandler := func(client pahomqtt.Client, msg pahomqtt.Message) {
+	// All topics share one handler whose notifications carry the subscribing request's ID
+	messageHandler := s.newMessageHandler(req.Broker, RequestIDFromContext(r.Context()))
+
+	granted, err := client.SubscribeMultiple(filters, messageHandler)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeSubscribeFailed, fmt.Sprintf("Failed to subscribe to topics: %v", err))
+		return
+	}
+
+	// Report the outcome of every topic in request order
+	results := make([]BatchSubscribeResult, 0, len(req.Subscriptions))
+	failed := 0
+	for _, subscription := range req.Subscriptions {
+		result := BatchSubscribeResult{Topic: subscription.Topic, Status: "success"}
+		topic := utils.ApplyNamespace(namespace, subscription.Topic)
+		if qos, ok := granted[topic]; ok {
+			result.GrantedQoS = &qos
+			result.Warning = qosDowngradeWarning(filters[topic], qos)
+			s.storeSubscription(r.Context(), req.Broker, topic, filters[topic])
+		} else {
+			result.Status = "error"
+			result.Error = "Subscription rejected by broker"
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	// Record latency and update the subscription count once for the whole batch
+	if s.metrics != nil {
+		s.metrics.AddSubscribeLatency(time.Since(startTime))
+	}
+	s.updateSubscriptionCount()
+
+	status := "success"
+	switch {
+	case failed == len(results):
+		status = "error"
+	case failed > 0:
+		status = "partial"
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  status,
+		"message": fmt.Sprintf("Subscribed to %d of %d topics", len(results)-failed, len(results)),
+		"results": results,
+	})
+}
+
+// brokerName resolves the name of the broker a request targets, which is the default connection when none is given
+func (s *Server) brokerName(broker string) string {
+	if broker == "" && s.config != nil {
+		return s.config.DefaultConnection
+	}
+	return broker
+}
+
+// normalizeTopic normalizes a topic or topic filter when TOPIC_NORMALIZE is enabled
+func (s *Server) normalizeTopic(topic string) string {
+	if s.config == nil || !s.config.TopicNormalize {
+		return topic
+	}
+	return utils.NormalizeTopic(topic)
+}
+
+// newMessageHandler creates a message handler for subscriptions on a broker that logs received messages,
+// updates metrics, and sends webhook notifications carrying the subscribing request's ID
+func (s *Server) newMessageHandler(broker, requestID string) pahomqtt.MessageHandler {
+	return func(client pahomqtt.Client, msg pahomqtt.Message) {
+		topic := s.normalizeTopic(msg.Topic())
 		s.logger.WithFields(map[string]interface{}{
-			"topic":   msg.Topic(),
-			"payload": string(msg.Payload()),
-			"qos":     msg.Qos(),
+			"topic":      topic,
+			"payload":    string(msg.Payload()),
+			"qos":        msg.Qos(),
+			"request_id": requestID,
 		}).Info("Received message")
 
 		// Increment received messages counter
 		if s.metrics != nil {
-			s.metrics.IncrementReceivedMessages()
+			s.metrics.IncrementReceivedMessagesForTopic(topic, s.brokerName(broker))
 		}
 
 		// Try to parse the payload as JSON
 		var payloadData interface{} = string(msg.Payload())
 		var jsonPayload interface{}
-		if err := json.Unmarshal(msg.Payload(), &jsonPayload); err == nil {
+		if err := unmarshalPayload(msg.Payload(), &jsonPayload); err == nil {
 			payloadData = jsonPayload
 		}
 
 		// Send webhook notification
-		go s.sendWebhookNotification(msg.Topic(), req.Broker, payloadData, msg.Qos())
+		go s.sendWebhookNotification(topic, broker, payloadData, msg.Qos(), requestID)
 	}
+}
 
-	if err := client.Subscribe(req.Topic, req.QoS, pahomqtt.MessageHandler(messageHandler)); err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to subscribe to topic: %v", err))
+// updateSubscriptionCount sets the subscription count metric to the total across all clients
+func (s *Server) updateSubscriptionCount() {
+	if s.metrics == nil {
 		return
 	}
 
-	// Calculate and record latency
-	if s.metrics != nil {
-		s.metrics.AddSubscribeLatency(time.Since(startTime))
-
-		// Count total subscriptions across all clients
-		var subscriptionCount int64
-		for _, client := range s.mqttManager.GetAllClients() {
-			subscriptionCount += int64(len(client.GetSubscriptions()))
-		}
-		s.metrics.SetSubscriptionCount(subscriptionCount)
+	var subscriptionCount int64
+	for _, client := range s.mqttManager.GetAllClients() {
+		subscriptionCount += int64(len(client.GetSubscriptions()))
 	}
-
-	s.writeJSON(w, http.StatusOK, map[string]string{
-		"status":  "success",
-		"message": fmt.Sprintf("Subscribed to topic %s", req.Topic),
-	})
+	s.metrics.SetSubscriptionCount(subscriptionCount)
 }
 
 // handleUnsubscribe handles requests to unsubscribe from topics
 func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
 	var req SubscribeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	if req.Topic == "" {
-		s.writeError(w, http.StatusBadRequest, "Topic is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required")
 		return
 	}
 
 	client, err := s.mqttManager.GetClient(req.Broker)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeUnknownBroker, fmt.Sprintf("Failed to get MQTT client: %v", err))
 		return
 	}
 
 	if !client.IsConnected() {
-		s.writeError(w, http.StatusInternalServerError, "MQTT client is not connected")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeBrokerUnavailable, "MQTT client is not connected")
 		return
 	}
 
-	if err := client.Unsubscribe(req.Topic); err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to unsubscribe from topic: %v", err))
+	// Confine tenants to their own namespace
+	req.Topic = s.normalizeTopic(req.Topic)
+	topic := utils.ApplyNamespace(s.tenantNamespace(r), req.Topic)
+
+	if err := client.Unsubscribe(topic); err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeSubscribeFailed, fmt.Sprintf("Failed to unsubscribe from topic: %v", err))
 		return
 	}
 
 	// Update subscription count in metrics
-	if s.metrics != nil {
-		// Count total subscriptions across all clients
-		var subscriptionCount int64
-		for _, client := range s.mqttManager.GetAllClients() {
-			subscriptionCount += int64(len(client.GetSubscriptions()))
-		}
-		s.metrics.SetSubscriptionCount(subscriptionCount)
-	}
+	s.updateSubscriptionCount()
+	s.deleteSubscription(r.Context(), req.Broker, topic)
 
 	s.writeJSON(w, http.StatusOK, map[string]string{
 		"status":  "success",
@@ -356,8 +961,15 @@ func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleStatus handles requests to get the status of MQTT connections
+// handleStatus handles requests to get the status of MQTT connections.
+// With detail=full, connected brokers are also probed for their round-trip latency.
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	detail := r.URL.Query().Get("detail")
+	if detail != "" && detail != "basic" && detail != "full" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid detail parameter: must be basic or full")
+		return
+	}
+
 	// Get all clients
 	clients := s.mqttManager.GetAllClients()
 
@@ -371,6 +983,9 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	// Check if any client is connected
 	allConnected := true
 
+	// Tenants only see their own subscriptions
+	namespace := s.tenantNamespace(r)
+
 	// Get status for each client
 	for name, client := range clients {
 		connected := client.IsConnected()
@@ -378,16 +993,39 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 			allConnected = false
 		}
 
-		// Get subscriptions
+		// Get subscriptions, detailing the group and filter of shared ones
 		subscriptions := make([]string, 0)
-		for topic := range client.GetSubscriptions() {
+		var shared []SharedSubscription
+		for topic, subscription := range client.GetSubscriptions() {
+			topic, ok := utils.StripNamespace(namespace, topic)
+			if !ok {
+				continue
+			}
 			subscriptions = append(subscriptions, topic)
+			if subscription.Shared() {
+				filter, _ := utils.StripNamespace(namespace, subscription.Filter)
+				shared = append(shared, SharedSubscription{Topic: topic, Group: subscription.ShareGroup, Filter: filter})
+			}
 		}
 
-		response.Brokers[name] = BrokerStatus{
-			Connected:     connected,
-			Subscriptions: subscriptions,
+		status := BrokerStatus{
+			Connected:           connected,
+			Subscriptions:       subscriptions,
+			SharedSubscriptions: shared,
 		}
+		if connErr := client.LastConnectError(); connErr != nil && !connected {
+			status.LastError = &ConnectionError{
+				Message:    connErr.Error(),
+				Reason:     connErr.Reason,
+				ReturnCode: connErr.ReturnCode,
+			}
+		}
+
+		response.Brokers[name] = status
+	}
+
+	if detail == "full" {
+		s.addBrokerHealth(clients, response.Brokers)
 	}
 
 	if !allConnected {
@@ -401,6 +1039,39 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, response)
 }
 
+// addBrokerHealth probes every connected broker concurrently and records the health of each broker in its status
+func (s *Server) addBrokerHealth(clients map[string]*mqtt.Client, brokers map[string]BrokerStatus) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, client := range clients {
+		wg.Add(1)
+		go func(name string, client *mqtt.Client) {
+			defer wg.Done()
+
+			health := &BrokerHealth{}
+			if connectedAt := client.ConnectedAt(); !connectedAt.IsZero() {
+				health.LastConnectedAt = connectedAt.Format(time.RFC3339)
+			}
+			if client.IsConnected() {
+				result := client.ProbeLatency(statusProbeTimeout, statusProbeMaxAge)
+				health.CheckedAt = result.CheckedAt.Format(time.RFC3339)
+				if result.Err != nil {
+					health.ProbeError = result.Err.Error()
+				} else {
+					health.Latency = result.Latency.String()
+				}
+			}
+
+			mu.Lock()
+			status := brokers[name]
+			status.Health = health
+			brokers[name] = status
+			mu.Unlock()
+		}(name, client)
+	}
+	wg.Wait()
+}
+
 // handleHealthCheck handles health check requests
 func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, map[string]string{
@@ -408,10 +1079,187 @@ func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// readinessTimeout bounds each dependency check of the readiness probe
+const readinessTimeout = 2 * time.Second
+
+// handleReadinessCheck handles readiness checks, verifying that the database and default broker are reachable
+func (s *Server) handleReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{
+		Status:     "ok",
+		Components: make(map[string]ComponentStatus),
+	}
+
+	// Check the database
+	if s.db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		err := s.db.Ping(ctx)
+		cancel()
+
+		response.Components["database"] = componentStatus(err)
+	}
+
+	// Check the default broker connection
+	client, err := s.mqttManager.GetDefaultClient()
+	if err == nil && !client.IsConnected() {
+		err = errors.New("not connected")
+		// Report why, e.g. while the startup connection is still being retried
+		if connErr := client.LastConnectError(); connErr != nil {
+			err = fmt.Errorf("not connected: %w", connErr)
+		}
+	}
+	response.Components["mqtt"] = componentStatus(err)
+
+	status := http.StatusOK
+	for _, component := range response.Components {
+		if component.Status != "ok" {
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	s.writeJSON(w, status, response)
+}
+
+// componentStatus converts the result of a dependency check into a component status
+func componentStatus(err error) ComponentStatus {
+	if err != nil {
+		return ComponentStatus{Status: "error", Error: err.Error()}
+	}
+	return ComponentStatus{Status: "ok"}
+}
+
+// handleBrokers handles requests to list every configured broker, including brokers that were never used
+func (s *Server) handleBrokers(w http.ResponseWriter, r *http.Request) {
+	if s.config == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Configuration not initialized")
+		return
+	}
+
+	clients := s.mqttManager.GetAllClients()
+
+	brokers := make([]BrokerInfo, 0, len(s.config.Brokers))
+	for name, brokerConfig := range s.config.Brokers {
+		brokers = append(brokers, s.brokerInfo(name, brokerConfig, clients[name]))
+	}
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i].Name < brokers[j].Name })
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"brokers": brokers,
+		"default": s.config.DefaultConnection,
+		"count":   len(brokers),
+	})
+}
+
+// brokerInfo describes a configured broker; client is nil when no client has been created for it
+func (s *Server) brokerInfo(name string, brokerConfig *config.BrokerConfig, client *mqtt.Client) BrokerInfo {
+	info := BrokerInfo{
+		Name:            name,
+		Host:            brokerConfig.Host,
+		Port:            brokerConfig.Port,
+		TLS:             brokerConfig.TLSEnabled,
+		ClientID:        brokerConfig.ClientID,
+		ProtocolVersion: brokerConfig.ProtocolVersion,
+		Default:         name == s.config.DefaultConnection,
+		State:           BrokerStateNeverConnected,
+	}
+
+	// Clients are created lazily, so brokers without one were never used
+	if client != nil {
+		info.State = BrokerStateDisconnected
+		if client.IsConnected() {
+			info.State = BrokerStateConnected
+		} else if connErr := client.LastConnectError(); connErr != nil {
+			info.LastError = &ConnectionError{
+				Message:    connErr.Error(),
+				Reason:     connErr.Reason,
+				ReturnCode: connErr.ReturnCode,
+			}
+		}
+	}
+
+	return info
+}
+
+// brokerClient resolves the broker named in the URL and its client, writing a 404 for unknown brokers
+func (s *Server) brokerClient(w http.ResponseWriter, r *http.Request) (string, *config.BrokerConfig, *mqtt.Client, bool) {
+	if s.config == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Configuration not initialized")
+		return "", nil, nil, false
+	}
+
+	name := mux.Vars(r)["name"]
+	brokerConfig, ok := s.config.Brokers[name]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, ErrCodeUnknownBroker, fmt.Sprintf("Broker '%s' not found", name))
+		return "", nil, nil, false
+	}
+
+	client, err := s.mqttManager.GetClient(name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		return "", nil, nil, false
+	}
+
+	return name, brokerConfig, client, true
+}
+
+// handleBrokerConnect handles requests to connect a broker ahead of its first use
+func (s *Server) handleBrokerConnect(w http.ResponseWriter, r *http.Request) {
+	name, brokerConfig, client, ok := s.brokerClient(w, r)
+	if !ok {
+		return
+	}
+
+	message := fmt.Sprintf("Broker '%s' is already connected", name)
+	if !client.IsConnected() {
+		if err := client.Connect(); err != nil {
+			s.writeConnectError(w, err)
+			return
+		}
+
+		// Restore subscriptions made before the connection was lost
+		if err := client.ResubscribeAll(); err != nil {
+			s.logger.WithError(err).WithField("broker", name).Error("Failed to restore subscriptions")
+		}
+		message = fmt.Sprintf("Connected to broker '%s'", name)
+	}
+
+	s.updateSubscriptionCount()
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": message,
+		"broker":  s.brokerInfo(name, brokerConfig, client),
+	})
+}
+
+// handleBrokerDisconnect handles requests to disconnect a broker and drop its subscriptions
+func (s *Server) handleBrokerDisconnect(w http.ResponseWriter, r *http.Request) {
+	name, brokerConfig, client, ok := s.brokerClient(w, r)
+	if !ok {
+		return
+	}
+
+	// The broker forgets the subscriptions of a closed clean session, so they aren't kept either
+	dropped := len(client.GetSubscriptions())
+	client.Disconnect()
+	client.ClearSubscriptions()
+
+	s.updateSubscriptionCount()
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":                "success",
+		"message":               fmt.Sprintf("Disconnected from broker '%s'", name),
+		"dropped_subscriptions": dropped,
+		"broker":                s.brokerInfo(name, brokerConfig, client),
+	})
+}
+
 // handleMetrics handles requests to get metrics
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	if s.metrics == nil {
-		s.writeError(w, http.StatusInternalServerError, "Metrics collector not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Metrics collector not initialized")
 		return
 	}
 
@@ -419,6 +1267,16 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, metrics)
 }
 
+// handleMetricsReset handles requests to reset the metrics, returning the metrics as they were before the reset
+func (s *Server) handleMetricsReset(w http.ResponseWriter, r *http.Request) {
+	metrics := s.metrics.GetMetricsAndReset()
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "Metrics reset",
+		"metrics": metrics,
+	})
+}
+
 // handleLogs handles requests to view logs
 func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	// Get the log file path from query parameter or use default
@@ -429,33 +1287,82 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 
 	// Ensure the path is safe (no directory traversal)
 	if filepath.IsAbs(logFilePath) || filepath.Clean(logFilePath) != logFilePath {
-		s.writeError(w, http.StatusBadRequest, "Invalid log file path")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid log file path")
 		return
 	}
 
 	// Check if the file exists
 	if _, err := os.Stat(logFilePath); os.IsNotExist(err) {
-		s.writeError(w, http.StatusNotFound, "Log file not found")
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Log file not found")
 		return
 	}
 
 	// Read the log file
 	logData, err := ioutil.ReadFile(logFilePath)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read log file: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to read log file: %v", err))
 		return
 	}
 
-	// Get the number of lines to return from query parameter
-	lines := r.URL.Query().Get("lines")
-	if lines != "" {
-		// TODO: Implement line limiting logic if needed
+	// Get the number of lines to return from query parameter, -1 returns all lines
+	tail := -1
+	if linesStr := r.URL.Query().Get("lines"); linesStr != "" {
+		n, err := strconv.Atoi(linesStr)
+		if err != nil || n < 0 {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid lines parameter")
+			return
+		}
+		tail = n
 	}
 
-	// Set content type to text/plain for log data
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	w.Write(logData)
+	format := r.URL.Query().Get("format")
+	levelStr := r.URL.Query().Get("level")
+	switch format {
+	case "", "text":
+		if levelStr != "" {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Level filtering requires format=json")
+			return
+		}
+
+		if tail >= 0 {
+			logData = tailLogLines(logData, tail)
+		}
+
+		// Set content type to text/plain for log data
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write(logData)
+	case "json":
+		// Structured entries can only be parsed from JSON logs
+		if !s.isJSONLogger() {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "format=json requires the JSON log format (--log-format=json)")
+			return
+		}
+
+		var minLevel *logrus.Level
+		if levelStr != "" {
+			level, err := logrus.ParseLevel(levelStr)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid level parameter")
+				return
+			}
+			minLevel = &level
+		}
+
+		// Filter by level before taking the tail so it only counts matching entries
+		entries := logEntries(logLines(logData), minLevel)
+		if tail >= 0 && tail < len(entries) {
+			entries = entries[len(entries)-tail:]
+		}
+
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":  "success",
+			"entries": entries,
+			"count":   len(entries),
+		})
+	default:
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid format parameter, must be 'text' or 'json'")
+	}
 }
 
 // writeJSON writes a JSON response
@@ -467,21 +1374,49 @@ func (s *Server) writeJSON(w http.ResponseWriter, status int, data interface{})
 	}
 }
 
-// writeError writes an error response
-func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+// writeError writes an error response with a machine-readable error code and a message for humans
+func (s *Server) writeError(w http.ResponseWriter, status int, code, message string) {
 	s.logger.WithFields(map[string]interface{}{
 		"status":  status,
+		"code":    code,
 		"message": message,
 	}).Error("API error")
 
 	s.writeJSON(w, status, map[string]string{
 		"status":  "error",
+		"code":    code,
 		"message": message,
 	})
 }
 
+// writeConnectError writes an error response for a failed broker connection,
+// including the broker's CONNACK reason when available
+func (s *Server) writeConnectError(w http.ResponseWriter, err error) {
+	var connErr *mqtt.ConnectError
+	if !errors.As(err, &connErr) {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeBrokerUnavailable, fmt.Sprintf("Failed to connect to MQTT broker: %v", err))
+		return
+	}
+	// The message of a ConnectError already says the connection failed
+	message := fmt.Sprintf("Failed to connect to MQTT broker: %v", connErr.Err)
+
+	s.logger.WithFields(map[string]interface{}{
+		"broker":      connErr.Broker,
+		"reason":      connErr.Reason,
+		"return_code": connErr.ReturnCode,
+	}).Error("API error")
+
+	s.writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+		"status":      "error",
+		"code":        ErrCodeBrokerUnavailable,
+		"message":     message,
+		"reason":      connErr.Reason,
+		"return_code": connErr.ReturnCode,
+	})
+}
+
 // sendWebhookNotification sends a notification to the configured webhook URL and any matching webhooks from the database
-func (s *Server) sendWebhookNotification(topic, broker string, payload interface{}, qos byte) {
+func (s *Server) sendWebhookNotification(topic, broker string, payload interface{}, qos byte, requestID string) {
 	// Create webhook payload
 	webhookPayload := WebhookPayload{
 		Topic:     topic,
@@ -489,19 +1424,12 @@ func (s *Server) sendWebhookNotification(topic, broker string, payload interface
 		QoS:       qos,
 		Timestamp: time.Now().Format(time.RFC3339),
 		Broker:    broker,
+		RequestID: requestID,
 	}
 
-	// Send to global webhook if enabled
-	if s.config != nil && s.config.Webhook != nil && s.config.Webhook.Enabled && s.config.Webhook.URL != "" {
-		s.sendWebhookNotificationToURL(
-			webhookPayload,
-			s.config.Webhook.URL,
-			s.config.Webhook.Method,
-			nil, // No custom headers for global webhook
-			s.config.Webhook.Timeout,
-			s.config.Webhook.RetryCount,
-			s.config.Webhook.RetryDelay,
-		)
+	// Send to global webhook if enabled and the topic matches its filter
+	if webhook := s.globalWebhook(); webhook != nil && utils.TopicMatchesFilter(topic, webhook.TopicFilter) {
+		s.enqueueWebhookNotification(webhookPayload, webhook)
 	}
 
 	// Send to database webhooks if database is available
@@ -510,110 +1438,219 @@ func (s *Server) sendWebhookNotification(topic, broker string, payload interface
 		defer cancel()
 
 		// Get webhooks that match the topic
-		webhooks, err := s.db.GetWebhooksByTopicFilter(ctx, topic)
+		webhooks, err := s.matchingWebhooks(ctx, topic)
 		if err != nil {
 			s.logger.WithError(err).Error("Failed to get webhooks for topic")
 			return
 		}
 
-		// Send notification to each matching webhook
+		// Send notification to each matching webhook whose QoS and payload filters the message satisfies
 		for _, webhook := range webhooks {
-			if webhook.Enabled {
-				s.sendWebhookNotificationToURL(
-					webhookPayload,
-					webhook.URL,
-					webhook.Method,
-					webhook.Headers,
-					webhook.Timeout,
-					webhook.RetryCount,
-					webhook.RetryDelay,
-				)
+			if !webhook.Enabled {
+				continue
 			}
+			if !webhook.Accepts(qos, payload) {
+				if s.metrics != nil {
+					s.metrics.IncrementWebhooksSkipped()
+				}
+				continue
+			}
+			s.enqueueWebhookNotification(webhookPayload, webhook)
 		}
 	}
 }
 
-// sendWebhookNotificationToURL sends a notification to a specific webhook URL
-func (s *Server) sendWebhookNotificationToURL(
-	webhookPayload WebhookPayload,
-	url string,
-	method string,
-	headers map[string]string,
-	timeout int,
-	retryCount int,
-	retryDelay int,
-) {
-	// Convert payload to JSON
-	jsonPayload, err := json.Marshal(webhookPayload)
-	if err != nil {
-		s.logger.WithError(err).Error("Failed to marshal webhook payload")
-		return
+// globalWebhook returns the webhook configured through environment variables, or nil if it is disabled
+func (s *Server) globalWebhook() *models.Webhook {
+	if s.config == nil || s.config.Webhook == nil || !s.config.Webhook.Enabled || s.config.Webhook.URL == "" {
+		return nil
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		s.logger.WithError(err).Error("Failed to create webhook request")
-		return
+	topicFilter := s.normalizeTopic(s.config.Webhook.TopicFilter)
+	if topicFilter == "" {
+		topicFilter = "#"
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "MQTT-Microservice")
-
-	// Add custom headers if provided
-	if headers != nil {
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
+	return &models.Webhook{
+		ID:          models.GlobalWebhookID,
+		Name:        models.GlobalWebhookID,
+		URL:         s.config.Webhook.URL,
+		Method:      s.config.Webhook.Method,
+		TopicFilter: topicFilter,
+		Enabled:     true,
+		Timeout:     s.config.Webhook.Timeout,
+		RetryCount:  s.config.Webhook.RetryCount,
+		RetryDelay:  s.config.Webhook.RetryDelay,
+		Secret:      s.config.Webhook.Secret,
 	}
+}
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+// sendWebhookNotificationToURL sends a notification to a webhook, retrying as configured,
+// and records the outcome so failed deliveries can be re-driven later
+func (s *Server) sendWebhookNotificationToURL(webhookPayload WebhookPayload, webhook *models.Webhook) {
+	// Render the request body, with the topic as the tenant that owns the webhook published to it
+	notification := webhookPayload
+	if topic, ok := utils.StripNamespace(webhook.Namespace, notification.Topic); ok {
+		notification.Topic = topic
+	}
+	jsonPayload, err := webhookBody(webhook, notification)
+	if err != nil {
+		s.logger.WithError(err).WithField("url", webhook.URL).Error("Failed to render webhook payload")
+		return
 	}
 
 	// Send request with retry logic
-	var resp *http.Response
 	var lastErr error
-	for i := 0; i <= retryCount; i++ {
+	attempts := 0
+	cancelled, shortCircuited := false, false
+	for i := 0; i <= webhook.RetryCount; i++ {
 		if i > 0 {
 			s.logger.WithFields(map[string]interface{}{
 				"attempt": i,
 				"error":   lastErr,
 			}).Warn("Retrying webhook notification")
-			time.Sleep(time.Duration(retryDelay) * time.Second)
+
+			// Back off exponentially, or as long as the receiver asked
+			var retryAfter time.Duration
+			var statusErr *webhookStatusError
+			if errors.As(lastErr, &statusErr) {
+				retryAfter = statusErr.RetryAfter
+			}
+			delay := webhookRetryDelay(time.Duration(webhook.RetryDelay)*time.Second, i, retryAfter, rand.Float64)
+			if !s.waitForWebhookRetry(delay) {
+				cancelled = true
+				break
+			}
 		}
 
-		resp, err = client.Do(req)
-		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			// Success
-			resp.Body.Close()
+		lastErr = s.attemptWebhook(webhook, jsonPayload)
+		if lastErr == errWebhookCircuitOpen {
+			shortCircuited = true
+			break
+		}
+		attempts++
+		if lastErr == nil {
 			s.logger.WithFields(map[string]interface{}{
-				"topic":  webhookPayload.Topic,
-				"broker": webhookPayload.Broker,
-				"url":    url,
+				"topic":      webhookPayload.Topic,
+				"broker":     webhookPayload.Broker,
+				"url":        webhook.URL,
+				"request_id": webhookPayload.RequestID,
 			}).Info("Webhook notification sent successfully")
-			return
+			break
 		}
 
-		if err != nil {
-			lastErr = err
-			s.logger.WithError(err).Error("Failed to send webhook notification")
+		s.logger.WithError(lastErr).WithField("url", webhook.URL).Error("Failed to send webhook notification")
+	}
+
+	// Notifications abandoned at shutdown aren't reported as failures, since they are retried from the delivery log
+	if lastErr != nil && !cancelled {
+		if shortCircuited {
+			s.logger.WithFields(map[string]interface{}{
+				"topic":      webhookPayload.Topic,
+				"url":        webhook.URL,
+				"attempts":   attempts,
+				"request_id": webhookPayload.RequestID,
+			}).Debug("Webhook circuit is open, skipping delivery")
 		} else {
-			lastErr = fmt.Errorf("webhook returned status code %d", resp.StatusCode)
-			resp.Body.Close()
 			s.logger.WithFields(map[string]interface{}{
-				"status": resp.StatusCode,
-				"url":    url,
-			}).Error("Webhook notification failed")
+				"topic":       webhookPayload.Topic,
+				"broker":      webhookPayload.Broker,
+				"url":         webhook.URL,
+				"retry_count": webhook.RetryCount,
+				"request_id":  webhookPayload.RequestID,
+			}).Error("Webhook notification failed after retries")
 		}
 	}
 
-	s.logger.WithFields(map[string]interface{}{
-		"topic":       webhookPayload.Topic,
-		"broker":      webhookPayload.Broker,
-		"url":         url,
-		"retry_count": retryCount,
-	}).Error("Webhook notification failed after retries")
+	// Failed notifications are dead-lettered once the delivery worker gives up on them, unless they can't be
+	// recorded for it to retry, so consumers of the dead-letter topic never receive a notification that is
+	// delivered later
+	if !s.recordWebhookDelivery(webhook, webhookPayload.Topic, jsonPayload, attempts, lastErr) && lastErr != nil {
+		s.deadLetter(webhookPayload, webhook.ID, webhook.URL, attempts, lastErr)
+	}
+}
+
+// webhookBody renders the request body of a notification with the webhook's body template,
+// or as the JSON payload when it has none
+func webhookBody(webhook *models.Webhook, webhookPayload WebhookPayload) ([]byte, error) {
+	tmpl, err := webhook.ParseBodyTemplate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse body template: %w", err)
+	}
+	if tmpl == nil {
+		return json.Marshal(webhookPayload)
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, webhookPayload); err != nil {
+		return nil, fmt.Errorf("failed to render body template: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// postWebhook makes a single delivery attempt of a request body to a webhook. GET and HEAD webhooks
+// receive the fields of the body as query parameters instead.
+func (s *Server) postWebhook(webhook *models.Webhook, body []byte) error {
+	// Create HTTP request
+	var req *http.Request
+	var err error
+	signed := body
+	if webhook.UsesQueryParameters() {
+		var queryURL string
+		if queryURL, err = webhookQueryURL(webhook.URL, body); err != nil {
+			return err
+		}
+		req, err = http.NewRequest(webhook.Method, queryURL, nil)
+		if err == nil {
+			// There is no body, so the query string is signed instead
+			signed = []byte(req.URL.RawQuery)
+		}
+	} else {
+		req, err = http.NewRequest(webhook.Method, webhook.URL, bytes.NewReader(body))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	// Set headers
+	if req.Body != nil {
+		contentType := webhook.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", "MQTT-Microservice")
+
+	// Add custom headers if provided
+	for key, value := range webhook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Sign the payload so the receiver can verify it came from us
+	if webhook.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, timestamp)
+		req.Header.Set(webhookSignatureHeader, signWebhookPayload(webhook.Secret, timestamp, signed))
+	}
+
+	// Create HTTP client with timeout
+	client := &http.Client{
+		Timeout:   time.Duration(webhook.Timeout) * time.Second,
+		Transport: s.webhookTransport(webhook),
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &webhookStatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return nil
 }
@@ -0,0 +1,791 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/metrics"
+	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// newTestServer creates a server connected to a test broker and a temporary SQLite database,
+// accepting the given API key entries
+func newTestServer(t *testing.T, broker *mqtttest.Broker, apiKeys ...string) *Server {
+	t.Helper()
+
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+
+	dbConfig := &database.Config{Type: "sqlite"}
+	dbConfig.SQLite.Path = filepath.Join(t.TempDir(), "messages.db")
+	db, err := database.New(dbConfig)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	brokerConfig := broker.BrokerConfig("test")
+	cfg := &config.Config{
+		DefaultConnection: brokerConfig.Name,
+		Brokers: map[string]*config.BrokerConfig{
+			brokerConfig.Name: brokerConfig,
+		},
+		MemoryBufferSize: config.DefaultMemoryBufferSize,
+	}
+
+	metricsCollector := metrics.New(log)
+	manager := mqtt.NewManager(cfg, log, metricsCollector, db)
+	t.Cleanup(func() {
+		for _, client := range manager.GetAllClients() {
+			client.Disconnect()
+		}
+	})
+
+	authService := auth.New(&auth.Config{
+		EnableAPIKey: true,
+		APIKeys:      auth.ParseAPIKeys(apiKeys),
+	}, log)
+
+	return NewServer(manager, log, metricsCollector, authService, db, cfg, ":0", HTTPTimeouts{})
+}
+
+// qos returns a pointer to a QoS level, for requests that set it explicitly
+func qos(level byte) *byte {
+	return &level
+}
+
+// doRequest sends a request to the server authenticated with the given API key
+func doRequest(t *testing.T, s *Server, method, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("X-API-Key", apiKey)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRefusedConnectionIsReported(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.ErrRefusedNotAuthorised), "admin-key")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "admin-key", PublishRequest{Topic: "sensors/temp", Payload: "21.5"})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	var response struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != ErrCodeBrokerUnavailable || response.Reason != mqtt.ReasonNotAuthorized {
+		t.Errorf("Expected the broker's reason, got %+v", response)
+	}
+	if strings.Count(strings.ToLower(response.Message), "failed to connect") != 1 {
+		t.Errorf("Expected the failure to be stated once, got '%s'", response.Message)
+	}
+}
+
+func TestTenantsPublishToSeparateNamespaces(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key-a::tenant-a", "key-b::tenant-b")
+
+	for _, key := range []string{"key-a", "key-b"} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", key, PublishRequest{Topic: "data", Payload: "hello"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	published := broker.WaitForPublished(t, 2)
+	if published[0].TopicName != "tenant-a/data" {
+		t.Errorf("Expected first message on 'tenant-a/data', got '%s'", published[0].TopicName)
+	}
+	if published[1].TopicName != "tenant-b/data" {
+		t.Errorf("Expected second message on 'tenant-b/data', got '%s'", published[1].TopicName)
+	}
+}
+
+func TestTenantWebhooksAreNotifiedWithoutNamespace(t *testing.T) {
+	topics := make(chan string, 2)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification WebhookPayload
+		json.NewDecoder(r.Body).Decode(&notification)
+		topics <- notification.Topic
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key-a::tenant-a", "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+
+	for _, webhook := range []struct{ key, filter string }{{"key-a", "sensors/#"}, {"admin-key", "tenant-a/sensors/#"}} {
+		rec := doRequest(t, s, http.MethodPost, "/webhooks", webhook.key, map[string]interface{}{
+			"url":          receiver.URL,
+			"method":       http.MethodPost,
+			"topic_filter": webhook.filter,
+			"enabled":      true,
+			"timeout":      5,
+			"retry_delay":  1,
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected the webhook to be created, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	s.sendWebhookNotification("tenant-a/sensors/temp", "test", 21.5, 0, "")
+
+	received := map[string]bool{<-topics: true, <-topics: true}
+	if !received["sensors/temp"] {
+		t.Errorf("Expected the tenant's webhook to be notified of 'sensors/temp', got %v", received)
+	}
+	if !received["tenant-a/sensors/temp"] {
+		t.Errorf("Expected the admin's webhook to be notified of the full topic, got %v", received)
+	}
+}
+
+func TestTenantsCannotReadEachOthersMessages(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key-a::tenant-a", "key-b::tenant-b")
+
+	for _, key := range []string{"key-a", "key-b"} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", key, PublishRequest{Topic: "data", Payload: key})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	listMessages := func(key string) []database.Message {
+		rec := doRequest(t, s, http.MethodGet, "/messages", key, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected listing messages to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Messages []database.Message `json:"messages"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Messages
+	}
+
+	messagesA := listMessages("key-a")
+	if len(messagesA) != 1 {
+		t.Fatalf("Expected tenant A to see 1 message, got %d", len(messagesA))
+	}
+	if messagesA[0].Topic != "data" {
+		t.Errorf("Expected tenant A to see topic 'data', got '%s'", messagesA[0].Topic)
+	}
+
+	messagesB := listMessages("key-b")
+	if len(messagesB) != 1 {
+		t.Fatalf("Expected tenant B to see 1 message, got %d", len(messagesB))
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/messages/"+messagesB[0].ID, "key-a", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected tenant A to get 404 for tenant B's message, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodDelete, "/messages/"+messagesB[0].ID, "key-a", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected tenant A to get 404 deleting tenant B's message, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/messages/"+messagesA[0].ID, "key-a", nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected tenant A to read its own message, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGetMessagesByTopicFilter(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	for _, topic := range []string{"sensors/a/temp", "sensors/b/temp", "sensors/a/humidity", "sensorsX/a/temp"} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: topic, Payload: "21.5"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	tests := map[string]int{
+		"sensors/%2B/temp": 2,
+		"sensors/a/%23":    2,
+		"sensors/%23":      3,
+		"sensors/a/temp":   1,
+		"%2B/a/temp":       2,
+	}
+	for filter, expected := range tests {
+		rec := doRequest(t, s, http.MethodGet, "/messages?topic="+filter, "key", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected listing messages to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Messages []database.Message `json:"messages"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Messages) != expected {
+			t.Errorf("Expected %d messages for filter '%s', got %d", expected, filter, len(response.Messages))
+		}
+	}
+}
+
+func TestRetainedClearPublishesEmptyRetainedMessage(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key")
+
+	rec := doRequest(t, s, http.MethodPost, "/retained/clear", "key", RetainedClearRequest{Topic: "sensors/+/temp"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a wildcard topic, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/retained/clear", "key", RetainedClearRequest{Topic: "sensors/a/temp"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected clearing the retained message to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	published := broker.WaitForPublished(t, 1)
+	if published[0].TopicName != "sensors/a/temp" {
+		t.Errorf("Expected message on 'sensors/a/temp', got '%s'", published[0].TopicName)
+	}
+	if !published[0].Retain {
+		t.Error("Expected the message to be retained")
+	}
+	if len(published[0].Payload) != 0 {
+		t.Errorf("Expected an empty payload, got %q", published[0].Payload)
+	}
+}
+
+func TestBatchSubscribe(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	broker.RejectSubscriptions = []string{"tenant-a/forbidden/#"}
+	s := newTestServer(t, broker, "key-a::tenant-a")
+
+	rec := doRequest(t, s, http.MethodPost, "/subscribe/batch", "key-a", BatchSubscribeRequest{
+		Subscriptions: []TopicSubscription{
+			{Topic: "sensors/+/temp", QoS: qos(1)},
+			{Topic: "alerts/#", QoS: qos(2)},
+			{Topic: "forbidden/#", QoS: qos(0)},
+		},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected batch subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Status  string                 `json:"status"`
+		Results []BatchSubscribeResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Status != "partial" {
+		t.Errorf("Expected status 'partial', got '%s'", response.Status)
+	}
+	if len(response.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(response.Results))
+	}
+	for i, expected := range []byte{1, 2} {
+		result := response.Results[i]
+		if result.Status != "success" || result.GrantedQoS == nil || *result.GrantedQoS != expected {
+			t.Errorf("Expected %s to be granted QoS %d, got %+v", result.Topic, expected, result)
+		}
+	}
+	if result := response.Results[2]; result.Status != "error" || result.Topic != "forbidden/#" {
+		t.Errorf("Expected forbidden/# to be rejected, got %+v", result)
+	}
+
+	if count := s.metrics.SubscriptionCount; count != 2 {
+		t.Errorf("Expected a subscription count of 2, got %d", count)
+	}
+}
+
+func TestSubscribeReportsGrantedQoS(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	broker.DowngradeSubscriptions = map[string]byte{"sensors/#": 0}
+	broker.RejectSubscriptions = []string{"admin/#"}
+	s := newTestServer(t, broker, "key")
+
+	var response struct {
+		Status     string `json:"status"`
+		GrantedQoS *byte  `json:"granted_qos"`
+		Warning    string `json:"warning"`
+	}
+
+	rec := doRequest(t, s, http.MethodPost, "/subscribe", "key", SubscribeRequest{Topic: "alerts/#", QoS: qos(2)})
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusOK || response.GrantedQoS == nil || *response.GrantedQoS != 2 || response.Warning != "" {
+		t.Errorf("Expected QoS 2 to be granted without a warning, got %d: %+v", rec.Code, response)
+	}
+
+	// A broker downgrading the subscription is reported with a warning
+	response.Warning = ""
+	rec = doRequest(t, s, http.MethodPost, "/subscribe", "key", SubscribeRequest{Topic: "sensors/#", QoS: qos(2)})
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusOK || response.Status != "success" || *response.GrantedQoS != 0 || response.Warning == "" {
+		t.Errorf("Expected a downgrade to QoS 0 with a warning, got %d: %+v", rec.Code, response)
+	}
+
+	// A refused subscription is an error, not a silent success
+	rec = doRequest(t, s, http.MethodPost, "/subscribe", "key", SubscribeRequest{Topic: "admin/#", QoS: qos(1)})
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusForbidden || response.Status != "error" || *response.GrantedQoS != 0x80 {
+		t.Errorf("Expected the refused subscription to be reported, got %d: %+v", rec.Code, response)
+	}
+
+	client, err := s.mqttManager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	subscriptions := client.GetSubscriptions()
+	if _, ok := subscriptions["admin/#"]; ok {
+		t.Error("Expected the refused subscription not to be recorded")
+	}
+	if subscription := subscriptions["sensors/#"]; subscription.QoS != 2 || subscription.GrantedQoS != 0 {
+		t.Errorf("Expected requested QoS 2 and granted QoS 0, got %d and %d", subscription.QoS, subscription.GrantedQoS)
+	}
+}
+
+func TestTopicNormalization(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	s := newTestServer(t, broker, "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+	s.config.TopicNormalize = true
+
+	rec := doRequest(t, s, http.MethodPost, "/subscribe", "admin-key", SubscribeRequest{Topic: "sensors//temp/", QoS: qos(1)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	client, err := s.mqttManager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	if _, ok := client.GetSubscriptions()["sensors/temp"]; !ok {
+		t.Errorf("Expected the subscription to be normalized to sensors/temp, got %v", client.GetSubscriptions())
+	}
+
+	// Webhook filters are normalized too, so they match the normalized topics of received messages
+	id := createWebhook(t, s, "sensors//#")
+	if got := matchingWebhookIDs(t, s, s.normalizeTopic("sensors//temp/")); got != id {
+		t.Errorf("Expected the webhook to match the normalized topic, got %q", got)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/unsubscribe", "admin-key", SubscribeRequest{Topic: "sensors/temp/"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if len(client.GetSubscriptions()) != 0 {
+		t.Errorf("Expected the normalized subscription to be removed, got %v", client.GetSubscriptions())
+	}
+}
+
+func TestInvalidTopicsAreRejected(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	tests := []struct {
+		path string
+		body interface{}
+	}{
+		{"/publish", PublishRequest{Topic: "sensors/+/temp", Payload: "hello"}},
+		{"/publish", PublishRequest{Topic: "sensors/#", Payload: "hello"}},
+		{"/subscribe", SubscribeRequest{Topic: "sport/#/x"}},
+		{"/subscribe", SubscribeRequest{Topic: "sport+"}},
+		{"/subscribe/batch", BatchSubscribeRequest{Subscriptions: []TopicSubscription{{Topic: "+/+"}, {Topic: "a/b#"}}}},
+	}
+
+	for _, test := range tests {
+		rec := doRequest(t, s, http.MethodPost, test.path, "key", test.body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 from %s for %+v, got %d", test.path, test.body, rec.Code)
+		}
+	}
+}
+
+func TestReadinessReflectsBrokerConnection(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	rec := doRequest(t, s, http.MethodGet, "/readyz", "", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 before connecting, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ReadinessResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Components["mqtt"].Status != "error" {
+		t.Errorf("Expected mqtt component to be unhealthy, got '%s'", response.Components["mqtt"].Status)
+	}
+	if response.Components["database"].Status != "ok" {
+		t.Errorf("Expected database component to be healthy, got '%s'", response.Components["database"].Status)
+	}
+
+	client, err := s.mqttManager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/readyz", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once connected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStatusDetailReportsBrokerHealth(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key")
+
+	client, err := s.mqttManager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	// The basic status doesn't probe brokers
+	rec := doRequest(t, s, http.MethodGet, "/status", "key", nil)
+	var response StatusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Brokers["test"].Health != nil || len(broker.Published()) != 0 {
+		t.Error("Expected the basic status not to probe brokers")
+	}
+
+	for i := 0; i < 2; i++ {
+		rec = doRequest(t, s, http.MethodGet, "/status?detail=full", "key", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	response = StatusResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	health := response.Brokers["test"].Health
+	if health == nil || health.Latency == "" || health.ProbeError != "" || health.LastConnectedAt == "" {
+		t.Fatalf("Expected a successful probe and connection time, got %+v", health)
+	}
+	if published := len(broker.Published()); published != 1 {
+		t.Errorf("Expected repeated polling to reuse the probe, got %d probe messages", published)
+	}
+
+	if rec := doRequest(t, s, http.MethodGet, "/status?detail=verbose", "key", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown detail level, got %d", rec.Code)
+	}
+}
+
+func TestBrokersListsConfiguredBrokersWithoutCredentials(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+	s.config.Brokers["test"].Password = "secret-password"
+	s.config.Brokers["idle"] = &config.BrokerConfig{Name: "idle", Host: "mqtt.example.com", Port: 8883, TLSEnabled: true, ClientID: "idle-client"}
+
+	client, err := s.mqttManager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/brokers", "key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "secret-password") {
+		t.Errorf("Expected the response not to contain broker passwords: %s", rec.Body.String())
+	}
+
+	var response struct {
+		Brokers []BrokerInfo `json:"brokers"`
+		Default string       `json:"default"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Default != "test" {
+		t.Errorf("Expected default broker 'test', got '%s'", response.Default)
+	}
+	if len(response.Brokers) != 2 {
+		t.Fatalf("Expected 2 brokers, got %d", len(response.Brokers))
+	}
+
+	idle, test := response.Brokers[0], response.Brokers[1]
+	if idle.Name != "idle" || idle.State != BrokerStateNeverConnected || !idle.TLS || idle.Port != 8883 || idle.Default {
+		t.Errorf("Unexpected idle broker: %+v", idle)
+	}
+	if test.Name != "test" || test.State != BrokerStateConnected || !test.Default {
+		t.Errorf("Unexpected test broker: %+v", test)
+	}
+}
+
+func TestBrokerConnectAndDisconnect(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	s := newTestServer(t, broker, "admin-key:admin", "read-key:read")
+
+	rec := doRequest(t, s, http.MethodPost, "/brokers/missing/connect", "admin-key", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown broker, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/brokers/test/connect", "read-key", nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a key without the admin scope, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/brokers/test/connect", "admin-key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected connect to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Broker BrokerInfo `json:"broker"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Broker.State != BrokerStateConnected {
+		t.Errorf("Expected broker to be connected, got '%s'", response.Broker.State)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/subscribe", "admin-key", SubscribeRequest{Topic: "sensors/#"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/brokers/test/disconnect", "admin-key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected disconnect to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Broker.State != BrokerStateDisconnected {
+		t.Errorf("Expected broker to be disconnected, got '%s'", response.Broker.State)
+	}
+
+	if s.metrics.SubscriptionCount != 0 {
+		t.Errorf("Expected subscription count to be 0 after disconnect, got %d", s.metrics.SubscriptionCount)
+	}
+	if s.metrics.Disconnections != 1 {
+		t.Errorf("Expected 1 disconnection, got %d", s.metrics.Disconnections)
+	}
+}
+
+func TestMetricsReset(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "admin-key:admin", "read-key:read")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "admin-key", PublishRequest{Topic: "data", Payload: "hello"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/metrics/reset", "read-key", nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a key without the admin scope, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/metrics/reset", "admin-key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected reset to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Metrics struct {
+			Messages map[string]int64 `json:"messages"`
+		} `json:"metrics"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if published := response.Metrics.Messages["published"]; published != 1 {
+		t.Errorf("Expected the pre-reset snapshot to report 1 published message, got %d", published)
+	}
+
+	if s.metrics.PublishedMessages != 0 || s.metrics.APIRequests != 0 {
+		t.Errorf("Expected counters to be zero after reset, got %d published and %d requests",
+			s.metrics.PublishedMessages, s.metrics.APIRequests)
+	}
+}
+
+func TestPublishReturnsStoredMessageID(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: "orders/created", Payload: map[string]interface{}{"id": 1234}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Status    string    `json:"status"`
+		Message   string    `json:"message"`
+		ID        string    `json:"id"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != "success" || response.Message == "" {
+		t.Errorf("Expected the existing status and message fields, got '%s' and '%s'", response.Status, response.Message)
+	}
+	if response.ID == "" || response.Timestamp.IsZero() {
+		t.Fatalf("Expected the stored message's ID and timestamp, got '%s' and %v", response.ID, response.Timestamp)
+	}
+
+	// The ID can be used to confirm the message
+	rec = doRequest(t, s, http.MethodPost, "/messages/"+response.ID+"/confirm", "key", nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected confirming the published message to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPublishPreservesLargeIntegers(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key")
+
+	// 2^53 + 1 can't be represented as a float64
+	payload := `{"id":9007199254740993}`
+	for _, req := range []PublishRequest{
+		{Topic: "devices/ids", Payload: json.RawMessage(payload)},
+		{Topic: "devices/ids", Payload: json.RawMessage("9007199254740993")},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", "key", req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	published := broker.WaitForPublished(t, 2)
+	if got := string(published[0].Payload); got != payload {
+		t.Errorf("Expected the published payload to be %s, got %s", payload, got)
+	}
+	if got := string(published[1].Payload); got != "9007199254740993" {
+		t.Errorf("Expected the published number to be 9007199254740993, got %s", got)
+	}
+
+	messages, err := s.db.GetMessages(context.Background(), false, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	for _, message := range messages {
+		if data, _ := message.PayloadBytes(); string(data) != payload && string(data) != "9007199254740993" {
+			t.Errorf("Expected the stored payload to keep the exact integer, got %s", data)
+		}
+	}
+}
+
+func TestPublishWithoutPayload(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	// A missing payload is published and stored as an empty payload, not as null
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", map[string]interface{}{"topic": "devices/ping"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	published := broker.WaitForPublished(t, 1)
+	if len(published[0].Payload) != 0 {
+		t.Errorf("Expected an empty payload, got %q", published[0].Payload)
+	}
+
+	messages, err := s.db.GetMessages(context.Background(), false, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ContentType != database.ContentTypeText {
+		t.Fatalf("Expected one message stored as text, got %+v", messages)
+	}
+	if data, _ := messages[0].PayloadBytes(); len(data) != 0 {
+		t.Errorf("Expected the stored payload to be empty, got %q", data)
+	}
+
+	// An empty retained message would clear the retained message of the topic, so it must be asked for explicitly
+	rec = doRequest(t, s, http.MethodPost, "/publish", "key", map[string]interface{}{"topic": "devices/ping", "retained": true})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a retained publish without a payload to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, s, http.MethodPost, "/publish", "key", map[string]interface{}{"topic": "devices/ping", "payload": "", "retained": true})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a retained publish with an empty payload to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPublishStopsWaitingWhenTheRequestTimesOut(t *testing.T) {
+	// The broker never acknowledges publishes
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+	s.requestTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: "sensors/temp", Payload: 21.5, QoS: qos(1)})
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected status 504, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the request to end at its timeout, took %v", elapsed)
+	}
+
+	// The handler gives up on the acknowledgement rather than blocking forever
+	deadline := time.Now().Add(2 * time.Second)
+	for s.metrics.GetMetrics()["messages"].(map[string]int64)["failed"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the publish to be recorded as failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
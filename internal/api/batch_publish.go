@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/utils"
+)
+
+// BatchPublishRequest represents a request to publish several messages to one broker
+type BatchPublishRequest struct {
+	Broker   string                `json:"broker,omitempty"`
+	Messages []BatchPublishMessage `json:"messages"`
+}
+
+// BatchPublishMessage is a single message of a batch publish request
+type BatchPublishMessage struct {
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload"`
+	// QoS defaults to DEFAULT_PUBLISH_QOS when omitted
+	QoS *byte `json:"qos,omitempty"`
+	// Retained defaults to DEFAULT_RETAINED when omitted
+	Retained *bool `json:"retained,omitempty"`
+	mqtt5Options
+}
+
+// BatchPublishResult is the outcome of publishing a single message of a batch
+type BatchPublishResult struct {
+	Topic  string `json:"topic"`
+	Status string `json:"status"`
+	// ID is the ID of the stored message, empty if the message wasn't stored
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleBatchPublish handles requests to publish several messages in a single request
+func (s *Server) handleBatchPublish(w http.ResponseWriter, r *http.Request) {
+	// Reject oversized batches before reading them into memory
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxPublishBytes())
+
+	var req BatchPublishRequest
+	if err := newPayloadDecoder(r.Body).Decode(&req); err != nil {
+		s.writePublishDecodeError(w, err)
+		return
+	}
+
+	if len(req.Messages) == 0 {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "At least one message is required")
+		return
+	}
+
+	// Confine tenants to their own namespace
+	namespace := s.tenantNamespace(r)
+	msgs := make([]mqtt.BatchMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Topic == "" {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required for every message")
+			return
+		}
+		if err := utils.ValidatePublishTopic(msg.Topic); err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic %s: %v", msg.Topic, err))
+			return
+		}
+		if err := msg.unsupportedOption(); err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("%v (topic %s)", err, msg.Topic))
+			return
+		}
+		qos := s.publishQoS(msg.QoS)
+		if qos > 2 {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidQoS, fmt.Sprintf("Invalid QoS %d for topic %s", qos, msg.Topic))
+			return
+		}
+		retained := s.publishRetained(msg.Retained)
+		if msg.Payload == nil && retained {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("%s (topic %s)", missingRetainedPayload, msg.Topic))
+			return
+		}
+		payload := publishedPayload(msg.Payload)
+		if !s.checkPayloadSchema(w, namespace, msg.Topic, payload) {
+			return
+		}
+		msgs = append(msgs, mqtt.BatchMessage{
+			Topic:    utils.ApplyNamespace(namespace, msg.Topic),
+			Payload:  payload,
+			QoS:      qos,
+			Retained: retained,
+		})
+	}
+
+	client, err := s.mqttManager.GetClient(req.Broker)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeUnknownBroker, fmt.Sprintf("Failed to get MQTT client: %v", err))
+		return
+	}
+
+	if !client.IsConnected() {
+		if err := client.Connect(); err != nil {
+			s.writeConnectError(w, err)
+			return
+		}
+	}
+
+	// Start timing for latency measurement
+	startTime := time.Now()
+
+	outcomes, err := client.PublishBatch(msgs)
+	if err != nil {
+		if s.metrics != nil {
+			s.metrics.IncrementFailedPublishes()
+		}
+		s.writeError(w, http.StatusInternalServerError, ErrCodePublishFailed, fmt.Sprintf("Failed to publish messages: %v", err))
+		return
+	}
+
+	// Report the outcome of every message in request order
+	results := make([]BatchPublishResult, 0, len(outcomes))
+	failed := 0
+	for i, outcome := range outcomes {
+		result := BatchPublishResult{Topic: req.Messages[i].Topic, Status: "success", ID: outcome.ID}
+		if outcome.Err != nil {
+			result.Status = "error"
+			result.Error = outcome.Err.Error()
+			failed++
+			if s.metrics != nil {
+				s.metrics.IncrementFailedPublishesForBroker(s.brokerName(req.Broker))
+			}
+		} else if s.metrics != nil {
+			s.metrics.IncrementPublishedMessagesForTopic(msgs[i].Topic, s.brokerName(req.Broker))
+		}
+		results = append(results, result)
+	}
+
+	// Record latency once for the whole batch
+	if s.metrics != nil {
+		s.metrics.AddPublishLatency(time.Since(startTime))
+	}
+
+	status := "success"
+	switch {
+	case failed == len(results):
+		status = "error"
+	case failed > 0:
+		status = "partial"
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  status,
+		"message": fmt.Sprintf("Published %d of %d messages", len(results)-failed, len(results)),
+		"results": results,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestBatchPublishStoresMessages(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key::tenant-a")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish/batch", "key", BatchPublishRequest{
+		Messages: []BatchPublishMessage{
+			{Topic: "sensors/1", Payload: "21.5"},
+			{Topic: "sensors/2", Payload: map[string]interface{}{"value": 22}, QoS: qos(1)},
+			{Topic: "sensors/3", Payload: "23.5", QoS: qos(2)},
+		},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected batch publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Status  string               `json:"status"`
+		Results []BatchPublishResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != "success" || len(response.Results) != 3 {
+		t.Fatalf("Expected 3 successful results, got '%s' with %d results", response.Status, len(response.Results))
+	}
+
+	published := broker.WaitForPublished(t, 3)
+	if published[0].TopicName != "tenant-a/sensors/1" {
+		t.Errorf("Expected the first message on 'tenant-a/sensors/1', got '%s'", published[0].TopicName)
+	}
+
+	for _, result := range response.Results {
+		if result.ID == "" {
+			t.Fatalf("Expected message on %s to be stored", result.Topic)
+		}
+		msg, err := s.db.GetMessageByID(context.Background(), result.ID)
+		if err != nil {
+			t.Fatalf("Failed to get stored message: %v", err)
+		}
+		if msg.Status != database.MessageStatusDelivered {
+			t.Errorf("Expected message on %s to be delivered, got '%s'", result.Topic, msg.Status)
+		}
+		if msg.Confirmed != (msg.QoS == 2) {
+			t.Errorf("Expected only the QoS 2 message to be confirmed, got confirmed=%v for QoS %d", msg.Confirmed, msg.QoS)
+		}
+	}
+}
+
+func TestBatchPublishRejectsInvalidTopics(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish/batch", "key", BatchPublishRequest{
+		Messages: []BatchPublishMessage{
+			{Topic: "sensors/1", Payload: "21.5"},
+			{Topic: "sensors/#", Payload: "22.5"},
+		},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a wildcard topic, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(broker.Published()) != 0 {
+		t.Error("Expected no message to be published when the batch is invalid")
+	}
+}
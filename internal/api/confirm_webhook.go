@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"MQTTmicroService/internal/models"
+)
+
+// WebhookEventMessageConfirmed is the event of the notifications sent to the confirmation webhook
+const WebhookEventMessageConfirmed = "message.confirmed"
+
+// confirmWebhook returns the webhook notified of confirmed messages, configured with CONFIRM_WEBHOOK_URL,
+// or nil if there is none. It is delivered to with the timeout, retries, and secret of the global webhook.
+func (s *Server) confirmWebhook() *models.Webhook {
+	if s.config == nil || s.config.Webhook == nil || s.config.Webhook.ConfirmURL == "" {
+		return nil
+	}
+
+	return &models.Webhook{
+		ID:          models.ConfirmWebhookID,
+		Name:        models.ConfirmWebhookID,
+		URL:         s.config.Webhook.ConfirmURL,
+		Method:      http.MethodPost,
+		TopicFilter: "#",
+		Enabled:     true,
+		Timeout:     s.config.Webhook.Timeout,
+		RetryCount:  s.config.Webhook.RetryCount,
+		RetryDelay:  s.config.Webhook.RetryDelay,
+		Secret:      s.config.Webhook.Secret,
+	}
+}
+
+// notifyConfirmation notifies the confirmation webhook, if any, that a stored message was confirmed.
+// The notification is delivered in the background, so a slow receiver doesn't hold up the confirmation.
+func (s *Server) notifyConfirmation(ctx context.Context, id string, confirmedAt time.Time) {
+	webhook := s.confirmWebhook()
+	if webhook == nil {
+		return
+	}
+
+	message, err := s.db.GetMessageByID(ctx, id)
+	if err != nil {
+		s.logger.WithError(err).WithField("id", id).Error("Failed to load confirmed message for the confirmation webhook")
+		return
+	}
+
+	webhookPayload := WebhookPayload{
+		Event:     WebhookEventMessageConfirmed,
+		MessageID: message.ID,
+		Topic:     message.Topic,
+		Payload:   message.Payload,
+		QoS:       message.QoS,
+		Timestamp: confirmedAt.Format(time.RFC3339),
+	}
+	go s.enqueueWebhookNotification(webhookPayload, webhook)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestConfirmingAMessageNotifiesTheConfirmationWebhook(t *testing.T) {
+	notifications := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		notifications <- body
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key")
+	s.config.Webhook = &config.WebhookConfig{ConfirmURL: receiver.URL, Timeout: 5}
+
+	message := &database.Message{ID: "42", Topic: "devices/42/commands", Payload: "reboot", QoS: 1, Timestamp: time.Now()}
+	if err := s.db.StoreMessage(context.Background(), message); err != nil {
+		t.Fatalf("Failed to store message: %v", err)
+	}
+
+	rec := doRequest(t, s, http.MethodPost, "/messages/42/confirm", "key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected confirmation to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var notification WebhookPayload
+	select {
+	case body := <-notifications:
+		if err := json.Unmarshal(body, &notification); err != nil {
+			t.Fatalf("Failed to decode notification: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the confirmation notification")
+	}
+	if notification.Event != WebhookEventMessageConfirmed || notification.MessageID != "42" || notification.Topic != "devices/42/commands" {
+		t.Errorf("Expected a confirmation of message 42 on devices/42/commands, got %+v", notification)
+	}
+	if _, err := time.Parse(time.RFC3339, notification.Timestamp); err != nil {
+		t.Errorf("Expected the confirmation time in the timestamp, got %q", notification.Timestamp)
+	}
+
+	if confirmed := s.metrics.GetMetrics()["messages"].(map[string]int64)["confirmed"]; confirmed != 1 {
+		t.Errorf("Expected 1 confirmed message in the metrics, got %d", confirmed)
+	}
+
+	// The delivery is recorded under the confirmation webhook's ID
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := s.db.GetWebhookDeliveries(context.Background(), models.ConfirmWebhookID, 10)
+		if err != nil {
+			t.Fatalf("Failed to get deliveries: %v", err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status == models.DeliveryStatusDelivered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a delivered confirmation notification in the delivery log, got %d deliveries", len(deliveries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
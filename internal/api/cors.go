@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"MQTTmicroService/internal/auth"
+)
+
+const (
+	// corsAllowedMethods are the methods browsers may use in cross-origin requests
+	corsAllowedMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	// corsAllowedHeaders are the request headers browsers may send in cross-origin requests, besides the API key headers
+	corsAllowedHeaders = "Content-Type, Authorization, Idempotency-Key"
+	// corsMaxAge is how long browsers may cache a preflight response, in seconds
+	corsMaxAge = "600"
+)
+
+// corsMiddleware adds CORS headers for allowed origins and answers preflight requests.
+// It wraps the whole router rather than being registered with Use, because the router
+// doesn't run middleware for OPTIONS requests that match no route, and it runs before
+// authentication so preflight requests, which carry no credentials, aren't rejected.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !s.corsOriginAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+
+		// Answer preflight requests without passing them on
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", s.corsAllowedHeaders())
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowedHeaders returns the request headers browsers may send in cross-origin requests,
+// including the configured API key headers
+func (s *Server) corsAllowedHeaders() string {
+	headers := s.config.APIKeyHeaders
+	if len(headers) == 0 {
+		headers = []string{auth.DefaultAPIKeyHeader}
+	}
+	return corsAllowedHeaders + ", " + strings.Join(headers, ", ")
+}
+
+// corsOriginAllowed reports whether the origin is in the CORS allowlist
+func (s *Server) corsOriginAllowed(origin string) bool {
+	for _, allowed := range s.config.CORSAllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
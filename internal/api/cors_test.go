@@ -0,0 +1,65 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+)
+
+// newCORSTestServer creates a server requiring an API key that allows cross-origin requests from the given origin
+func newCORSTestServer(origin string) *Server {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	authService := auth.New(&auth.Config{
+		EnableAPIKey: true,
+		APIKeys:      auth.ParseAPIKeys([]string{"key"}),
+	}, log)
+	cfg := &config.Config{CORSAllowedOrigins: []string{origin}}
+	return NewServer(nil, log, nil, authService, nil, cfg, ":0", HTTPTimeouts{})
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s := newCORSTestServer("https://dashboard.example.com")
+
+	req := httptest.NewRequest(http.MethodOptions, "/status", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "X-API-Key")
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://dashboard.example.com",
+		"Access-Control-Allow-Methods": corsAllowedMethods,
+		"Access-Control-Allow-Headers": "Content-Type, Authorization, Idempotency-Key, X-API-Key",
+	}
+	for header, value := range expected {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("Expected %s to be '%s', got '%s'", header, value, got)
+		}
+	}
+}
+
+func TestCORSRejectsUnknownOrigin(t *testing.T) {
+	s := newCORSTestServer("https://dashboard.example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+
+	if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin header for an unknown origin, got '%s'", origin)
+	}
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthenticated request to be rejected with %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/utils"
 
 	"github.com/gorilla/mux"
 )
@@ -15,19 +17,27 @@ import (
 // handleGetMessages handles requests to get messages from the database
 func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
 	// Get query parameters
 	confirmed := r.URL.Query().Get("confirmed") == "true"
+	topic := r.URL.Query().Get("topic")
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", database.MessageStatusPending, database.MessageStatusDelivered, database.MessageStatusFailed:
+	default:
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid status parameter")
+		return
+	}
 	limitStr := r.URL.Query().Get("limit")
 	limit := 100 // Default limit
 	if limitStr != "" {
 		var err error
 		limit, err = strconv.Atoi(limitStr)
 		if err != nil {
-			s.writeError(w, http.StatusBadRequest, "Invalid limit parameter")
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid limit parameter")
 			return
 		}
 	}
@@ -36,13 +46,26 @@ func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Get messages from the database
-	messages, err := s.db.GetMessages(ctx, confirmed, limit)
+	// Get messages from the database, restricted to the caller's namespace for tenants
+	var messages []*database.Message
+	var err error
+	namespace := s.tenantNamespace(r)
+	if topic != "" {
+		messages, err = s.db.GetMessagesByTopicFilter(ctx, utils.ApplyNamespace(namespace, topic), limit)
+	} else if namespace != "" {
+		messages, err = s.db.GetMessagesByTopicPrefix(ctx, utils.ApplyNamespace(namespace, ""), confirmed, status, limit)
+	} else {
+		messages, err = s.db.GetMessages(ctx, confirmed, status, limit)
+	}
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get messages: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get messages: %v", err))
 		return
 	}
 
+	for _, message := range messages {
+		tenantMessage(namespace, message)
+	}
+
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":   "success",
@@ -54,7 +77,7 @@ func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
 // handleGetMessage handles requests to get a specific message from the database
 func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -62,7 +85,7 @@ func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		s.writeError(w, http.StatusBadRequest, "Message ID is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Message ID is required")
 		return
 	}
 
@@ -72,15 +95,34 @@ func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
 
 	// Get the message from the database
 	message, err := s.db.GetMessageByID(ctx, id)
+	if err == nil && !tenantMessage(s.tenantNamespace(r), message) {
+		// Messages of other tenants are reported as missing
+		err = database.ErrMessageNotFound
+	}
 	if err != nil {
 		if err == database.ErrMessageNotFound {
-			s.writeError(w, http.StatusNotFound, "Message not found")
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Message not found")
 		} else {
-			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get message: %v", err))
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get message: %v", err))
 		}
 		return
 	}
 
+	// Download the payload itself rather than the message envelope
+	if r.URL.Query().Get("raw") == "true" {
+		payload, err := message.PayloadBytes()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to encode payload: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", payloadContentType(payload, message.ContentType))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		w.Write(payload)
+		return
+	}
+
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
@@ -88,10 +130,26 @@ func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// payloadContentType returns the HTTP Content-Type of a stored payload, detecting the media type of binary payloads
+func payloadContentType(payload []byte, contentType string) string {
+	switch contentType {
+	case database.ContentTypeJSON:
+		return "application/json"
+	case database.ContentTypeText:
+		return "text/plain; charset=utf-8"
+	default:
+		// Binary payloads aren't valid UTF-8, so they are never served as text
+		if detected := http.DetectContentType(payload); !strings.HasPrefix(detected, "text/") {
+			return detected
+		}
+		return "application/octet-stream"
+	}
+}
+
 // handleConfirmMessage handles requests to confirm a message
 func (s *Server) handleConfirmMessage(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -99,7 +157,7 @@ func (s *Server) handleConfirmMessage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		s.writeError(w, http.StatusBadRequest, "Message ID is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Message ID is required")
 		return
 	}
 
@@ -107,17 +165,25 @@ func (s *Server) handleConfirmMessage(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Confirm the message
-	err := s.db.ConfirmMessage(ctx, id)
+	// Confirm the message, making sure tenants can only touch their own messages
+	err := s.checkMessageOwner(ctx, r, id)
+	if err == nil {
+		err = s.db.ConfirmMessage(ctx, id)
+	}
 	if err != nil {
 		if err == database.ErrMessageNotFound {
-			s.writeError(w, http.StatusNotFound, "Message not found")
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Message not found")
 		} else {
-			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to confirm message: %v", err))
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to confirm message: %v", err))
 		}
 		return
 	}
 
+	if s.metrics != nil {
+		s.metrics.IncrementConfirmedMessages()
+	}
+	s.notifyConfirmation(ctx, id, time.Now())
+
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]string{
 		"status":  "success",
@@ -128,7 +194,7 @@ func (s *Server) handleConfirmMessage(w http.ResponseWriter, r *http.Request) {
 // handleDeleteMessage handles requests to delete a message
 func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -136,7 +202,7 @@ func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		s.writeError(w, http.StatusBadRequest, "Message ID is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Message ID is required")
 		return
 	}
 
@@ -144,13 +210,16 @@ func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Delete the message
-	err := s.db.DeleteMessage(ctx, id)
+	// Delete the message, making sure tenants can only touch their own messages
+	err := s.checkMessageOwner(ctx, r, id)
+	if err == nil {
+		err = s.db.DeleteMessage(ctx, id)
+	}
 	if err != nil {
 		if err == database.ErrMessageNotFound {
-			s.writeError(w, http.StatusNotFound, "Message not found")
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Message not found")
 		} else {
-			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete message: %v", err))
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to delete message: %v", err))
 		}
 		return
 	}
@@ -165,7 +234,13 @@ func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
 // handleDeleteConfirmedMessages handles requests to delete all confirmed messages
 func (s *Server) handleDeleteConfirmedMessages(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Bulk deletion spans all tenants, so it's reserved for unrestricted callers
+	if s.tenantNamespace(r) != "" {
+		s.writeError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden: deleting all confirmed messages is not available to tenants")
 		return
 	}
 
@@ -176,7 +251,7 @@ func (s *Server) handleDeleteConfirmedMessages(w http.ResponseWriter, r *http.Re
 	// Delete confirmed messages
 	count, err := s.db.DeleteConfirmedMessages(ctx)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete confirmed messages: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to delete confirmed messages: %v", err))
 		return
 	}
 
@@ -186,4 +261,21 @@ func (s *Server) handleDeleteConfirmedMessages(w http.ResponseWriter, r *http.Re
 		"message": fmt.Sprintf("%d confirmed messages deleted", count),
 		"count":   count,
 	})
-}
\ No newline at end of file
+}
+
+// checkMessageOwner returns ErrMessageNotFound if a tenant caller doesn't own the message
+func (s *Server) checkMessageOwner(ctx context.Context, r *http.Request, id string) error {
+	namespace := s.tenantNamespace(r)
+	if namespace == "" {
+		return nil
+	}
+
+	message, err := s.db.GetMessageByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !tenantMessage(namespace, message) {
+		return database.ErrMessageNotFound
+	}
+	return nil
+}
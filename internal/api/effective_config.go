@@ -0,0 +1,397 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/metrics"
+)
+
+// redactedSecret replaces secrets in the effective configuration. Unset secrets are left empty so it stays
+// visible whether they are configured.
+const redactedSecret = "***"
+
+// EffectiveConfig is the configuration the service is running with, with defaults resolved and secrets redacted
+type EffectiveConfig struct {
+	DefaultConnection string                  `json:"default_connection"`
+	Brokers           []EffectiveBrokerConfig `json:"brokers"`
+	Auth              EffectiveAuthConfig     `json:"auth"`
+	// APIRequestTimeout is in seconds; 0 means requests aren't timed out
+	APIRequestTimeout  int      `json:"api_request_timeout"`
+	CORSAllowedOrigins []string `json:"cors_allowed_origins"`
+	IPAllowlist        []string `json:"ip_allowlist"`
+	TrustedProxies     []string `json:"trusted_proxies"`
+	APIGzipEnabled     bool     `json:"api_gzip_enabled"`
+	// RateLimitRPS is 0 when rate limiting is disabled
+	RateLimitRPS    float64 `json:"rate_limit_rps"`
+	RateLimitBurst  int     `json:"rate_limit_burst"`
+	MaxPublishBytes int64   `json:"max_publish_bytes"`
+	// IdempotencyTTL is in seconds
+	IdempotencyTTL         int  `json:"idempotency_ttl"`
+	StartupConnectAttempts int  `json:"startup_connect_attempts"`
+	StartupConnectMaxWait  int  `json:"startup_connect_max_wait"`
+	MemoryBufferSize       int  `json:"memory_buffer_size"`
+	DefaultPublishQoS      byte `json:"default_publish_qos"`
+	DefaultSubscribeQoS    byte `json:"default_subscribe_qos"`
+	DefaultRetained        bool `json:"default_retained"`
+	MetricsMaxTopics       int  `json:"metrics_max_topics"`
+	// MetricsLatencyBuckets are the upper bounds of the latency histogram buckets in milliseconds
+	MetricsLatencyBuckets []float64 `json:"metrics_latency_buckets"`
+	TopicNormalize        bool      `json:"topic_normalize"`
+	// TopicRewriteRules are written as from=>to, with regular expressions prefixed by ^
+	TopicRewriteRules []string `json:"topic_rewrite_rules"`
+	// SchemaRules are written as filter=>file
+	SchemaRules []string                 `json:"schema_rules"`
+	Database    *EffectiveDatabaseConfig `json:"database,omitempty"`
+	Webhook     *EffectiveWebhookConfig  `json:"webhook,omitempty"`
+}
+
+// EffectiveBrokerConfig is the configuration of a broker. Timings are in seconds.
+type EffectiveBrokerConfig struct {
+	Name          string `json:"name"`
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	ClientID      string `json:"client_id"`
+	CleanSession  bool   `json:"clean_session"`
+	EnableLogging bool   `json:"enable_logging"`
+	LogChannel    string `json:"log_channel"`
+	TLSEnabled    bool   `json:"tls_enabled"`
+	TLSVerifyPeer bool   `json:"tls_verify_peer"`
+	TLSCAFile     string `json:"tls_ca_file"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ProbeInterval int    `json:"probe_interval"`
+	ProbeTopic    string `json:"probe_topic"`
+	// ProtocolVersion is 0 when the version is negotiated
+	ProtocolVersion          int     `json:"protocol_version"`
+	KeepAlive                int     `json:"keepalive"`
+	PingTimeout              int     `json:"ping_timeout"`
+	ReconnectInitialInterval int     `json:"reconnect_initial_interval"`
+	MaxReconnectInterval     int     `json:"max_reconnect_interval"`
+	ReconnectJitter          float64 `json:"reconnect_jitter"`
+	WriteTimeout             int     `json:"write_timeout"`
+	ConnectTimeout           int     `json:"connect_timeout"`
+	StoreDir                 string  `json:"store_dir"`
+	MaxInflight              int     `json:"max_inflight"`
+}
+
+// EffectiveAuthConfig is the authentication configuration in force
+type EffectiveAuthConfig struct {
+	APIKeyEnabled        bool              `json:"api_key_enabled"`
+	APIKeys              []EffectiveAPIKey `json:"api_keys"`
+	APIKeyHeaders        []string          `json:"api_key_headers"`
+	APIKeyBasicAuthField string            `json:"api_key_basic_auth_field"`
+	JWTEnabled           bool              `json:"jwt_enabled"`
+	JWTSecret            string            `json:"jwt_secret"`
+	JWTJWKSURL           string            `json:"jwt_jwks_url"`
+	JWTAudience          string            `json:"jwt_audience"`
+	JWTIssuer            string            `json:"jwt_issuer"`
+	JWTDefaultScopes     []string          `json:"jwt_default_scopes"`
+}
+
+// EffectiveAPIKey describes an accepted API key without revealing it
+type EffectiveAPIKey struct {
+	Key       string   `json:"key"`
+	Scopes    []string `json:"scopes"`
+	Namespace string   `json:"namespace,omitempty"`
+}
+
+// EffectiveDatabaseConfig is the database configuration. Credentials in connection strings are redacted.
+type EffectiveDatabaseConfig struct {
+	Type                 string   `json:"type"`
+	Connection           string   `json:"connection"`
+	MongoDBURI           string   `json:"mongodb_uri"`
+	MongoDBDatabase      string   `json:"mongodb_database"`
+	MongoDBUsername      string   `json:"mongodb_username"`
+	MongoDBPassword      string   `json:"mongodb_password"`
+	MongoDBPort          int      `json:"mongodb_port"`
+	SQLitePath           string   `json:"sqlite_path"`
+	SQLiteBusyTimeout    int      `json:"sqlite_busy_timeout"`
+	SQLiteJournalMode    string   `json:"sqlite_journal_mode"`
+	SQLiteSynchronous    string   `json:"sqlite_synchronous"`
+	ConnectAttempts      int      `json:"connect_attempts"`
+	ReconnectMaxWait     int      `json:"reconnect_max_wait"`
+	StoreMaxPayloadBytes int      `json:"store_max_payload_bytes"`
+	StoreRedactFields    []string `json:"store_redact_fields"`
+	StoreExcludeTopics   []string `json:"store_exclude_topics"`
+	StoreAsync           bool     `json:"store_async"`
+	StoreQueueSize       int      `json:"store_queue_size"`
+	StoreQueueFullPolicy string   `json:"store_queue_full_policy"`
+	Dedup                bool     `json:"dedup"`
+	DedupWindow          int      `json:"dedup_window"`
+}
+
+// EffectiveWebhookConfig is the webhook configuration. Timings are in seconds.
+type EffectiveWebhookConfig struct {
+	Enabled          bool   `json:"enabled"`
+	URL              string `json:"url"`
+	TopicFilter      string `json:"topic_filter"`
+	Method           string `json:"method"`
+	Timeout          int    `json:"timeout"`
+	RetryCount       int    `json:"retry_count"`
+	RetryDelay       int    `json:"retry_delay"`
+	Secret           string `json:"secret"`
+	DeliveryMaxAge   int    `json:"delivery_max_age"`
+	AllowPrivate     bool   `json:"allow_private"`
+	DLQTopic         string `json:"dlq_topic"`
+	Workers          int    `json:"workers"`
+	QueueSize        int    `json:"queue_size"`
+	QueueFullPolicy  string `json:"queue_full_policy"`
+	ConfirmURL       string `json:"confirm_url"`
+	BreakerThreshold int    `json:"breaker_threshold"`
+	BreakerCooldown  int    `json:"breaker_cooldown"`
+}
+
+// handleGetConfig handles requests for the effective configuration, which shows which settings took effect
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	if s.config == nil {
+		s.writeError(w, http.StatusServiceUnavailable, ErrCodeNotConfigured, "No configuration loaded")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"config": s.effectiveConfig(),
+	})
+}
+
+// effectiveConfig builds the effective configuration from the loaded configuration and the state of the
+// components using it, so it reflects what is actually in force rather than what was requested
+func (s *Server) effectiveConfig() EffectiveConfig {
+	cfg := s.config
+	effective := EffectiveConfig{
+		DefaultConnection:      cfg.DefaultConnection,
+		Brokers:                make([]EffectiveBrokerConfig, 0, len(cfg.Brokers)),
+		Auth:                   s.effectiveAuthConfig(),
+		APIRequestTimeout:      int(s.requestTimeout / time.Second),
+		CORSAllowedOrigins:     nonNilStrings(cfg.CORSAllowedOrigins),
+		IPAllowlist:            make([]string, 0, len(cfg.IPAllowlist)),
+		TrustedProxies:         make([]string, 0, len(cfg.TrustedProxies)),
+		APIGzipEnabled:         cfg.APIGzipEnabled,
+		MaxPublishBytes:        s.maxPublishBytes(),
+		IdempotencyTTL:         int(s.idempotency.ttl / time.Second),
+		StartupConnectAttempts: cfg.StartupConnectAttempts,
+		StartupConnectMaxWait:  cfg.StartupConnectMaxWait,
+		MemoryBufferSize:       cfg.MemoryBufferSize,
+		DefaultPublishQoS:      cfg.DefaultPublishQoS,
+		DefaultSubscribeQoS:    cfg.DefaultSubscribeQoS,
+		DefaultRetained:        cfg.DefaultRetained,
+		MetricsMaxTopics:       cfg.MetricsMaxTopics,
+		TopicNormalize:         cfg.TopicNormalize,
+		TopicRewriteRules:      make([]string, 0),
+		SchemaRules:            make([]string, 0),
+	}
+
+	for _, broker := range cfg.Brokers {
+		effective.Brokers = append(effective.Brokers, effectiveBrokerConfig(broker))
+	}
+	sort.Slice(effective.Brokers, func(i, j int) bool {
+		return effective.Brokers[i].Name < effective.Brokers[j].Name
+	})
+
+	for _, prefix := range cfg.IPAllowlist {
+		effective.IPAllowlist = append(effective.IPAllowlist, prefix.String())
+	}
+	for _, prefix := range cfg.TrustedProxies {
+		effective.TrustedProxies = append(effective.TrustedProxies, prefix.String())
+	}
+
+	if s.rateLimiter != nil {
+		state := s.rateLimiter.state(time.Now())
+		effective.RateLimitRPS = state.RPS
+		effective.RateLimitBurst = state.Burst
+	}
+
+	if effective.MetricsMaxTopics <= 0 {
+		effective.MetricsMaxTopics = metrics.DefaultMaxTopics
+	}
+
+	latencyBuckets := cfg.MetricsLatencyBuckets
+	if latencyBuckets == nil {
+		latencyBuckets = metrics.DefaultLatencyBuckets
+	}
+	for _, bound := range latencyBuckets {
+		effective.MetricsLatencyBuckets = append(effective.MetricsLatencyBuckets, float64(bound)/float64(time.Millisecond))
+	}
+
+	if cfg.TopicRewrite != nil {
+		for _, rule := range cfg.TopicRewrite.Rules {
+			from := rule.Prefix
+			if rule.Pattern != nil {
+				from = rule.Pattern.String()
+			}
+			effective.TopicRewriteRules = append(effective.TopicRewriteRules, from+"=>"+rule.Replacement)
+		}
+	}
+
+	if cfg.PayloadSchemas != nil {
+		for _, rule := range cfg.PayloadSchemas.Rules {
+			effective.SchemaRules = append(effective.SchemaRules, rule.Filter+"=>"+rule.Path)
+		}
+	}
+
+	if cfg.Database != nil {
+		effective.Database = &EffectiveDatabaseConfig{
+			Type:                 cfg.Database.Type,
+			Connection:           redactURL(cfg.Database.Connection),
+			MongoDBURI:           redactURL(cfg.Database.MongoDB.URI),
+			MongoDBDatabase:      cfg.Database.MongoDB.Database,
+			MongoDBUsername:      cfg.Database.MongoDB.Username,
+			MongoDBPassword:      redact(cfg.Database.MongoDB.Password),
+			MongoDBPort:          cfg.Database.MongoDB.Port,
+			SQLitePath:           cfg.Database.SQLite.Path,
+			SQLiteBusyTimeout:    cfg.Database.SQLite.BusyTimeout,
+			SQLiteJournalMode:    cfg.Database.SQLite.JournalMode,
+			SQLiteSynchronous:    cfg.Database.SQLite.Synchronous,
+			ConnectAttempts:      cfg.Database.ConnectAttempts,
+			ReconnectMaxWait:     cfg.Database.ReconnectMaxWait,
+			StoreMaxPayloadBytes: cfg.Database.StoreMaxPayloadBytes,
+			StoreRedactFields:    nonNilStrings(cfg.Database.StoreRedactFields),
+			StoreExcludeTopics:   nonNilStrings(cfg.Database.StoreExcludeTopics),
+			StoreAsync:           cfg.Database.StoreAsync,
+			StoreQueueSize:       cfg.Database.StoreQueueSize,
+			StoreQueueFullPolicy: cfg.Database.StoreQueueFullPolicy,
+			Dedup:                cfg.Database.Dedup,
+			DedupWindow:          cfg.Database.DedupWindow,
+		}
+	}
+
+	if cfg.Webhook != nil {
+		effective.Webhook = &EffectiveWebhookConfig{
+			Enabled:          cfg.Webhook.Enabled,
+			URL:              redactURL(cfg.Webhook.URL),
+			TopicFilter:      cfg.Webhook.TopicFilter,
+			Method:           cfg.Webhook.Method,
+			Timeout:          cfg.Webhook.Timeout,
+			RetryCount:       cfg.Webhook.RetryCount,
+			RetryDelay:       cfg.Webhook.RetryDelay,
+			Secret:           redact(cfg.Webhook.Secret),
+			DeliveryMaxAge:   cfg.Webhook.DeliveryMaxAge,
+			AllowPrivate:     cfg.Webhook.AllowPrivate,
+			DLQTopic:         cfg.Webhook.DLQTopic,
+			Workers:          cfg.Webhook.Workers,
+			QueueSize:        cfg.Webhook.QueueSize,
+			QueueFullPolicy:  cfg.Webhook.QueueFullPolicy,
+			ConfirmURL:       redactURL(cfg.Webhook.ConfirmURL),
+			BreakerThreshold: cfg.Webhook.BreakerThreshold,
+			BreakerCooldown:  cfg.Webhook.BreakerCooldown,
+		}
+	}
+
+	return effective
+}
+
+// effectiveAuthConfig describes the authentication in force. Without an auth service no request is authenticated,
+// whatever the configuration says.
+func (s *Server) effectiveAuthConfig() EffectiveAuthConfig {
+	cfg := s.config
+	effective := EffectiveAuthConfig{
+		APIKeys:              make([]EffectiveAPIKey, 0),
+		APIKeyHeaders:        nonNilStrings(cfg.APIKeyHeaders),
+		APIKeyBasicAuthField: cfg.APIKeyBasicAuthField,
+		JWTSecret:            redact(cfg.JWTSecret),
+		JWTJWKSURL:           cfg.JWTJWKSURL,
+		JWTAudience:          cfg.JWTAudience,
+		JWTIssuer:            cfg.JWTIssuer,
+		JWTDefaultScopes:     nonNilStrings(cfg.JWTDefaultScopes),
+	}
+	if len(effective.APIKeyHeaders) == 0 {
+		effective.APIKeyHeaders = []string{auth.DefaultAPIKeyHeader}
+	}
+	if effective.APIKeyBasicAuthField == "" {
+		effective.APIKeyBasicAuthField = auth.BasicAuthPassword
+	}
+
+	if s.auth != nil {
+		effective.APIKeyEnabled = s.auth.GetEnableAPIKey()
+		effective.JWTEnabled = s.auth.GetEnableJWT()
+		for _, key := range s.auth.GetAPIKeys() {
+			effective.APIKeys = append(effective.APIKeys, EffectiveAPIKey{
+				Key:       redactedSecret,
+				Scopes:    nonNilStrings(key.Scopes),
+				Namespace: key.Namespace,
+			})
+		}
+	}
+
+	return effective
+}
+
+// effectiveBrokerConfig describes a broker's configuration with the default timings resolved
+func effectiveBrokerConfig(broker *config.BrokerConfig) EffectiveBrokerConfig {
+	return EffectiveBrokerConfig{
+		Name:                     broker.Name,
+		Host:                     broker.Host,
+		Port:                     broker.Port,
+		ClientID:                 broker.ClientID,
+		CleanSession:             broker.CleanSession,
+		EnableLogging:            broker.EnableLogging,
+		LogChannel:               broker.LogChannel,
+		TLSEnabled:               broker.TLSEnabled,
+		TLSVerifyPeer:            broker.TLSVerifyPeer,
+		TLSCAFile:                broker.TLSCAFile,
+		Username:                 broker.Username,
+		Password:                 redact(broker.Password),
+		ProbeInterval:            broker.ProbeInterval,
+		ProbeTopic:               broker.ProbeTopic,
+		ProtocolVersion:          broker.ProtocolVersion,
+		KeepAlive:                positiveOrDefault(broker.KeepAlive, config.DefaultKeepAlive),
+		PingTimeout:              positiveOrDefault(broker.PingTimeout, config.DefaultPingTimeout),
+		ReconnectInitialInterval: positiveOrDefault(broker.ReconnectInitialInterval, config.DefaultReconnectInitialInterval),
+		MaxReconnectInterval:     positiveOrDefault(broker.MaxReconnectInterval, config.DefaultMaxReconnectInterval),
+		ReconnectJitter:          broker.ReconnectJitter,
+		WriteTimeout:             positiveOrDefault(broker.WriteTimeout, config.DefaultWriteTimeout),
+		ConnectTimeout:           positiveOrDefault(broker.ConnectTimeout, config.DefaultConnectTimeout),
+		StoreDir:                 broker.StoreDir,
+		MaxInflight:              broker.MaxInflight,
+	}
+}
+
+// redact hides a secret, leaving unset secrets empty
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+// redactURL hides the password in a URL's user info, such as a MongoDB connection string with credentials
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		// Don't risk showing credentials that couldn't be located
+		return redact(rawURL)
+	}
+	if parsed.User == nil {
+		return rawURL
+	}
+	if _, ok := parsed.User.Password(); !ok {
+		return rawURL
+	}
+
+	// url.UserPassword would escape the placeholder, so the user info is put back by hand
+	username := url.User(parsed.User.Username()).String()
+	parsed.User = nil
+	return strings.Replace(parsed.String(), "//", "//"+username+":"+redactedSecret+"@", 1)
+}
+
+// positiveOrDefault returns value, or defaultValue when value isn't positive
+func positiveOrDefault(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// nonNilStrings returns values, or an empty slice when values is nil so it is encoded as an empty JSON array
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,58 @@
+package api
+
+import "MQTTmicroService/internal/auth"
+
+// Machine-readable error codes sent in the code field of error responses. Clients should branch on the
+// code, which is stable, rather than on the message, which is meant for humans and may change.
+const (
+	// ErrCodeInvalidRequest is returned for malformed request bodies and missing required fields
+	ErrCodeInvalidRequest = "invalid_request"
+	// ErrCodeInvalidParameter is returned for invalid query parameters
+	ErrCodeInvalidParameter = "invalid_parameter"
+	// ErrCodeInvalidTopic is returned for invalid topics and topic filters
+	ErrCodeInvalidTopic = "invalid_topic"
+	// ErrCodeInvalidQoS is returned for QoS levels other than 0, 1, and 2
+	ErrCodeInvalidQoS = "invalid_qos"
+	// ErrCodeInvalidWebhook is returned for webhooks that fail validation
+	ErrCodeInvalidWebhook = "invalid_webhook"
+	// ErrCodePayloadTooLarge is returned for publish requests over the size limit
+	ErrCodePayloadTooLarge = "payload_too_large"
+	// ErrCodeSchemaViolation is returned for payloads that don't conform to the JSON Schema of their topic
+	ErrCodeSchemaViolation = "schema_violation"
+	// ErrCodeNotFound is returned when the requested resource doesn't exist
+	ErrCodeNotFound = "not_found"
+	// ErrCodeConflict is returned when the request conflicts with the resource's state, such as a reused idempotency key
+	ErrCodeConflict = "conflict"
+	// ErrCodeUnauthorized is returned for missing or invalid credentials
+	ErrCodeUnauthorized = auth.ErrCodeUnauthorized
+	// ErrCodeTokenExpired is returned for expired JWTs
+	ErrCodeTokenExpired = auth.ErrCodeTokenExpired
+	// ErrCodeInsufficientScope is returned when the credentials lack the scope an endpoint requires
+	ErrCodeInsufficientScope = auth.ErrCodeInsufficientScope
+	// ErrCodeForbidden is returned when the caller isn't allowed to make the request whatever its credentials
+	ErrCodeForbidden = "forbidden"
+	// ErrCodeRateLimited is returned when the client exceeded the rate limit
+	ErrCodeRateLimited = "rate_limited"
+	// ErrCodeTimeout is returned when the request took longer than the API request timeout
+	ErrCodeTimeout = "timeout"
+	// ErrCodeCancelled is returned when the request was cancelled, typically because the server is shutting down
+	ErrCodeCancelled = "cancelled"
+	// ErrCodeUnknownBroker is returned for brokers that aren't configured
+	ErrCodeUnknownBroker = "unknown_broker"
+	// ErrCodeBrokerUnavailable is returned when the broker isn't connected and can't be connected to
+	ErrCodeBrokerUnavailable = "broker_unavailable"
+	// ErrCodePublishFailed is returned when the broker didn't accept a published message
+	ErrCodePublishFailed = "publish_failed"
+	// ErrCodeSubscribeFailed is returned when subscribing or unsubscribing failed
+	ErrCodeSubscribeFailed = "subscribe_failed"
+	// ErrCodeSubscriptionRefused is returned when the broker refused a subscription, typically because of an ACL
+	ErrCodeSubscriptionRefused = "subscription_refused"
+	// ErrCodeDeliveryFailed is returned when redelivering a webhook notification failed
+	ErrCodeDeliveryFailed = "delivery_failed"
+	// ErrCodeDatabaseError is returned when a database operation failed
+	ErrCodeDatabaseError = "database_error"
+	// ErrCodeNotConfigured is returned when the endpoint needs a component that isn't configured, such as the database
+	ErrCodeNotConfigured = "not_configured"
+	// ErrCodeInternal is returned for unexpected server errors
+	ErrCodeInternal = "internal_error"
+)
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestErrorResponsesCarryCodes(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key", "reader:read")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		apiKey string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"missing API key", http.MethodGet, "/status", "", nil, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"missing scope", http.MethodPost, "/publish", "reader", PublishRequest{Topic: "sensors/temp", Payload: 1}, http.StatusForbidden, ErrCodeInsufficientScope},
+		{"malformed body", http.MethodPost, "/subscribe", "key", "not an object", http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"invalid topic", http.MethodPost, "/publish", "key", PublishRequest{Topic: "sensors/#", Payload: 1}, http.StatusBadRequest, ErrCodeInvalidTopic},
+		{"invalid parameter", http.MethodGet, "/messages?limit=many", "key", nil, http.StatusBadRequest, ErrCodeInvalidParameter},
+		{"unknown broker", http.MethodPost, "/publish", "key", PublishRequest{Topic: "sensors/temp", Payload: 1, Broker: "missing"}, http.StatusInternalServerError, ErrCodeUnknownBroker},
+		{"missing resource", http.MethodGet, "/webhooks/missing", "key", nil, http.StatusNotFound, ErrCodeNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(t, s, test.method, test.path, test.apiKey, test.body)
+			if rec.Code != test.status {
+				t.Fatalf("Expected status %d, got %d: %s", test.status, rec.Code, rec.Body.String())
+			}
+
+			var response struct {
+				Status  string `json:"status"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Status != "error" || response.Code != test.code || response.Message == "" {
+				t.Errorf("Expected an error with code '%s' and a message, got %+v", test.code, response)
+			}
+		})
+	}
+}
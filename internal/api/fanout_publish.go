@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/utils"
+)
+
+// allBrokers is the brokers entry of a publish request that targets every configured broker
+const allBrokers = "*"
+
+// BrokerPublishResult is the outcome of publishing a message to one of several brokers
+type BrokerPublishResult struct {
+	Broker string `json:"broker"`
+	Status string `json:"status"`
+	// ID is the ID of the stored message, empty if the message wasn't stored
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// publishToBrokers publishes a message to every broker of the request concurrently, so a slow broker doesn't
+// hold up the others. A broker failing doesn't fail the request; the outcome is reported per broker.
+func (s *Server) publishToBrokers(w http.ResponseWriter, r *http.Request, req *PublishRequest) {
+	if req.Broker != "" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Only one of broker and brokers may be set")
+		return
+	}
+
+	brokers, ok := s.resolvePublishBrokers(w, req.Brokers)
+	if !ok {
+		return
+	}
+
+	// Start timing for latency measurement
+	startTime := time.Now()
+
+	// Confine tenants to their own namespace
+	topic := utils.ApplyNamespace(s.tenantNamespace(r), req.Topic)
+
+	results := make([]BrokerPublishResult, len(brokers))
+	var wg sync.WaitGroup
+	for i, broker := range brokers {
+		wg.Add(1)
+		go func(i int, broker string) {
+			defer wg.Done()
+			results[i] = s.publishToBroker(r, broker, topic, req)
+		}(i, broker)
+	}
+	wg.Wait()
+
+	// Record latency once for the whole request
+	if s.metrics != nil {
+		s.metrics.AddPublishLatency(time.Since(startTime))
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != "success" {
+			failed++
+		}
+	}
+
+	status := "success"
+	switch {
+	case failed == len(results):
+		status = "error"
+	case failed > 0:
+		status = "partial"
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  status,
+		"message": fmt.Sprintf("Published to %d of %d brokers", len(results)-failed, len(results)),
+		"results": results,
+	})
+}
+
+// publishToBroker publishes a message to a single broker of a multi-broker publish, counting it in the broker's metrics
+func (s *Server) publishToBroker(r *http.Request, broker, topic string, req *PublishRequest) BrokerPublishResult {
+	result := BrokerPublishResult{Broker: broker, Status: "success"}
+
+	err := func() error {
+		client, err := s.mqttManager.GetClient(broker)
+		if err != nil {
+			return err
+		}
+		if !client.IsConnected() {
+			if err := client.Connect(); err != nil {
+				return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+			}
+		}
+
+		published, err := client.PublishMessageContext(r.Context(), topic, s.publishQoS(req.QoS), s.publishRetained(req.Retained), req.Payload)
+		if published != nil {
+			result.ID = published.ID
+		}
+		return err
+	}()
+
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		if s.metrics != nil {
+			s.metrics.IncrementFailedPublishesForBroker(broker)
+		}
+		return result
+	}
+
+	if s.metrics != nil {
+		s.metrics.IncrementPublishedMessagesForTopic(topic, broker)
+	}
+	return result
+}
+
+// resolvePublishBrokers returns the distinct brokers of a publish request in order, expanding "*" to every
+// configured broker. Unknown brokers are rejected up front, so a typo isn't mistaken for a broker failing.
+func (s *Server) resolvePublishBrokers(w http.ResponseWriter, requested []string) ([]string, bool) {
+	if s.config == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Configuration not initialized")
+		return nil, false
+	}
+
+	if len(requested) == 1 && requested[0] == allBrokers {
+		brokers := make([]string, 0, len(s.config.Brokers))
+		for name := range s.config.Brokers {
+			brokers = append(brokers, name)
+		}
+		sort.Strings(brokers)
+		return brokers, true
+	}
+
+	brokers := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, broker := range requested {
+		if broker == allBrokers {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "\"*\" can't be combined with other brokers")
+			return nil, false
+		}
+		if _, ok := s.config.Brokers[broker]; !ok {
+			s.writeError(w, http.StatusBadRequest, ErrCodeUnknownBroker, fmt.Sprintf("Unknown broker: %s", broker))
+			return nil, false
+		}
+		if !seen[broker] {
+			seen[broker] = true
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers, true
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/metrics"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// decodeFanoutResponse decodes the response of a multi-broker publish
+func decodeFanoutResponse(t *testing.T, body []byte) (string, []BrokerPublishResult) {
+	t.Helper()
+
+	var response struct {
+		Status  string                `json:"status"`
+		Results []BrokerPublishResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response.Status, response.Results
+}
+
+func TestPublishToSeveralBrokers(t *testing.T) {
+	primary := mqtttest.Start(t, packets.Accepted)
+	backup := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, primary, "key")
+	s.config.Brokers["backup"] = backup.BrokerConfig("backup")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: "alerts/fire", Payload: "evacuate", Brokers: []string{"test", "backup", "test"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	status, results := decodeFanoutResponse(t, rec.Body.Bytes())
+	if status != "success" || len(results) != 2 {
+		t.Fatalf("Expected a successful publish to each broker once, got '%s' with %+v", status, results)
+	}
+	if results[0].Broker != "test" || results[1].Broker != "backup" {
+		t.Errorf("Expected the results in request order, got %+v", results)
+	}
+	for _, result := range results {
+		if result.Status != "success" {
+			t.Errorf("Expected the publish to every broker to succeed, got %+v", result)
+		}
+	}
+
+	for _, broker := range []*mqtttest.Broker{primary, backup} {
+		if published := broker.WaitForPublished(t, 1); published[0].TopicName != "alerts/fire" {
+			t.Errorf("Expected the message on 'alerts/fire', got '%s'", published[0].TopicName)
+		}
+	}
+
+	brokerCounts := s.metrics.GetMetrics()["brokers"].(map[string]metrics.MessageCounts)
+	if brokerCounts["test"].Published != 1 || brokerCounts["backup"].Published != 1 {
+		t.Errorf("Expected one publish counted for each broker, got %+v", brokerCounts)
+	}
+}
+
+func TestPublishToAllBrokersReportsPartialFailure(t *testing.T) {
+	primary := mqtttest.Start(t, packets.Accepted)
+	refusing := mqtttest.Start(t, packets.ErrRefusedNotAuthorised)
+	s := newTestServer(t, primary, "key")
+	s.config.Brokers["refusing"] = refusing.BrokerConfig("refusing")
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: "alerts/fire", Payload: "evacuate", Brokers: []string{"*"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 despite the failing broker, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	status, results := decodeFanoutResponse(t, rec.Body.Bytes())
+	if status != "partial" || len(results) != 2 {
+		t.Fatalf("Expected a partial publish to both brokers, got '%s' with %+v", status, results)
+	}
+	if results[0].Broker != "refusing" || results[0].Status != "error" || results[0].Error == "" {
+		t.Errorf("Expected the refusing broker to report an error, got %+v", results[0])
+	}
+	if results[1].Broker != "test" || results[1].Status != "success" {
+		t.Errorf("Expected the publish to the working broker to succeed, got %+v", results[1])
+	}
+
+	brokerCounts := s.metrics.GetMetrics()["brokers"].(map[string]metrics.MessageCounts)
+	if brokerCounts["refusing"].Failed != 1 || brokerCounts["test"].Published != 1 {
+		t.Errorf("Expected the failure and the publish counted per broker, got %+v", brokerCounts)
+	}
+}
+
+func TestPublishToSeveralBrokersRejectsInvalidBrokers(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key")
+
+	tests := []struct {
+		name string
+		req  PublishRequest
+		code string
+	}{
+		{"unknown broker", PublishRequest{Topic: "alerts/fire", Payload: 1, Brokers: []string{"test", "missing"}}, ErrCodeUnknownBroker},
+		{"wildcard with other brokers", PublishRequest{Topic: "alerts/fire", Payload: 1, Brokers: []string{"*", "test"}}, ErrCodeInvalidRequest},
+		{"broker and brokers", PublishRequest{Topic: "alerts/fire", Payload: 1, Broker: "test", Brokers: []string{"test"}}, ErrCodeInvalidRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(t, s, http.MethodPost, "/publish", "key", test.req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var response struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != test.code {
+				t.Errorf("Expected code '%s', got '%s'", test.code, response.Code)
+			}
+		})
+	}
+}
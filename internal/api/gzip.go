@@ -0,0 +1,144 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest response body, in bytes, worth compressing
+const gzipMinSize = 1024
+
+// gzipMiddleware compresses responses with gzip for clients that accept it.
+// Responses are buffered until gzipMinSize bytes have been written, so small responses are sent
+// uncompressed. Streaming requests are passed through untouched so they are never held back.
+func (s *Server) gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || isStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The response depends on Accept-Encoding whether or not it ends up compressed
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding header allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+
+		// A quality of zero means the client refuses gzip
+		quality := strings.TrimPrefix(strings.TrimSpace(params), "q=")
+		if q, err := strconv.ParseFloat(quality, 64); err == nil && q == 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response to decide whether to compress it,
+// then writes the status code and body to the underlying ResponseWriter
+type gzipWriter struct {
+	http.ResponseWriter
+	statusCode int
+	buffer     []byte
+	started    bool
+	gz         *gzip.Writer
+}
+
+// WriteHeader records the status code until the response is started
+func (gw *gzipWriter) WriteHeader(statusCode int) {
+	if !gw.started {
+		gw.statusCode = statusCode
+	}
+}
+
+// Write buffers response data until it is large enough to compress, then compresses it
+func (gw *gzipWriter) Write(data []byte) (int, error) {
+	if gw.started {
+		if gw.gz != nil {
+			return gw.gz.Write(data)
+		}
+		return gw.ResponseWriter.Write(data)
+	}
+
+	gw.buffer = append(gw.buffer, data...)
+	if len(gw.buffer) >= gzipMinSize {
+		if err := gw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush starts the response and flushes everything written so far to the client
+func (gw *gzipWriter) Flush() {
+	if !gw.started {
+		gw.start(len(gw.buffer) > 0)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// Close starts the response if it is still buffered and finishes the gzip stream
+func (gw *gzipWriter) Close() error {
+	if !gw.started {
+		gw.start(len(gw.buffer) >= gzipMinSize)
+	}
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+	return nil
+}
+
+// start writes the status code and the buffered data, compressing the response if requested
+// and the handler hasn't already encoded it
+func (gw *gzipWriter) start(compress bool) error {
+	gw.started = true
+
+	header := gw.ResponseWriter.Header()
+	if compress && header.Get("Content-Encoding") == "" && bodyAllowed(gw.statusCode) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.statusCode)
+
+	buffer := gw.buffer
+	gw.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	_, err := gw.Write(buffer)
+	return err
+}
+
+// bodyAllowed reports whether a response with the given status code may have a body
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+}
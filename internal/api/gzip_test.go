@@ -0,0 +1,80 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/metrics"
+)
+
+func TestGzipCompressesLargeResponses(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	s := &Server{logger: log, metrics: metrics.New(log)}
+
+	body := strings.Repeat("sensors/temperature ", 100)
+	handler := s.metricsMiddleware(s.gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(body))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/messages", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if encoding := rec.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("Expected Content-Encoding 'gzip', got '%s'", encoding)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("Expected Vary 'Accept-Encoding', got '%s'", vary)
+	}
+
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to read gzip body: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	if string(decompressed) != body {
+		t.Error("Expected the decompressed body to match the original")
+	}
+
+	// The metrics middleware must still see the handler's status code
+	if s.metrics.APIErrors != 1 {
+		t.Errorf("Expected 1 API error in metrics, got %d", s.metrics.APIErrors)
+	}
+}
+
+func TestGzipSkipsSmallResponses(t *testing.T) {
+	s := &Server{logger: logger.New(&logger.Config{Level: "error", Output: io.Discard})}
+
+	handler := s.gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if encoding := rec.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Expected no Content-Encoding for a small response, got '%s'", encoding)
+	}
+	if body := rec.Body.String(); body != `{"status":"success"}` {
+		t.Errorf("Expected the body to be sent as is, got '%s'", body)
+	}
+}
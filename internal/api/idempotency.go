@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/database"
+)
+
+const (
+	// idempotencyKeyHeader is the header clients set to make a request safe to retry
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyReplayedHeader tells clients whether a response was replayed from an earlier request
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the maximum length of an idempotency key
+	maxIdempotencyKeyLength = 255
+	// defaultIdempotencyTTL is how long request outcomes are kept when no TTL is configured
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyCacheSize is the number of keys kept in memory when no database is configured
+	idempotencyCacheSize = 10000
+)
+
+// idempotencyStore persists the outcome of requests made with an idempotency key
+type idempotencyStore interface {
+	// get returns the record of a key, or nil if the key is unknown or expired
+	get(ctx context.Context, key string) (*database.IdempotencyRecord, error)
+	// put stores a record, replacing any previous record with the same key
+	put(ctx context.Context, record *database.IdempotencyRecord) error
+}
+
+// databaseIdempotencyStore keeps idempotency records in the database
+type databaseIdempotencyStore struct {
+	db database.Database
+}
+
+func (d *databaseIdempotencyStore) get(ctx context.Context, key string) (*database.IdempotencyRecord, error) {
+	record, err := d.db.GetIdempotencyRecord(ctx, key)
+	if err == database.ErrIdempotencyRecordNotFound {
+		return nil, nil
+	}
+	return record, err
+}
+
+func (d *databaseIdempotencyStore) put(ctx context.Context, record *database.IdempotencyRecord) error {
+	return d.db.StoreIdempotencyRecord(ctx, record)
+}
+
+// memoryIdempotencyStore keeps the most recently used idempotency records in memory
+type memoryIdempotencyStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newMemoryIdempotencyStore(capacity int) *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (m *memoryIdempotencyStore) get(ctx context.Context, key string) (*database.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	record := element.Value.(*database.IdempotencyRecord)
+	if !time.Now().Before(record.ExpiresAt) {
+		m.order.Remove(element)
+		delete(m.entries, key)
+		return nil, nil
+	}
+
+	m.order.MoveToFront(element)
+	return record, nil
+}
+
+func (m *memoryIdempotencyStore) put(ctx context.Context, record *database.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.entries[record.Key]; ok {
+		element.Value = record
+		m.order.MoveToFront(element)
+		return nil
+	}
+
+	m.entries[record.Key] = m.order.PushFront(record)
+
+	// Evict the least recently used record
+	if m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*database.IdempotencyRecord).Key)
+	}
+	return nil
+}
+
+// idempotency deduplicates requests made with the same idempotency key
+type idempotency struct {
+	store idempotencyStore
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// newIdempotency creates an idempotency tracker, keeping records in the database when there is one
+func newIdempotency(db database.Database, ttl time.Duration) *idempotency {
+	var store idempotencyStore = newMemoryIdempotencyStore(idempotencyCacheSize)
+	if db != nil {
+		store = &databaseIdempotencyStore{db: db}
+	}
+
+	return &idempotency{
+		store:    store,
+		ttl:      ttl,
+		inFlight: make(map[string]bool),
+	}
+}
+
+// claim marks a key as being processed, returning false if another request holds it
+func (i *idempotency) claim(key string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.inFlight[key] {
+		return false
+	}
+	i.inFlight[key] = true
+	return true
+}
+
+// release marks a key as no longer being processed
+func (i *idempotency) release(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.inFlight, key)
+}
+
+// idempotencyKey returns the idempotency key of a request, preferring the header over the body field
+func idempotencyKey(r *http.Request, bodyKey string) string {
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		return key
+	}
+	return bodyKey
+}
+
+// validIdempotencyKey reports whether an idempotency key is safe to store and log
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, c := range key {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash identifies a decoded request, so a reused key can be matched against the request it was first used with
+func requestHash(req interface{}) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// withIdempotency runs handle at most once per idempotency key and caller. Repeats of a successful request
+// replay its response, repeats with a different request or while the first is still running are answered
+// with 409 Conflict, and failed requests may be retried with the same key.
+func (s *Server) withIdempotency(w http.ResponseWriter, r *http.Request, key string, req interface{}, handle func(http.ResponseWriter)) {
+	if !validIdempotencyKey(key) {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid idempotency key")
+		return
+	}
+
+	hash, err := requestHash(req)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	// Keys are scoped to the caller so clients can't replay each other's responses
+	scopedKey := auth.CallerFromContext(r.Context()) + " " + key
+	if !s.idempotency.claim(scopedKey) {
+		s.writeError(w, http.StatusConflict, ErrCodeConflict, "A request with this idempotency key is already in progress")
+		return
+	}
+	defer s.idempotency.release(scopedKey)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	record, err := s.idempotency.store.get(ctx, scopedKey)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, "Failed to check idempotency key")
+		return
+	}
+	if record != nil {
+		if record.RequestHash != hash {
+			s.writeError(w, http.StatusConflict, ErrCodeConflict, "Idempotency key was already used with a different request")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(idempotencyReplayedHeader, "true")
+		w.WriteHeader(record.StatusCode)
+		w.Write([]byte(record.Response))
+		return
+	}
+
+	w.Header().Set(idempotencyReplayedHeader, "false")
+	recorder := &idempotencyRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+	handle(recorder)
+
+	// Only successful outcomes are kept, so failed requests can be retried
+	if recorder.statusCode < 200 || recorder.statusCode >= 300 {
+		return
+	}
+
+	now := time.Now()
+	record = &database.IdempotencyRecord{
+		Key:         scopedKey,
+		RequestHash: hash,
+		StatusCode:  recorder.statusCode,
+		Response:    recorder.body.String(),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.idempotency.ttl),
+	}
+
+	storeCtx, storeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer storeCancel()
+
+	if err := s.idempotency.store.put(storeCtx, record); err != nil {
+		s.logger.WithError(err).Error("Failed to store idempotency record")
+	}
+}
+
+// idempotencyRecorder captures the response written by a handler while passing it through
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader captures the status code and calls the underlying ResponseWriter's WriteHeader
+func (ir *idempotencyRecorder) WriteHeader(statusCode int) {
+	ir.statusCode = statusCode
+	ir.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write captures the response body and writes it to the underlying ResponseWriter
+func (ir *idempotencyRecorder) Write(data []byte) (int, error) {
+	ir.body.Write(data)
+	return ir.ResponseWriter.Write(data)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// publishWithKey sends a publish request carrying an idempotency key
+func publishWithKey(t *testing.T, s *Server, apiKey, idempotencyKey string, req PublishRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/publish", bytes.NewReader(data))
+	r.Header.Set("X-API-Key", apiKey)
+	r.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestPublishWithIdempotencyKeyIsNotRepeated(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key-a", "key-b")
+
+	req := PublishRequest{Topic: "data", Payload: "hello"}
+
+	rec := publishWithKey(t, s, "key-a", "order-1", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if replayed := rec.Header().Get(idempotencyReplayedHeader); replayed != "false" {
+		t.Errorf("Expected the first response not to be replayed, got '%s'", replayed)
+	}
+	first := rec.Body.String()
+
+	rec = publishWithKey(t, s, "key-a", "order-1", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the retry to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if replayed := rec.Header().Get(idempotencyReplayedHeader); replayed != "true" {
+		t.Errorf("Expected the retry to be replayed, got '%s'", replayed)
+	}
+	if rec.Body.String() != first {
+		t.Errorf("Expected the original response %q, got %q", first, rec.Body.String())
+	}
+
+	rec = publishWithKey(t, s, "key-a", "order-1", PublishRequest{Topic: "data", Payload: "changed"})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when reusing the key with a different request, got %d", rec.Code)
+	}
+
+	// Keys are scoped per API key, so another client's identical key publishes again
+	rec = publishWithKey(t, s, "key-b", "order-1", req)
+	if rec.Code != http.StatusOK || rec.Header().Get(idempotencyReplayedHeader) != "false" {
+		t.Errorf("Expected another API key to publish with the same idempotency key, got %d", rec.Code)
+	}
+
+	broker.WaitForPublished(t, 2)
+	time.Sleep(100 * time.Millisecond)
+	if published := len(broker.Published()); published != 2 {
+		t.Errorf("Expected 2 messages to be published, got %d", published)
+	}
+}
+
+func TestMemoryIdempotencyStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := newMemoryIdempotencyStore(2)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	for _, key := range []string{"a", "b"} {
+		store.put(ctx, &database.IdempotencyRecord{Key: key, ExpiresAt: expiresAt})
+	}
+	store.get(ctx, "a")
+	store.put(ctx, &database.IdempotencyRecord{Key: "c", ExpiresAt: expiresAt})
+
+	if record, _ := store.get(ctx, "b"); record != nil {
+		t.Error("Expected the least recently used key to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if record, _ := store.get(ctx, key); record == nil {
+			t.Errorf("Expected key '%s' to be kept", key)
+		}
+	}
+
+	store.put(ctx, &database.IdempotencyRecord{Key: "expired", ExpiresAt: time.Now().Add(-time.Second)})
+	if record, _ := store.get(ctx, "expired"); record != nil {
+		t.Error("Expected an expired key to be ignored")
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ipFilterMiddleware rejects requests from source IPs outside the allowlist with 403 Forbidden.
+// It runs before authentication, so disallowed sources can't probe for valid credentials.
+func (s *Server) ipFilterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, ok := clientIP(r, s.config.TrustedProxies)
+		if ok && prefixesContain(s.config.IPAllowlist, ip) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.logger.WithFields(map[string]interface{}{
+			"path":        r.URL.Path,
+			"remote_addr": r.RemoteAddr,
+			"client_ip":   ip.String(),
+		}).Warn("Rejected request from a source IP outside the allowlist")
+		s.writeError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden: source IP not allowed")
+	})
+}
+
+// clientIP resolves the IP address of the client that made a request. When the peer is a trusted proxy,
+// X-Forwarded-For is walked from the right, skipping trusted proxies, to the first address they didn't
+// add themselves; the header is ignored for any other peer, so clients can't spoof their address.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip = ip.Unmap().WithZone("")
+
+	if !prefixesContain(trustedProxies, ip) {
+		return ip, true
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// The proxy in front of a malformed entry is the last address that can be trusted
+			break
+		}
+		ip = hop.Unmap()
+		if !prefixesContain(trustedProxies, ip) {
+			break
+		}
+	}
+	return ip, true
+}
+
+// prefixesContain reports whether an IP address is in any of the networks
+func prefixesContain(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{"direct", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"direct IPv6", "[2001:db8::1]:51234", nil, "2001:db8::1"},
+		{"spoofed header from an untrusted peer", "203.0.113.7:51234", []string{"192.168.1.10"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:443", []string{"192.168.1.10"}, "192.168.1.10"},
+		{"chain of trusted proxies", "10.0.0.2:443", []string{"192.168.1.10, 10.0.0.3"}, "192.168.1.10"},
+		{"spoofed entry before the real client", "10.0.0.2:443", []string{"127.0.0.1, 192.168.1.10"}, "192.168.1.10"},
+		{"several headers", "10.0.0.2:443", []string{"192.168.1.10", "10.0.0.3"}, "192.168.1.10"},
+		{"trusted proxy without header", "10.0.0.2:443", nil, "10.0.0.2"},
+		{"malformed entry", "10.0.0.2:443", []string{"192.168.1.10, bogus, 10.0.0.3"}, "10.0.0.3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/status", nil)
+			req.RemoteAddr = test.remoteAddr
+			for _, header := range test.forwardedFor {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+
+			ip, ok := clientIP(req, trustedProxies)
+			if !ok {
+				t.Fatal("Expected the client IP to be resolved")
+			}
+			if ip.String() != test.expected {
+				t.Errorf("Expected client IP %s, got %s", test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestIPAllowlist(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	cfg := &config.Config{
+		IPAllowlist:    []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.2/32")},
+	}
+	s := NewServer(nil, log, nil, nil, nil, cfg, ":0", HTTPTimeouts{})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expected     int
+	}{
+		{"allowed source", "192.168.1.10:51234", "", http.StatusOK},
+		{"disallowed source", "203.0.113.7:51234", "", http.StatusForbidden},
+		{"allowed source behind a trusted proxy", "10.0.0.2:443", "192.168.1.10", http.StatusOK},
+		{"disallowed source behind a trusted proxy", "10.0.0.2:443", "203.0.113.7", http.StatusForbidden},
+		{"spoofed header from a disallowed source", "203.0.113.7:51234", "192.168.1.10", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.expected {
+				t.Errorf("Expected status %d, got %d", test.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestEmptyIPAllowlistAllowsEverything(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	s := NewServer(nil, log, nil, nil, nil, &config.Config{}, ":0", HTTPTimeouts{})
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
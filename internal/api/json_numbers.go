@@ -0,0 +1,28 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// newPayloadDecoder returns a decoder for request bodies carrying payloads. Numbers are decoded as
+// json.Number rather than float64, so large integers such as 64-bit device IDs are republished exactly.
+func newPayloadDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder
+}
+
+// unmarshalPayload parses a JSON payload like json.Unmarshal, but keeps numbers as json.Number
+func unmarshalPayload(data []byte, v interface{}) error {
+	decoder := newPayloadDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
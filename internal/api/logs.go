@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logEntries parses JSON log lines into entries. Lines that aren't JSON objects are returned
+// as an entry with the line in a "_raw" field. If minLevel is set, only entries at that level
+// or more severe are returned, which excludes unparseable lines.
+func logEntries(lines []string, minLevel *logrus.Level) []map[string]interface{} {
+	entries := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry == nil {
+			if minLevel == nil {
+				entries = append(entries, map[string]interface{}{"_raw": line})
+			}
+			continue
+		}
+
+		if minLevel != nil {
+			levelName, _ := entry["level"].(string)
+			level, err := logrus.ParseLevel(levelName)
+			if err != nil || level > *minLevel {
+				continue
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// logLines splits log data into its non-empty lines
+func logLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// tailLogLines returns the last n lines of log data
+func tailLogLines(data []byte, n int) []byte {
+	lines := logLines(data)
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// isJSONLogger reports whether the logger writes JSON formatted entries
+func (s *Server) isJSONLogger() bool {
+	_, ok := s.logger.Formatter.(*logrus.JSONFormatter)
+	return ok
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"MQTTmicroService/internal/logger"
+)
+
+const testJSONLog = `{"level":"info","msg":"Starting MQTT microservice","time":"2023-04-27 16:33:15"}
+{"level":"error","msg":"MQTT connection lost","time":"2023-04-27 16:33:20"}
+not a json line
+{"level":"warning","msg":"MQTT reconnecting","time":"2023-04-27 16:33:21"}
+{"level":"error","msg":"Failed to publish message","time":"2023-04-27 16:33:25"}
+`
+
+func TestLogsJSONFormat(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("mqtt-service.log", []byte(testJSONLog), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	s := &Server{logger: logger.New(&logger.Config{Level: "error", Format: "json", Output: io.Discard})}
+
+	getEntries := func(query string) []map[string]interface{} {
+		rec := httptest.NewRecorder()
+		s.handleLogs(rec, httptest.NewRequest(http.MethodGet, "/logs?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for '%s', got %d: %s", http.StatusOK, query, rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Entries []map[string]interface{} `json:"entries"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Entries
+	}
+
+	entries := getEntries("format=json")
+	if len(entries) != 5 {
+		t.Fatalf("Expected 5 entries, got %d", len(entries))
+	}
+	if raw := entries[2]["_raw"]; raw != "not a json line" {
+		t.Errorf("Expected unparseable line in '_raw', got %v", raw)
+	}
+
+	entries = getEntries("format=json&level=error&lines=1")
+	if len(entries) != 1 || entries[0]["msg"] != "Failed to publish message" {
+		t.Errorf("Expected only the last error entry, got %v", entries)
+	}
+
+	entries = getEntries("format=json&level=warning")
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 entries at warning level or above, got %d", len(entries))
+	}
+}
+
+func TestLogsJSONFormatRequiresJSONLogger(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("mqtt-service.log", []byte("time=\"2023-04-27 16:33:15\" level=info msg=\"Starting\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	s := &Server{logger: logger.New(&logger.Config{Level: "error", Format: "text", Output: io.Discard})}
+
+	rec := httptest.NewRecorder()
+	s.handleLogs(rec, httptest.NewRequest(http.MethodGet, "/logs?format=json", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleLogs(rec, httptest.NewRequest(http.MethodGet, "/logs", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected text output to keep working, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/utils"
+)
+
+// exportFlushInterval is the number of messages written between flushes of an export
+const exportFlushInterval = 100
+
+// handleExportMessages handles requests to stream every stored message as newline-delimited JSON, one message per
+// line, optionally filtered by confirmation, timestamp, and topic filter
+func (s *Server) handleExportMessages(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Get query parameters
+	var filter database.MessageFilter
+	query := r.URL.Query()
+	if confirmedStr := query.Get("confirmed"); confirmedStr != "" {
+		confirmed, err := strconv.ParseBool(confirmedStr)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid confirmed parameter")
+			return
+		}
+		filter.Confirmed = &confirmed
+	}
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid since parameter, expected an RFC 3339 time")
+			return
+		}
+		filter.Since = since
+	}
+	topic := query.Get("topic")
+	if topic != "" {
+		if err := utils.ValidateFilter(topic); err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic filter: %v", err))
+			return
+		}
+	}
+
+	// Restrict tenants to their own namespace
+	namespace := s.tenantNamespace(r)
+	if topic == "" && namespace != "" {
+		topic = "#"
+	}
+	if topic != "" {
+		filter.Topic = utils.ApplyNamespace(namespace, topic)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming not supported")
+		return
+	}
+
+	// The status is sent with the first message, so errors before it can still be reported
+	started := false
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	err := s.db.ExportMessages(r.Context(), filter, func(msg *database.Message) error {
+		tenantMessage(namespace, msg)
+		start()
+		if err := encoder.Encode(msg); err != nil {
+			return err
+		}
+		if count++; count%exportFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		start()
+		flusher.Flush()
+	case !started:
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to export messages: %v", err))
+	default:
+		// Abort the response so the client sees a truncated export instead of a complete one
+		s.logger.WithError(err).WithField("exported", count).Error("Failed to export messages")
+		panic(http.ErrAbortHandler)
+	}
+}
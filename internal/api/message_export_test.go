@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestExportMessagesStreamsNDJSON(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key-a::tenant-a")
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, msg := range []*database.Message{
+		{Topic: "tenant-a/sensors/1/temp", Payload: "21.5"},
+		{Topic: "tenant-a/alerts/door", Payload: "open", Confirmed: true},
+		{Topic: "tenant-b/sensors/1/temp", Payload: "19.0"},
+		{Topic: "tenant-a/sensors/2/temp", Payload: map[string]interface{}{"value": 22}},
+	} {
+		msg.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if err := s.db.StoreMessage(context.Background(), msg); err != nil {
+			t.Fatalf("Failed to store message: %v", err)
+		}
+	}
+
+	tests := map[string][]string{
+		"/messages/export":                 {"sensors/1/temp", "alerts/door", "sensors/2/temp"},
+		"/messages/export?confirmed=false": {"sensors/1/temp", "sensors/2/temp"},
+		"/messages/export?topic=sensors/%2B/temp&since=2024-01-01T00:01:00Z": {"sensors/2/temp"},
+		"/messages/export?since=2030-01-01T00:00:00Z":                        nil,
+	}
+	for path, expected := range tests {
+		rec := doRequest(t, s, http.MethodGet, path, "key-a", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected %s to succeed, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+			t.Errorf("Expected Content-Type application/x-ndjson for %s, got %s", path, contentType)
+		}
+
+		// Each line is one message, oldest first, with the tenant's namespace stripped
+		var topics []string
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			var msg database.Message
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				t.Fatalf("Failed to decode line %q of %s: %v", scanner.Text(), path, err)
+			}
+			topics = append(topics, msg.Topic)
+		}
+		if len(topics) != len(expected) {
+			t.Errorf("Expected topics %v from %s, got %v", expected, path, topics)
+			continue
+		}
+		for i := range topics {
+			if topics[i] != expected[i] {
+				t.Errorf("Expected topics %v from %s, got %v", expected, path, topics)
+				break
+			}
+		}
+	}
+
+	for _, path := range []string{"/messages/export?since=yesterday", "/messages/export?confirmed=maybe", "/messages/export?topic=sensors/%23/temp"} {
+		if rec := doRequest(t, s, http.MethodGet, path, "key-a", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/utils"
+)
+
+const (
+	// importBatchSize is the number of messages stored at a time by an import
+	importBatchSize = 500
+	// maxImportLineBytes is the maximum size of a single message of an import
+	maxImportLineBytes = 16 << 20
+	// maxImportErrors is the number of failed records described in the response of an import
+	maxImportErrors = 100
+)
+
+// MessageImportResponse is the outcome of an import of messages
+type MessageImportResponse struct {
+	// Status is success when no record failed, partial when some failed, and error when all failed
+	Status   string `json:"status"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+	Failed   int    `json:"failed"`
+	// Errors describes the first failed records
+	Errors []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError describes a record of an import that failed
+type ImportError struct {
+	// Line is the line of the record in the request body, starting at 1
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importRecord is a message of an import, with its payload kept raw until its content type is known
+type importRecord struct {
+	database.Message
+	Payload json.RawMessage `json:"payload"`
+}
+
+// messageImport accumulates the records of an import and stores them in batches
+type messageImport struct {
+	db       database.Database
+	replace  bool
+	response MessageImportResponse
+	batch    []*database.Message
+	// lines holds the line of each message of the batch
+	lines []int
+}
+
+// handleImportMessages handles requests to store the messages of a newline-delimited JSON body, such as an export
+// of GET /messages/export. Messages already stored are skipped or replaced, depending on the mode parameter.
+func (s *Server) handleImportMessages(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Message IDs are shared by all tenants, so imports are reserved for unrestricted callers
+	if s.tenantNamespace(r) != "" {
+		s.writeError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden: importing messages is not available to tenants")
+		return
+	}
+
+	replace := false
+	switch r.URL.Query().Get("mode") {
+	case "", "skip":
+	case "upsert":
+		replace = true
+	default:
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid mode parameter, expected skip or upsert")
+		return
+	}
+
+	// Read the body a line at a time, so imports of any size use little memory
+	imp := &messageImport{db: s.db, replace: replace}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		msg, err := importMessage(data)
+		if err != nil {
+			imp.fail(line, err)
+			continue
+		}
+		imp.add(r.Context(), line, msg)
+	}
+	imp.flush(r.Context())
+
+	if err := scanner.Err(); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+			fmt.Sprintf("Failed to read line %d of the request body after importing %d messages: %v", line+1, imp.response.Imported, err))
+		return
+	}
+
+	response := imp.response
+	switch {
+	case response.Failed > 0 && response.Imported == 0 && response.Skipped == 0:
+		response.Status = "error"
+	case response.Failed > 0:
+		response.Status = "partial"
+	default:
+		response.Status = "success"
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// importMessage decodes and validates a record of an import
+func importMessage(data []byte) (*database.Message, error) {
+	var record importRecord
+	if err := unmarshalPayload(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	msg := &record.Message
+	if msg.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	if err := utils.ValidatePublishTopic(msg.Topic); err != nil {
+		return nil, fmt.Errorf("invalid topic: %w", err)
+	}
+	if msg.QoS > 2 {
+		return nil, fmt.Errorf("invalid qos: %d", msg.QoS)
+	}
+	switch msg.Status {
+	case "", database.MessageStatusPending, database.MessageStatusDelivered, database.MessageStatusFailed:
+	default:
+		return nil, fmt.Errorf("invalid status: %s", msg.Status)
+	}
+	if len(record.Payload) == 0 {
+		return nil, errors.New("payload is required")
+	}
+
+	// Restore the payload the way GET /messages returned it: text as a string, binary data base64-encoded,
+	// and anything else as JSON
+	switch msg.ContentType {
+	case database.ContentTypeText:
+		var text string
+		if err := json.Unmarshal(record.Payload, &text); err != nil {
+			return nil, errors.New("text payloads must be strings")
+		}
+		msg.Payload = text
+	case database.ContentTypeBinary:
+		var data []byte
+		if err := json.Unmarshal(record.Payload, &data); err != nil {
+			return nil, errors.New("binary payloads must be base64-encoded strings")
+		}
+		msg.Payload = data
+	case "", database.ContentTypeJSON:
+		msg.Payload = record.Payload
+	default:
+		return nil, fmt.Errorf("invalid content_type: %s", msg.ContentType)
+	}
+
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return msg, nil
+}
+
+// add queues a message, storing the batch once it is full
+func (imp *messageImport) add(ctx context.Context, line int, msg *database.Message) {
+	imp.batch = append(imp.batch, msg)
+	imp.lines = append(imp.lines, line)
+	if len(imp.batch) >= importBatchSize {
+		imp.flush(ctx)
+	}
+}
+
+// flush stores the queued messages
+func (imp *messageImport) flush(ctx context.Context) {
+	if len(imp.batch) == 0 {
+		return
+	}
+
+	skipped, err := imp.db.ImportMessages(ctx, imp.batch, imp.replace)
+	var batchErr *database.BatchError
+	switch {
+	case errors.As(err, &batchErr):
+		for i, line := range imp.lines {
+			if failure, ok := batchErr.Failed[i]; ok {
+				imp.fail(line, failure)
+			}
+		}
+		imp.response.Imported += len(imp.batch) - len(batchErr.Failed) - skipped
+		imp.response.Skipped += skipped
+	case err != nil:
+		// The whole batch was rolled back
+		for _, line := range imp.lines {
+			imp.fail(line, err)
+		}
+	default:
+		imp.response.Imported += len(imp.batch) - skipped
+		imp.response.Skipped += skipped
+	}
+
+	imp.batch = imp.batch[:0]
+	imp.lines = imp.lines[:0]
+}
+
+// fail records a failed record
+func (imp *messageImport) fail(line int, err error) {
+	imp.response.Failed++
+	if len(imp.response.Errors) < maxImportErrors {
+		imp.response.Errors = append(imp.response.Errors, ImportError{Line: line, Error: err.Error()})
+	}
+}
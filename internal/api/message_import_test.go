@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// importMessages posts an NDJSON body to /messages/import and decodes the response
+func importMessages(t *testing.T, s *Server, query, apiKey string, body []byte) (int, MessageImportResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/messages/import"+query, bytes.NewReader(body))
+	req.Header.Set("X-API-Key", apiKey)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var response MessageImportResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return rec.Code, response
+}
+
+func TestImportMessagesRestoresAnExport(t *testing.T) {
+	source := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key")
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, msg := range []*database.Message{
+		{ID: "1", Topic: "sensors/1/temp", Payload: json.RawMessage(`{"id":9007199254740993}`), QoS: 1},
+		{ID: "2", Topic: "sensors/1/name", Payload: "kitchen", Confirmed: true},
+		{ID: "3", Topic: "cameras/1/frame", Payload: []byte{0xff, 0xd8, 0xff}, Retained: true},
+	} {
+		msg.Timestamp = timestamp
+		if err := source.db.StoreMessage(context.Background(), msg); err != nil {
+			t.Fatalf("Failed to store message: %v", err)
+		}
+	}
+
+	rec := doRequest(t, source, http.MethodGet, "/messages/export", "key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the export to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	export := rec.Body.Bytes()
+
+	target := newTestServer(t, mqtttest.Start(t, packets.Accepted), "key", "tenant-key::tenant-a")
+	code, response := importMessages(t, target, "", "key", export)
+	if code != http.StatusOK || response.Status != "success" || response.Imported != 3 {
+		t.Fatalf("Expected 3 imported messages, got %d: %+v", code, response)
+	}
+
+	// The messages read back the same from the new deployment
+	for _, id := range []string{"1", "2", "3"} {
+		original, _ := source.db.GetMessageByID(context.Background(), id)
+		imported, err := target.db.GetMessageByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Failed to get imported message %s: %v", id, err)
+		}
+		if !reflect.DeepEqual(imported, original) {
+			t.Errorf("Expected imported message %+v, got %+v", original, imported)
+		}
+	}
+
+	// Messages already stored are skipped by default and replaced in upsert mode
+	if _, response := importMessages(t, target, "?mode=skip", "key", export); response.Imported != 0 || response.Skipped != 3 {
+		t.Errorf("Expected 3 skipped messages, got %+v", response)
+	}
+	changed := bytes.Replace(export, []byte(`"kitchen"`), []byte(`"garage"`), 1)
+	if _, response := importMessages(t, target, "?mode=upsert", "key", changed); response.Imported != 3 || response.Skipped != 0 {
+		t.Errorf("Expected 3 imported messages, got %+v", response)
+	}
+	if msg, _ := target.db.GetMessageByID(context.Background(), "2"); msg.Payload != "garage" {
+		t.Errorf("Expected the upsert to replace the payload, got %v", msg.Payload)
+	}
+
+	// Invalid records fail on their own
+	body := strings.Join([]string{
+		`{"id": "4", "topic": "sensors/2/temp", "payload": 21.5}`,
+		`not json`,
+		`{"topic": "sensors/2/temp", "payload": 21.5}`,
+		``,
+		`{"id": "5", "topic": "sensors/+/temp", "payload": 21.5}`,
+		`{"id": "6", "topic": "sensors/2/temp", "payload": 21.5, "qos": 3}`,
+	}, "\n")
+	code, response = importMessages(t, target, "", "key", []byte(body))
+	if code != http.StatusOK || response.Status != "partial" || response.Imported != 1 || response.Failed != 4 {
+		t.Fatalf("Expected 1 imported and 4 failed messages, got %d: %+v", code, response)
+	}
+	lines := make([]int, len(response.Errors))
+	for i, importErr := range response.Errors {
+		lines[i] = importErr.Line
+	}
+	if !reflect.DeepEqual(lines, []int{2, 3, 5, 6}) {
+		t.Errorf("Expected errors for lines 2, 3, 5, and 6, got %+v", response.Errors)
+	}
+
+	if code, _ := importMessages(t, target, "?mode=merge", "key", export); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid mode, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := importMessages(t, target, "", "tenant-key", export); code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a tenant, got %d", http.StatusForbidden, code)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultMetricsStreamInterval is how often metrics are streamed when no interval is requested
+	defaultMetricsStreamInterval = 5 * time.Second
+	// minMetricsStreamInterval is the shortest interval a client may request
+	minMetricsStreamInterval = time.Second
+)
+
+// handleMetricsStream handles requests to stream metrics snapshots as Server-Sent Events
+func (s *Server) handleMetricsStream(w http.ResponseWriter, r *http.Request) {
+	if s.metrics == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Metrics collector not initialized")
+		return
+	}
+
+	// Get the interval in seconds, capped to the minimum
+	interval := defaultMetricsStreamInterval
+	if intervalStr := r.URL.Query().Get("interval"); intervalStr != "" {
+		seconds, err := strconv.Atoi(intervalStr)
+		if err != nil || seconds <= 0 {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid interval parameter")
+			return
+		}
+		interval = time.Duration(seconds) * time.Second
+		if interval < minMetricsStreamInterval {
+			interval = minMetricsStreamInterval
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		data, err := json.Marshal(s.metrics.GetMetrics())
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to encode metrics")
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
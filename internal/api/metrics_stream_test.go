@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestMetricsStreamEmitsSnapshots(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/metrics/stream?interval=1", nil)
+	req.Header.Set("X-API-Key", "key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected Content-Type 'text/event-stream', got '%s'", contentType)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	events := 0
+	for events < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var snapshot map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &snapshot); err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		if _, ok := snapshot["messages"]; !ok {
+			t.Errorf("Expected the event to contain a metrics snapshot, got %v", snapshot)
+		}
+		events++
+	}
+	if events != 2 {
+		t.Fatalf("Expected 2 events, got %d (%v)", events, scanner.Err())
+	}
+}
+
+func TestMetricsStreamRejectsInvalidInterval(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	rec := doRequest(t, s, http.MethodGet, "/metrics/stream?interval=soon", "key", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid interval, got %d", rec.Code)
+	}
+}
+
+func TestMetricsStreamOutlivesServerTimeouts(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	// The stream's second event is sent well after both timeouts expired
+	server := httptest.NewUnstartedServer(s.router)
+	server.Config.ReadTimeout = 200 * time.Millisecond
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/metrics/stream?interval=1", nil)
+	req.Header.Set("X-API-Key", "key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	events := 0
+	for events < 2 && scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data: ") {
+			events++
+		}
+	}
+	if events != 2 {
+		t.Fatalf("Expected 2 events despite the server timeouts, got %d (%v)", events, scanner.Err())
+	}
+}
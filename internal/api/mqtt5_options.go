@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// mqtt5Options are the MQTT 5 publish properties clients may ask for. The broker clients only speak MQTT 3.1 and
+// 3.1.1, since paho.mqtt.golang has no MQTT 5 support, so the options are only decoded to reject requests that set
+// them instead of silently publishing without them.
+type mqtt5Options struct {
+	UserProperties json.RawMessage `json:"user_properties,omitempty"`
+	MessageExpiry  json.RawMessage `json:"message_expiry,omitempty"`
+}
+
+// unsupportedOption returns an error naming the first MQTT 5 option that is set, or nil if none is
+func (o mqtt5Options) unsupportedOption() error {
+	for _, option := range []struct {
+		name  string
+		value json.RawMessage
+	}{
+		{"user_properties", o.UserProperties},
+		{"message_expiry", o.MessageExpiry},
+	} {
+		if len(option.value) > 0 && string(option.value) != "null" {
+			return fmt.Errorf("%s requires MQTT 5, which is not supported; brokers are connected with MQTT 3.1.1 or 3.1", option.name)
+		}
+	}
+	return nil
+}
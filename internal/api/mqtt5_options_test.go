@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestMQTT5OptionsAreRejected(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "admin-key")
+
+	tests := []struct {
+		name   string
+		path   string
+		body   map[string]interface{}
+		option string
+	}{
+		{
+			"publish with user properties", "/publish",
+			map[string]interface{}{"topic": "sensors/temp", "payload": "21.5", "user_properties": map[string]string{"unit": "celsius"}},
+			"user_properties",
+		},
+		{
+			"publish with message expiry", "/publish",
+			map[string]interface{}{"topic": "sensors/temp", "payload": "21.5", "message_expiry": 60},
+			"message_expiry",
+		},
+		{
+			"batch publish", "/publish/batch",
+			map[string]interface{}{"messages": []map[string]interface{}{
+				{"topic": "sensors/temp", "payload": "21.5"},
+				{"topic": "sensors/humidity", "payload": "40", "message_expiry": 60},
+			}},
+			"message_expiry",
+		},
+		{
+			"scheduled publish", "/publish/schedule",
+			map[string]interface{}{"topic": "sensors/temp", "payload": "21.5", "delay_seconds": 60, "user_properties": map[string]string{"unit": "celsius"}},
+			"user_properties",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(t, s, http.MethodPost, test.path, "admin-key", test.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+			}
+
+			var response struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != ErrCodeInvalidRequest || !strings.Contains(response.Message, test.option) || !strings.Contains(response.Message, "MQTT 5") {
+				t.Errorf("Expected %s to be rejected as requiring MQTT 5, got %+v", test.option, response)
+			}
+		})
+	}
+
+	if published := broker.Published(); len(published) != 0 {
+		t.Errorf("Expected nothing to be published, got %d messages", len(published))
+	}
+
+	// Null options are treated as absent
+	rec := doRequest(t, s, http.MethodPost, "/publish", "admin-key", map[string]interface{}{"topic": "sensors/temp", "payload": "21.5", "user_properties": nil})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a publish with null user properties to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
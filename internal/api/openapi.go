@@ -0,0 +1,21 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 description of the HTTP API. It's maintained by hand, and
+// TestOpenAPISpecMatchesRoutes fails when it falls out of sync with the registered routes.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves the OpenAPI description of the API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(openAPISpec); err != nil {
+		s.logger.WithError(err).Error("Failed to write OpenAPI document")
+	}
+}
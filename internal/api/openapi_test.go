@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+	"MQTTmicroService/internal/utils"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/gorilla/mux"
+)
+
+// openAPIDocument is the part of the OpenAPI document checked against the code
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPIDocument(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("Failed to parse OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	// The test server has a database and metrics, so every route is registered
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted))
+	doc := loadOpenAPIDocument(t)
+
+	registered := make(map[string]bool)
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			registered[strings.ToLower(method)+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			documented[method+" "+path] = true
+		}
+	}
+
+	for route := range registered {
+		if !documented[route] {
+			t.Errorf("Route %s is missing from the OpenAPI document", route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			t.Errorf("OpenAPI document describes %s, which isn't a registered route", route)
+		}
+	}
+}
+
+func TestOpenAPISchemasMatchStructs(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	structs := map[string]interface{}{
+		"PublishRequest":          PublishRequest{},
+		"BatchPublishRequest":     BatchPublishRequest{},
+		"BatchPublishMessage":     BatchPublishMessage{},
+		"BatchPublishResult":      BatchPublishResult{},
+		"BrokerPublishResult":     BrokerPublishResult{},
+		"SchedulePublishRequest":  SchedulePublishRequest{},
+		"RetainedClearRequest":    RetainedClearRequest{},
+		"SubscribeRequest":        SubscribeRequest{},
+		"BatchSubscribeRequest":   BatchSubscribeRequest{},
+		"TopicSubscription":       TopicSubscription{},
+		"BatchSubscribeResult":    BatchSubscribeResult{},
+		"StatusResponse":          StatusResponse{},
+		"BrokerStatus":            BrokerStatus{},
+		"BrokerHealth":            BrokerHealth{},
+		"SharedSubscription":      SharedSubscription{},
+		"ConnectionError":         ConnectionError{},
+		"SchemaViolation":         utils.SchemaViolation{},
+		"BrokerInfo":              BrokerInfo{},
+		"ReadinessResponse":       ReadinessResponse{},
+		"ComponentStatus":         ComponentStatus{},
+		"VersionResponse":         VersionResponse{},
+		"SubscriptionInfo":        SubscriptionInfo{},
+		"BrokerSubscriptions":     BrokerSubscriptions{},
+		"RateLimitState":          RateLimitState{},
+		"RateLimitClientState":    RateLimitClientState{},
+		"EffectiveConfig":         EffectiveConfig{},
+		"EffectiveBrokerConfig":   EffectiveBrokerConfig{},
+		"EffectiveAuthConfig":     EffectiveAuthConfig{},
+		"EffectiveAPIKey":         EffectiveAPIKey{},
+		"EffectiveDatabaseConfig": EffectiveDatabaseConfig{},
+		"EffectiveWebhookConfig":  EffectiveWebhookConfig{},
+		"WebhookRequest":          WebhookRequest{},
+		"Webhook":                 models.Webhook{},
+		"PayloadCondition":        models.PayloadCondition{},
+		"WebhookDelivery":         models.WebhookDelivery{},
+		"WebhookCircuit":          WebhookCircuit{},
+		"ScheduledMessage":        models.ScheduledMessage{},
+		"Message":                 database.Message{},
+		"MessageImportResponse":   MessageImportResponse{},
+		"ImportError":             ImportError{},
+		"BufferedMessage":         mqtt.BufferedMessage{},
+	}
+
+	for name, value := range structs {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("Schema %s is missing from the OpenAPI document", name)
+			continue
+		}
+
+		var fields []string
+		typ := reflect.TypeOf(value)
+		for i := 0; i < typ.NumField(); i++ {
+			field := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			if field != "" && field != "-" {
+				fields = append(fields, field)
+			}
+		}
+
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+
+		sort.Strings(fields)
+		sort.Strings(properties)
+		if !reflect.DeepEqual(fields, properties) {
+			t.Errorf("Schema %s has properties %v, expected the fields of %s: %v", name, properties, typ, fields)
+		}
+	}
+}
+
+func TestOpenAPIWithoutAPIKey(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "secret-key")
+
+	rec := doRequest(t, s, http.MethodGet, "/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", contentType)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("Expected an OpenAPI 3.0.3 document, got %v", doc["openapi"])
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// PayloadEncodingBase64 is the payload_encoding of publish requests carrying binary payloads as standard base64
+// strings, since JSON can't hold arbitrary bytes
+const PayloadEncodingBase64 = "base64"
+
+// missingRetainedPayload is the error message of retained publishes without a payload. An empty retained
+// message clears the retained message of its topic, which a request that left out its payload by mistake
+// shouldn't do, so clearing it takes an explicit empty string or /retained/clear.
+const missingRetainedPayload = "Payload is required for retained messages, since an empty one clears the retained message of the topic; send an empty string or use /retained/clear to clear it"
+
+// publishedPayload returns the payload published for the payload of a request: a missing or null payload is
+// published as an empty payload rather than as the JSON null
+func publishedPayload(payload interface{}) interface{} {
+	if payload == nil {
+		return []byte{}
+	}
+	return payload
+}
+
+// decodePayload returns the payload a publish request carries in the given encoding. Without an encoding, the
+// payload is published as it was decoded from JSON, or as an empty payload if it is missing.
+func decodePayload(payload interface{}, encoding string) (interface{}, error) {
+	switch encoding {
+	case "":
+		return publishedPayload(payload), nil
+	case PayloadEncodingBase64:
+		encoded, ok := payload.(string)
+		if !ok {
+			return nil, errors.New("base64 payloads must be strings")
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported payload_encoding '%s', expected base64", encoding)
+	}
+}
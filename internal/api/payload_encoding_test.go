@@ -0,0 +1,53 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestPublishBase64PayloadRoundTripsBinary(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key")
+
+	binary := []byte{0x00, 0xff, 0xfe, 0x10, 0x80, '{', 0x00}
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{
+		Topic:           "cameras/1/frame",
+		Payload:         base64.StdEncoding.EncodeToString(binary),
+		PayloadEncoding: PayloadEncodingBase64,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if published := broker.WaitForPublished(t, 1); !bytes.Equal(published[0].Payload, binary) {
+		t.Errorf("Expected the decoded bytes %v to be published, got %v", binary, published[0].Payload)
+	}
+
+	stored, err := s.db.GetMessagesByTopicFilter(context.Background(), "cameras/1/frame", 1)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("Expected the message to be stored, got %v (%v)", stored, err)
+	}
+	if payload, ok := stored[0].Payload.([]byte); !ok || !bytes.Equal(payload, binary) || stored[0].ContentType != database.ContentTypeBinary {
+		t.Errorf("Expected the binary payload to be stored, got %v (%s)", stored[0].Payload, stored[0].ContentType)
+	}
+
+	for name, req := range map[string]PublishRequest{
+		"invalid base64":   {Topic: "cameras/1/frame", Payload: "not base64!", PayloadEncoding: PayloadEncodingBase64},
+		"non-string":       {Topic: "cameras/1/frame", Payload: 42, PayloadEncoding: PayloadEncodingBase64},
+		"unknown encoding": {Topic: "cameras/1/frame", Payload: "AAEC", PayloadEncoding: "hex"},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", "key", req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d: %s", name, http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"MQTTmicroService/internal/utils"
+)
+
+// checkPayloadSchema validates a payload against the schema configured in SCHEMA_RULES for its topic,
+// once the tenant namespace is added and the topic normalized. If the payload doesn't conform, it writes a 422 response listing
+// the violations and returns false.
+func (s *Server) checkPayloadSchema(w http.ResponseWriter, namespace, topic string, payload interface{}) bool {
+	if s.config == nil {
+		return true
+	}
+
+	topic = s.normalizeTopic(utils.ApplyNamespace(namespace, topic))
+	err := s.config.PayloadSchemas.Validate(topic, payload)
+	if err == nil {
+		return true
+	}
+
+	var schemaErr *utils.PayloadSchemaError
+	if !errors.As(err, &schemaErr) {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to validate payload: %v", err))
+		return false
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"status":     http.StatusUnprocessableEntity,
+		"code":       ErrCodeSchemaViolation,
+		"topic":      topic,
+		"filter":     schemaErr.Filter,
+		"violations": len(schemaErr.Violations),
+	}).Error("API error")
+
+	s.writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"status":  "error",
+		"code":    ErrCodeSchemaViolation,
+		"message": fmt.Sprintf("Payload for %s doesn't conform to its schema", topic),
+		"errors":  schemaErr.Violations,
+	})
+	return false
+}
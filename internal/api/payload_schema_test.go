@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+	"MQTTmicroService/internal/utils"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestPublishValidatesPayloadSchemas(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key::tenant-a")
+
+	path := filepath.Join(t.TempDir(), "temperature.json")
+	schema := `{"type": "object", "properties": {"value": {"type": "number"}}, "required": ["value"]}`
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	schemas, err := utils.ParsePayloadSchemaRules("tenant-a/sensors/+/temperature=>" + path)
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	s.config.PayloadSchemas = schemas
+
+	// Conforming payloads and topics without a schema are published
+	for _, req := range []PublishRequest{
+		{Topic: "sensors/kitchen/temperature", Payload: map[string]interface{}{"value": 21.5}},
+		{Topic: "sensors/kitchen/humidity", Payload: "anything"},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", "key", req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected publish to %s to succeed, got %d: %s", req.Topic, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{
+		Topic:   "sensors/kitchen/temperature",
+		Payload: map[string]interface{}{"value": "hot"},
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Code   string                  `json:"code"`
+		Errors []utils.SchemaViolation `json:"errors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != ErrCodeSchemaViolation || len(response.Errors) != 1 || response.Errors[0].Path != "/value" {
+		t.Errorf("Expected a schema violation on /value, got %+v", response)
+	}
+
+	// Batches are rejected as a whole when one of their payloads doesn't conform
+	rec = doRequest(t, s, http.MethodPost, "/publish/batch", "key", BatchPublishRequest{
+		Messages: []BatchPublishMessage{
+			{Topic: "sensors/kitchen/humidity", Payload: "anything"},
+			{Topic: "sensors/kitchen/temperature", Payload: map[string]interface{}{}},
+		},
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for the batch, got %d: %s", http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+	}
+
+	if published := broker.WaitForPublished(t, 2); len(published) != 2 {
+		t.Errorf("Expected only the accepted messages to be published, got %d", len(published))
+	}
+}
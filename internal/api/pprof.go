@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+
+	"MQTTmicroService/internal/auth"
+)
+
+// pprofPrefix is the path the runtime profiles are served under
+const pprofPrefix = "/debug/pprof/"
+
+// EnableProfiling serves the runtime profiles of net/http/pprof under /debug/pprof/. It must be called before
+// the server is started. Profiles expose the command line and internals of the service, and CPU profiles and
+// traces keep it busy while they are recorded, so they require the admin scope and, when authentication is
+// disabled, are only served to clients on the loopback interface.
+func (s *Server) EnableProfiling() {
+	s.router.HandleFunc(pprofPrefix+"cmdline", s.requireProfiling(pprof.Cmdline)).Methods("GET")
+	s.router.HandleFunc(pprofPrefix+"profile", s.requireProfiling(pprof.Profile)).Methods("GET")
+	s.router.HandleFunc(pprofPrefix+"symbol", s.requireProfiling(pprof.Symbol)).Methods("GET", "POST")
+	s.router.HandleFunc(pprofPrefix+"trace", s.requireProfiling(pprof.Trace)).Methods("GET")
+	// The index also serves the named profiles, such as /debug/pprof/heap and /debug/pprof/goroutine
+	s.router.PathPrefix(pprofPrefix).HandlerFunc(s.requireProfiling(pprof.Index)).Methods("GET")
+}
+
+// requireProfiling restricts a profiling handler to admins, or to loopback clients without authentication
+func (s *Server) requireProfiling(handler http.HandlerFunc) http.HandlerFunc {
+	return s.requireScope(auth.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		if _, authenticated := auth.ScopesFromContext(r.Context()); authenticated {
+			handler(w, r)
+			return
+		}
+
+		var trustedProxies []netip.Prefix
+		if s.config != nil {
+			trustedProxies = s.config.TrustedProxies
+		}
+		if ip, ok := clientIP(r, trustedProxies); ok && ip.IsLoopback() {
+			handler(w, r)
+			return
+		}
+
+		s.logger.WithFields(map[string]interface{}{
+			"path":        r.URL.Path,
+			"remote_addr": r.RemoteAddr,
+		}).Warn("Rejected unauthenticated profiling request from outside the loopback interface")
+		s.writeError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden: profiling requires authentication or a loopback client")
+	})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/logger"
+)
+
+func TestProfilingIsDisabledByDefault(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	s := NewServer(nil, log, nil, nil, nil, nil, ":0", HTTPTimeouts{})
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.RemoteAddr = "127.0.0.1:51234"
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected profiles not to be served unless enabled, got %d", rec.Code)
+	}
+}
+
+func TestProfilingRequiresTheAdminScope(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	authService := auth.New(&auth.Config{
+		EnableAPIKey: true,
+		APIKeys:      auth.ParseAPIKeys([]string{"admin-key:admin", "read-key:read"}),
+	}, log)
+	s := NewServer(nil, log, nil, authService, nil, nil, ":0", HTTPTimeouts{})
+	s.EnableProfiling()
+
+	tests := []struct {
+		path     string
+		apiKey   string
+		expected int
+	}{
+		{"/debug/pprof/", "admin-key", http.StatusOK},
+		{"/debug/pprof/heap?debug=1", "admin-key", http.StatusOK},
+		{"/debug/pprof/cmdline", "admin-key", http.StatusOK},
+		{"/debug/pprof/heap?debug=1", "read-key", http.StatusForbidden},
+		{"/debug/pprof/heap?debug=1", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		if rec := doRequest(t, s, http.MethodGet, test.path, test.apiKey, nil); rec.Code != test.expected {
+			t.Errorf("Expected GET %s with key %q to return %d, got %d", test.path, test.apiKey, test.expected, rec.Code)
+		}
+	}
+}
+
+func TestProfilingWithoutAuthenticationIsLimitedToLoopback(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	s := NewServer(nil, log, nil, nil, nil, nil, ":0", HTTPTimeouts{})
+	s.EnableProfiling()
+
+	tests := []struct {
+		remoteAddr string
+		expected   int
+	}{
+		{"127.0.0.1:51234", http.StatusOK},
+		{"[::1]:51234", http.StatusOK},
+		{"203.0.113.7:51234", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+		req.RemoteAddr = test.remoteAddr
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != test.expected {
+			t.Errorf("Expected a request from %s to return %d, got %d", test.remoteAddr, test.expected, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxPublishBytes is the maximum size of a publish request body when no limit is configured
+const defaultMaxPublishBytes = 1 << 20
+
+// maxPublishBytes returns the maximum size of a publish request body
+func (s *Server) maxPublishBytes() int64 {
+	if s.config != nil && s.config.MaxPublishBytes > 0 {
+		return s.config.MaxPublishBytes
+	}
+	return defaultMaxPublishBytes
+}
+
+// isRawPublish reports whether a publish request carries its payload as the raw request body
+// rather than as a JSON document
+func isRawPublish(r *http.Request) bool {
+	if raw, err := strconv.ParseBool(r.URL.Query().Get("raw")); err == nil && raw {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/octet-stream"
+}
+
+// decodeRawPublish builds a publish request from the query parameters, using the request body as the payload.
+// It writes an error response and returns false if the request is invalid.
+func (s *Server) decodeRawPublish(w http.ResponseWriter, r *http.Request) (*PublishRequest, bool) {
+	query := r.URL.Query()
+	req := &PublishRequest{
+		Topic:          query.Get("topic"),
+		Broker:         query.Get("broker"),
+		IdempotencyKey: query.Get("idempotency_key"),
+	}
+
+	// Several brokers are given as a comma-separated list
+	for _, broker := range strings.Split(query.Get("brokers"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			req.Brokers = append(req.Brokers, broker)
+		}
+	}
+
+	if qosStr := query.Get("qos"); qosStr != "" {
+		qos, err := strconv.ParseUint(qosStr, 10, 8)
+		if err != nil || qos > 2 {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidQoS, "Invalid qos parameter")
+			return nil, false
+		}
+		qosLevel := byte(qos)
+		req.QoS = &qosLevel
+	}
+
+	if retainedStr := query.Get("retained"); retainedStr != "" {
+		retained, err := strconv.ParseBool(retainedStr)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid retained parameter")
+			return nil, false
+		}
+		req.Retained = &retained
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writePublishDecodeError(w, err)
+		return nil, false
+	}
+	req.Payload = payload
+
+	return req, true
+}
+
+// writePublishDecodeError answers a publish request whose body couldn't be read or decoded
+func (s *Server) writePublishDecodeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, fmt.Sprintf("Request body exceeds the limit of %d bytes", maxBytesErr.Limit))
+		return
+	}
+	s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestRawPublishSendsBodyAsIs(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	payload := []byte{0x08, 0x96, 0x01, 0x00, 0xff}
+	for _, tc := range []struct {
+		path        string
+		contentType string
+	}{
+		{"/publish?raw=true&topic=sensors/raw&qos=0", "text/plain"},
+		{"/publish?topic=sensors/raw", "application/octet-stream"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader(payload))
+		req.Header.Set("X-API-Key", "key")
+		req.Header.Set("Content-Type", tc.contentType)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected raw publish to %s to succeed, got %d: %s", tc.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	for _, published := range broker.WaitForPublished(t, 2) {
+		if published.TopicName != "sensors/raw" {
+			t.Errorf("Expected message on 'sensors/raw', got '%s'", published.TopicName)
+		}
+		if !bytes.Equal(published.Payload, payload) {
+			t.Errorf("Expected payload %x, got %x", payload, published.Payload)
+		}
+	}
+}
+
+func TestRawPublishRejectsInvalidParameters(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	for _, path := range []string{
+		"/publish?raw=true&topic=sensors/raw&qos=3",
+		"/publish?raw=true&topic=sensors/raw&retained=maybe",
+		"/publish?raw=true",
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("data"))
+		req.Header.Set("X-API-Key", "key")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestPublishRejectsOversizedBody(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+	s.config.MaxPublishBytes = 64
+
+	rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: "data", Payload: strings.Repeat("x", 100)})
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized JSON body, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/publish?raw=true&topic=data", strings.NewReader(strings.Repeat("x", 100)))
+	req.Header.Set("X-API-Key", "key")
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized raw body, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: "data", Payload: "small"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a small body to be published, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBinaryPayloadRoundTrip(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	// A PNG header isn't valid UTF-8
+	png := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00, 0x00, 0x0d, 'I', 'H', 'D', 'R'}
+
+	req := httptest.NewRequest(http.MethodPost, "/publish?topic=images/cam", bytes.NewReader(png))
+	req.Header.Set("X-API-Key", "key")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected raw publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/messages?topic=images/cam", "key", nil)
+	var list struct {
+		Messages []struct {
+			ID          string `json:"id"`
+			Payload     []byte `json:"payload"`
+			ContentType string `json:"content_type"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list.Messages) != 1 {
+		t.Fatalf("Expected 1 stored message, got %d", len(list.Messages))
+	}
+	stored := list.Messages[0]
+	if stored.ContentType != database.ContentTypeBinary {
+		t.Errorf("Expected content type '%s', got '%s'", database.ContentTypeBinary, stored.ContentType)
+	}
+	if !bytes.Equal(stored.Payload, png) {
+		t.Errorf("Expected base64 payload to decode to %x, got %x", png, stored.Payload)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/messages/"+stored.ID+"?raw=true", "key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected raw download to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("Expected Content-Type 'image/png', got '%s'", contentType)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Errorf("Expected raw payload %x, got %x", png, rec.Body.Bytes())
+	}
+}
+
+func TestStoredPayloadsKeepTheirContentType(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	for topic, payload := range map[string]interface{}{
+		"data/json": map[string]interface{}{"value": 21.5},
+		"data/text": "hello",
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", "key", PublishRequest{Topic: topic, Payload: payload})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	for topic, expected := range map[string]string{
+		"data/json": `{"value":21.5}`,
+		"data/text": `"hello"`,
+	} {
+		rec := doRequest(t, s, http.MethodGet, "/messages?topic="+topic, "key", nil)
+		var list struct {
+			Messages []struct {
+				Payload json.RawMessage `json:"payload"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(list.Messages) != 1 || string(list.Messages[0].Payload) != expected {
+			t.Errorf("Expected payload %s on '%s', got %+v", expected, topic, list.Messages)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/auth"
+)
+
+// rateLimiterSweepInterval is how often idle buckets are removed from the rate limiter
+const rateLimiterSweepInterval = time.Minute
+
+// rateLimiter is a token bucket rate limiter with one bucket per client
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// tokenBucket holds the tokens available to a client and when they were last refilled
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimitClientState is the state of a single client's bucket
+type RateLimitClientState struct {
+	Client string  `json:"client"`
+	Tokens float64 `json:"tokens"`
+}
+
+// RateLimitState is the current state of the rate limiter
+type RateLimitState struct {
+	Enabled bool                   `json:"enabled"`
+	RPS     float64                `json:"rps,omitempty"`
+	Burst   int                    `json:"burst,omitempty"`
+	Clients []RateLimitClientState `json:"clients,omitempty"`
+}
+
+// newRateLimiter creates a rate limiter allowing rps requests per second with bursts of up to burst requests
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rps)))
+	}
+	return &rateLimiter{
+		rate:      rps,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the client's bucket. If none is available it returns false
+// together with how long the client has to wait for the next token.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucket, exists := l.buckets[client]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// exhausted reports whether the client's bucket is out of tokens without taking one, together with how long
+// the client has to wait for the next token
+func (l *rateLimiter) exhausted(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, exists := l.buckets[client]
+	if !exists {
+		return false, 0
+	}
+	l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		return true, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	return false, 0
+}
+
+// refill adds the tokens accumulated since the bucket was last refilled
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+		bucket.last = now
+	}
+}
+
+// sweep removes buckets that have refilled completely, since they behave like new buckets
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for client, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// state returns the rate limiter's configuration and the tokens left in every client's bucket
+func (l *rateLimiter) state(now time.Time) RateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := RateLimitState{
+		Enabled: true,
+		RPS:     l.rate,
+		Burst:   int(l.burst),
+		Clients: make([]RateLimitClientState, 0, len(l.buckets)),
+	}
+	for client, bucket := range l.buckets {
+		l.refill(bucket, now)
+		state.Clients = append(state.Clients, RateLimitClientState{Client: client, Tokens: bucket.tokens})
+	}
+	sort.Slice(state.Clients, func(i, j int) bool {
+		return state.Clients[i].Client < state.Clients[j].Client
+	})
+
+	return state
+}
+
+// rateLimitMiddleware rejects requests from clients that exceeded the rate limit with 429 Too Many Requests.
+// Clients are identified by their API key or JWT subject, falling back to the remote IP for unauthenticated requests.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Skip rate limiting for health check endpoints
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := s.rateLimiter.allow(rateLimitClient(r), time.Now())
+		if !allowed {
+			s.writeRateLimited(w, wait)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authFailureLimitMiddleware throttles sources that keep failing authentication, which rateLimitMiddleware never
+// sees since it runs after authentication. Every 401 response takes a token from a bucket keyed by the remote IP,
+// and while that bucket is empty all requests from the IP are rejected with 429 Too Many Requests before they
+// reach authentication. Requests that authenticate successfully don't use the bucket.
+func (s *Server) authFailureLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := "auth-failures:" + remoteIP(r)
+		if exhausted, wait := s.rateLimiter.exhausted(client, time.Now()); exhausted {
+			s.writeRateLimited(w, wait)
+			return
+		}
+
+		rww := &responseWriterWrapper{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(rww, r)
+
+		if rww.statusCode == http.StatusUnauthorized {
+			s.rateLimiter.allow(client, time.Now())
+		}
+	})
+}
+
+// writeRateLimited writes a 429 Too Many Requests response telling the client how long to wait
+func (s *Server) writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	s.writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Rate limit exceeded")
+}
+
+// rateLimitClient returns the identifier the rate limiter uses for the request's client
+func rateLimitClient(r *http.Request) string {
+	if caller := auth.CallerFromContext(r.Context()); caller != "" {
+		return caller
+	}
+	return "ip:" + remoteIP(r)
+}
+
+// remoteIP returns the IP address the request came from
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// handleRateLimit handles requests to inspect the rate limiter's state
+func (s *Server) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	state := RateLimitState{}
+	if s.rateLimiter != nil {
+		state = s.rateLimiter.state(time.Now())
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"rate_limit": state,
+	})
+}
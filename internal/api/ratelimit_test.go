@@ -0,0 +1,113 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+)
+
+func TestRateLimitRejectsRequestsOverBurst(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	authService := auth.New(&auth.Config{
+		EnableAPIKey: true,
+		APIKeys:      auth.ParseAPIKeys([]string{"key-a", "key-b"}),
+	}, log)
+	cfg := &config.Config{RateLimitRPS: 1, RateLimitBurst: 3}
+	s := NewServer(nil, log, nil, authService, nil, cfg, ":0", HTTPTimeouts{})
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ratelimit", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 1; i <= 3; i++ {
+		if rec := request("key-a"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to succeed, got %d", i, rec.Code)
+		}
+	}
+
+	rec := request("key-a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected request 4 to be rate limited with %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Expected Retry-After to be '1', got '%s'", retryAfter)
+	}
+
+	if rec := request("key-b"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another key to have its own limit, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitThrottlesFailedAuthentication(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	authService := auth.New(&auth.Config{
+		EnableAPIKey: true,
+		APIKeys:      auth.ParseAPIKeys([]string{"key-a"}),
+	}, log)
+	cfg := &config.Config{RateLimitRPS: 1, RateLimitBurst: 3}
+	s := NewServer(nil, log, nil, authService, nil, cfg, ":0", HTTPTimeouts{})
+
+	request := func(key, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ratelimit", nil)
+		req.Header.Set("X-API-Key", key)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Successful requests don't count towards the failed authentication limit
+	for i := 1; i <= 3; i++ {
+		if rec := request("key-a", "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to succeed, got %d", i, rec.Code)
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		if rec := request("wrong-key", "192.0.2.1:1234"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected failed attempt %d to be unauthorized, got %d", i, rec.Code)
+		}
+	}
+
+	rec := request("wrong-key", "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected failed attempt 4 to be rate limited with %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Expected Retry-After to be '1', got '%s'", retryAfter)
+	}
+
+	if rec := request("wrong-key", "198.51.100.1:1234"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected another IP to have its own limit, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterRefillsOverTime(t *testing.T) {
+	limiter := newRateLimiter(2, 1)
+	now := time.Now()
+
+	if allowed, _ := limiter.allow("client", now); !allowed {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	allowed, wait := limiter.allow("client", now)
+	if allowed {
+		t.Fatal("Expected the second request to be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for the next token, got %s", wait)
+	}
+
+	if allowed, _ := limiter.allow("client", now.Add(wait)); !allowed {
+		t.Error("Expected a request to be allowed once a token was refilled")
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/utils"
+)
+
+// handleGetRecentMessages handles requests to list the most recent messages from the in-memory buffer,
+// which is available with or without a database
+func (s *Server) handleGetRecentMessages(w http.ResponseWriter, r *http.Request) {
+	limit := 0 // Every buffered message by default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid limit parameter")
+			return
+		}
+	}
+
+	// Tenants only see messages in their own namespace, so filter before applying the limit
+	namespace := s.tenantNamespace(r)
+	messages := make([]mqtt.BufferedMessage, 0)
+	for _, msg := range s.mqttManager.RecentMessages(0) {
+		topic, ok := utils.StripNamespace(namespace, msg.Topic)
+		if !ok {
+			continue
+		}
+		msg.Topic = topic
+		messages = append(messages, msg)
+		if len(messages) == limit {
+			break
+		}
+	}
+
+	// Write the response
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "success",
+		"messages": messages,
+		"count":    len(messages),
+	})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestRecentMessagesAreScopedToTenants(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key-a::tenant-a", "key-b::tenant-b")
+
+	for _, req := range []struct{ key, topic string }{
+		{"key-a", "sensors/1"},
+		{"key-b", "sensors/2"},
+		{"key-a", "sensors/3"},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", req.key, PublishRequest{Topic: req.topic, Payload: "hello"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/messages/recent?limit=5", "key-a", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected listing recent messages to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Messages []mqtt.BufferedMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Messages) != 2 {
+		t.Fatalf("Expected tenant A to see 2 messages, got %d", len(response.Messages))
+	}
+	if response.Messages[0].Topic != "sensors/3" || response.Messages[1].Topic != "sensors/1" {
+		t.Errorf("Expected tenant A's messages newest first, got '%s' and '%s'", response.Messages[0].Topic, response.Messages[1].Topic)
+	}
+	if response.Messages[0].Direction != mqtt.DirectionPublished || response.Messages[0].Payload != "hello" {
+		t.Errorf("Expected a published message with payload 'hello', got %+v", response.Messages[0])
+	}
+}
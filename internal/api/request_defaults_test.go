@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestPublishDefaultsApplyOnlyToOmittedFields(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "key")
+	s.config.DefaultPublishQoS = 1
+	s.config.DefaultRetained = true
+
+	// Omitted fields take the configured defaults, explicit zero values are kept
+	for _, body := range []map[string]interface{}{
+		{"topic": "sensors/omitted", "payload": "21.5"},
+		{"topic": "sensors/explicit", "payload": "21.5", "qos": 0, "retained": false},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish", "key", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	published := broker.WaitForPublished(t, 2)
+	if omitted := published[0]; omitted.Qos != 1 || !omitted.Retain {
+		t.Errorf("Expected the omitted fields to default to QoS 1 and retained, got QoS %d and retained %v", omitted.Qos, omitted.Retain)
+	}
+	if explicit := published[1]; explicit.Qos != 0 || explicit.Retain {
+		t.Errorf("Expected the explicit QoS 0 and retained false to be kept, got QoS %d and retained %v", explicit.Qos, explicit.Retain)
+	}
+}
+
+func TestSubscribeDefaultAppliesOnlyToOmittedQoS(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	s := newTestServer(t, broker, "key")
+	s.config.DefaultSubscribeQoS = 2
+
+	for _, body := range []map[string]interface{}{
+		{"topic": "sensors/omitted"},
+		{"topic": "sensors/explicit", "qos": 0},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/subscribe", "key", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	rec := doRequest(t, s, http.MethodPost, "/subscribe/batch", "key", map[string]interface{}{
+		"subscriptions": []map[string]interface{}{{"topic": "alerts/omitted"}, {"topic": "alerts/explicit", "qos": 0}},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected batch subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	stored := storedSubscriptions(t, s)
+	expected := map[string]byte{
+		"test sensors/omitted":  2,
+		"test sensors/explicit": 0,
+		"test alerts/omitted":   2,
+		"test alerts/explicit":  0,
+	}
+	for subscription, qos := range expected {
+		if got, ok := stored[subscription]; !ok || got != qos {
+			t.Errorf("Expected %s to be subscribed with QoS %d, got %v", subscription, qos, stored)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader is the header carrying the correlation ID of a request
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest incoming request ID that is honored
+const maxRequestIDLength = 128
+
+// requestIDContextKey is the context key under which the request ID is stored
+type requestIDContextKey struct{}
+
+// RequestIDFromContext returns the correlation ID of the request, or "" if it has none
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// requestIDMiddleware assigns every request a correlation ID, honoring a valid incoming X-Request-ID header,
+// stores it in the request context, echoes it in the response, and writes an access log entry carrying it
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, requestID)
+
+		rww := &responseWriterWrapper{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		start := time.Now()
+		next.ServeHTTP(rww, r.WithContext(ctx))
+
+		s.logger.WithFields(map[string]interface{}{
+			"request_id":  requestID,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rww.statusCode,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}).Info("HTTP request")
+	})
+}
+
+// validRequestID reports whether an incoming request ID is safe to reuse in headers and logs
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
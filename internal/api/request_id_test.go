@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	s := &Server{logger: logger.New(&logger.Config{Level: "error", Output: io.Discard})}
+
+	var seen string
+	handler := s.requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	// An incoming request ID is honored
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set(requestIDHeader, "trace-1234")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "trace-1234" {
+		t.Errorf("Expected request ID 'trace-1234' in the context, got '%s'", seen)
+	}
+	if echoed := rec.Header().Get(requestIDHeader); echoed != "trace-1234" {
+		t.Errorf("Expected request ID 'trace-1234' to be echoed, got '%s'", echoed)
+	}
+
+	// A request without one gets a generated ID
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if seen == "" || seen == "trace-1234" {
+		t.Errorf("Expected a newly generated request ID, got '%s'", seen)
+	}
+	if echoed := rec.Header().Get(requestIDHeader); echoed != seen {
+		t.Errorf("Expected the generated request ID '%s' to be echoed, got '%s'", seen, echoed)
+	}
+}
+
+func TestWebhookPayloadCarriesRequestID(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	s := &Server{
+		logger: logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		config: &config.Config{Webhook: &config.WebhookConfig{
+			Enabled:      true,
+			URL:          receiver.URL,
+			Method:       http.MethodPost,
+			Timeout:      5,
+			RetryDelay:   1,
+			AllowPrivate: true,
+		}},
+	}
+	s.sendWebhookNotification("sensors/temp", "test", 21.5, 0, "trace-1234")
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(<-bodies, &payload); err != nil {
+		t.Fatalf("Failed to decode webhook payload: %v", err)
+	}
+	if payload.RequestID != "trace-1234" {
+		t.Errorf("Expected request_id 'trace-1234', got '%s'", payload.RequestID)
+	}
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// scheduleWorkerInterval is how often the schedule worker looks for due messages
+	scheduleWorkerInterval = time.Second
+	// scheduleBatchSize is the maximum number of scheduled messages published per worker run
+	scheduleBatchSize = 100
+)
+
+// SchedulePublishRequest represents a request to publish a message at a later time
+type SchedulePublishRequest struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+	// QoS defaults to DEFAULT_PUBLISH_QOS when omitted
+	QoS *byte `json:"qos,omitempty"`
+	// Retained defaults to DEFAULT_RETAINED when omitted
+	Retained *bool  `json:"retained,omitempty"`
+	Broker   string `json:"broker,omitempty"`
+	// PublishAt is the RFC3339 time to publish the message at; mutually exclusive with DelaySeconds
+	PublishAt string `json:"publish_at,omitempty"`
+	// DelaySeconds is the number of seconds to wait before publishing the message
+	DelaySeconds int `json:"delay_seconds,omitempty"`
+	mqtt5Options
+}
+
+// publishTime returns the time a scheduled message should be published at
+func (req *SchedulePublishRequest) publishTime(now time.Time) (time.Time, error) {
+	switch {
+	case req.PublishAt != "" && req.DelaySeconds != 0:
+		return time.Time{}, fmt.Errorf("only one of publish_at and delay_seconds may be given")
+	case req.PublishAt != "":
+		publishAt, err := time.Parse(time.RFC3339, req.PublishAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("publish_at must be an RFC3339 time")
+		}
+		if !publishAt.After(now) {
+			return time.Time{}, fmt.Errorf("publish_at must be in the future")
+		}
+		return publishAt, nil
+	case req.DelaySeconds > 0:
+		return now.Add(time.Duration(req.DelaySeconds) * time.Second), nil
+	case req.DelaySeconds < 0:
+		return time.Time{}, fmt.Errorf("delay_seconds must be greater than 0")
+	default:
+		return time.Time{}, fmt.Errorf("publish_at or delay_seconds is required")
+	}
+}
+
+// startScheduleWorker starts the background worker that publishes due scheduled messages
+func (s *Server) startScheduleWorker() {
+	if s.db == nil || s.scheduleStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	s.scheduleStop = stop
+
+	go func() {
+		ticker := time.NewTicker(scheduleWorkerInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.publishDueMessages()
+			}
+		}
+	}()
+}
+
+// stopScheduleWorker stops the schedule worker if it is running
+func (s *Server) stopScheduleWorker() {
+	if s.scheduleStop != nil {
+		close(s.scheduleStop)
+		s.scheduleStop = nil
+	}
+}
+
+// publishDueMessages publishes every pending scheduled message whose publish time has come
+func (s *Server) publishDueMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	messages, err := s.db.GetDueScheduledMessages(ctx, time.Now(), scheduleBatchSize)
+	cancel()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get due scheduled messages")
+		return
+	}
+
+	for _, msg := range messages {
+		s.publishScheduledMessage(msg)
+	}
+}
+
+// publishScheduledMessage publishes a scheduled message and records the outcome
+func (s *Server) publishScheduledMessage(msg *models.ScheduledMessage) {
+	msg.Status = models.ScheduledStatusPublished
+	msg.LastError = ""
+	if err := s.publishScheduledPayload(msg); err != nil {
+		msg.Status = models.ScheduledStatusFailed
+		msg.LastError = err.Error()
+		if s.metrics != nil {
+			s.metrics.IncrementFailedPublishes()
+		}
+	} else if s.metrics != nil {
+		s.metrics.IncrementPublishedMessagesForTopic(msg.Topic, msg.Broker)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"scheduled_id": msg.ID,
+		"topic":        msg.Topic,
+		"status":       msg.Status,
+	}).Info("Scheduled message publish attempted")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.UpdateScheduledMessage(ctx, msg); err != nil {
+		s.logger.WithError(err).WithField("scheduled_id", msg.ID).Error("Failed to update scheduled message")
+	}
+}
+
+// publishScheduledPayload decodes a scheduled message's payload and publishes it like an immediate publish would
+func (s *Server) publishScheduledPayload(msg *models.ScheduledMessage) error {
+	var payload interface{}
+	if len(msg.Payload) > 0 {
+		if err := unmarshalPayload(msg.Payload, &payload); err != nil {
+			return fmt.Errorf("failed to decode payload: %w", err)
+		}
+	}
+
+	client, err := s.mqttManager.GetClient(msg.Broker)
+	if err != nil {
+		return fmt.Errorf("failed to get MQTT client: %w", err)
+	}
+
+	if !client.IsConnected() {
+		if err := client.Connect(); err != nil {
+			return err
+		}
+	}
+
+	return client.Publish(msg.Topic, msg.QoS, msg.Retained, payload)
+}
+
+// tenantScheduledMessage strips the caller's namespace from a scheduled message's topic,
+// reporting false if the message belongs to another tenant
+func (s *Server) tenantScheduledMessage(r *http.Request, msg *models.ScheduledMessage) bool {
+	topic, ok := utils.StripNamespace(s.tenantNamespace(r), msg.Topic)
+	if !ok {
+		return false
+	}
+	msg.Topic = topic
+	return true
+}
+
+// handleSchedulePublish handles requests to publish a message at a later time
+func (s *Server) handleSchedulePublish(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	var req SchedulePublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if req.Topic == "" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic is required")
+		return
+	}
+
+	if err := utils.ValidatePublishTopic(req.Topic); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidTopic, fmt.Sprintf("Invalid topic: %v", err))
+		return
+	}
+
+	if err := req.unsupportedOption(); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	qos := s.publishQoS(req.QoS)
+	if qos > 2 {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidQoS, fmt.Sprintf("Invalid QoS %d", qos))
+		return
+	}
+
+	retained := s.publishRetained(req.Retained)
+	if (len(req.Payload) == 0 || string(req.Payload) == "null") && retained {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, missingRetainedPayload)
+		return
+	}
+
+	// Reject non-conforming payloads now rather than when they are due
+	if !s.checkPayloadSchema(w, s.tenantNamespace(r), req.Topic, req.Payload) {
+		return
+	}
+
+	publishAt, err := req.publishTime(time.Now())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Resolve the broker now so the message isn't affected by later changes to the default connection
+	if _, err := s.mqttManager.GetClient(req.Broker); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeUnknownBroker, fmt.Sprintf("Invalid broker: %v", err))
+		return
+	}
+
+	msg := &models.ScheduledMessage{
+		Topic:     utils.ApplyNamespace(s.tenantNamespace(r), req.Topic),
+		Payload:   req.Payload,
+		QoS:       qos,
+		Retained:  retained,
+		Broker:    s.brokerName(req.Broker),
+		PublishAt: publishAt.UTC(),
+		Status:    models.ScheduledStatusPending,
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.StoreScheduledMessage(ctx, msg); err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to schedule message: %v", err))
+		return
+	}
+
+	s.tenantScheduledMessage(r, msg)
+
+	// Write the response
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":            "success",
+		"message":           fmt.Sprintf("Message scheduled for %s", msg.PublishAt.Format(time.RFC3339)),
+		"scheduled_message": msg,
+	})
+}
+
+// handleGetScheduledMessages handles requests to list scheduled messages
+func (s *Server) handleGetScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Get query parameters
+	limitStr := r.URL.Query().Get("limit")
+	limit := 100 // Default limit
+	if limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid limit parameter")
+			return
+		}
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	messages, err := s.db.GetScheduledMessages(ctx, limit)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get scheduled messages: %v", err))
+		return
+	}
+
+	// Tenants only see their own scheduled messages
+	filtered := make([]*models.ScheduledMessage, 0, len(messages))
+	for _, msg := range messages {
+		if s.tenantScheduledMessage(r, msg) {
+			filtered = append(filtered, msg)
+		}
+	}
+
+	// Write the response
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":             "success",
+		"scheduled_messages": filtered,
+		"count":              len(filtered),
+	})
+}
+
+// handleCancelScheduledMessage handles requests to cancel a scheduled message
+func (s *Server) handleCancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Get the scheduled message ID from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Scheduled message ID is required")
+		return
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Tenants can only cancel their own scheduled messages
+	msg, err := s.db.GetScheduledMessageByID(ctx, id)
+	if err == database.ErrScheduledMessageNotFound || (err == nil && !s.tenantScheduledMessage(r, msg)) {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Scheduled message not found")
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get scheduled message: %v", err))
+		return
+	}
+
+	if msg.Status != models.ScheduledStatusPending {
+		s.writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("Scheduled message was already %s", msg.Status))
+		return
+	}
+
+	if err := s.db.DeleteScheduledMessage(ctx, id); err != nil {
+		if err == database.ErrScheduledMessageNotFound {
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Scheduled message not found")
+		} else {
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to cancel scheduled message: %v", err))
+		}
+		return
+	}
+
+	// Write the response
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": fmt.Sprintf("Scheduled message %s cancelled", id),
+	})
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// scheduleMessage schedules a message through the API and returns it
+func scheduleMessage(t *testing.T, s *Server, apiKey string, req SchedulePublishRequest) *models.ScheduledMessage {
+	t.Helper()
+
+	rec := doRequest(t, s, http.MethodPost, "/publish/schedule", apiKey, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected scheduling to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		ScheduledMessage *models.ScheduledMessage `json:"scheduled_message"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response.ScheduledMessage
+}
+
+func TestScheduledMessageIsPublishedWhenDue(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key::tenant-a")
+
+	scheduled := scheduleMessage(t, s, "key", SchedulePublishRequest{
+		Topic:        "commands/reboot",
+		Payload:      json.RawMessage(`{"delay":5}`),
+		DelaySeconds: 1,
+	})
+	if scheduled.Topic != "commands/reboot" || scheduled.Status != models.ScheduledStatusPending {
+		t.Errorf("Expected a pending message on 'commands/reboot', got %+v", scheduled)
+	}
+
+	// Nothing is due yet
+	s.publishDueMessages()
+	if published := len(broker.Published()); published != 0 {
+		t.Fatalf("Expected no message to be published before it is due, got %d", published)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	s.publishDueMessages()
+
+	published := broker.WaitForPublished(t, 1)
+	if published[0].TopicName != "tenant-a/commands/reboot" {
+		t.Errorf("Expected message on 'tenant-a/commands/reboot', got '%s'", published[0].TopicName)
+	}
+	if string(published[0].Payload) != `{"delay":5}` {
+		t.Errorf("Expected payload '{\"delay\":5}', got '%s'", published[0].Payload)
+	}
+
+	msg, err := s.db.GetScheduledMessageByID(t.Context(), scheduled.ID)
+	if err != nil {
+		t.Fatalf("Failed to get scheduled message: %v", err)
+	}
+	if msg.Status != models.ScheduledStatusPublished {
+		t.Errorf("Expected status '%s', got '%s' (%s)", models.ScheduledStatusPublished, msg.Status, msg.LastError)
+	}
+}
+
+func TestCancelScheduledMessage(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key-a::tenant-a", "key-b::tenant-b")
+
+	scheduled := scheduleMessage(t, s, "key-a", SchedulePublishRequest{
+		Topic:     "commands/reboot",
+		PublishAt: time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+
+	// Other tenants can neither see nor cancel the message
+	rec := doRequest(t, s, http.MethodDelete, "/publish/scheduled/"+scheduled.ID, "key-b", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when another tenant cancels, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodDelete, "/publish/scheduled/"+scheduled.ID, "key-a", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected cancelling to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/publish/scheduled", "key-a", nil)
+	var response struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Count != 0 {
+		t.Errorf("Expected no scheduled messages after cancelling, got %d", response.Count)
+	}
+}
+
+func TestSchedulePublishValidatesTime(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	s := newTestServer(t, broker, "key")
+
+	for _, req := range []SchedulePublishRequest{
+		{Topic: "data"},
+		{Topic: "data", DelaySeconds: -1},
+		{Topic: "data", PublishAt: "tomorrow"},
+		{Topic: "data", PublishAt: time.Now().Add(-time.Minute).Format(time.RFC3339)},
+		{Topic: "data", PublishAt: time.Now().Add(time.Minute).Format(time.RFC3339), DelaySeconds: 60},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/publish/schedule", "key", req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt"
+)
+
+// storeSubscription records a subscription made through the API so it can be restored after a restart.
+// Failing to record it doesn't fail the subscription, which is already in place.
+func (s *Server) storeSubscription(ctx context.Context, broker, topic string, qos byte) {
+	if s.db == nil {
+		return
+	}
+
+	subscription := &models.Subscription{Broker: s.brokerName(broker), Topic: topic, QoS: qos}
+	if err := s.db.StoreSubscription(ctx, subscription); err != nil {
+		s.logger.WithError(err).WithFields(map[string]interface{}{
+			"broker": subscription.Broker,
+			"topic":  topic,
+		}).Warn("Failed to store subscription, it won't be restored after a restart")
+	}
+}
+
+// deleteSubscription forgets a stored subscription after unsubscribing from its topic
+func (s *Server) deleteSubscription(ctx context.Context, broker, topic string) {
+	if s.db == nil {
+		return
+	}
+
+	broker = s.brokerName(broker)
+	if err := s.db.DeleteSubscription(ctx, broker, topic); err != nil {
+		s.logger.WithError(err).WithFields(map[string]interface{}{
+			"broker": broker,
+			"topic":  topic,
+		}).Warn("Failed to delete stored subscription, it will be restored after a restart")
+	}
+}
+
+// restoreSubscriptions re-establishes the stored subscriptions of a broker the first time its client connects.
+// Later reconnects restore the client's subscriptions themselves, and topics the client is already
+// subscribed to are skipped, so no subscription is made twice.
+func (s *Server) restoreSubscriptions(broker string, client *mqtt.Client) {
+	if _, restored := s.restoredBrokers.LoadOrStore(broker, true); restored {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stored, err := s.db.GetSubscriptions(ctx)
+	if err != nil {
+		// Try again on the next connect
+		s.restoredBrokers.Delete(broker)
+		s.logger.WithError(err).WithField("broker", broker).Error("Failed to load stored subscriptions")
+		return
+	}
+
+	active := client.GetSubscriptions()
+	filters := make(map[string]byte)
+	for _, subscription := range stored {
+		if subscription.Broker != broker {
+			continue
+		}
+		if _, subscribed := active[subscription.Topic]; subscribed {
+			continue
+		}
+		filters[subscription.Topic] = subscription.QoS
+	}
+	if len(filters) == 0 {
+		return
+	}
+
+	granted, err := client.SubscribeMultiple(filters, s.newMessageHandler(broker, ""))
+	if err != nil {
+		s.restoredBrokers.Delete(broker)
+		s.logger.WithError(err).WithField("broker", broker).Error("Failed to restore stored subscriptions")
+		return
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"broker":   broker,
+		"stored":   len(filters),
+		"restored": len(granted),
+	}).Info("Restored stored subscriptions")
+	s.updateSubscriptionCount()
+}
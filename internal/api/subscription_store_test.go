@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// storedSubscriptions returns the stored subscriptions by broker and topic
+func storedSubscriptions(t *testing.T, s *Server) map[string]byte {
+	t.Helper()
+
+	subscriptions, err := s.db.GetSubscriptions(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get subscriptions: %v", err)
+	}
+
+	stored := make(map[string]byte)
+	for _, subscription := range subscriptions {
+		stored[subscription.Broker+" "+subscription.Topic] = subscription.QoS
+	}
+	return stored
+}
+
+// waitForSubscription waits until the client is subscribed to the topic
+func waitForSubscription(t *testing.T, client *mqtt.Client, topic string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := client.GetSubscriptions()[topic]; ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for a subscription to %s", topic)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionsAreStored(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	s := newTestServer(t, broker, "key-a::tenant-a")
+
+	rec := doRequest(t, s, http.MethodPost, "/subscribe", "key-a", SubscribeRequest{Topic: "sensors/#", QoS: qos(1)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, s, http.MethodPost, "/subscribe/batch", "key-a", BatchSubscribeRequest{
+		Subscriptions: []TopicSubscription{{Topic: "alerts/#", QoS: qos(2)}},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected batch subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Subscriptions are stored on the resolved broker, in the tenant's namespace
+	stored := storedSubscriptions(t, s)
+	if len(stored) != 2 || stored["test tenant-a/sensors/#"] != 1 || stored["test tenant-a/alerts/#"] != 2 {
+		t.Fatalf("Expected both subscriptions to be stored, got %v", stored)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/unsubscribe", "key-a", SubscribeRequest{Topic: "sensors/#"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected unsubscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if stored := storedSubscriptions(t, s); len(stored) != 1 {
+		t.Errorf("Expected the unsubscribed topic to be forgotten, got %v", stored)
+	}
+}
+
+func TestStoredSubscriptionsAreRestoredOnConnect(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	s := newTestServer(t, broker)
+
+	ctx := context.Background()
+	for _, subscription := range []*models.Subscription{
+		{Broker: "test", Topic: "sensors/#", QoS: 1},
+		{Broker: "other", Topic: "alerts/#", QoS: 0},
+	} {
+		if err := s.db.StoreSubscription(ctx, subscription); err != nil {
+			t.Fatalf("Failed to store subscription: %v", err)
+		}
+	}
+
+	client, err := s.mqttManager.GetClient("test")
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	waitForSubscription(t, client, "sensors/#")
+
+	if subscriptions := client.GetSubscriptions(); len(subscriptions) != 1 || subscriptions["sensors/#"].QoS != 1 {
+		t.Errorf("Expected only the broker's stored subscription to be restored, got %+v", subscriptions)
+	}
+
+	// Restoring again doesn't subscribe to topics the client is already subscribed to
+	s.restoredBrokers.Delete("test")
+	s.restoreSubscriptions("test", client)
+	if subscribed := broker.Subscribed(); len(subscribed) != 1 {
+		t.Errorf("Expected a single subscription to reach the broker, got %v", subscribed)
+	}
+}
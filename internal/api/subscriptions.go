@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"MQTTmicroService/internal/utils"
+)
+
+// SubscriptionInfo describes an active subscription of a broker
+type SubscriptionInfo struct {
+	Topic string `json:"topic"`
+	// QoS is the requested QoS, and GrantedQoS the one the broker granted, which may be lower
+	QoS        byte `json:"qos"`
+	GrantedQoS byte `json:"granted_qos"`
+	// ShareGroup and Filter are set for shared subscriptions
+	ShareGroup   string    `json:"share_group,omitempty"`
+	Filter       string    `json:"filter,omitempty"`
+	SubscribedAt time.Time `json:"subscribed_at"`
+}
+
+// BrokerSubscriptions lists the active subscriptions of a broker
+type BrokerSubscriptions struct {
+	Connected     bool               `json:"connected"`
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
+}
+
+// handleGetSubscriptions handles requests to list the subscription table of every broker, with the QoS each
+// subscription was made with and when it was last made, which shows whether subscriptions were restored after a reconnect
+func (s *Server) handleGetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	// Tenants only see their own subscriptions
+	namespace := s.tenantNamespace(r)
+
+	brokers := make(map[string]BrokerSubscriptions)
+	count := 0
+	for name, client := range s.mqttManager.GetAllClients() {
+		subscriptions := make([]SubscriptionInfo, 0)
+		for topic, subscription := range client.GetSubscriptions() {
+			topic, ok := utils.StripNamespace(namespace, topic)
+			if !ok {
+				continue
+			}
+
+			info := SubscriptionInfo{
+				Topic:        topic,
+				QoS:          subscription.QoS,
+				GrantedQoS:   subscription.GrantedQoS,
+				SubscribedAt: subscription.SubscribedAt,
+			}
+			if subscription.Shared() {
+				info.ShareGroup = subscription.ShareGroup
+				info.Filter, _ = utils.StripNamespace(namespace, subscription.Filter)
+			}
+			subscriptions = append(subscriptions, info)
+		}
+
+		// List subscriptions in a stable order
+		sort.Slice(subscriptions, func(i, j int) bool {
+			return subscriptions[i].Topic < subscriptions[j].Topic
+		})
+
+		brokers[name] = BrokerSubscriptions{
+			Connected:     client.IsConnected(),
+			Subscriptions: subscriptions,
+		}
+		count += len(subscriptions)
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"brokers": brokers,
+		"count":   count,
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestGetSubscriptions(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	s := newTestServer(t, broker, "key-a:subscribe|admin:tenant-a", "key-b:admin:tenant-b", "reader:read")
+
+	for _, req := range []SubscribeRequest{
+		{Topic: "sensors/#", QoS: qos(2)},
+		{Topic: "$share/workers/alerts/+", QoS: qos(1)},
+	} {
+		if rec := doRequest(t, s, http.MethodPost, "/subscribe", "key-a", req); rec.Code != http.StatusOK {
+			t.Fatalf("Expected subscribe to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/subscriptions", "key-a", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected listing subscriptions to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Brokers map[string]BrokerSubscriptions `json:"brokers"`
+		Count   int                            `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	subscriptions := response.Brokers["test"].Subscriptions
+	if response.Count != 2 || len(subscriptions) != 2 {
+		t.Fatalf("Expected 2 subscriptions, got %+v", response)
+	}
+	shared, plain := subscriptions[0], subscriptions[1]
+	if shared.Topic != "$share/workers/alerts/+" || shared.QoS != 1 || shared.ShareGroup != "workers" || shared.Filter != "alerts/+" {
+		t.Errorf("Unexpected shared subscription %+v", shared)
+	}
+	if plain.Topic != "sensors/#" || plain.QoS != 2 || plain.ShareGroup != "" || plain.SubscribedAt.IsZero() {
+		t.Errorf("Unexpected subscription %+v", plain)
+	}
+
+	// Other tenants don't see the subscriptions
+	rec = doRequest(t, s, http.MethodGet, "/subscriptions", "key-b", nil)
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Count != 0 {
+		t.Errorf("Expected no subscriptions for another tenant, got %d", response.Count)
+	}
+
+	// The subscription table requires the admin scope
+	if rec := doRequest(t, s, http.MethodGet, "/subscriptions", "reader", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without the admin scope, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
+)
+
+// tenantNamespace returns the topic namespace the caller is confined to, or "" for unrestricted callers
+func (s *Server) tenantNamespace(r *http.Request) string {
+	return auth.NamespaceFromContext(r.Context())
+}
+
+// tenantMessage reports whether a message belongs to the namespace and strips the namespace from its topic
+func tenantMessage(namespace string, msg *database.Message) bool {
+	topic, ok := utils.StripNamespace(namespace, msg.Topic)
+	if !ok {
+		return false
+	}
+	msg.Topic = topic
+	return true
+}
+
+// tenantWebhook reports whether a webhook belongs to the namespace and strips the namespace from its topic filter
+func tenantWebhook(namespace string, webhook *models.Webhook) bool {
+	filter, ok := utils.StripNamespace(namespace, webhook.TopicFilter)
+	if !ok {
+		return false
+	}
+	webhook.TopicFilter = filter
+	return true
+}
+
+// tenantWebhooks filters webhooks down to those belonging to the namespace
+func tenantWebhooks(namespace string, webhooks []*models.Webhook) []*models.Webhook {
+	filtered := make([]*models.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		if tenantWebhook(namespace, webhook) {
+			filtered = append(filtered, webhook)
+		}
+	}
+	return filtered
+}
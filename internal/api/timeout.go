@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeoutMiddleware is middleware that bounds each request with a deadline, answering 504 when it is exceeded
+func (s *Server) timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Streaming responses are long-lived by design, so they are also exempt from the server's read and write
+		// timeouts. Clearing the read deadline keeps it from cancelling the request's context mid-stream.
+		if isStreamingRequest(r) {
+			controller := http.NewResponseController(w)
+			controller.SetReadDeadline(time.Time{})
+			controller.SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.requestTimeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			for key, values := range tw.header {
+				w.Header()[key] = values
+			}
+			if tw.statusCode == 0 {
+				tw.statusCode = http.StatusOK
+			}
+			w.WriteHeader(tw.statusCode)
+			w.Write(tw.body.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Request timed out")
+			} else {
+				s.writeError(w, http.StatusServiceUnavailable, ErrCodeCancelled, "Request cancelled")
+			}
+		}
+	})
+}
+
+// streamingRoutes are the paths of the endpoints that stream their response or request body: the metrics stream
+// and message exports and imports
+var streamingRoutes = map[string]bool{
+	"/metrics/stream":  true,
+	"/messages/export": true,
+	"/messages/import": true,
+}
+
+// isStreamingRequest reports whether a request targets a streaming endpoint. Profiles are also exempt, since they
+// are recorded for as long as the request asks before they are sent. The decision is made by route only, never by
+// request headers, so clients can't lift the timeouts of other endpoints by asking for an event stream.
+func isStreamingRequest(r *http.Request) bool {
+	return streamingRoutes[r.URL.Path] || strings.HasPrefix(r.URL.Path, pprofPrefix)
+}
+
+// timeoutWriter buffers a handler's response so it can be discarded if the request times out
+type timeoutWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+	timedOut   bool
+	mu         sync.Mutex
+}
+
+// Header returns the buffered response headers
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// Write buffers response data, failing once the request has timed out
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.statusCode == 0 {
+		tw.statusCode = http.StatusOK
+	}
+	return tw.body.Write(data)
+}
+
+// WriteHeader records the response status code
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.statusCode != 0 {
+		return
+	}
+	tw.statusCode = statusCode
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/logger"
+)
+
+func TestSlowRequestTimesOut(t *testing.T) {
+	s := &Server{
+		logger:         logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		requestTimeout: 50 * time.Millisecond,
+	}
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	s.timeoutMiddleware(slow).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("Expected request to be cut off at the deadline, took %s", elapsed)
+	}
+}
+
+func TestFastRequestPassesThrough(t *testing.T) {
+	s := &Server{
+		logger:         logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		requestTimeout: time.Second,
+	}
+
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handled", "true")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	})
+
+	rec := httptest.NewRecorder()
+	s.timeoutMiddleware(fast).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if rec.Header().Get("X-Handled") != "true" {
+		t.Error("Expected handler headers to be passed through")
+	}
+	if rec.Body.String() != "done" {
+		t.Errorf("Expected body 'done', got '%s'", rec.Body.String())
+	}
+}
+
+func TestOnlyStreamingRoutesAreExempt(t *testing.T) {
+	s := &Server{
+		logger:         logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		requestTimeout: 50 * time.Millisecond,
+	}
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+
+	tests := []struct {
+		method   string
+		path     string
+		accept   string
+		expected int
+	}{
+		{http.MethodGet, "/metrics/stream", "", http.StatusOK},
+		{http.MethodGet, "/messages/export", "", http.StatusOK},
+		{http.MethodPost, "/messages/import", "", http.StatusOK},
+		{http.MethodPost, "/publish", "text/event-stream", http.StatusGatewayTimeout},
+		{http.MethodGet, "/status/stream", "", http.StatusGatewayTimeout},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		s.timeoutMiddleware(slow).ServeHTTP(rec, req)
+		if rec.Code != test.expected {
+			t.Errorf("Expected %s %s (Accept %q) to return %d, got %d", test.method, test.path, test.accept, test.expected, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// BuildInfo identifies the build of the running service, as injected at build time with -ldflags
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildDate string
+}
+
+// VersionResponse is the response of the version endpoint
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	// GoVersion is the Go release the service was built with
+	GoVersion string `json:"go_version"`
+}
+
+// SetBuildInfo sets the build information reported by the version endpoint
+func (s *Server) SetBuildInfo(info BuildInfo) {
+	s.buildInfo = info
+}
+
+// handleVersion handles requests for the build information of the running service
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, VersionResponse{
+		Version:   s.buildInfo.Version,
+		Commit:    s.buildInfo.Commit,
+		BuildDate: s.buildInfo.BuildDate,
+		GoVersion: runtime.Version(),
+	})
+}
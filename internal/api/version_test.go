@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestVersionReportsBuildInfoWithoutAPIKey(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "secret-key")
+	s.SetBuildInfo(BuildInfo{Version: "1.4.0", Commit: "3c4a849", BuildDate: "2026-10-16T12:00:00Z"})
+
+	rec := doRequest(t, s, http.MethodGet, "/version", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response VersionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := VersionResponse{Version: "1.4.0", Commit: "3c4a849", BuildDate: "2026-10-16T12:00:00Z", GoVersion: runtime.Version()}
+	if response != expected {
+		t.Errorf("Expected %+v, got %+v", expected, response)
+	}
+}
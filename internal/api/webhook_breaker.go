@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/models"
+)
+
+// States of the circuit of a webhook receiver
+const (
+	// CircuitClosed lets every delivery through
+	CircuitClosed = "closed"
+	// CircuitOpen short-circuits every delivery until the cooldown has passed
+	CircuitOpen = "open"
+	// CircuitHalfOpen lets a single probe through, closing the circuit if it succeeds and reopening it if it fails
+	CircuitHalfOpen = "half-open"
+)
+
+// errWebhookCircuitOpen is returned for a delivery attempt short-circuited by the breaker
+var errWebhookCircuitOpen = errors.New("webhook circuit is open")
+
+// WebhookCircuit describes the circuit of a webhook receiver
+type WebhookCircuit struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	// OpenedAt and RetryAt are set while the circuit isn't closed: RetryAt is when an open circuit lets a probe through
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	RetryAt  *time.Time `json:"retry_at,omitempty"`
+	// ShortCircuited counts the delivery attempts skipped since the service started
+	ShortCircuited int64 `json:"short_circuited"`
+}
+
+// webhookCircuit is the state of the circuit of a webhook receiver
+type webhookCircuit struct {
+	state    string
+	failures int
+	openedAt time.Time
+	// probing is set while the probe of a half-open circuit is in flight
+	probing        bool
+	shortCircuited int64
+}
+
+// webhookBreaker tracks consecutive delivery failures per webhook URL. After threshold failures in a row the
+// circuit of the URL opens, and attempts are short-circuited for the cooldown instead of each waiting out its
+// timeout and retries. Then one probe is let through to decide whether the receiver recovered.
+type webhookBreaker struct {
+	// threshold is the number of consecutive failures that open a circuit; 0 disables the breaker
+	threshold int
+	cooldown  time.Duration
+	logger    *logger.Logger
+	now       func() time.Time
+
+	mu sync.Mutex
+	// circuits holds the circuits of the URLs that failed at least once
+	circuits map[string]*webhookCircuit
+}
+
+// newWebhookBreaker creates a breaker configured by the webhook settings, using the defaults without any
+func newWebhookBreaker(cfg *config.WebhookConfig, log *logger.Logger) *webhookBreaker {
+	threshold, cooldown := config.DefaultWebhookBreakerThreshold, config.DefaultWebhookBreakerCooldown
+	if cfg != nil {
+		threshold = cfg.BreakerThreshold
+		if cfg.BreakerCooldown > 0 {
+			cooldown = cfg.BreakerCooldown
+		}
+	}
+
+	return &webhookBreaker{
+		threshold: threshold,
+		cooldown:  time.Duration(cooldown) * time.Second,
+		logger:    log,
+		now:       time.Now,
+		circuits:  make(map[string]*webhookCircuit),
+	}
+}
+
+// allow reports whether a delivery attempt to the URL may be made. An open circuit whose cooldown has
+// passed turns half-open and lets this attempt through as its probe.
+func (b *webhookBreaker) allow(url string) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit, ok := b.circuits[url]
+	if !ok {
+		return true
+	}
+
+	switch circuit.state {
+	case CircuitOpen:
+		if b.now().Before(circuit.openedAt.Add(b.cooldown)) {
+			break
+		}
+		circuit.state = CircuitHalfOpen
+		circuit.probing = true
+		b.logTransition(url, circuit)
+		return true
+	case CircuitHalfOpen:
+		if circuit.probing {
+			break
+		}
+		circuit.probing = true
+		return true
+	default:
+		return true
+	}
+
+	circuit.shortCircuited++
+	return false
+}
+
+// record updates the circuit of the URL with the outcome of an attempt allowed through
+func (b *webhookBreaker) record(url string, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit, ok := b.circuits[url]
+	if err == nil {
+		if ok {
+			reopened := circuit.state != CircuitClosed
+			circuit.state = CircuitClosed
+			circuit.failures = 0
+			circuit.probing = false
+			if reopened {
+				b.logTransition(url, circuit)
+			}
+		}
+		return
+	}
+
+	if !ok {
+		circuit = &webhookCircuit{state: CircuitClosed}
+		b.circuits[url] = circuit
+	}
+	circuit.failures++
+	circuit.probing = false
+	if circuit.state == CircuitHalfOpen || (circuit.state == CircuitClosed && circuit.failures >= b.threshold) {
+		circuit.state = CircuitOpen
+		circuit.openedAt = b.now()
+		b.logTransition(url, circuit)
+	}
+}
+
+// status returns the circuit of the URL
+func (b *webhookBreaker) status(url string) WebhookCircuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit, ok := b.circuits[url]
+	if !ok {
+		return WebhookCircuit{State: CircuitClosed}
+	}
+
+	status := WebhookCircuit{
+		State:               circuit.state,
+		ConsecutiveFailures: circuit.failures,
+		ShortCircuited:      circuit.shortCircuited,
+	}
+	if circuit.state != CircuitClosed {
+		openedAt, retryAt := circuit.openedAt, circuit.openedAt.Add(b.cooldown)
+		status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+	}
+	return status
+}
+
+// logTransition logs the new state of a circuit
+func (b *webhookBreaker) logTransition(url string, circuit *webhookCircuit) {
+	if b.logger == nil {
+		return
+	}
+
+	entry := b.logger.WithFields(map[string]interface{}{
+		"url":      url,
+		"state":    circuit.state,
+		"failures": circuit.failures,
+	})
+	switch circuit.state {
+	case CircuitOpen:
+		entry.WithField("cooldown", b.cooldown.String()).Warn("Webhook circuit opened, short-circuiting deliveries")
+	case CircuitHalfOpen:
+		entry.Info("Webhook circuit half-open, probing the receiver")
+	default:
+		entry.Info("Webhook circuit closed, the receiver recovered")
+	}
+}
+
+// attemptWebhook makes a delivery attempt through the circuit breaker, returning errWebhookCircuitOpen
+// without contacting the receiver while its circuit is open. Client errors other than 429 show the
+// receiver is up, so they don't count as failures of the receiver.
+func (s *Server) attemptWebhook(webhook *models.Webhook, body []byte) error {
+	if s.webhookBreaker == nil {
+		return s.postWebhook(webhook, body)
+	}
+
+	if !s.webhookBreaker.allow(webhook.URL) {
+		if s.metrics != nil {
+			s.metrics.IncrementWebhooksShortCircuited()
+		}
+		return errWebhookCircuitOpen
+	}
+
+	err := s.postWebhook(webhook, body)
+	outcome := err
+	var statusErr *webhookStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests {
+		outcome = nil
+	}
+	s.webhookBreaker.record(webhook.URL, outcome)
+	return err
+}
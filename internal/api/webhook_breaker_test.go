@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestWebhookBreakerTransitions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := newWebhookBreaker(&config.WebhookConfig{BreakerThreshold: 3, BreakerCooldown: 60}, nil)
+	breaker.now = func() time.Time { return now }
+
+	const url = "http://receiver.example.com/hook"
+	failure := errors.New("connection refused")
+	expectState := func(state string) {
+		t.Helper()
+		if circuit := breaker.status(url); circuit.State != state {
+			t.Fatalf("Expected the circuit to be %s, got %+v", state, circuit)
+		}
+	}
+
+	// Failures below the threshold, or interrupted by a success, keep the circuit closed
+	breaker.record(url, failure)
+	breaker.record(url, failure)
+	breaker.record(url, nil)
+	breaker.record(url, failure)
+	breaker.record(url, failure)
+	expectState(CircuitClosed)
+	if !breaker.allow(url) {
+		t.Fatal("Expected a closed circuit to allow deliveries")
+	}
+
+	// The third failure in a row opens it until the cooldown has passed
+	breaker.record(url, failure)
+	expectState(CircuitOpen)
+	if breaker.allow(url) || breaker.allow(url) {
+		t.Fatal("Expected an open circuit to short-circuit deliveries")
+	}
+	if circuit := breaker.status(url); circuit.ShortCircuited != 2 || !circuit.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected 2 short-circuited deliveries and a retry in a minute, got %+v", circuit)
+	}
+	if !breaker.allow("http://other.example.com/hook") {
+		t.Fatal("Expected the circuits of other URLs to stay closed")
+	}
+
+	// After the cooldown, a single probe is let through; its failure reopens the circuit
+	now = now.Add(time.Minute)
+	if !breaker.allow(url) {
+		t.Fatal("Expected a probe after the cooldown")
+	}
+	expectState(CircuitHalfOpen)
+	if breaker.allow(url) {
+		t.Fatal("Expected a single probe while half-open")
+	}
+	breaker.record(url, failure)
+	expectState(CircuitOpen)
+	if breaker.allow(url) {
+		t.Fatal("Expected a failed probe to reopen the circuit for another cooldown")
+	}
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	if !breaker.allow(url) {
+		t.Fatal("Expected a probe after the cooldown")
+	}
+	breaker.record(url, nil)
+	expectState(CircuitClosed)
+	if circuit := breaker.status(url); circuit.ConsecutiveFailures != 0 || circuit.OpenedAt != nil {
+		t.Errorf("Expected a reset circuit, got %+v", circuit)
+	}
+	if !breaker.allow(url) {
+		t.Fatal("Expected a closed circuit to allow deliveries")
+	}
+}
+
+func TestWebhookBreakerDisabled(t *testing.T) {
+	breaker := newWebhookBreaker(&config.WebhookConfig{BreakerThreshold: 0}, nil)
+	for i := 0; i < 10; i++ {
+		breaker.record("http://receiver.example.com/hook", errors.New("connection refused"))
+	}
+	if !breaker.allow("http://receiver.example.com/hook") {
+		t.Error("Expected a disabled breaker to allow every delivery")
+	}
+}
+
+func TestWebhookCircuitShortCircuitsDeliveries(t *testing.T) {
+	var requests int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+	s.webhookBreaker = newWebhookBreaker(&config.WebhookConfig{BreakerThreshold: 2, BreakerCooldown: 60}, s.logger)
+
+	webhook := models.NewWebhook()
+	webhook.URL = receiver.URL
+	webhook.TopicFilter = "sensors/#"
+	webhook.RetryCount = 1
+	webhook.RetryDelay = 0
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+
+	// The first notification fails both attempts and opens the circuit, so the next ones don't reach the receiver
+	for i := 0; i < 3; i++ {
+		s.sendWebhookNotification("sensors/temp", "test", 21.5, 0, "")
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("Expected 2 requests to the receiver, got %d", got)
+	}
+	if s.metrics.WebhooksShortCircuited != 2 {
+		t.Errorf("Expected 2 short-circuited deliveries, got %d", s.metrics.WebhooksShortCircuited)
+	}
+
+	// Short-circuited notifications are kept in the delivery log to be retried once the receiver recovers
+	deliveries, err := s.db.GetWebhookDeliveries(context.Background(), webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get deliveries: %v", err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("Expected 3 deliveries, got %d", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status != models.DeliveryStatusPending {
+			t.Errorf("Expected pending deliveries, got %+v", delivery)
+		}
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/webhooks/"+webhook.ID, "admin-key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Circuit WebhookCircuit `json:"circuit"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Circuit.State != CircuitOpen || response.Circuit.ConsecutiveFailures != 2 || response.Circuit.ShortCircuited != 2 {
+		t.Errorf("Expected an open circuit after 2 failures, got %+v", response.Circuit)
+	}
+}
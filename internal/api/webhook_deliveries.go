@@ -0,0 +1,390 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// deliveryWorkerInterval is how often the delivery worker looks for failed deliveries to retry
+	deliveryWorkerInterval = 30 * time.Second
+	// deliveryRetryBaseDelay is the delay before the first redelivery, doubled for every further attempt
+	deliveryRetryBaseDelay = 30 * time.Second
+	// deliveryRetryMaxDelay caps the delay between redeliveries
+	deliveryRetryMaxDelay = time.Hour
+	// deliveryBatchSize is the maximum number of deliveries retried per worker run
+	deliveryBatchSize = 100
+	// deliveryPurgeInterval is how often the delivery worker deletes finished deliveries past their retention
+	deliveryPurgeInterval = time.Hour
+)
+
+// recordWebhookDelivery persists the outcome of a delivery, scheduling a retry if it failed.
+// It reports whether the delivery was recorded.
+func (s *Server) recordWebhookDelivery(webhook *models.Webhook, topic string, body []byte, attempts int, deliveryErr error) bool {
+	if s.db == nil {
+		return false
+	}
+
+	delivery := &models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		Topic:     topic,
+		Payload:   string(body),
+		Status:    models.DeliveryStatusDelivered,
+		Attempts:  attempts,
+	}
+	if deliveryErr != nil {
+		delivery.Status = models.DeliveryStatusPending
+		delivery.LastError = deliveryErr.Error()
+		delivery.NextRetryAt = time.Now().Add(deliveryRetryDelay(attempts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.StoreWebhookDelivery(ctx, delivery); err != nil {
+		s.logger.WithError(err).WithField("webhook_id", webhook.ID).Error("Failed to record webhook delivery")
+		return false
+	}
+	return true
+}
+
+// deliveryRetryDelay returns the exponential backoff delay after the given number of attempts
+func deliveryRetryDelay(attempts int) time.Duration {
+	delay := deliveryRetryBaseDelay
+	for i := 1; i < attempts && delay < deliveryRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > deliveryRetryMaxDelay {
+		delay = deliveryRetryMaxDelay
+	}
+	return delay
+}
+
+// deliveryMaxAge returns how long failed deliveries keep being retried, and how long finished deliveries are kept
+func (s *Server) deliveryMaxAge() time.Duration {
+	if s.config != nil && s.config.Webhook != nil && s.config.Webhook.DeliveryMaxAge > 0 {
+		return time.Duration(s.config.Webhook.DeliveryMaxAge) * time.Second
+	}
+	return 24 * time.Hour
+}
+
+// startDeliveryWorker starts the background worker that re-drives failed deliveries
+func (s *Server) startDeliveryWorker() {
+	if s.db == nil || s.deliveryStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	s.deliveryStop = stop
+
+	go func() {
+		ticker := time.NewTicker(deliveryWorkerInterval)
+		defer ticker.Stop()
+		purgeTicker := time.NewTicker(deliveryPurgeInterval)
+		defer purgeTicker.Stop()
+
+		s.purgeOldDeliveries()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.retryDueDeliveries()
+			case <-purgeTicker.C:
+				s.purgeOldDeliveries()
+			}
+		}
+	}()
+}
+
+// stopDeliveryWorker stops the delivery worker if it is running
+func (s *Server) stopDeliveryWorker() {
+	if s.deliveryStop != nil {
+		close(s.deliveryStop)
+		s.deliveryStop = nil
+	}
+}
+
+// retryDueDeliveries redelivers every failed delivery whose next retry is due
+func (s *Server) retryDueDeliveries() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	deliveries, err := s.db.GetDueWebhookDeliveries(ctx, time.Now(), deliveryBatchSize)
+	cancel()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get due webhook deliveries")
+		return
+	}
+
+	for _, delivery := range deliveries {
+		s.redeliver(delivery)
+	}
+}
+
+// purgeOldDeliveries deletes delivered and failed deliveries that finished more than the maximum delivery age ago,
+// so the delivery log doesn't grow without bound. Pending deliveries are kept until they are delivered or failed.
+func (s *Server) purgeOldDeliveries() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	deleted, err := s.db.DeleteWebhookDeliveriesBefore(ctx, time.Now().Add(-s.deliveryMaxAge()))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to purge old webhook deliveries")
+		return
+	}
+	if deleted > 0 {
+		s.logger.WithField("count", deleted).Info("Purged old webhook deliveries")
+	}
+}
+
+// redeliver makes one more attempt at a delivery and records the outcome.
+// Deliveries still failing after the maximum age, or whose webhook was deleted, are marked as failed and dead-lettered.
+func (s *Server) redeliver(delivery *models.WebhookDelivery) error {
+	var deliveryErr error
+	var url string
+	alreadyFailed := delivery.Status == models.DeliveryStatusFailed
+
+	// The lookup is bounded on its own, since the attempt itself may take as long as the webhook's timeout
+	lookupCtx, cancelLookup := context.WithTimeout(context.Background(), 5*time.Second)
+	webhook, err := s.deliveryWebhook(lookupCtx, delivery.WebhookID)
+	cancelLookup()
+	if err != nil {
+		deliveryErr = err
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.NextRetryAt = time.Time{}
+	} else {
+		url = webhook.URL
+		deliveryErr = s.attemptWebhook(webhook, []byte(delivery.Payload))
+		if deliveryErr != errWebhookCircuitOpen {
+			delivery.Attempts++
+		}
+
+		switch {
+		case deliveryErr == nil:
+			delivery.Status = models.DeliveryStatusDelivered
+			delivery.NextRetryAt = time.Time{}
+		case time.Since(delivery.CreatedAt) >= s.deliveryMaxAge():
+			delivery.Status = models.DeliveryStatusFailed
+			delivery.NextRetryAt = time.Time{}
+		default:
+			delivery.Status = models.DeliveryStatusPending
+			delivery.NextRetryAt = time.Now().Add(deliveryRetryDelay(delivery.Attempts))
+		}
+	}
+
+	delivery.LastError = ""
+	if deliveryErr != nil {
+		delivery.LastError = deliveryErr.Error()
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"status":      delivery.Status,
+		"attempts":    delivery.Attempts,
+	}).Info("Webhook redelivery attempted")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		s.logger.WithError(err).WithField("delivery_id", delivery.ID).Error("Failed to update webhook delivery")
+		return deliveryErr
+	}
+
+	// Deliveries are dead-lettered once, when they are given up on and that is stored, and not again on manual
+	// retries. Deliveries whose update failed stay due and are dead-lettered by a later attempt.
+	if delivery.Status == models.DeliveryStatusFailed && !alreadyFailed {
+		s.deadLetter(deliveryNotification(delivery), delivery.WebhookID, url, delivery.Attempts, deliveryErr)
+	}
+
+	return deliveryErr
+}
+
+// deliveryNotification recovers the notification of a recorded delivery from its body. Bodies rendered with a body
+// template may not be notifications, in which case the body is returned as the payload of the delivery's topic.
+func deliveryNotification(delivery *models.WebhookDelivery) WebhookPayload {
+	var notification WebhookPayload
+	if err := json.Unmarshal([]byte(delivery.Payload), &notification); err != nil || notification.Topic == "" {
+		return WebhookPayload{Topic: delivery.Topic, Payload: delivery.Payload}
+	}
+	return notification
+}
+
+// deliveryWebhook resolves the webhook a delivery was made to
+func (s *Server) deliveryWebhook(ctx context.Context, webhookID string) (*models.Webhook, error) {
+	if webhookID == models.GlobalWebhookID {
+		webhook := s.globalWebhook()
+		if webhook == nil {
+			return nil, fmt.Errorf("global webhook is no longer enabled")
+		}
+		return webhook, nil
+	}
+	if webhookID == models.ConfirmWebhookID {
+		webhook := s.confirmWebhook()
+		if webhook == nil {
+			return nil, fmt.Errorf("confirmation webhook is no longer configured")
+		}
+		return webhook, nil
+	}
+
+	webhook, err := s.db.GetWebhookByID(ctx, webhookID)
+	if err == database.ErrMessageNotFound {
+		return nil, fmt.Errorf("webhook no longer exists")
+	}
+	return webhook, err
+}
+
+// tenantOwnsWebhook reports whether the caller may access the webhook with the given ID
+func (s *Server) tenantOwnsWebhook(ctx context.Context, r *http.Request, webhookID string) (bool, error) {
+	namespace := s.tenantNamespace(r)
+	if namespace == "" {
+		return true, nil
+	}
+	if webhookID == models.GlobalWebhookID || webhookID == models.ConfirmWebhookID {
+		return false, nil
+	}
+
+	webhook, err := s.db.GetWebhookByID(ctx, webhookID)
+	if err == database.ErrMessageNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return tenantWebhook(namespace, webhook), nil
+}
+
+// tenantDelivery strips the caller's namespace from a delivery's topic
+func (s *Server) tenantDelivery(r *http.Request, delivery *models.WebhookDelivery) {
+	if topic, ok := utils.StripNamespace(s.tenantNamespace(r), delivery.Topic); ok {
+		delivery.Topic = topic
+	}
+}
+
+// handleGetWebhookDeliveries handles requests to list the recent deliveries of a webhook
+func (s *Server) handleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Get the webhook ID from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Webhook ID is required")
+		return
+	}
+
+	// Get query parameters
+	limitStr := r.URL.Query().Get("limit")
+	limit := 100 // Default limit
+	if limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid limit parameter")
+			return
+		}
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Tenants can only inspect their own webhooks
+	owned, err := s.tenantOwnsWebhook(ctx, r, id)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook: %v", err))
+		return
+	}
+	if !owned {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		return
+	}
+
+	// Get deliveries from the database
+	deliveries, err := s.db.GetWebhookDeliveries(ctx, id, limit)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook deliveries: %v", err))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		s.tenantDelivery(r, delivery)
+	}
+
+	// Write the response
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// handleRetryWebhookDelivery handles requests to force the redelivery of a webhook notification
+func (s *Server) handleRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
+		return
+	}
+
+	// Get the delivery ID from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Delivery ID is required")
+		return
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Get the delivery from the database
+	delivery, err := s.db.GetWebhookDeliveryByID(ctx, id)
+	if err != nil {
+		if err == database.ErrDeliveryNotFound {
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Delivery not found")
+		} else {
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook delivery: %v", err))
+		}
+		return
+	}
+
+	// Tenants can only retry deliveries of their own webhooks
+	owned, err := s.tenantOwnsWebhook(ctx, r, delivery.WebhookID)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook: %v", err))
+		return
+	}
+	if !owned {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Delivery not found")
+		return
+	}
+
+	// Redeliver the notification
+	if err := s.redeliver(delivery); err != nil {
+		s.writeError(w, http.StatusBadGateway, ErrCodeDeliveryFailed, fmt.Sprintf("Redelivery failed: %v", err))
+		return
+	}
+
+	s.tenantDelivery(r, delivery)
+
+	// Write the response
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "success",
+		"message":  fmt.Sprintf("Delivery %s redelivered", id),
+		"delivery": delivery,
+	})
+}
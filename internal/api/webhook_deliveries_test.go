@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestFailedDeliveryIsRecordedAndRedelivered(t *testing.T) {
+	var healthy int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+
+	webhook := models.NewWebhook()
+	webhook.URL = receiver.URL
+	webhook.TopicFilter = "sensors/#"
+	webhook.RetryCount = 1
+	webhook.RetryDelay = 0
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+
+	s.sendWebhookNotification("sensors/temp", "test", 21.5, 0, "")
+
+	deliveries, err := s.db.GetWebhookDeliveries(context.Background(), webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get deliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(deliveries))
+	}
+
+	delivery := deliveries[0]
+	if delivery.Status != models.DeliveryStatusPending {
+		t.Errorf("Expected status '%s', got '%s'", models.DeliveryStatusPending, delivery.Status)
+	}
+	if delivery.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", delivery.Attempts)
+	}
+	if delivery.NextRetryAt.IsZero() {
+		t.Error("Expected a next retry time for a failed delivery")
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+
+	rec := doRequest(t, s, http.MethodPost, "/webhooks/deliveries/"+delivery.ID+"/retry", "admin-key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected redelivery to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	delivery, err = s.db.GetWebhookDeliveryByID(context.Background(), delivery.ID)
+	if err != nil {
+		t.Fatalf("Failed to get delivery: %v", err)
+	}
+	if delivery.Status != models.DeliveryStatusDelivered {
+		t.Errorf("Expected status '%s', got '%s'", models.DeliveryStatusDelivered, delivery.Status)
+	}
+	if delivery.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", delivery.Attempts)
+	}
+}
+
+func TestOldDeliveriesArePurged(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "admin-key")
+	s.config.Webhook = &config.WebhookConfig{DeliveryMaxAge: 3600}
+	ctx := context.Background()
+
+	old := time.Now().Add(-2 * time.Hour)
+	deliveries := []*models.WebhookDelivery{
+		{ID: "old-delivered", Status: models.DeliveryStatusDelivered, CreatedAt: old, UpdatedAt: old},
+		{ID: "old-failed", Status: models.DeliveryStatusFailed, CreatedAt: old, UpdatedAt: old},
+		{ID: "old-pending", Status: models.DeliveryStatusPending, CreatedAt: old, UpdatedAt: old, NextRetryAt: time.Now()},
+		{ID: "recent-failed", Status: models.DeliveryStatusFailed, CreatedAt: old, UpdatedAt: time.Now()},
+		{ID: "recent-delivered", Status: models.DeliveryStatusDelivered},
+	}
+	for _, delivery := range deliveries {
+		delivery.WebhookID = "webhook"
+		delivery.Topic = "sensors/temp"
+		if err := s.db.StoreWebhookDelivery(ctx, delivery); err != nil {
+			t.Fatalf("Failed to store delivery: %v", err)
+		}
+	}
+
+	s.purgeOldDeliveries()
+
+	expected := map[string]bool{
+		"old-delivered":    false,
+		"old-failed":       false,
+		"old-pending":      true,
+		"recent-failed":    true,
+		"recent-delivered": true,
+	}
+	for id, kept := range expected {
+		_, err := s.db.GetWebhookDeliveryByID(ctx, id)
+		if kept && err != nil {
+			t.Errorf("Expected delivery %s to be kept, got %v", id, err)
+		}
+		if !kept && err != database.ErrDeliveryNotFound {
+			t.Errorf("Expected delivery %s to be purged, got %v", id, err)
+		}
+	}
+}
+
+func TestSlowRedeliveryIsStored(t *testing.T) {
+	// The receiver answers after the 5 second bound of delivery lookups and updates
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5500 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker, "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true, DLQTopic: "webhooks/dead-letters", DeliveryMaxAge: 3600}
+	connectDefaultClient(t, s)
+
+	webhook := &models.Webhook{ID: "slow-hook", URL: receiver.URL, Method: http.MethodPost, TopicFilter: "sensors/#", Enabled: true, Timeout: 10, RetryDelay: 1}
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+	delivery := &models.WebhookDelivery{
+		ID:          "slow-delivery",
+		WebhookID:   webhook.ID,
+		Topic:       "sensors/temp",
+		Payload:     `{"topic":"sensors/temp","payload":21.5}`,
+		Status:      models.DeliveryStatusPending,
+		Attempts:    1,
+		CreatedAt:   time.Now().Add(-2 * time.Hour),
+		NextRetryAt: time.Now(),
+	}
+	if err := s.db.StoreWebhookDelivery(context.Background(), delivery); err != nil {
+		t.Fatalf("Failed to store delivery: %v", err)
+	}
+
+	if err := s.redeliver(delivery); err == nil {
+		t.Fatal("Expected the redelivery to fail")
+	}
+
+	stored, err := s.db.GetWebhookDeliveryByID(context.Background(), delivery.ID)
+	if err != nil {
+		t.Fatalf("Failed to get delivery: %v", err)
+	}
+	if stored.Status != models.DeliveryStatusFailed || stored.Attempts != 2 {
+		t.Errorf("Expected the failed attempt to be stored, got status '%s' after %d attempts", stored.Status, stored.Attempts)
+	}
+
+	broker.WaitForPublished(t, 1)
+	time.Sleep(200 * time.Millisecond)
+	if published := broker.Published(); len(published) != 1 {
+		t.Errorf("Expected a single dead letter, got %d messages", len(published))
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"time"
+)
+
+// DeadLetter is the message republished to the dead-letter topic for a notification whose delivery was given up on
+type DeadLetter struct {
+	// Notification is the payload the webhook was notified with
+	Notification WebhookPayload `json:"notification"`
+	WebhookID    string         `json:"webhook_id"`
+	URL          string         `json:"url"`
+	Attempts     int            `json:"attempts"`
+	Error        string         `json:"error"`
+	FailedAt     string         `json:"failed_at"`
+}
+
+// deadLetter republishes a failed notification to the dead-letter topic with the default client, if one is
+// configured. It is best-effort: the publish doesn't block the caller, and a failed publish is only logged.
+// Notifications are dead-lettered when the delivery worker marks their delivery as failed, or right away when
+// their delivery couldn't be recorded for the worker to retry.
+func (s *Server) deadLetter(webhookPayload WebhookPayload, webhookID, url string, attempts int, deliveryErr error) {
+	if s.config == nil || s.config.Webhook == nil || s.config.Webhook.DLQTopic == "" || s.mqttManager == nil {
+		return
+	}
+	topic := s.config.Webhook.DLQTopic
+
+	// Notifications of dead letters aren't dead-lettered again, which could loop forever
+	if webhookPayload.Topic == topic {
+		return
+	}
+
+	letter := DeadLetter{
+		Notification: webhookPayload,
+		WebhookID:    webhookID,
+		URL:          url,
+		Attempts:     attempts,
+		Error:        deliveryErr.Error(),
+		FailedAt:     time.Now().Format(time.RFC3339),
+	}
+
+	go func() {
+		client, err := s.mqttManager.GetDefaultClient()
+		if err == nil {
+			err = client.Publish(topic, 1, false, letter)
+		}
+		if err != nil {
+			s.logger.WithError(err).WithFields(map[string]interface{}{
+				"topic":      topic,
+				"webhook_id": webhookID,
+			}).Error("Failed to dead-letter webhook notification")
+			return
+		}
+
+		if s.metrics != nil {
+			s.metrics.IncrementWebhooksDeadLettered()
+		}
+		s.logger.WithFields(map[string]interface{}{
+			"topic":      topic,
+			"webhook_id": webhookID,
+		}).Warn("Webhook notification dead-lettered")
+	}()
+}
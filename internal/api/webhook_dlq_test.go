@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestFailedNotificationIsDeadLetteredWithoutDeliveryLog(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker)
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true, DLQTopic: "webhooks/dead-letters"}
+	connectDefaultClient(t, s)
+
+	// Deliveries can't be recorded once the database is closed
+	s.db.Close(context.Background())
+
+	webhook := &models.Webhook{ID: "hook-1", URL: receiver.URL, Method: http.MethodPost, Timeout: 5, RetryCount: 0, RetryDelay: 1}
+	s.sendWebhookNotificationToURL(WebhookPayload{Topic: "sensors/temp", Payload: 21.5, QoS: 1, Broker: "test"}, webhook)
+
+	published := broker.WaitForPublished(t, 1)
+	if published[0].TopicName != "webhooks/dead-letters" {
+		t.Fatalf("Expected message on 'webhooks/dead-letters', got '%s'", published[0].TopicName)
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal(published[0].Payload, &letter); err != nil {
+		t.Fatalf("Failed to decode dead letter: %v", err)
+	}
+	if letter.Notification.Topic != "sensors/temp" || letter.Notification.Payload != 21.5 {
+		t.Errorf("Expected the original notification, got %+v", letter.Notification)
+	}
+	if letter.WebhookID != "hook-1" || letter.Attempts != 1 || letter.Error == "" {
+		t.Errorf("Expected failure metadata, got %+v", letter)
+	}
+
+	// The counter is incremented once the broker acknowledged the dead letter
+	deadline := time.Now().Add(2 * time.Second)
+	for s.metrics.GetMetrics()["webhooks"].(map[string]int64)["dead_lettered"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the dead-lettered counter to be incremented")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecordedDeliveryIsDeadLetteredOnceItFails(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker)
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true, DLQTopic: "webhooks/dead-letters", DeliveryMaxAge: 3600}
+	connectDefaultClient(t, s)
+
+	webhook := &models.Webhook{ID: "hook-1", URL: receiver.URL, Method: http.MethodPost, Timeout: 5, RetryCount: 0, RetryDelay: 1, Enabled: true}
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+	s.sendWebhookNotificationToURL(WebhookPayload{Topic: "sensors/temp", Payload: 21.5, QoS: 1, Broker: "test"}, webhook)
+
+	// The delivery is retried in the background, so it isn't dead-lettered yet
+	time.Sleep(200 * time.Millisecond)
+	if published := broker.Published(); len(published) != 0 {
+		t.Fatalf("Expected no dead letter while the delivery is pending, got %d messages", len(published))
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveries(context.Background(), webhook.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d (%v)", len(deliveries), err)
+	}
+	delivery := deliveries[0]
+	delivery.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := s.redeliver(delivery); err == nil || delivery.Status != models.DeliveryStatusFailed {
+		t.Fatalf("Expected the delivery to fail after the maximum age, got status '%s' (%v)", delivery.Status, err)
+	}
+
+	published := broker.WaitForPublished(t, 1)
+	var letter DeadLetter
+	if err := json.Unmarshal(published[0].Payload, &letter); err != nil {
+		t.Fatalf("Failed to decode dead letter: %v", err)
+	}
+	if letter.Notification.Topic != "sensors/temp" || letter.Notification.Payload != 21.5 {
+		t.Errorf("Expected the original notification, got %+v", letter.Notification)
+	}
+	if letter.WebhookID != "hook-1" || letter.URL != receiver.URL || letter.Attempts != 2 || letter.Error == "" {
+		t.Errorf("Expected failure metadata, got %+v", letter)
+	}
+
+	// Retrying a failed delivery by hand doesn't dead-letter it again
+	s.redeliver(delivery)
+	time.Sleep(200 * time.Millisecond)
+	if published := broker.Published(); len(published) != 1 {
+		t.Errorf("Expected a single dead letter, got %d messages", len(published))
+	}
+}
+
+func TestDeadLetterNotificationsAreNotDeadLettered(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	s := newTestServer(t, broker)
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true, DLQTopic: "webhooks/dead-letters"}
+	connectDefaultClient(t, s)
+
+	webhook := &models.Webhook{ID: "hook-1", URL: receiver.URL, Method: http.MethodPost, Timeout: 5, RetryCount: 0, RetryDelay: 1}
+	s.sendWebhookNotificationToURL(WebhookPayload{Topic: "webhooks/dead-letters", Payload: "{}"}, webhook)
+
+	time.Sleep(200 * time.Millisecond)
+	if published := broker.Published(); len(published) != 0 {
+		t.Errorf("Expected no dead letter, got %d messages", len(published))
+	}
+}
+
+// connectDefaultClient connects the server's default broker client
+func connectDefaultClient(t *testing.T, s *Server) {
+	t.Helper()
+
+	client, err := s.mqttManager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Failed to get client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestWebhookFiltersSkipNotifications(t *testing.T) {
+	var notifications int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&notifications, 1)
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted))
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+
+	webhook := models.NewWebhook()
+	webhook.URL = receiver.URL
+	webhook.TopicFilter = "sensors/#"
+	webhook.MinQoS = 1
+	webhook.Condition = &models.PayloadCondition{Path: "temperature", Operator: ">", Value: 30}
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+
+	// Below the minimum QoS, then below the threshold
+	s.sendWebhookNotification("sensors/temp", "test", map[string]interface{}{"temperature": 35.0}, 0, "")
+	s.sendWebhookNotification("sensors/temp", "test", map[string]interface{}{"temperature": 25.0}, 1, "")
+	if got := atomic.LoadInt32(&notifications); got != 0 {
+		t.Fatalf("Expected no notifications, got %d", got)
+	}
+	if skipped := s.metrics.WebhooksSkipped; skipped != 2 {
+		t.Errorf("Expected 2 skipped notifications, got %d", skipped)
+	}
+
+	s.sendWebhookNotification("sensors/temp", "test", map[string]interface{}{"temperature": 35.0}, 1, "")
+	if got := atomic.LoadInt32(&notifications); got != 1 {
+		t.Errorf("Expected 1 notification, got %d", got)
+	}
+}
+
+func TestGlobalWebhookTopicFilter(t *testing.T) {
+	var notifications int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&notifications, 1)
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted))
+	s.config.Webhook = &config.WebhookConfig{
+		Enabled:      true,
+		URL:          receiver.URL,
+		Method:       http.MethodPost,
+		TopicFilter:  "alerts/#",
+		Timeout:      5,
+		RetryDelay:   1,
+		AllowPrivate: true,
+	}
+
+	s.sendWebhookNotification("sensors/temp", "test", 21.5, 0, "")
+	if got := atomic.LoadInt32(&notifications); got != 0 {
+		t.Fatalf("Expected no notification for a non-matching topic, got %d", got)
+	}
+
+	s.sendWebhookNotification("alerts/door", "test", "open", 0, "")
+	if got := atomic.LoadInt32(&notifications); got != 1 {
+		t.Errorf("Expected 1 notification for a matching topic, got %d", got)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"MQTTmicroService/internal/models"
+)
+
+// allowPrivateWebhooks reports whether webhooks may target loopback, link-local, and private addresses
+func (s *Server) allowPrivateWebhooks() bool {
+	return s.config != nil && s.config.Webhook != nil && s.config.Webhook.AllowPrivate
+}
+
+// webhookTransport returns the HTTP transport used to deliver to a webhook. Unless private destinations
+// are allowed, database webhooks get the shared transport that refuses to connect to non-public addresses,
+// which also covers hosts whose DNS records changed after the webhook was validated.
+// The global and confirmation webhooks are configured by the operator and are trusted.
+func (s *Server) webhookTransport(webhook *models.Webhook) http.RoundTripper {
+	if s.allowPrivateWebhooks() || webhook.ID == models.GlobalWebhookID || webhook.ID == models.ConfirmWebhookID {
+		return http.DefaultTransport
+	}
+	return s.publicWebhookTransport
+}
+
+// newPublicWebhookTransport creates a transport that only connects to public addresses. It is created
+// once per server so connections to receivers are pooled across deliveries.
+func newPublicWebhookTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicAddressOnly,
+	}).DialContext
+	return transport
+}
+
+// publicAddressOnly is a dialer control function that rejects connections to non-public addresses
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("webhook destination %s is not an IP address", host)
+	}
+	if kind := models.PrivateAddressKind(ip); kind != "" {
+		return fmt.Errorf("webhook destination %s is %s address, which is not allowed", ip, kind)
+	}
+	return nil
+}
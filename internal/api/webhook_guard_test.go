@@ -0,0 +1,36 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/models"
+)
+
+func TestWebhookTransportIsShared(t *testing.T) {
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	s := NewServer(nil, log, nil, nil, nil, &config.Config{Webhook: &config.WebhookConfig{}}, ":0", HTTPTimeouts{})
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	webhook := &models.Webhook{ID: "webhook-1", URL: receiver.URL, Method: http.MethodPost, Timeout: 5}
+	first := s.webhookTransport(webhook)
+	if first != s.webhookTransport(&models.Webhook{ID: "webhook-2"}) {
+		t.Error("Expected database webhooks to share one transport")
+	}
+	if first == http.DefaultTransport {
+		t.Error("Expected database webhooks not to use the default transport")
+	}
+
+	// The shared transport still refuses non-public destinations
+	err := s.postWebhook(webhook, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a loopback receiver to be refused, got %v", err)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"strconv"
 	"time"
 
+	"MQTTmicroService/internal/database"
 	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
 
 	"github.com/gorilla/mux"
 )
@@ -24,12 +26,34 @@ type WebhookRequest struct {
 	Timeout     int               `json:"timeout"`
 	RetryCount  int               `json:"retry_count"`
 	RetryDelay  int               `json:"retry_delay"`
+	Secret      string            `json:"secret,omitempty"`
+	// BodyTemplate and ContentType are pointers so an update can clear them with an empty string
+	BodyTemplate *string `json:"body_template,omitempty"`
+	ContentType  *string `json:"content_type,omitempty"`
+	// MinQoS is a pointer so an update can lower it back to 0
+	MinQoS *byte `json:"min_qos,omitempty"`
+	// Condition replaces the webhook's payload condition; an update with an empty condition ({}) removes it
+	Condition *models.PayloadCondition `json:"condition,omitempty"`
+}
+
+// applyFilters sets the QoS and payload filters of a webhook from the request
+func (req *WebhookRequest) applyFilters(webhook *models.Webhook) {
+	if req.MinQoS != nil {
+		webhook.MinQoS = *req.MinQoS
+	}
+	if req.Condition != nil {
+		if req.Condition.Path == "" && req.Condition.Operator == "" && req.Condition.Value == nil {
+			webhook.Condition = nil
+		} else {
+			webhook.Condition = req.Condition
+		}
+	}
 }
 
 // handleGetWebhooks handles requests to get all webhooks
 func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -40,7 +64,7 @@ func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
 		var err error
 		limit, err = strconv.Atoi(limitStr)
 		if err != nil {
-			s.writeError(w, http.StatusBadRequest, "Invalid limit parameter")
+			s.writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid limit parameter")
 			return
 		}
 	}
@@ -52,10 +76,13 @@ func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
 	// Get webhooks from the database
 	webhooks, err := s.db.GetWebhooks(ctx, limit)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get webhooks: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhooks: %v", err))
 		return
 	}
 
+	// Tenants only see their own webhooks
+	webhooks = tenantWebhooks(s.tenantNamespace(r), webhooks)
+
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":   "success",
@@ -67,7 +94,7 @@ func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
 // handleGetWebhook handles requests to get a specific webhook
 func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -75,7 +102,7 @@ func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		s.writeError(w, http.StatusBadRequest, "Webhook ID is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Webhook ID is required")
 		return
 	}
 
@@ -85,39 +112,54 @@ func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
 
 	// Get the webhook from the database
 	webhook, err := s.db.GetWebhookByID(ctx, id)
+	if err == database.ErrMessageNotFound {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		return
+	}
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get webhook: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook: %v", err))
+		return
+	}
+	if !tenantWebhook(s.tenantNamespace(r), webhook) {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
 		return
 	}
 
+	// Include the state of the receiver's circuit breaker
+	circuit := WebhookCircuit{State: CircuitClosed}
+	if s.webhookBreaker != nil {
+		circuit = s.webhookBreaker.status(webhook.URL)
+	}
+
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
 		"webhook": webhook,
+		"circuit": circuit,
 	})
 }
 
 // handleCreateWebhook handles requests to create a new webhook
 func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
 	// Parse the request body
 	var req WebhookRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	// Validate the request
 	if req.URL == "" {
-		s.writeError(w, http.StatusBadRequest, "URL is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "URL is required")
 		return
 	}
 	if req.TopicFilter == "" {
-		s.writeError(w, http.StatusBadRequest, "Topic filter is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Topic filter is required")
 		return
 	}
 
@@ -126,16 +168,29 @@ func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
 	webhook.Name = req.Name
 	webhook.URL = req.URL
 	webhook.Method = req.Method
-	webhook.TopicFilter = req.TopicFilter
+	webhook.TopicFilter = utils.ApplyNamespace(s.tenantNamespace(r), s.normalizeTopic(req.TopicFilter))
+	webhook.Namespace = s.tenantNamespace(r)
 	webhook.Enabled = req.Enabled
 	webhook.Headers = req.Headers
 	webhook.Timeout = req.Timeout
 	webhook.RetryCount = req.RetryCount
 	webhook.RetryDelay = req.RetryDelay
+	webhook.Secret = req.Secret
+	if req.BodyTemplate != nil {
+		webhook.BodyTemplate = *req.BodyTemplate
+	}
+	if req.ContentType != nil {
+		webhook.ContentType = *req.ContentType
+	}
+	req.applyFilters(webhook)
 
-	// Validate the webhook
+	// Validate the webhook, including where its URL points
 	if err := webhook.Validate(); err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid webhook: %v", err))
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidWebhook, fmt.Sprintf("Invalid webhook: %v", err))
+		return
+	}
+	if err := webhook.ValidateURL(s.allowPrivateWebhooks()); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidWebhook, fmt.Sprintf("Invalid webhook: %v", err))
 		return
 	}
 
@@ -145,9 +200,11 @@ func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
 
 	// Store the webhook in the database
 	if err := s.db.StoreWebhook(ctx, webhook); err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store webhook: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to store webhook: %v", err))
 		return
 	}
+	s.webhookIndex.invalidate()
+	tenantWebhook(s.tenantNamespace(r), webhook)
 
 	// Write the response
 	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
@@ -160,7 +217,7 @@ func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
 // handleUpdateWebhook handles requests to update a webhook
 func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -168,14 +225,14 @@ func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		s.writeError(w, http.StatusBadRequest, "Webhook ID is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Webhook ID is required")
 		return
 	}
 
 	// Parse the request body
 	var req WebhookRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -185,8 +242,17 @@ func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
 
 	// Get the existing webhook
 	webhook, err := s.db.GetWebhookByID(ctx, id)
+	if err == database.ErrMessageNotFound {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		return
+	}
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get webhook: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook: %v", err))
+		return
+	}
+	namespace := s.tenantNamespace(r)
+	if !tenantWebhook(namespace, webhook) {
+		s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
 		return
 	}
 
@@ -201,7 +267,7 @@ func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
 		webhook.Method = req.Method
 	}
 	if req.TopicFilter != "" {
-		webhook.TopicFilter = req.TopicFilter
+		webhook.TopicFilter = s.normalizeTopic(req.TopicFilter)
 	}
 	webhook.Enabled = req.Enabled
 	if req.Headers != nil {
@@ -216,18 +282,35 @@ func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
 	if req.RetryDelay > 0 {
 		webhook.RetryDelay = req.RetryDelay
 	}
+	if req.Secret != "" {
+		webhook.Secret = req.Secret
+	}
+	if req.BodyTemplate != nil {
+		webhook.BodyTemplate = *req.BodyTemplate
+	}
+	if req.ContentType != nil {
+		webhook.ContentType = *req.ContentType
+	}
+	req.applyFilters(webhook)
 
-	// Validate the webhook
+	// Validate the webhook, including where its URL points
 	if err := webhook.Validate(); err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid webhook: %v", err))
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidWebhook, fmt.Sprintf("Invalid webhook: %v", err))
+		return
+	}
+	if err := webhook.ValidateURL(s.allowPrivateWebhooks()); err != nil {
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidWebhook, fmt.Sprintf("Invalid webhook: %v", err))
 		return
 	}
 
-	// Update the webhook in the database
+	// Update the webhook in the database, storing the topic filter in the tenant's namespace
+	webhook.TopicFilter = utils.ApplyNamespace(namespace, webhook.TopicFilter)
 	if err := s.db.UpdateWebhook(ctx, webhook); err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update webhook: %v", err))
+		s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to update webhook: %v", err))
 		return
 	}
+	s.webhookIndex.invalidate()
+	tenantWebhook(namespace, webhook)
 
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -240,7 +323,7 @@ func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
 // handleDeleteWebhook handles requests to delete a webhook
 func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
-		s.writeError(w, http.StatusInternalServerError, "Database not initialized")
+		s.writeError(w, http.StatusInternalServerError, ErrCodeNotConfigured, "Database not initialized")
 		return
 	}
 
@@ -248,7 +331,7 @@ func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		s.writeError(w, http.StatusBadRequest, "Webhook ID is required")
+		s.writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Webhook ID is required")
 		return
 	}
 
@@ -256,11 +339,33 @@ func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	// Tenants can only delete their own webhooks
+	if namespace := s.tenantNamespace(r); namespace != "" {
+		webhook, err := s.db.GetWebhookByID(ctx, id)
+		if err == database.ErrMessageNotFound {
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+			return
+		}
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to get webhook: %v", err))
+			return
+		}
+		if !tenantWebhook(namespace, webhook) {
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+			return
+		}
+	}
+
 	// Delete the webhook from the database
 	if err := s.db.DeleteWebhook(ctx, id); err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete webhook: %v", err))
+		if err == database.ErrMessageNotFound {
+			s.writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		} else {
+			s.writeError(w, http.StatusInternalServerError, ErrCodeDatabaseError, fmt.Sprintf("Failed to delete webhook: %v", err))
+		}
 		return
 	}
+	s.webhookIndex.invalidate()
 
 	// Write the response
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{
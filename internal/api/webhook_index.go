@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
+)
+
+// webhookIndexTTL is how long the webhook index is trusted before it is rebuilt, so that webhooks
+// changed by another instance sharing the database are picked up
+const webhookIndexTTL = 30 * time.Second
+
+// webhookIndex indexes the enabled webhooks by topic filter so that the webhooks matching a received
+// message can be found without testing every filter. It is rebuilt from the database when it goes stale:
+// initially, after a webhook is created, updated or deleted, and once webhookIndexTTL has passed.
+type webhookIndex struct {
+	mu sync.Mutex
+	// trie maps topic filters to positions in webhooks; nil when the index is stale
+	trie     *utils.TopicTrie
+	webhooks []*models.Webhook
+	loadedAt time.Time
+	// generation is incremented on every invalidation so that a rebuild racing with a change is discarded
+	generation uint64
+	// refreshing is set while the index is being rebuilt
+	refreshing bool
+}
+
+// newWebhookIndex creates an empty, stale webhook index
+func newWebhookIndex() *webhookIndex {
+	return &webhookIndex{}
+}
+
+// invalidate marks the index as stale after the webhooks have changed
+func (i *webhookIndex) invalidate() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.trie = nil
+	i.webhooks = nil
+	i.generation++
+}
+
+// match returns the indexed webhooks whose topic filter matches the topic, in database order.
+// It reports false if the index is stale.
+func (i *webhookIndex) match(topic string) ([]*models.Webhook, bool) {
+	i.mu.Lock()
+	trie, webhooks := i.trie, i.webhooks
+	fresh := trie != nil && time.Since(i.loadedAt) < webhookIndexTTL
+	i.mu.Unlock()
+
+	if !fresh {
+		return nil, false
+	}
+
+	var positions []int
+	for _, value := range trie.Match(topic) {
+		positions = append(positions, value.(int))
+	}
+	sort.Ints(positions)
+
+	matched := make([]*models.Webhook, len(positions))
+	for n, position := range positions {
+		matched[n] = webhooks[position]
+	}
+	return matched, true
+}
+
+// startRefresh claims the rebuild of the index, returning the generation being rebuilt.
+// It reports false if another rebuild is already under way.
+func (i *webhookIndex) startRefresh() (uint64, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.refreshing {
+		return 0, false
+	}
+	i.refreshing = true
+	return i.generation, true
+}
+
+// finishRefresh installs the webhooks loaded by a rebuild, unless they changed while it was under way.
+// A nil slice of webhooks abandons the rebuild.
+func (i *webhookIndex) finishRefresh(generation uint64, webhooks []*models.Webhook) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.refreshing = false
+	if webhooks == nil || generation != i.generation {
+		return
+	}
+
+	trie := utils.NewTopicTrie()
+	for position, webhook := range webhooks {
+		trie.Add(webhook.TopicFilter, position)
+	}
+	i.trie = trie
+	i.webhooks = webhooks
+	i.loadedAt = time.Now()
+}
+
+// matchingWebhooks returns the enabled webhooks whose topic filter matches the topic, newest first.
+// It answers from the webhook index, rebuilding it if it is stale; while another message is rebuilding
+// it, or if the rebuild fails, the database is searched directly.
+func (s *Server) matchingWebhooks(ctx context.Context, topic string) ([]*models.Webhook, error) {
+	if webhooks, ok := s.webhookIndex.match(topic); ok {
+		return webhooks, nil
+	}
+
+	if generation, ok := s.webhookIndex.startRefresh(); ok {
+		webhooks, err := s.db.GetEnabledWebhooks(ctx)
+		if err != nil {
+			s.logger.WithError(err).Warn("Failed to rebuild the webhook index")
+			webhooks = nil
+		} else if webhooks == nil {
+			webhooks = []*models.Webhook{}
+		}
+		s.webhookIndex.finishRefresh(generation, webhooks)
+
+		if webhooks, ok := s.webhookIndex.match(topic); ok {
+			return webhooks, nil
+		}
+	}
+
+	return s.db.GetWebhooksByTopicFilter(ctx, topic)
+}
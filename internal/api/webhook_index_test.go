@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// matchingWebhookIDs returns the sorted IDs of the webhooks matching a topic
+func matchingWebhookIDs(t *testing.T, s *Server, topic string) string {
+	t.Helper()
+
+	webhooks, err := s.matchingWebhooks(context.Background(), topic)
+	if err != nil {
+		t.Fatalf("Failed to match webhooks: %v", err)
+	}
+
+	ids := make([]string, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		ids = append(ids, webhook.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// createWebhook creates a webhook through the API and returns its ID
+func createWebhook(t *testing.T, s *Server, topicFilter string) string {
+	t.Helper()
+
+	body := map[string]interface{}{
+		"name":         topicFilter,
+		"url":          "http://127.0.0.1:9/notify",
+		"method":       http.MethodPost,
+		"topic_filter": topicFilter,
+		"enabled":      true,
+		"timeout":      5,
+		"retry_delay":  1,
+	}
+	rec := doRequest(t, s, http.MethodPost, "/webhooks", "admin-key", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Webhook models.Webhook `json:"webhook"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response.Webhook.ID
+}
+
+func TestWebhookIndexFollowsWebhookChanges(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+
+	all := createWebhook(t, s, "sensors/#")
+	if got := matchingWebhookIDs(t, s, "sensors/temp"); got != all {
+		t.Fatalf("Expected %s to match, got %s", all, got)
+	}
+
+	single := createWebhook(t, s, "sensors/+")
+	if got, expected := matchingWebhookIDs(t, s, "sensors/temp"), strings.Join(sortedStrings(all, single), ","); got != expected {
+		t.Errorf("Expected %s to match after creating a webhook, got %s", expected, got)
+	}
+
+	rec := doRequest(t, s, http.MethodPut, "/webhooks/"+all, "admin-key", map[string]interface{}{"topic_filter": "alerts/#", "enabled": true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got := matchingWebhookIDs(t, s, "sensors/temp"); got != single {
+		t.Errorf("Expected %s to match after updating a webhook, got %s", single, got)
+	}
+	if got := matchingWebhookIDs(t, s, "alerts/door"); got != all {
+		t.Errorf("Expected %s to match its new filter, got %s", all, got)
+	}
+
+	rec = doRequest(t, s, http.MethodDelete, "/webhooks/"+single, "admin-key", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got := matchingWebhookIDs(t, s, "sensors/temp"); got != "" {
+		t.Errorf("Expected no webhook to match after deleting one, got %s", got)
+	}
+}
+
+func TestWebhookIndexFallsBackToTheDatabaseWhileRebuilding(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted))
+
+	// Another message is rebuilding the stale index
+	if _, ok := s.webhookIndex.startRefresh(); !ok {
+		t.Fatal("Expected to claim the rebuild of the index")
+	}
+
+	webhook := models.NewWebhook()
+	webhook.URL = "http://127.0.0.1:9/notify"
+	webhook.TopicFilter = "sensors/#"
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+
+	if got := matchingWebhookIDs(t, s, "sensors/temp"); got != webhook.ID {
+		t.Errorf("Expected %s to match through the database, got %s", webhook.ID, got)
+	}
+}
+
+func sortedStrings(values ...string) []string {
+	sort.Strings(values)
+	return values
+}
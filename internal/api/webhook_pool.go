@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/models"
+)
+
+// webhookEnqueueTimeout is how long a notification waits for room in a full queue under the block policy
+const webhookEnqueueTimeout = time.Second
+
+// webhookJob is a notification waiting to be delivered to a webhook
+type webhookJob struct {
+	payload WebhookPayload
+	webhook *models.Webhook
+}
+
+// webhookPool delivers notifications with a fixed number of workers reading from a bounded queue,
+// so bursts of messages don't start a goroutine per notification
+type webhookPool struct {
+	workers      int
+	queue        chan webhookJob
+	dropWhenFull bool
+	// cancel is closed when the pool is stopped before the queue drained, abandoning retries and queued jobs
+	cancel chan struct{}
+
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	running bool
+	stopped bool
+}
+
+// newWebhookPool creates a worker pool configured by the webhook settings, using the defaults for unset ones
+func newWebhookPool(cfg *config.WebhookConfig) *webhookPool {
+	workers, queueSize, dropWhenFull := config.DefaultWebhookWorkers, config.DefaultWebhookQueueSize, false
+	if cfg != nil {
+		if cfg.Workers > 0 {
+			workers = cfg.Workers
+		}
+		if cfg.QueueSize > 0 {
+			queueSize = cfg.QueueSize
+		}
+		dropWhenFull = cfg.QueueFullPolicy == config.WebhookQueueFullDrop
+	}
+
+	return &webhookPool{
+		workers:      workers,
+		queue:        make(chan webhookJob, queueSize),
+		dropWhenFull: dropWhenFull,
+		cancel:       make(chan struct{}),
+	}
+}
+
+// startWebhookWorkers starts the workers delivering queued webhook notifications
+func (s *Server) startWebhookWorkers() {
+	pool := s.webhookPool
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.running || pool.stopped {
+		return
+	}
+	pool.running = true
+
+	for i := 0; i < pool.workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.queue {
+				select {
+				case <-pool.cancel:
+					continue
+				default:
+				}
+				s.sendWebhookNotificationToURL(job.payload, job.webhook)
+			}
+		}()
+	}
+}
+
+// stopWebhookWorkers stops accepting notifications and waits for the queued ones to be delivered until the
+// context expires. Then retries in progress are abandoned and the remaining queued notifications are dropped;
+// notifications whose delivery failed are still in the delivery log and retried after a restart.
+func (s *Server) stopWebhookWorkers(ctx context.Context) {
+	pool := s.webhookPool
+	pool.mu.Lock()
+	if pool.stopped {
+		pool.mu.Unlock()
+		return
+	}
+	pool.stopped = true
+	close(pool.queue)
+	pool.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.logger.WithField("queued", len(pool.queue)).Warn("Webhook deliveries didn't finish before shutdown, abandoning them")
+		close(pool.cancel)
+	}
+}
+
+// enqueueWebhookNotification queues a notification for delivery to a webhook. If the queue is full, it waits
+// briefly for room or, with the drop policy, drops the notification right away. Notifications are delivered
+// by the caller while the workers aren't started, and dropped once they are stopped.
+func (s *Server) enqueueWebhookNotification(webhookPayload WebhookPayload, webhook *models.Webhook) {
+	pool := s.webhookPool
+	if pool == nil {
+		s.sendWebhookNotificationToURL(webhookPayload, webhook)
+		return
+	}
+
+	pool.mu.RLock()
+	running, stopped := pool.running, pool.stopped
+	if !running || stopped {
+		pool.mu.RUnlock()
+		if !stopped {
+			s.sendWebhookNotificationToURL(webhookPayload, webhook)
+			return
+		}
+		s.dropWebhookNotification(webhookPayload, webhook, "Webhook notification dropped during shutdown")
+		return
+	}
+	defer pool.mu.RUnlock()
+
+	job := webhookJob{payload: webhookPayload, webhook: webhook}
+	select {
+	case pool.queue <- job:
+		return
+	default:
+	}
+
+	if !pool.dropWhenFull {
+		timer := time.NewTimer(webhookEnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case pool.queue <- job:
+			return
+		case <-timer.C:
+		}
+	}
+	s.dropWebhookNotification(webhookPayload, webhook, "Webhook delivery queue is full, dropping notification")
+}
+
+// dropWebhookNotification logs and counts a notification that won't be delivered
+func (s *Server) dropWebhookNotification(webhookPayload WebhookPayload, webhook *models.Webhook, reason string) {
+	if s.metrics != nil {
+		s.metrics.IncrementWebhooksDropped()
+	}
+	s.logger.WithFields(map[string]interface{}{
+		"topic":      webhookPayload.Topic,
+		"webhook_id": webhook.ID,
+		"url":        webhook.URL,
+	}).Warn(reason)
+}
+
+// waitForWebhookRetry sleeps for the delay between delivery attempts, returning false if the
+// workers were cancelled meanwhile
+func (s *Server) waitForWebhookRetry(delay time.Duration) bool {
+	var cancel chan struct{}
+	if s.webhookPool != nil {
+		cancel = s.webhookPool.cancel
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		return false
+	}
+}
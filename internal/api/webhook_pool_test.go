@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestWebhookPoolDropsWhenQueueIsFull(t *testing.T) {
+	var delivered int32
+	requests := make(chan struct{}, 10)
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		<-release
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted))
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+	s.webhookPool = newWebhookPool(&config.WebhookConfig{Workers: 1, QueueSize: 1, QueueFullPolicy: config.WebhookQueueFullDrop})
+	s.startWebhookWorkers()
+
+	webhook := &models.Webhook{ID: "hook-1", URL: receiver.URL, Method: http.MethodPost, Timeout: 5, RetryDelay: 1}
+	payload := WebhookPayload{Topic: "sensors/temp", Payload: 21.5}
+
+	// The only worker is busy with the first notification, the second waits in the queue, and the third is dropped
+	s.enqueueWebhookNotification(payload, webhook)
+	<-requests
+	s.enqueueWebhookNotification(payload, webhook)
+	s.enqueueWebhookNotification(payload, webhook)
+
+	if dropped := s.metrics.WebhooksDropped; dropped != 1 {
+		t.Errorf("Expected 1 dropped notification, got %d", dropped)
+	}
+
+	// Stopping drains the queue
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.stopWebhookWorkers(ctx)
+
+	if got := atomic.LoadInt32(&delivered); got != 2 {
+		t.Errorf("Expected 2 delivered notifications, got %d", got)
+	}
+}
+
+func TestStoppingWebhookPoolAbandonsRetries(t *testing.T) {
+	requests := make(chan struct{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted))
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+	s.startWebhookWorkers()
+
+	webhook := models.NewWebhook()
+	webhook.URL = receiver.URL
+	webhook.TopicFilter = "sensors/#"
+	webhook.RetryDelay = 60
+	if err := s.db.StoreWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("Failed to store webhook: %v", err)
+	}
+
+	s.sendWebhookNotification("sensors/temp", "test", 21.5, 0, "")
+	<-requests
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.stopWebhookWorkers(ctx)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Expected stopping to abandon the retry, took %v", elapsed)
+	}
+
+	// The abandoned notification is left in the delivery log to be retried later
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		// Reading may briefly fail with SQLITE_BUSY while the abandoned worker records the delivery
+		deliveries, err := s.db.GetWebhookDeliveries(context.Background(), webhook.ID, 10)
+		if err == nil && len(deliveries) == 1 {
+			if deliveries[0].Status != models.DeliveryStatusPending {
+				t.Errorf("Expected status '%s', got '%s'", models.DeliveryStatusPending, deliveries[0].Status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the abandoned notification to be recorded, got %d deliveries (error: %v)", len(deliveries), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// maxWebhookQueryURLLength is the longest URL sent to GET and HEAD webhooks. Many servers and proxies
+// reject longer request lines, for example nginx and Apache at about 8 KB.
+const maxWebhookQueryURLLength = 8192
+
+// webhookQueryURL returns the URL of a GET or HEAD notification: the webhook URL with the fields of the JSON
+// notification body appended as query parameters. The payload is JSON-encoded in the payload parameter.
+func webhookQueryURL(webhookURL string, body []byte) (string, error) {
+	var notification struct {
+		Topic     string          `json:"topic"`
+		Payload   json.RawMessage `json:"payload"`
+		QoS       byte            `json:"qos"`
+		Timestamp string          `json:"timestamp"`
+		Broker    string          `json:"broker"`
+		RequestID string          `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return "", fmt.Errorf("failed to decode webhook payload: %w", err)
+	}
+
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	// Keep the parameters already in the webhook URL
+	query := u.Query()
+	query.Set("topic", notification.Topic)
+	if len(notification.Payload) > 0 {
+		var payload bytes.Buffer
+		if err := json.Compact(&payload, notification.Payload); err != nil {
+			return "", fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+		query.Set("payload", payload.String())
+	}
+	query.Set("qos", strconv.Itoa(int(notification.QoS)))
+	query.Set("timestamp", notification.Timestamp)
+	query.Set("broker", notification.Broker)
+	if notification.RequestID != "" {
+		query.Set("request_id", notification.RequestID)
+	}
+	u.RawQuery = query.Encode()
+
+	queryURL := u.String()
+	if len(queryURL) > maxWebhookQueryURLLength {
+		return "", fmt.Errorf("webhook URL with query parameters is %d bytes, more than the %d allowed", len(queryURL), maxWebhookQueryURLLength)
+	}
+	return queryURL, nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/models"
+)
+
+func TestWebhookQueryURL(t *testing.T) {
+	body := []byte(`{"topic":"sensors/temp & humidity","payload":{"value": 21.5},"qos":1,"timestamp":"2023-04-27T16:43:42Z","broker":"hivemq"}`)
+
+	queryURL, err := webhookQueryURL("https://example.com/hook?token=abc", body)
+	if err != nil {
+		t.Fatalf("Failed to build URL: %v", err)
+	}
+
+	expected := "https://example.com/hook?broker=hivemq&payload=%7B%22value%22%3A21.5%7D&qos=1" +
+		"&timestamp=2023-04-27T16%3A43%3A42Z&token=abc&topic=sensors%2Ftemp+%26+humidity"
+	if queryURL != expected {
+		t.Errorf("Expected URL '%s', got '%s'", expected, queryURL)
+	}
+}
+
+func TestWebhookQueryURLRejectsLongURLs(t *testing.T) {
+	body := []byte(`{"topic":"logs","payload":"` + strings.Repeat("x", maxWebhookQueryURLLength) + `"}`)
+
+	if _, err := webhookQueryURL("https://example.com/hook", body); err == nil {
+		t.Error("Expected an error for a URL longer than the limit")
+	}
+}
+
+func TestGetWebhookNotificationUsesQueryParameters(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	s := &Server{
+		logger: logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		config: &config.Config{Webhook: &config.WebhookConfig{AllowPrivate: true}},
+	}
+	webhook := &models.Webhook{URL: receiver.URL, Method: http.MethodGet, Secret: "my-secret", Timeout: 5}
+	s.sendWebhookNotificationToURL(WebhookPayload{Topic: "sensors/temp", Payload: "hot", QoS: 2, Broker: "test"}, webhook)
+
+	r := <-received
+	if body := <-bodies; len(body) != 0 {
+		t.Errorf("Expected no body, got '%s'", body)
+	}
+
+	query := r.URL.Query()
+	if query.Get("topic") != "sensors/temp" || query.Get("payload") != `"hot"` || query.Get("qos") != "2" || query.Get("broker") != "test" {
+		t.Errorf("Unexpected query parameters: %s", r.URL.RawQuery)
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		t.Errorf("Expected no content type, got '%s'", contentType)
+	}
+
+	expected := signWebhookPayload("my-secret", r.Header.Get(webhookTimestampHeader), []byte(r.URL.RawQuery))
+	if signature := r.Header.Get(webhookSignatureHeader); signature != expected {
+		t.Errorf("Expected signature '%s', got '%s'", expected, signature)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookRetryMaxDelay caps the delay between the delivery attempts of a notification,
+	// unless the webhook's retry delay alone is longer
+	webhookRetryMaxDelay = 5 * time.Minute
+	// webhookRetryJitter is the fraction by which each delay is randomly shortened
+	webhookRetryJitter = 0.5
+)
+
+// webhookStatusError is returned by a delivery attempt the receiver answered with a non-2xx status
+type webhookStatusError struct {
+	StatusCode int
+	// RetryAfter is how long the receiver asked to wait before the next attempt, or zero if it didn't
+	RetryAfter time.Duration
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook returned status code %d", e.StatusCode)
+}
+
+// webhookRetryDelay returns how long to wait before the given retry of a notification, counting from 1.
+// The delay starts at the webhook's retry delay and doubles with every retry up to the maximum, then is
+// shortened by a random fraction of up to the jitter, so notifications that failed together don't all
+// hit the receiver again at the same time. A longer Retry-After from the receiver is waited out instead,
+// up to the same maximum. random returns a number in [0, 1).
+func webhookRetryDelay(base time.Duration, retry int, retryAfter time.Duration, random func() float64) time.Duration {
+	maxDelay := webhookRetryMaxDelay
+	if base > maxDelay {
+		maxDelay = base
+	}
+
+	delay := base
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	delay -= time.Duration(float64(delay) * webhookRetryJitter * random())
+
+	if retryAfter > delay {
+		delay = retryAfter
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+	return delay
+}
+
+// parseRetryAfter returns the wait requested by a Retry-After header, given either as a number of
+// seconds or as an HTTP date, or zero if the header is missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		if int64(seconds) > math.MaxInt64/int64(time.Second) {
+			return math.MaxInt64
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
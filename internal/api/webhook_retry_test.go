@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWebhookRetryDelayGrowsAndIsCapped(t *testing.T) {
+	noJitter := func() float64 { return 0 }
+
+	previous := time.Duration(0)
+	for retry := 1; retry <= 20; retry++ {
+		delay := webhookRetryDelay(time.Second, retry, 0, noJitter)
+		if delay > webhookRetryMaxDelay {
+			t.Fatalf("Expected retry %d to wait at most %v, got %v", retry, webhookRetryMaxDelay, delay)
+		}
+		if delay < previous {
+			t.Fatalf("Expected retry %d to wait at least %v, got %v", retry, previous, delay)
+		}
+		if expected := time.Second << (retry - 1); expected < webhookRetryMaxDelay && delay != expected {
+			t.Errorf("Expected retry %d to wait %v, got %v", retry, expected, delay)
+		}
+		previous = delay
+	}
+	if previous != webhookRetryMaxDelay {
+		t.Errorf("Expected the delay to reach the maximum %v, got %v", webhookRetryMaxDelay, previous)
+	}
+
+	// A retry delay longer than the maximum is kept as is
+	if delay := webhookRetryDelay(10*time.Minute, 3, 0, noJitter); delay != 10*time.Minute {
+		t.Errorf("Expected a long retry delay to be kept, got %v", delay)
+	}
+
+	// Jitter shortens the delay by up to half
+	if delay := webhookRetryDelay(4*time.Second, 2, 0, func() float64 { return 0.5 }); delay != 6*time.Second {
+		t.Errorf("Expected jitter to shorten the delay to 6s, got %v", delay)
+	}
+
+	// A longer Retry-After is waited out, up to the maximum
+	if delay := webhookRetryDelay(time.Second, 1, 30*time.Second, noJitter); delay != 30*time.Second {
+		t.Errorf("Expected the Retry-After delay of 30s, got %v", delay)
+	}
+	if delay := webhookRetryDelay(time.Second, 1, time.Hour, noJitter); delay != webhookRetryMaxDelay {
+		t.Errorf("Expected the Retry-After delay to be capped at %v, got %v", webhookRetryMaxDelay, delay)
+	}
+	if delay := webhookRetryDelay(8*time.Second, 1, time.Second, noJitter); delay != 8*time.Second {
+		t.Errorf("Expected a shorter Retry-After to be ignored, got %v", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":     0,
+		"120":  2 * time.Minute,
+		" 5 ":  5 * time.Second,
+		"0":    0,
+		"-3":   0,
+		"soon": 0,
+		now.Add(90 * time.Second).Format(http.TimeFormat): 90 * time.Second,
+		now.Add(-time.Minute).Format(http.TimeFormat):     0,
+	}
+	for value, expected := range tests {
+		if delay := parseRetryAfter(value, now); delay != expected {
+			t.Errorf("Expected Retry-After %q to wait %v, got %v", value, expected, delay)
+		}
+	}
+}
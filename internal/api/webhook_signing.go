@@ -0,0 +1,23 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Headers carrying the webhook payload signature
+const (
+	webhookSignatureHeader = "X-Signature"
+	webhookTimestampHeader = "X-Signature-Timestamp"
+)
+
+// signWebhookPayload returns the X-Signature header value for a webhook body: the hex-encoded
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret, prefixed with "sha256="
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/models"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"topic":"sensors/temp","payload":21.5}`)
+
+	signature := signWebhookPayload("my-secret", "1700000000", body)
+
+	expected := "sha256=0d8d1603a2d7cf8ae02b8e310cc03ebd80501dd6ca4ebd0fd0e975fad1f24302"
+	if signature != expected {
+		t.Errorf("Expected signature '%s', got '%s'", expected, signature)
+	}
+}
+
+func TestWebhookNotificationIsSigned(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	s := &Server{
+		logger: logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		config: &config.Config{Webhook: &config.WebhookConfig{AllowPrivate: true}},
+	}
+	webhook := &models.Webhook{URL: receiver.URL, Method: http.MethodPost, Secret: "my-secret", Timeout: 5}
+	s.sendWebhookNotificationToURL(WebhookPayload{Topic: "sensors/temp", Payload: 21.5}, webhook)
+
+	r := <-received
+	body := <-bodies
+
+	timestamp := r.Header.Get(webhookTimestampHeader)
+	if timestamp == "" {
+		t.Fatal("Expected a timestamp header")
+	}
+
+	expected := signWebhookPayload("my-secret", timestamp, body)
+	if signature := r.Header.Get(webhookSignatureHeader); signature != expected {
+		t.Errorf("Expected signature '%s', got '%s'", expected, signature)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestWebhookNotificationRendersBodyTemplate(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	s := &Server{
+		logger: logger.New(&logger.Config{Level: "error", Output: io.Discard}),
+		config: &config.Config{Webhook: &config.WebhookConfig{AllowPrivate: true}},
+	}
+	webhook := &models.Webhook{
+		URL:          receiver.URL,
+		Method:       http.MethodPost,
+		Timeout:      5,
+		BodyTemplate: `{"text": {{ printf "%s on %s" .Payload .Topic | json }}}`,
+		ContentType:  "application/vnd.alert+json",
+	}
+	s.sendWebhookNotificationToURL(WebhookPayload{Topic: "alerts/door", Payload: "open", Broker: "test"}, webhook)
+
+	r := <-received
+	body := <-bodies
+
+	if expected := `{"text": "open on alerts/door"}`; string(body) != expected {
+		t.Errorf("Expected body '%s', got '%s'", expected, body)
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/vnd.alert+json" {
+		t.Errorf("Expected content type 'application/vnd.alert+json', got '%s'", contentType)
+	}
+}
+
+func TestCreateWebhookRejectsMalformedBodyTemplate(t *testing.T) {
+	s := newTestServer(t, mqtttest.Start(t, packets.Accepted), "admin-key")
+	s.config.Webhook = &config.WebhookConfig{AllowPrivate: true}
+
+	body := map[string]interface{}{
+		"name":          "Alerts",
+		"url":           "http://127.0.0.1:9/alerts",
+		"method":        http.MethodPost,
+		"topic_filter":  "alerts/#",
+		"timeout":       5,
+		"retry_count":   1,
+		"retry_delay":   1,
+		"body_template": `{"text": {{ .Topic }`,
+	}
+	rec := doRequest(t, s, http.MethodPost, "/webhooks", "admin-key", body)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+
+	body["body_template"] = `{"text": {{ .Topic | json }}}`
+	rec = doRequest(t, s, http.MethodPost, "/webhooks", "admin-key", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+}
@@ -1,7 +1,10 @@
 ﻿package auth
 
 import (
+	"context"
 	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"MQTTmicroService/internal/logger"
@@ -11,13 +14,42 @@ import (
 type Config struct {
 	// API key authentication
 	EnableAPIKey bool
-	APIKeys      []string
+	APIKeys      []APIKey
+	// APIKeyHeaders are the request headers checked, in order, for the API key; DefaultAPIKeyHeader when empty
+	APIKeyHeaders []string
+	// BasicAuthField is the Basic Auth credential carrying the API key: BasicAuthPassword (the default) or BasicAuthUsername
+	BasicAuthField string
+	// JWT bearer token authentication
+	EnableJWT   bool
+	JWTSecret   string
+	JWTJWKSURL  string
+	JWTAudience string
+	JWTIssuer   string
+	// JWTDefaultScopes are granted to JWTs without a "scope" or "scopes" claim; none when empty
+	JWTDefaultScopes []string
 }
 
+// Machine-readable codes of authentication and authorization errors
+const (
+	ErrCodeUnauthorized      = "unauthorized"
+	ErrCodeTokenExpired      = "token_expired"
+	ErrCodeInsufficientScope = "insufficient_scope"
+)
+
+// DefaultAPIKeyHeader is the request header carrying the API key unless others are configured
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// Basic Auth credentials that may carry the API key
+const (
+	BasicAuthPassword = "password"
+	BasicAuthUsername = "username"
+)
+
 // Auth handles authentication for the API
 type Auth struct {
 	config *Config
 	logger *logger.Logger
+	jwks   *jwksCache
 }
 
 // GetEnableAPIKey returns the value of the EnableAPIKey flag
@@ -25,11 +57,22 @@ func (a *Auth) GetEnableAPIKey() bool {
 	return a.config.EnableAPIKey
 }
 
+// GetEnableJWT returns the value of the EnableJWT flag
+func (a *Auth) GetEnableJWT() bool {
+	return a.config.EnableJWT
+}
+
+// GetAPIKeys returns the accepted API keys
+func (a *Auth) GetAPIKeys() []APIKey {
+	return a.config.APIKeys
+}
+
 // New creates a new Auth instance
 func New(config *Config, log *logger.Logger) *Auth {
 	return &Auth{
 		config: config,
 		logger: log,
+		jwks:   &jwksCache{},
 	}
 }
 
@@ -37,12 +80,19 @@ func New(config *Config, log *logger.Logger) *Auth {
 func DefaultConfig() *Config {
 	return &Config{
 		EnableAPIKey: false,
-		APIKeys:      []string{},
+		APIKeys:      []APIKey{},
+		EnableJWT:    false,
 	}
 }
 
 // ValidateAPIKey validates an API key
 func (a *Auth) ValidateAPIKey(apiKey string) bool {
+	_, valid := a.lookupAPIKey(apiKey)
+	return valid
+}
+
+// lookupAPIKey validates an API key and returns the matching key configuration
+func (a *Auth) lookupAPIKey(apiKey string) (*APIKey, bool) {
 	// Log that we're validating an API key
 	a.logger.WithFields(map[string]interface{}{
 		"enableAPIKey": a.config.EnableAPIKey,
@@ -50,42 +100,44 @@ func (a *Auth) ValidateAPIKey(apiKey string) bool {
 
 	if !a.config.EnableAPIKey {
 		a.logger.Info("API key validation skipped: API key authentication is disabled")
-		return false
+		return nil, false
 	}
 
-	for _, key := range a.config.APIKeys {
-		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+	for i := range a.config.APIKeys {
+		key := &a.config.APIKeys[i]
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key.Key)) == 1 {
 			a.logger.Info("API key validation successful")
-			return true
+			return key, true
 		}
 	}
 
 	a.logger.Info("API key validation failed: invalid API key")
-	return false
+	return nil, false
 }
 
-// AuthMiddleware is a middleware that authenticates requests using API keys
+// AuthMiddleware is a middleware that authenticates requests using API keys or JWT bearer tokens
 func (a *Auth) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip authentication for health check endpoint
-		if r.URL.Path == "/healthz" {
+		// Skip authentication for health check endpoints, the API description, and the build version
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/openapi.json" || r.URL.Path == "/version" {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Skip authentication if API key authentication is not enabled
-		if !a.config.EnableAPIKey {
+		// Skip authentication if neither API key nor JWT authentication is enabled
+		if !a.config.EnableAPIKey && !a.config.EnableJWT {
 			// Log that we're skipping authentication because it's disabled
 			a.logger.WithFields(map[string]interface{}{
 				"path":          r.URL.Path,
 				"enableAPIKey":  a.config.EnableAPIKey,
+				"enableJWT":     a.config.EnableJWT,
 			}).Info("Skipping authentication: API key authentication is disabled")
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Check for API key in header
-		apiKey := r.Header.Get("X-API-Key")
+		// Check for API key in the configured headers
+		apiKey := a.headerAPIKey(r)
 		if apiKey == "" {
 			// Check for API key in query parameter
 			apiKey = r.URL.Query().Get("api_key")
@@ -95,18 +147,90 @@ func (a *Auth) AuthMiddleware(next http.Handler) http.Handler {
 		if apiKey == "" {
 			authHeader := r.Header.Get("Authorization")
 			if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-				apiKey = authHeader[7:]
+				token := authHeader[7:]
+
+				// Validate the bearer token as a JWT when JWT authentication is enabled
+				if a.config.EnableJWT && isJWT(token) {
+					claims, err := a.ValidateJWT(token)
+					if err != nil {
+						a.writeJWTError(w, r, err)
+						return
+					}
+					ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+					next.ServeHTTP(w, withCaller(r.WithContext(ctx), jwtCaller(token, claims), scopesFromClaims(claims, a.config.JWTDefaultScopes), namespaceFromClaims(claims)))
+					return
+				}
+
+				apiKey = token
 			}
 		}
 
-		// Validate API key
-		if apiKey != "" && a.ValidateAPIKey(apiKey) {
-			next.ServeHTTP(w, r)
-			return
+		// Check for an API key in Basic Auth credentials, for tooling that can't send other headers
+		if apiKey == "" {
+			apiKey = a.basicAuthAPIKey(r)
+		}
+
+		// Validate API key and attach its scopes and namespace to the request
+		if apiKey != "" {
+			if key, valid := a.lookupAPIKey(apiKey); valid {
+				next.ServeHTTP(w, withCaller(r, apiKeyCaller(key.Key), key.Scopes, key.Namespace))
+				return
+			}
 		}
 
 		// Authentication failed
 		a.logger.WithField("path", r.URL.Path).Info("Authentication failed: invalid or missing API key")
-		http.Error(w, "Unauthorized: invalid or missing API key", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized: invalid or missing API key")
+	})
+}
+
+// headerAPIKey returns the API key from the first configured API key header present in a request, or "" if there is none
+func (a *Auth) headerAPIKey(r *http.Request) string {
+	headers := a.config.APIKeyHeaders
+	if len(headers) == 0 {
+		headers = []string{DefaultAPIKeyHeader}
+	}
+	for _, header := range headers {
+		if apiKey := r.Header.Get(header); apiKey != "" {
+			return apiKey
+		}
+	}
+	return ""
+}
+
+// basicAuthAPIKey returns the API key carried by a request's Basic Auth credentials, or "" if there are none
+func (a *Auth) basicAuthAPIKey(r *http.Request) string {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return ""
+	}
+	if a.config.BasicAuthField == BasicAuthUsername {
+		return username
+	}
+	return password
+}
+
+// writeJWTError writes a 401 response describing why a JWT was rejected
+func (a *Auth) writeJWTError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := ErrCodeUnauthorized, "Unauthorized: invalid token"
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		code, message = ErrCodeTokenExpired, "Unauthorized: token has expired"
+	case errors.Is(err, ErrTokenMalformed):
+		message = "Unauthorized: malformed token"
+	}
+
+	a.logger.WithError(err).WithField("path", r.URL.Path).Info("Authentication failed: JWT validation failed")
+	writeError(w, http.StatusUnauthorized, code, message)
+}
+
+// writeError writes a JSON error response in the format used by the API handlers
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "error",
+		"code":    code,
+		"message": message,
 	})
 }
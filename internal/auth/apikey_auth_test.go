@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MQTTmicroService/internal/logger"
+)
+
+func TestBasicAuthCarriesAPIKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		username string
+		password string
+		expected int
+	}{
+		{"key as password", "", "anyone", "secret", http.StatusOK},
+		{"wrong password", "", "anyone", "wrong", http.StatusUnauthorized},
+		{"key as username", BasicAuthUsername, "secret", "", http.StatusOK},
+		{"key as password when username is configured", BasicAuthUsername, "anyone", "secret", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := New(&Config{
+				EnableAPIKey:   true,
+				APIKeys:        ParseAPIKeys([]string{"secret"}),
+				BasicAuthField: test.field,
+			}, logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+
+			handler := a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if CallerFromContext(r.Context()) == "" {
+					t.Error("Expected the caller to be attached to the request")
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/publish", nil)
+			req.SetBasicAuth(test.username, test.password)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.expected {
+				t.Errorf("Expected status %d, got %d", test.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestXAPIKeyTakesPrecedenceOverBasicAuth(t *testing.T) {
+	a := New(&Config{
+		EnableAPIKey: true,
+		APIKeys:      ParseAPIKeys([]string{"secret"}),
+	}, logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+	handler := a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/publish", nil)
+	req.Header.Set("X-API-Key", "secret")
+	req.SetBasicAuth("anyone", "wrong")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the X-API-Key header to authenticate the request, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeyHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  []string
+		header   string
+		expected int
+	}{
+		{"default header when unset", nil, "X-API-Key", http.StatusOK},
+		{"custom header", []string{"X-Gateway-Key"}, "X-Gateway-Key", http.StatusOK},
+		{"default header when a custom one is configured", []string{"X-Gateway-Key"}, "X-API-Key", http.StatusUnauthorized},
+		{"second of several headers", []string{"X-Gateway-Key", "X-API-Key"}, "X-API-Key", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := New(&Config{
+				EnableAPIKey:  true,
+				APIKeys:       ParseAPIKeys([]string{"secret"}),
+				APIKeyHeaders: test.headers,
+			}, logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+			handler := a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodPost, "/publish", nil)
+			req.Header.Set(test.header, "secret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.expected {
+				t.Errorf("Expected status %d, got %d", test.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHeadersKeepQueryFallback(t *testing.T) {
+	a := New(&Config{
+		EnableAPIKey:  true,
+		APIKeys:       ParseAPIKeys([]string{"secret"}),
+		APIKeyHeaders: []string{"X-Gateway-Key"},
+	}, logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+	handler := a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, configure := range []func(*http.Request){
+		func(r *http.Request) { r.URL.RawQuery = "api_key=secret" },
+		func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/publish", nil)
+		configure(req)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected the fallback credentials to authenticate the request, got %d", rec.Code)
+		}
+	}
+}
+
+func TestAuthErrorsCarryCodes(t *testing.T) {
+	a := New(&Config{
+		EnableAPIKey: true,
+		APIKeys:      ParseAPIKeys([]string{"reader:read"}),
+	}, logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+	handler := a.AuthMiddleware(a.RequireScope(ScopePublish, func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		apiKey string
+		status int
+		code   string
+	}{
+		{"missing API key", "", http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"missing scope", "reader", http.StatusForbidden, ErrCodeInsufficientScope},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/publish", nil)
+			if test.apiKey != "" {
+				req.Header.Set("X-API-Key", test.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				t.Fatalf("Expected status %d, got %d", test.status, rec.Code)
+			}
+			var response map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response["status"] != "error" || response["code"] != test.code {
+				t.Errorf("Expected an error with code '%s', got %v", test.code, response)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// contextKey is the type used for values stored in the request context by this package
+type contextKey string
+
+// claimsContextKey is the context key under which validated JWT claims are stored
+const claimsContextKey contextKey = "jwt_claims"
+
+// jwksRefreshInterval is how long fetched JWKS keys are cached before being refreshed
+const jwksRefreshInterval = 1 * time.Hour
+
+// jwksMinRefreshInterval is the minimum time between JWKS fetches, so tokens with unknown key IDs, which anyone
+// can send before their signature is checked, can't make the service fetch the key set on every request
+const jwksMinRefreshInterval = 30 * time.Second
+
+// JWT validation errors
+var (
+	ErrTokenExpired   = errors.New("token has expired")
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenInvalid   = errors.New("token is invalid")
+)
+
+// ClaimsFromContext returns the JWT claims attached to the request context, if any
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	return claims, ok
+}
+
+// isJWT reports whether a bearer token looks like a JWT (three dot-separated segments)
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// ValidateJWT validates a JWT bearer token and returns its claims
+func (a *Auth) ValidateJWT(tokenString string) (jwt.MapClaims, error) {
+	if !a.config.EnableJWT {
+		return nil, ErrTokenInvalid
+	}
+
+	var parserOptions []jwt.ParserOption
+	parserOptions = append(parserOptions, jwt.WithExpirationRequired())
+	if a.config.JWTAudience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(a.config.JWTAudience))
+	}
+	if a.config.JWTIssuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(a.config.JWTIssuer))
+	}
+	if a.config.JWTJWKSURL != "" {
+		parserOptions = append(parserOptions, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}))
+	} else {
+		parserOptions = append(parserOptions, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, a.jwtKeyFunc, parserOptions...)
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return nil, ErrTokenMalformed
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+		}
+	}
+
+	return claims, nil
+}
+
+// jwtKeyFunc returns the key used to verify a token's signature
+func (a *Auth) jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	if a.config.JWTJWKSURL != "" {
+		kid, _ := token.Header["kid"].(string)
+		return a.jwks.getKey(a.config.JWTJWKSURL, kid)
+	}
+
+	if a.config.JWTSecret == "" {
+		return nil, errors.New("no JWT signing secret configured")
+	}
+	return []byte(a.config.JWTSecret), nil
+}
+
+// jwksCache caches RSA public keys fetched from a JWKS endpoint
+type jwksCache struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// attemptedAt is when the last fetch started, whether or not it succeeded
+	attemptedAt time.Time
+	// refreshed is closed once the fetch in progress completes; it is nil when no fetch is in progress
+	refreshed chan struct{}
+	// refreshErr is the error of the last fetch, nil if it succeeded
+	refreshErr error
+	mu         sync.Mutex
+}
+
+// jsonWebKey represents a single key in a JWKS document
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// getKey returns the public key with the given key ID. Stale keys are served while the key set is refreshed in
+// the background; requests for unknown keys wait for a refresh. Refreshes run one at a time without holding the
+// lock, at most once per jwksMinRefreshInterval, and a failed refresh keeps the cached keys.
+func (c *jwksCache) getKey(url, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	key, exists := c.keys[kid]
+	if time.Since(c.fetchedAt) >= jwksRefreshInterval || !exists {
+		c.startRefresh(url)
+	}
+	refreshed := c.refreshed
+	c.mu.Unlock()
+
+	if exists {
+		return key, nil
+	}
+
+	// Wait for the refresh in progress, if any, which may bring the unknown key
+	if refreshed != nil {
+		<-refreshed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, exists := c.keys[kid]; exists {
+		return key, nil
+	}
+	if c.refreshErr != nil {
+		return nil, fmt.Errorf("signing key '%s' not found in JWKS: %w", kid, c.refreshErr)
+	}
+	return nil, fmt.Errorf("signing key '%s' not found in JWKS", kid)
+}
+
+// startRefresh fetches the key set in the background unless a fetch is in progress or one started less than
+// jwksMinRefreshInterval ago. It must be called with the lock held.
+func (c *jwksCache) startRefresh(url string) {
+	if c.refreshed != nil || (!c.attemptedAt.IsZero() && time.Since(c.attemptedAt) < jwksMinRefreshInterval) {
+		return
+	}
+	c.attemptedAt = time.Now()
+	refreshed := make(chan struct{})
+	c.refreshed = refreshed
+
+	go func() {
+		keys, err := fetchJWKS(url)
+
+		c.mu.Lock()
+		c.refreshErr = err
+		if err == nil {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.refreshed = nil
+		c.mu.Unlock()
+		close(refreshed)
+	}()
+}
+
+// fetchJWKS downloads and parses the RSA keys from a JWKS endpoint
+func fetchJWKS(url string) (map[string]*rsa.PublicKey, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status code %d", resp.StatusCode)
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range document.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JWKS modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JWKS exponent: %w", err)
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "test-secret"
+
+// newJWTAuth creates an Auth accepting HS256 tokens signed with testJWTSecret and the given API keys
+func newJWTAuth(config *Config, apiKeys ...string) *Auth {
+	config.EnableJWT = true
+	if config.JWTJWKSURL == "" {
+		config.JWTSecret = testJWTSecret
+	}
+	if len(apiKeys) > 0 {
+		config.EnableAPIKey = true
+		config.APIKeys = ParseAPIKeys(apiKeys)
+	}
+	return New(config, logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+}
+
+// signHS256 signs claims with testJWTSecret
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+// validClaims returns claims that expire in an hour
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "device-42", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// authenticate sends a request with the given Authorization header through the middleware
+func authenticate(a *Auth, authorization string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	a.AuthMiddleware(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+// errorResponse decodes the code and message of an error response
+func errorResponse(t *testing.T, rec *httptest.ResponseRecorder) (string, string) {
+	t.Helper()
+	var body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return body.Code, body.Message
+}
+
+func TestValidateJWTAcceptsHS256(t *testing.T) {
+	a := newJWTAuth(&Config{})
+
+	claims, err := a.ValidateJWT(signHS256(t, validClaims()))
+	if err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+	if claims["sub"] != "device-42" {
+		t.Errorf("Expected the subject claim, got %v", claims["sub"])
+	}
+
+	// Tokens signed with another secret are rejected
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("other-secret"))
+	if _, err := a.ValidateJWT(forged); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Expected a token with another signature to be invalid, got %v", err)
+	}
+}
+
+func TestExpiredAndMalformedTokensAreDistinguished(t *testing.T) {
+	a := newJWTAuth(&Config{})
+	expired := signHS256(t, jwt.MapClaims{"sub": "device-42", "exp": time.Now().Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		name    string
+		token   string
+		code    string
+		message string
+	}{
+		{"expired", expired, ErrCodeTokenExpired, "Unauthorized: token has expired"},
+		{"malformed", "not.a.token", ErrCodeUnauthorized, "Unauthorized: malformed token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := authenticate(a, "Bearer "+test.token, func(w http.ResponseWriter, r *http.Request) {
+				t.Error("Expected the request to be rejected")
+			})
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status 401, got %d", rec.Code)
+			}
+			if code, message := errorResponse(t, rec); code != test.code || message != test.message {
+				t.Errorf("Expected %s (%s), got %s (%s)", test.message, test.code, message, code)
+			}
+		})
+	}
+}
+
+func TestValidateJWTChecksAudienceAndIssuer(t *testing.T) {
+	a := newJWTAuth(&Config{JWTAudience: "mqtt-service", JWTIssuer: "https://idp.example.com"})
+
+	tests := []struct {
+		name  string
+		aud   string
+		iss   string
+		valid bool
+	}{
+		{"matching", "mqtt-service", "https://idp.example.com", true},
+		{"other audience", "billing-service", "https://idp.example.com", false},
+		{"other issuer", "mqtt-service", "https://evil.example.com", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := validClaims()
+			claims["aud"] = test.aud
+			claims["iss"] = test.iss
+
+			_, err := a.ValidateJWT(signHS256(t, claims))
+			if test.valid && err != nil {
+				t.Errorf("Expected the token to be valid, got %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrTokenInvalid) {
+				t.Errorf("Expected the token to be invalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJWTClaimsAreAttachedToTheRequest(t *testing.T) {
+	a := newJWTAuth(&Config{})
+	claims := validClaims()
+	claims["scope"] = "publish read"
+	claims["namespace"] = "tenant-a"
+
+	called := false
+	rec := authenticate(a, "Bearer "+signHS256(t, claims), func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if claims, ok := ClaimsFromContext(r.Context()); !ok || claims["sub"] != "device-42" {
+			t.Errorf("Expected the claims in the request context, got %v", claims)
+		}
+		if scopes, _ := ScopesFromContext(r.Context()); len(scopes) != 2 || scopes[0] != ScopePublish || scopes[1] != ScopeRead {
+			t.Errorf("Expected the publish and read scopes, got %v", scopes)
+		}
+		if namespace := NamespaceFromContext(r.Context()); namespace != "tenant-a" {
+			t.Errorf("Expected namespace tenant-a, got %q", namespace)
+		}
+		if caller := CallerFromContext(r.Context()); caller != "jwt:device-42" {
+			t.Errorf("Expected caller jwt:device-42, got %q", caller)
+		}
+	})
+	if rec.Code != http.StatusOK || !called {
+		t.Errorf("Expected the request to be authenticated, got %d", rec.Code)
+	}
+}
+
+func TestJWTsWithoutSubjectAreDistinctCallers(t *testing.T) {
+	a := newJWTAuth(&Config{})
+	callers := map[string]bool{}
+	for _, id := range []string{"token-1", "token-2"} {
+		claims := validClaims()
+		delete(claims, "sub")
+		claims["jti"] = id
+
+		authenticate(a, "Bearer "+signHS256(t, claims), func(w http.ResponseWriter, r *http.Request) {
+			callers[CallerFromContext(r.Context())] = true
+		})
+	}
+	if len(callers) != 2 || callers["jwt:"] {
+		t.Errorf("Expected tokens without a subject to be told apart, got callers %v", callers)
+	}
+}
+
+func TestAPIKeysWorkAlongsideJWT(t *testing.T) {
+	a := newJWTAuth(&Config{}, "secret-key")
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	rec := httptest.NewRecorder()
+	a.AuthMiddleware(http.HandlerFunc(handler)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the API key to authenticate the request, got %d", rec.Code)
+	}
+
+	// An API key may also be sent as a bearer token
+	if rec := authenticate(a, "Bearer secret-key", handler); rec.Code != http.StatusOK {
+		t.Errorf("Expected the API key bearer token to authenticate the request, got %d", rec.Code)
+	}
+	if rec := authenticate(a, "Bearer "+signHS256(t, validClaims()), handler); rec.Code != http.StatusOK {
+		t.Errorf("Expected the JWT to authenticate the request, got %d", rec.Code)
+	}
+	if rec := authenticate(a, "Bearer wrong-key", handler); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown bearer token to be rejected, got %d", rec.Code)
+	}
+}
+
+// jwksServer serves the public key of a generated RSA key under the key ID "key-1", counting the requests.
+// Once failing is set, it answers 500.
+type jwksServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	requests atomic.Int32
+	failing  atomic.Bool
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	server := &jwksServer{key: key}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.requests.Add(1)
+		if server.failing.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sign signs claims with RS256 under a key ID
+func (s *jwksServer) sign(t *testing.T, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestValidateJWTWithJWKS(t *testing.T) {
+	server := newJWKSServer(t)
+	a := newJWTAuth(&Config{JWTJWKSURL: server.URL})
+
+	if _, err := a.ValidateJWT(server.sign(t, "key-1")); err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+	if _, err := a.ValidateJWT(server.sign(t, "key-1")); err != nil {
+		t.Fatalf("Expected the token to stay valid, got %v", err)
+	}
+	if requests := server.requests.Load(); requests != 1 {
+		t.Errorf("Expected the key set to be fetched once, got %d fetches", requests)
+	}
+
+	// HS256 tokens aren't accepted when keys come from a JWKS endpoint
+	if _, err := a.ValidateJWT(signHS256(t, validClaims())); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Expected an HS256 token to be invalid, got %v", err)
+	}
+}
+
+func TestUnknownKeyIDsDontRefetchTheJWKS(t *testing.T) {
+	server := newJWKSServer(t)
+	a := newJWTAuth(&Config{JWTJWKSURL: server.URL})
+
+	if _, err := a.ValidateJWT(server.sign(t, "key-1")); err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+
+	for _, kid := range []string{"random-1", "random-2", "random-3"} {
+		if _, err := a.ValidateJWT(server.sign(t, kid)); !errors.Is(err, ErrTokenInvalid) {
+			t.Errorf("Expected a token with the unknown key ID %s to be invalid, got %v", kid, err)
+		}
+	}
+	if requests := server.requests.Load(); requests != 1 {
+		t.Errorf("Expected unknown key IDs not to refetch the key set within the minimum interval, got %d fetches", requests)
+	}
+}
+
+func TestFailedJWKSRefreshKeepsCachedKeys(t *testing.T) {
+	server := newJWKSServer(t)
+	a := newJWTAuth(&Config{JWTJWKSURL: server.URL})
+
+	if _, err := a.ValidateJWT(server.sign(t, "key-1")); err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+
+	// Make the cache stale and the endpoint fail
+	server.failing.Store(true)
+	a.jwks.mu.Lock()
+	a.jwks.fetchedAt = time.Now().Add(-2 * jwksRefreshInterval)
+	a.jwks.attemptedAt = a.jwks.fetchedAt
+	a.jwks.mu.Unlock()
+
+	if _, err := a.ValidateJWT(server.sign(t, "key-1")); err != nil {
+		t.Fatalf("Expected the cached key to be served during the refresh, got %v", err)
+	}
+
+	// Wait for the failed refresh, after which the cached key is still used
+	deadline := time.Now().Add(5 * time.Second)
+	for server.requests.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := a.jwks.getKey(server.URL, "key-1"); err != nil {
+		t.Errorf("Expected the cached key to be kept after a failed refresh, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API scopes
+const (
+	// ScopePublish allows publishing messages
+	ScopePublish = "publish"
+	// ScopeSubscribe allows managing subscriptions
+	ScopeSubscribe = "subscribe"
+	// ScopeRead allows read-only access to status, metrics, logs, messages, and webhooks
+	ScopeRead = "read"
+	// ScopeAdmin allows everything, including webhook and message management
+	ScopeAdmin = "admin"
+)
+
+// AllScopes lists every scope, granted to keys configured without explicit scopes
+var AllScopes = []string{ScopePublish, ScopeSubscribe, ScopeRead, ScopeAdmin}
+
+// Context keys under which the authenticated caller's identity, scopes, and tenant namespace are stored
+const (
+	callerContextKey    contextKey = "caller"
+	scopesContextKey    contextKey = "scopes"
+	namespaceContextKey contextKey = "namespace"
+)
+
+// APIKey is an API key together with the scopes it grants and the tenant namespace it is confined to
+type APIKey struct {
+	Key    string
+	Scopes []string
+	// Namespace is the topic prefix of the key's tenant; empty means no tenant isolation
+	Namespace string
+}
+
+// ParseAPIKeys parses API key entries of the form "key", "key:scope1|scope2", or
+// "key:scope1|scope2:namespace". A key without scopes is granted all scopes for
+// backward compatibility.
+func ParseAPIKeys(entries []string) []APIKey {
+	keys := make([]APIKey, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		apiKey := APIKey{Key: parts[0], Scopes: AllScopes}
+
+		if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+			var scopes []string
+			for _, scope := range strings.Split(parts[1], "|") {
+				scope = strings.ToLower(strings.TrimSpace(scope))
+				if scope != "" {
+					scopes = append(scopes, scope)
+				}
+			}
+			apiKey.Scopes = scopes
+		}
+
+		if len(parts) > 2 {
+			apiKey.Namespace = strings.Trim(strings.TrimSpace(parts[2]), "/")
+		}
+
+		keys = append(keys, apiKey)
+	}
+	return keys
+}
+
+// ValidateScopes checks that every scope of every key is known and that namespaces are valid topic levels
+func ValidateScopes(keys []APIKey) error {
+	for _, key := range keys {
+		for _, scope := range key.Scopes {
+			if !isKnownScope(scope) {
+				return fmt.Errorf("unknown API key scope '%s'", scope)
+			}
+		}
+		if strings.ContainsAny(key.Namespace, "+#") {
+			return fmt.Errorf("API key namespace '%s' must not contain wildcards", key.Namespace)
+		}
+	}
+	return nil
+}
+
+// isKnownScope reports whether a scope is one of the defined scopes
+func isKnownScope(scope string) bool {
+	for _, known := range AllScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether a set of scopes grants the given scope; admin grants every scope
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopesFromContext returns the scopes of the authenticated caller, if any
+func ScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(scopesContextKey).([]string)
+	return scopes, ok
+}
+
+// NamespaceFromContext returns the tenant namespace of the authenticated caller, or "" if the caller isn't confined to one
+func NamespaceFromContext(ctx context.Context) string {
+	namespace, _ := ctx.Value(namespaceContextKey).(string)
+	return namespace
+}
+
+// CallerFromContext returns an identifier of the authenticated caller, or "" if the request wasn't authenticated.
+// API keys are identified by a fingerprint rather than the key itself, so the identifier is safe to log.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerContextKey).(string)
+	return caller
+}
+
+// apiKeyCaller returns the caller identifier of an API key
+func apiKeyCaller(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// jwtCaller returns the caller identifier of a JWT, based on its subject. Tokens without a subject are
+// identified by a fingerprint of the token, so they don't all share one identity and rate limit.
+func jwtCaller(token string, claims map[string]interface{}) string {
+	if subject, _ := claims["sub"].(string); subject != "" {
+		return "jwt:" + subject
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "jwt-token:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// withCaller returns a copy of the request carrying the caller's identity, scopes, and tenant namespace in its context
+func withCaller(r *http.Request, caller string, scopes []string, namespace string) *http.Request {
+	ctx := context.WithValue(r.Context(), callerContextKey, caller)
+	ctx = context.WithValue(ctx, scopesContextKey, scopes)
+	ctx = context.WithValue(ctx, namespaceContextKey, namespace)
+	return r.WithContext(ctx)
+}
+
+// namespaceFromClaims extracts the tenant namespace from a JWT "namespace" claim
+func namespaceFromClaims(claims map[string]interface{}) string {
+	namespace, _ := claims["namespace"].(string)
+	return strings.Trim(namespace, "/")
+}
+
+// ValidateJWTDefaultScopes checks that the scopes granted to JWTs without a scope claim are known
+func ValidateJWTDefaultScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return fmt.Errorf("unknown JWT default scope '%s'", scope)
+		}
+	}
+	return nil
+}
+
+// scopesFromClaims extracts scopes from a JWT "scope" (space-separated) or "scopes" (array) claim.
+// Tokens without either claim are granted the default scopes, which are none unless configured, so that
+// tokens the identity provider minted for other services aren't accepted as admin tokens.
+func scopesFromClaims(claims map[string]interface{}, defaults []string) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	if list, ok := claims["scopes"].([]interface{}); ok {
+		var scopes []string
+		for _, item := range list {
+			if scope, ok := item.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return defaults
+}
+
+// RequireScope wraps a handler so that it is only reachable by callers holding the given scope.
+// Requests that were not authenticated (authentication disabled) are let through unchanged.
+func (a *Auth) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scopes, authenticated := ScopesFromContext(r.Context())
+		if !authenticated || HasScope(scopes, scope) {
+			next(w, r)
+			return
+		}
+
+		a.logger.WithFields(map[string]interface{}{
+			"path":  r.URL.Path,
+			"scope": scope,
+		}).Info("Authorization failed: missing scope")
+		writeError(w, http.StatusForbidden, ErrCodeInsufficientScope, fmt.Sprintf("Forbidden: missing required scope '%s'", scope))
+	}
+}
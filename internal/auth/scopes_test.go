@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	tests := []struct {
+		entry    string
+		expected APIKey
+	}{
+		{"plain", APIKey{Key: "plain", Scopes: AllScopes}},
+		{" padded ", APIKey{Key: "padded", Scopes: AllScopes}},
+		{"scoped:publish|READ", APIKey{Key: "scoped", Scopes: []string{ScopePublish, ScopeRead}}},
+		{"spaced: subscribe | | read ", APIKey{Key: "spaced", Scopes: []string{ScopeSubscribe, ScopeRead}}},
+		{"tenant:read:tenant-a", APIKey{Key: "tenant", Scopes: []string{ScopeRead}, Namespace: "tenant-a"}},
+		{"unscoped-tenant::/tenant-b/", APIKey{Key: "unscoped-tenant", Scopes: AllScopes, Namespace: "tenant-b"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.entry, func(t *testing.T) {
+			keys := ParseAPIKeys([]string{test.entry})
+			if len(keys) != 1 || !reflect.DeepEqual(keys[0], test.expected) {
+				t.Errorf("Expected %+v, got %+v", test.expected, keys)
+			}
+		})
+	}
+
+	if keys := ParseAPIKeys([]string{"", "  ", "key"}); len(keys) != 1 {
+		t.Errorf("Expected blank entries to be skipped, got %+v", keys)
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		entry string
+		err   string
+	}{
+		{"key", ""},
+		{"key:publish|subscribe|read|admin:tenant-a", ""},
+		{"key:publish|write", "unknown API key scope 'write'"},
+		{"key:read:tenant/+", "must not contain wildcards"},
+		{"key::tenant/#", "must not contain wildcards"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.entry, func(t *testing.T) {
+			err := ValidateScopes(ParseAPIKeys([]string{test.entry}))
+			if test.err == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		scopes   []string
+		scope    string
+		expected bool
+	}{
+		{[]string{ScopePublish, ScopeRead}, ScopeRead, true},
+		{[]string{ScopePublish}, ScopeSubscribe, false},
+		{[]string{ScopeAdmin}, ScopePublish, true},
+		{[]string{ScopeRead}, ScopeAdmin, false},
+		{nil, ScopeRead, false},
+	}
+
+	for _, test := range tests {
+		if got := HasScope(test.scopes, test.scope); got != test.expected {
+			t.Errorf("Expected HasScope(%v, %s) to be %v, got %v", test.scopes, test.scope, test.expected, got)
+		}
+	}
+}
+
+func TestScopesFromClaims(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		defaults []string
+		expected []string
+	}{
+		{"scope claim", map[string]interface{}{"scope": "publish read"}, nil, []string{ScopePublish, ScopeRead}},
+		{"scopes claim", map[string]interface{}{"scopes": []interface{}{"subscribe", 42}}, nil, []string{ScopeSubscribe}},
+		{"no claim", map[string]interface{}{"sub": "other-service"}, nil, nil},
+		{"no claim with defaults", map[string]interface{}{"sub": "other-service"}, []string{ScopeRead}, []string{ScopeRead}},
+		{"claim overrides defaults", map[string]interface{}{"scope": "publish"}, []string{ScopeRead}, []string{ScopePublish}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scopes := scopesFromClaims(test.claims, test.defaults)
+			if !reflect.DeepEqual(scopes, test.expected) {
+				t.Errorf("Expected scopes %v, got %v", test.expected, scopes)
+			}
+			if test.expected == nil && HasScope(scopes, ScopeAdmin) {
+				t.Error("Expected a token without a scope claim not to be an admin")
+			}
+		})
+	}
+}
+
+func TestValidateJWTDefaultScopes(t *testing.T) {
+	if err := ValidateJWTDefaultScopes([]string{ScopeRead, ScopePublish}); err != nil {
+		t.Errorf("Expected known scopes to be valid, got %v", err)
+	}
+	if err := ValidateJWTDefaultScopes([]string{"everything"}); err == nil {
+		t.Error("Expected an unknown scope to be rejected")
+	}
+}
@@ -3,9 +3,15 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"MQTTmicroService/internal/utils"
 
 	"github.com/joho/godotenv"
 )
@@ -24,11 +30,116 @@ type BrokerConfig struct {
 	TLSCAFile     string
 	Username      string
 	Password      string
+	// ProbeInterval is the interval in seconds between connection probes (0 disables probing)
+	ProbeInterval int
+	// ProbeTopic is the topic connection probes are published to
+	ProbeTopic string
+	// ProtocolVersion is the MQTT protocol version to connect with (3 for MQTT 3.1, 4 for MQTT 3.1.1, 0 negotiates)
+	ProtocolVersion int
+	// KeepAlive is the keepalive interval in seconds (0 uses DefaultKeepAlive)
+	KeepAlive int
+	// PingTimeout is how long to wait for a ping response in seconds (0 uses DefaultPingTimeout)
+	PingTimeout int
+	// ReconnectInitialInterval is the delay before the first reconnect attempt in seconds, doubled after every
+	// failed attempt (0 uses DefaultReconnectInitialInterval)
+	ReconnectInitialInterval int
+	// MaxReconnectInterval is the maximum delay between reconnect attempts in seconds (0 uses DefaultMaxReconnectInterval)
+	MaxReconnectInterval int
+	// ReconnectJitter is the fraction, between 0 and 1, by which each reconnect delay is randomly shortened so
+	// clients don't reconnect in lockstep (0 disables jitter)
+	ReconnectJitter float64
+	// WriteTimeout is the timeout for writing packets in seconds (0 uses DefaultWriteTimeout)
+	WriteTimeout int
+	// ConnectTimeout is how long a single connection attempt may take in seconds (0 uses DefaultConnectTimeout)
+	ConnectTimeout int
+	// StoreDir is the directory used to persist in-flight QoS 1/2 messages (empty keeps them in memory)
+	StoreDir string
+	// MaxInflight is the maximum number of in-flight QoS 1/2 messages resent at once when a session is
+	// resumed after a reconnect (0 sends them all at once)
+	MaxInflight int
 }
 
+// MaxInflightLimit is the largest MaxInflight, the number of packet identifiers MQTT can tell apart
+const MaxInflightLimit = 65535
+
+// Default connection timings in seconds, used when a broker doesn't configure its own
+const (
+	DefaultKeepAlive            = 30
+	DefaultPingTimeout          = 10
+	DefaultMaxReconnectInterval = 60
+	DefaultWriteTimeout         = 10
+	DefaultConnectTimeout       = 30
+
+	DefaultReconnectInitialInterval = 1
+)
+
+// DefaultReconnectJitter is the reconnect jitter of brokers configured through the environment
+const DefaultReconnectJitter = 0.2
+
+// Defaults for connecting to the default broker at startup
+const (
+	DefaultStartupConnectAttempts = 5
+	DefaultStartupConnectMaxWait  = 30
+)
+
+// DefaultMemoryBufferSize is the number of recent messages kept in memory when none is configured
+const DefaultMemoryBufferSize = 100
+
+// Defaults for the webhook delivery worker pool
+const (
+	DefaultWebhookWorkers   = 10
+	DefaultWebhookQueueSize = 1000
+)
+
+// Defaults for the circuit breaker of webhook receivers
+const (
+	// DefaultWebhookBreakerThreshold is the number of consecutive failed attempts that open the circuit
+	DefaultWebhookBreakerThreshold = 5
+	// DefaultWebhookBreakerCooldown is how long an open circuit short-circuits deliveries, in seconds
+	DefaultWebhookBreakerCooldown = 60
+)
+
+// Policies applied to webhook notifications when the delivery queue is full
+const (
+	// WebhookQueueFullBlock waits briefly for room in the queue, dropping the notification if none frees up
+	WebhookQueueFullBlock = "block"
+	// WebhookQueueFullDrop drops the notification immediately
+	WebhookQueueFullDrop = "drop"
+)
+
+// Defaults for connecting and reconnecting to the database
+const (
+	DefaultDBConnectAttempts  = 5
+	DefaultDBReconnectMaxWait = 30
+)
+
+// DefaultStoreQueueSize is the number of published messages waiting to be stored by the asynchronous writer
+const DefaultStoreQueueSize = 1000
+
+// Policies applied to published messages when the queue of the asynchronous writer is full
+const (
+	// StoreQueueFullBlock waits for room in the queue, delaying the publish
+	StoreQueueFullBlock = "block"
+	// StoreQueueFullDrop doesn't store the message
+	StoreQueueFullDrop = "drop"
+)
+
+// DefaultDedupWindow is the window, in seconds, within which identical stored messages are deduplicated
+const DefaultDedupWindow = 60
+
+// Defaults for SQLite connections
+const (
+	// DefaultSQLiteBusyTimeout is how long a connection waits for a lock held by another, in milliseconds
+	DefaultSQLiteBusyTimeout = 5000
+	// DefaultSQLiteJournalMode lets readers and a writer work concurrently
+	DefaultSQLiteJournalMode = "wal"
+	// DefaultSQLiteSynchronous is durable in WAL mode except for the last commits on power loss
+	DefaultSQLiteSynchronous = "normal"
+)
+
 // DatabaseConfig holds the configuration for the database
 type DatabaseConfig struct {
-	// Type is the type of database to use (sqlite or mongodb)
+	// Type is the type of database to use (sqlite, mongodb, or memory)
 	Type string
 	// Connection is the connection string for the database
 	Connection string
@@ -43,7 +154,33 @@ type DatabaseConfig struct {
 	// SQLite specific settings
 	SQLite struct {
 		Path string
+		// BusyTimeout is how long a connection waits for a lock held by another before failing, in milliseconds
+		BusyTimeout int
+		// JournalMode is the journal_mode pragma: delete, truncate, persist, memory, wal, or off
+		JournalMode string
+		// Synchronous is the synchronous pragma: off, normal, full, or extra
+		Synchronous string
 	}
+	// ConnectAttempts is the number of times the database connection is attempted at startup
+	ConnectAttempts int
+	// ReconnectMaxWait is the maximum delay between database connection attempts, in seconds
+	ReconnectMaxWait int
+	// StoreMaxPayloadBytes truncates stored payloads longer than it; 0 stores payloads in full
+	StoreMaxPayloadBytes int
+	// StoreRedactFields lists the JSON paths of payload fields redacted in stored messages
+	StoreRedactFields []string
+	// StoreExcludeTopics lists the topic filters of published messages that aren't stored
+	StoreExcludeTopics []string
+	// StoreAsync stores published messages from a background writer instead of in the publish path
+	StoreAsync bool
+	// StoreQueueSize is the number of messages waiting for the asynchronous writer before the queue is full
+	StoreQueueSize int
+	// StoreQueueFullPolicy is StoreQueueFullBlock or StoreQueueFullDrop
+	StoreQueueFullPolicy string
+	// Dedup skips storing a message identical to one stored within the same window (same topic, payload, and QoS)
+	Dedup bool
+	// DedupWindow is the length of the deduplication windows, in seconds
+	DedupWindow int
 }
 
 // WebhookConfig holds the configuration for webhook notifications
@@ -52,6 +189,8 @@ type WebhookConfig struct {
 	Enabled bool
 	// URL is the URL to send webhook notifications to
 	URL string
+	// TopicFilter restricts notifications to messages received on matching topics
+	TopicFilter string
 	// Method is the HTTP method to use (GET, POST, etc.)
 	Method string
 	// Timeout is the timeout for webhook requests in seconds
@@ -60,6 +199,26 @@ type WebhookConfig struct {
 	RetryCount int
 	// RetryDelay is the delay between retries in seconds
 	RetryDelay int
+	// Secret is used to sign notification payloads with HMAC-SHA256; empty disables signing
+	Secret string
+	// DeliveryMaxAge is how long failed deliveries keep being retried, in seconds
+	DeliveryMaxAge int
+	// AllowPrivate allows database webhooks to target loopback, link-local, and private addresses
+	AllowPrivate bool
+	// DLQTopic is the topic notifications are republished to once their delivery is given up on; empty disables it
+	DLQTopic string
+	// Workers is the number of notifications delivered concurrently
+	Workers int
+	// QueueSize is the number of notifications waiting for a worker before the queue is full
+	QueueSize int
+	// QueueFullPolicy is WebhookQueueFullBlock or WebhookQueueFullDrop
+	QueueFullPolicy string
+	// ConfirmURL is notified whenever a stored message is confirmed; empty disables confirmation notifications
+	ConfirmURL string
+	// BreakerThreshold is the number of consecutive failed attempts to a URL that open its circuit; 0 disables the breaker
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit short-circuits deliveries before letting a probe through, in seconds
+	BreakerCooldown int
 }
 
 // Config holds the configuration for the MQTT microservice
@@ -69,6 +228,59 @@ type Config struct {
 	// API key authentication
 	EnableAPIKey bool
 	APIKeys      []string
+	// APIKeyHeaders are the request headers checked, in order, for the API key
+	APIKeyHeaders []string
+	// APIKeyBasicAuthField is the Basic Auth credential carrying the API key ("password" or "username")
+	APIKeyBasicAuthField string
+	// JWT bearer token authentication
+	EnableJWT   bool
+	JWTSecret   string
+	JWTJWKSURL  string
+	JWTAudience string
+	JWTIssuer   string
+	// JWTDefaultScopes are the scopes granted to JWTs without a scope claim (empty grants none)
+	JWTDefaultScopes []string
+	// APIRequestTimeout is the maximum time an API request may take, in seconds (0 disables the timeout)
+	APIRequestTimeout int
+	// CORSAllowedOrigins are the origins allowed to make cross-origin API requests (empty disables CORS, "*" allows any)
+	CORSAllowedOrigins []string
+	// IPAllowlist are the networks allowed to reach the API (empty allows every source)
+	IPAllowlist []netip.Prefix
+	// TrustedProxies are the networks of proxies whose X-Forwarded-For header is honored when resolving client IPs
+	TrustedProxies []netip.Prefix
+	// APIGzipEnabled enables gzip compression of API responses for clients that accept it
+	APIGzipEnabled bool
+	// RateLimitRPS is the number of API requests per second each client may make (0 disables rate limiting)
+	RateLimitRPS float64
+	// RateLimitBurst is the number of requests a client may make in a burst (0 defaults to RateLimitRPS rounded up)
+	RateLimitBurst int
+	// MaxPublishBytes is the maximum size of a publish request body in bytes (0 uses the default)
+	MaxPublishBytes int64
+	// IdempotencyTTL is how long the outcome of a request made with an idempotency key is kept, in seconds (0 uses the default)
+	IdempotencyTTL int
+	// StartupConnectAttempts is the number of times the default broker connection is attempted at startup
+	StartupConnectAttempts int
+	// StartupConnectMaxWait is the maximum delay between startup connection attempts, in seconds
+	StartupConnectMaxWait int
+	// MemoryBufferSize is the number of recent messages kept in memory; 0 disables the buffer
+	MemoryBufferSize int
+	// DefaultPublishQoS is the QoS of publish requests that don't specify one
+	DefaultPublishQoS byte
+	// DefaultSubscribeQoS is the QoS of subscribe requests that don't specify one
+	DefaultSubscribeQoS byte
+	// DefaultRetained is the retained flag of publish requests that don't specify one
+	DefaultRetained bool
+	// TopicNormalize collapses empty topic levels and strips trailing slashes from the topics of published and
+	// received messages, subscriptions, and webhook filters
+	TopicNormalize bool
+	// TopicRewrite rewrites the topics of published messages; nil publishes to topics as they are
+	TopicRewrite *utils.TopicRewriter
+	// PayloadSchemas holds the JSON Schemas published payloads must conform to; nil accepts any payload
+	PayloadSchemas *utils.PayloadSchemas
+	// MetricsMaxTopics is the number of topics tracked individually in the metrics breakdown (0 uses the default)
+	MetricsMaxTopics int
+	// MetricsLatencyBuckets are the upper bounds of the latency histogram buckets (nil uses the default)
+	MetricsLatencyBuckets []time.Duration
 	// Database configuration
 	Database *DatabaseConfig
 	// Webhook configuration
@@ -94,7 +306,7 @@ func LoadConfig() (*Config, error) {
 
 	// Find all broker configurations
 	for _, env := range os.Environ() {
-		if strings.HasPrefix(env, "MQTT_") && !strings.HasPrefix(env, "MQTT_DEFAULT_") && !strings.HasPrefix(env, "MQTT_TLS_") && !strings.HasPrefix(env, "MQTT_AUTH_") {
+		if strings.HasPrefix(env, "MQTT_") && !strings.HasPrefix(env, "MQTT_DEFAULT_") && !strings.HasPrefix(env, "MQTT_TLS_") && !strings.HasPrefix(env, "MQTT_AUTH_") && !strings.HasPrefix(env, "MQTT_STARTUP_") {
 			parts := strings.SplitN(env, "=", 2)
 			if len(parts) != 2 {
 				continue
@@ -112,12 +324,14 @@ func LoadConfig() (*Config, error) {
 			// Initialize broker config if it doesn't exist
 			if _, exists := config.Brokers[brokerName]; !exists {
 				config.Brokers[brokerName] = &BrokerConfig{
-					Name: brokerName,
+					Name:            brokerName,
+					ReconnectJitter: DefaultReconnectJitter,
 				}
 			}
 
 			// Set broker config values
 			broker := config.Brokers[brokerName]
+			var err error
 			switch configKey {
 			case "HOST":
 				broker.Host = os.Getenv(key)
@@ -134,6 +348,56 @@ func LoadConfig() (*Config, error) {
 				broker.EnableLogging = os.Getenv(key) == "true"
 			case "LOG_CHANNEL":
 				broker.LogChannel = os.Getenv(key)
+			case "PROBE_INTERVAL":
+				interval, err := strconv.Atoi(os.Getenv(key))
+				if err == nil {
+					broker.ProbeInterval = interval
+				}
+			case "PROBE_TOPIC":
+				broker.ProbeTopic = os.Getenv(key)
+			case "PROTOCOL_VERSION":
+				version, err := strconv.Atoi(os.Getenv(key))
+				if err == nil {
+					broker.ProtocolVersion = version
+				}
+			case "KEEPALIVE":
+				if broker.KeepAlive, err = parsePositiveSeconds(key); err != nil {
+					return nil, err
+				}
+			case "PING_TIMEOUT":
+				if broker.PingTimeout, err = parsePositiveSeconds(key); err != nil {
+					return nil, err
+				}
+			case "RECONNECT_INITIAL_INTERVAL":
+				if broker.ReconnectInitialInterval, err = parsePositiveSeconds(key); err != nil {
+					return nil, err
+				}
+			case "MAX_RECONNECT_INTERVAL":
+				if broker.MaxReconnectInterval, err = parsePositiveSeconds(key); err != nil {
+					return nil, err
+				}
+			case "RECONNECT_JITTER":
+				jitter, err := strconv.ParseFloat(os.Getenv(key), 64)
+				if err != nil || jitter < 0 || jitter > 1 {
+					return nil, fmt.Errorf("invalid %s: %s (must be between 0 and 1)", key, os.Getenv(key))
+				}
+				broker.ReconnectJitter = jitter
+			case "WRITE_TIMEOUT":
+				if broker.WriteTimeout, err = parsePositiveSeconds(key); err != nil {
+					return nil, err
+				}
+			case "CONNECT_TIMEOUT":
+				if broker.ConnectTimeout, err = parsePositiveSeconds(key); err != nil {
+					return nil, err
+				}
+			case "STORE_DIR":
+				broker.StoreDir = os.Getenv(key)
+			case "MAX_INFLIGHT":
+				maxInflight, err := strconv.Atoi(os.Getenv(key))
+				if err != nil || maxInflight < 0 || maxInflight > MaxInflightLimit {
+					return nil, fmt.Errorf("invalid %s: %s (must be between 0 and %d)", key, os.Getenv(key), MaxInflightLimit)
+				}
+				broker.MaxInflight = maxInflight
 			}
 		}
 	}
@@ -148,15 +412,199 @@ func LoadConfig() (*Config, error) {
 	password := os.Getenv("MQTT_AUTH_PASSWORD")
 
 	// Process API key authentication settings
-	apiKeyEnabled := os.Getenv("API_KEY_ENABLED")
-	config.EnableAPIKey = apiKeyEnabled == "true"
-	fmt.Printf("API_KEY_ENABLED environment variable: %s, resulting EnableAPIKey flag: %v\n", apiKeyEnabled, config.EnableAPIKey)
+	config.EnableAPIKey = os.Getenv("API_KEY_ENABLED") == "true"
 
 	apiKeys := os.Getenv("API_KEYS")
 	if apiKeys != "" {
 		config.APIKeys = strings.Split(apiKeys, ",")
 	}
 
+	config.APIKeyHeaders = []string{"X-API-Key"}
+	if headers := splitList(os.Getenv("API_KEY_HEADER")); len(headers) > 0 {
+		for _, header := range headers {
+			if !validHeaderName(header) || strings.EqualFold(header, "Authorization") {
+				return nil, fmt.Errorf("invalid API_KEY_HEADER: %s", header)
+			}
+		}
+		config.APIKeyHeaders = headers
+	}
+
+	config.APIKeyBasicAuthField = "password"
+	if basicAuthField := os.Getenv("API_KEY_BASIC_AUTH_FIELD"); basicAuthField != "" {
+		if basicAuthField != "password" && basicAuthField != "username" {
+			return nil, fmt.Errorf("invalid API_KEY_BASIC_AUTH_FIELD: %s", basicAuthField)
+		}
+		config.APIKeyBasicAuthField = basicAuthField
+	}
+
+	// Process JWT authentication settings
+	config.EnableJWT = os.Getenv("JWT_ENABLED") == "true"
+	config.JWTSecret = os.Getenv("JWT_SECRET")
+	config.JWTJWKSURL = os.Getenv("JWT_JWKS_URL")
+	config.JWTAudience = os.Getenv("JWT_AUDIENCE")
+	config.JWTIssuer = os.Getenv("JWT_ISSUER")
+	for _, scope := range splitList(os.Getenv("JWT_DEFAULT_SCOPES")) {
+		config.JWTDefaultScopes = append(config.JWTDefaultScopes, strings.ToLower(scope))
+	}
+	if config.EnableJWT && config.JWTSecret == "" && config.JWTJWKSURL == "" {
+		return nil, errors.New("JWT_SECRET or JWT_JWKS_URL is required when JWT_ENABLED is true")
+	}
+
+	// Process API request timeout
+	config.APIRequestTimeout = 10 // Default to 10 seconds
+	if requestTimeoutStr := os.Getenv("API_REQUEST_TIMEOUT"); requestTimeoutStr != "" {
+		requestTimeout, err := strconv.Atoi(requestTimeoutStr)
+		if err != nil || requestTimeout < 0 {
+			return nil, fmt.Errorf("invalid API_REQUEST_TIMEOUT: %s", requestTimeoutStr)
+		}
+		config.APIRequestTimeout = requestTimeout
+	}
+
+	// Process response compression settings
+	config.APIGzipEnabled = os.Getenv("API_GZIP_ENABLED") == "true"
+
+	// Process rate limit settings
+	if rpsStr := os.Getenv("RATE_LIMIT_RPS"); rpsStr != "" {
+		rps, err := strconv.ParseFloat(rpsStr, 64)
+		if err != nil || rps < 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_RPS: %s", rpsStr)
+		}
+		config.RateLimitRPS = rps
+	}
+	if burstStr := os.Getenv("RATE_LIMIT_BURST"); burstStr != "" {
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil || burst < 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_BURST: %s", burstStr)
+		}
+		config.RateLimitBurst = burst
+	}
+
+	// Process publish size limit
+	if maxPublishBytesStr := os.Getenv("MAX_PUBLISH_BYTES"); maxPublishBytesStr != "" {
+		maxPublishBytes, err := strconv.ParseInt(maxPublishBytesStr, 10, 64)
+		if err != nil || maxPublishBytes <= 0 {
+			return nil, fmt.Errorf("invalid MAX_PUBLISH_BYTES: %s", maxPublishBytesStr)
+		}
+		config.MaxPublishBytes = maxPublishBytes
+	}
+
+	// Process idempotency settings
+	if idempotencyTTLStr := os.Getenv("IDEMPOTENCY_TTL"); idempotencyTTLStr != "" {
+		idempotencyTTL, err := strconv.Atoi(idempotencyTTLStr)
+		if err != nil || idempotencyTTL <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: %s", idempotencyTTLStr)
+		}
+		config.IdempotencyTTL = idempotencyTTL
+	}
+
+	// Process startup connection settings
+	config.StartupConnectAttempts = DefaultStartupConnectAttempts
+	if attemptsStr := os.Getenv("MQTT_STARTUP_CONNECT_ATTEMPTS"); attemptsStr != "" {
+		attempts, err := strconv.Atoi(attemptsStr)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("invalid MQTT_STARTUP_CONNECT_ATTEMPTS: %s", attemptsStr)
+		}
+		config.StartupConnectAttempts = attempts
+	}
+	config.StartupConnectMaxWait = DefaultStartupConnectMaxWait
+	if os.Getenv("MQTT_STARTUP_CONNECT_MAX_WAIT") != "" {
+		maxWait, err := parsePositiveSeconds("MQTT_STARTUP_CONNECT_MAX_WAIT")
+		if err != nil {
+			return nil, err
+		}
+		config.StartupConnectMaxWait = maxWait
+	}
+
+	// Process metrics settings
+	if maxTopicsStr := os.Getenv("METRICS_MAX_TOPICS"); maxTopicsStr != "" {
+		maxTopics, err := strconv.Atoi(maxTopicsStr)
+		if err != nil || maxTopics <= 0 {
+			return nil, fmt.Errorf("invalid METRICS_MAX_TOPICS: %s", maxTopicsStr)
+		}
+		config.MetricsMaxTopics = maxTopics
+	}
+	for _, bucket := range splitList(os.Getenv("METRICS_LATENCY_BUCKETS")) {
+		bound, err := strconv.ParseFloat(bucket, 64)
+		if err != nil || bound <= 0 {
+			return nil, fmt.Errorf("invalid METRICS_LATENCY_BUCKETS: %s (must be positive milliseconds)", bucket)
+		}
+		duration := time.Duration(bound * float64(time.Millisecond))
+		if last := len(config.MetricsLatencyBuckets) - 1; last >= 0 && duration <= config.MetricsLatencyBuckets[last] {
+			return nil, fmt.Errorf("invalid METRICS_LATENCY_BUCKETS: %s (bounds must be increasing)", bucket)
+		}
+		config.MetricsLatencyBuckets = append(config.MetricsLatencyBuckets, duration)
+	}
+
+	// Process recent messages buffer settings
+	config.MemoryBufferSize = DefaultMemoryBufferSize
+	if bufferSizeStr := os.Getenv("MEMORY_BUFFER_SIZE"); bufferSizeStr != "" {
+		bufferSize, err := strconv.Atoi(bufferSizeStr)
+		if err != nil || bufferSize < 0 {
+			return nil, fmt.Errorf("invalid MEMORY_BUFFER_SIZE: %s", bufferSizeStr)
+		}
+		config.MemoryBufferSize = bufferSize
+	}
+
+	// Process the defaults of requests omitting their QoS or retained flag
+	defaultPublishQoS, err := parseQoS("DEFAULT_PUBLISH_QOS")
+	if err != nil {
+		return nil, err
+	}
+	config.DefaultPublishQoS = defaultPublishQoS
+	defaultSubscribeQoS, err := parseQoS("DEFAULT_SUBSCRIBE_QOS")
+	if err != nil {
+		return nil, err
+	}
+	config.DefaultSubscribeQoS = defaultSubscribeQoS
+	if retainedStr := os.Getenv("DEFAULT_RETAINED"); retainedStr != "" {
+		retained, err := strconv.ParseBool(retainedStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DEFAULT_RETAINED: %s", retainedStr)
+		}
+		config.DefaultRetained = retained
+	}
+
+	if normalizeStr := os.Getenv("TOPIC_NORMALIZE"); normalizeStr != "" {
+		normalize, err := strconv.ParseBool(normalizeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOPIC_NORMALIZE: %s", normalizeStr)
+		}
+		config.TopicNormalize = normalize
+	}
+
+	// Process topic rewrite rules
+	if rules := os.Getenv("TOPIC_REWRITE_RULES"); rules != "" {
+		rewriter, err := utils.ParseTopicRewriteRules(rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOPIC_REWRITE_RULES: %w", err)
+		}
+		config.TopicRewrite = rewriter
+	}
+
+	// Process payload schema rules
+	if rules := os.Getenv("SCHEMA_RULES"); rules != "" {
+		schemas, err := utils.ParsePayloadSchemaRules(rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SCHEMA_RULES: %w", err)
+		}
+		config.PayloadSchemas = schemas
+	}
+
+	// Process CORS settings
+	config.CORSAllowedOrigins = splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+
+	// Process source IP settings
+	ipAllowlist, err := parsePrefixes("IP_ALLOWLIST")
+	if err != nil {
+		return nil, err
+	}
+	config.IPAllowlist = ipAllowlist
+	trustedProxies, err := parsePrefixes("TRUSTED_PROXIES")
+	if err != nil {
+		return nil, err
+	}
+	config.TrustedProxies = trustedProxies
+
 	// Process database settings
 	dbType := os.Getenv("DB_CONNECTION")
 	if dbType == "" {
@@ -187,12 +635,116 @@ func LoadConfig() (*Config, error) {
 		if config.Database.SQLite.Path == "" {
 			config.Database.SQLite.Path = "mqtt-messages.db" // Default SQLite database path
 		}
+
+		config.Database.SQLite.BusyTimeout = DefaultSQLiteBusyTimeout
+		if timeoutStr := os.Getenv("DB_SQLITE_BUSY_TIMEOUT"); timeoutStr != "" {
+			timeout, err := strconv.Atoi(timeoutStr)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid DB_SQLITE_BUSY_TIMEOUT: %s", timeoutStr)
+			}
+			config.Database.SQLite.BusyTimeout = timeout
+		}
+		config.Database.SQLite.JournalMode = DefaultSQLiteJournalMode
+		if mode := strings.ToLower(os.Getenv("DB_SQLITE_JOURNAL_MODE")); mode != "" {
+			switch mode {
+			case "delete", "truncate", "persist", "memory", "wal", "off":
+			default:
+				return nil, fmt.Errorf("invalid DB_SQLITE_JOURNAL_MODE: %s", mode)
+			}
+			config.Database.SQLite.JournalMode = mode
+		}
+		config.Database.SQLite.Synchronous = DefaultSQLiteSynchronous
+		if synchronous := strings.ToLower(os.Getenv("DB_SQLITE_SYNCHRONOUS")); synchronous != "" {
+			switch synchronous {
+			case "off", "normal", "full", "extra":
+			default:
+				return nil, fmt.Errorf("invalid DB_SQLITE_SYNCHRONOUS: %s", synchronous)
+			}
+			config.Database.SQLite.Synchronous = synchronous
+		}
+	}
+
+	// Process database connection retry settings
+	config.Database.ConnectAttempts = DefaultDBConnectAttempts
+	if attemptsStr := os.Getenv("DB_CONNECT_ATTEMPTS"); attemptsStr != "" {
+		attempts, err := strconv.Atoi(attemptsStr)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("invalid DB_CONNECT_ATTEMPTS: %s", attemptsStr)
+		}
+		config.Database.ConnectAttempts = attempts
+	}
+	config.Database.ReconnectMaxWait = DefaultDBReconnectMaxWait
+	if os.Getenv("DB_RECONNECT_MAX_WAIT") != "" {
+		maxWait, err := parsePositiveSeconds("DB_RECONNECT_MAX_WAIT")
+		if err != nil {
+			return nil, err
+		}
+		config.Database.ReconnectMaxWait = maxWait
+	}
+
+	// Process the transforms applied to stored copies of published messages
+	if maxBytesStr := os.Getenv("DB_STORE_MAX_PAYLOAD_BYTES"); maxBytesStr != "" {
+		maxBytes, err := strconv.Atoi(maxBytesStr)
+		if err != nil || maxBytes < 0 {
+			return nil, fmt.Errorf("invalid DB_STORE_MAX_PAYLOAD_BYTES: %s", maxBytesStr)
+		}
+		config.Database.StoreMaxPayloadBytes = maxBytes
+	}
+	config.Database.StoreRedactFields = splitList(os.Getenv("DB_STORE_REDACT_FIELDS"))
+	config.Database.StoreExcludeTopics = splitList(os.Getenv("DB_STORE_EXCLUDE_TOPICS"))
+	for _, filter := range config.Database.StoreExcludeTopics {
+		if err := utils.ValidateFilter(filter); err != nil {
+			return nil, fmt.Errorf("invalid DB_STORE_EXCLUDE_TOPICS filter %s: %w", filter, err)
+		}
+	}
+
+	// Process the asynchronous storage settings
+	config.Database.StoreAsync = os.Getenv("DB_STORE_ASYNC") == "true"
+	config.Database.StoreQueueSize = DefaultStoreQueueSize
+	if queueSizeStr := os.Getenv("DB_STORE_QUEUE_SIZE"); queueSizeStr != "" {
+		queueSize, err := strconv.Atoi(queueSizeStr)
+		if err != nil || queueSize <= 0 {
+			return nil, fmt.Errorf("invalid DB_STORE_QUEUE_SIZE: %s", queueSizeStr)
+		}
+		config.Database.StoreQueueSize = queueSize
+	}
+	config.Database.StoreQueueFullPolicy = StoreQueueFullBlock
+	if policy := os.Getenv("DB_STORE_QUEUE_FULL_POLICY"); policy != "" {
+		if policy != StoreQueueFullBlock && policy != StoreQueueFullDrop {
+			return nil, fmt.Errorf("invalid DB_STORE_QUEUE_FULL_POLICY: %s", policy)
+		}
+		config.Database.StoreQueueFullPolicy = policy
+	}
+
+	// Process the deduplication settings
+	config.Database.Dedup = os.Getenv("DB_DEDUP") == "true"
+	config.Database.DedupWindow = DefaultDedupWindow
+	if os.Getenv("DB_DEDUP_WINDOW") != "" {
+		if config.Database.DedupWindow, err = parsePositiveSeconds("DB_DEDUP_WINDOW"); err != nil {
+			return nil, err
+		}
 	}
 
 	// Process webhook settings
 	webhookEnabled := os.Getenv("WEBHOOK_ENABLED") == "true"
 	config.Webhook.Enabled = webhookEnabled
 	config.Webhook.URL = os.Getenv("WEBHOOK_URL")
+	config.Webhook.TopicFilter = os.Getenv("WEBHOOK_TOPIC_FILTER")
+	if config.Webhook.TopicFilter == "" {
+		config.Webhook.TopicFilter = "#" // Default to every topic if not specified
+	}
+	if err := utils.ValidateFilter(config.Webhook.TopicFilter); err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_TOPIC_FILTER %s: %w", config.Webhook.TopicFilter, err)
+	}
+	config.Webhook.Secret = os.Getenv("WEBHOOK_SECRET")
+	config.Webhook.ConfirmURL = os.Getenv("CONFIRM_WEBHOOK_URL")
+	config.Webhook.AllowPrivate = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+	config.Webhook.DLQTopic = os.Getenv("WEBHOOK_DLQ_TOPIC")
+	if config.Webhook.DLQTopic != "" {
+		if err := utils.ValidatePublishTopic(config.Webhook.DLQTopic); err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_DLQ_TOPIC %s: %w", config.Webhook.DLQTopic, err)
+		}
+	}
 	config.Webhook.Method = os.Getenv("WEBHOOK_METHOD")
 	if config.Webhook.Method == "" {
 		config.Webhook.Method = "POST" // Default to POST if not specified
@@ -234,8 +786,64 @@ func LoadConfig() (*Config, error) {
 		config.Webhook.RetryDelay = 5 // Default to 5 seconds if not specified or invalid
 	}
 
+	// Parse webhook delivery max age
+	webhookDeliveryMaxAgeStr := os.Getenv("WEBHOOK_DELIVERY_MAX_AGE")
+	if webhookDeliveryMaxAgeStr != "" {
+		webhookDeliveryMaxAge, err := strconv.Atoi(webhookDeliveryMaxAgeStr)
+		if err == nil && webhookDeliveryMaxAge > 0 {
+			config.Webhook.DeliveryMaxAge = webhookDeliveryMaxAge
+		}
+	}
+	if config.Webhook.DeliveryMaxAge == 0 {
+		config.Webhook.DeliveryMaxAge = 86400 // Default to 24 hours if not specified or invalid
+	}
+
+	// Process webhook delivery worker pool settings
+	config.Webhook.Workers = DefaultWebhookWorkers
+	if workersStr := os.Getenv("WEBHOOK_WORKERS"); workersStr != "" {
+		workers, err := strconv.Atoi(workersStr)
+		if err != nil || workers <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_WORKERS: %s", workersStr)
+		}
+		config.Webhook.Workers = workers
+	}
+	config.Webhook.QueueSize = DefaultWebhookQueueSize
+	if queueSizeStr := os.Getenv("WEBHOOK_QUEUE_SIZE"); queueSizeStr != "" {
+		queueSize, err := strconv.Atoi(queueSizeStr)
+		if err != nil || queueSize < 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_QUEUE_SIZE: %s", queueSizeStr)
+		}
+		config.Webhook.QueueSize = queueSize
+	}
+	config.Webhook.QueueFullPolicy = WebhookQueueFullBlock
+	if policy := os.Getenv("WEBHOOK_QUEUE_FULL_POLICY"); policy != "" {
+		if policy != WebhookQueueFullBlock && policy != WebhookQueueFullDrop {
+			return nil, fmt.Errorf("invalid WEBHOOK_QUEUE_FULL_POLICY: %s", policy)
+		}
+		config.Webhook.QueueFullPolicy = policy
+	}
+
+	// Process webhook circuit breaker settings
+	config.Webhook.BreakerThreshold = DefaultWebhookBreakerThreshold
+	if thresholdStr := os.Getenv("WEBHOOK_BREAKER_THRESHOLD"); thresholdStr != "" {
+		threshold, err := strconv.Atoi(thresholdStr)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_BREAKER_THRESHOLD: %s", thresholdStr)
+		}
+		config.Webhook.BreakerThreshold = threshold
+	}
+	config.Webhook.BreakerCooldown = DefaultWebhookBreakerCooldown
+	if cooldownStr := os.Getenv("WEBHOOK_BREAKER_COOLDOWN"); cooldownStr != "" {
+		cooldown, err := strconv.Atoi(cooldownStr)
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_BREAKER_COOLDOWN: %s", cooldownStr)
+		}
+		config.Webhook.BreakerCooldown = cooldown
+	}
+
 	// Apply TLS and auth settings to all brokers
 	for _, broker := range config.Brokers {
+		broker.ClientID = resolveClientID(broker.ClientID, broker.Name)
 		broker.TLSEnabled = tlsEnabled
 		broker.TLSVerifyPeer = tlsVerifyPeer
 		broker.TLSCAFile = tlsCAFile
@@ -275,6 +883,50 @@ func (c *Config) GetDefaultBrokerConfig() (*BrokerConfig, error) {
 	return c.GetBrokerConfig(c.DefaultConnection)
 }
 
+// Summary returns an overview of the configuration as log fields. It never includes secrets, only whether they are set.
+func (c *Config) Summary() map[string]interface{} {
+	brokers := make([]string, 0, len(c.Brokers))
+	tlsEnabled := false
+	for name, broker := range c.Brokers {
+		brokers = append(brokers, name)
+		tlsEnabled = tlsEnabled || broker.TLSEnabled
+	}
+	sort.Strings(brokers)
+
+	authModes := make([]string, 0, 2)
+	if c.EnableAPIKey {
+		authModes = append(authModes, "api_key")
+	}
+	if c.EnableJWT {
+		authModes = append(authModes, "jwt")
+	}
+	authMode := "none"
+	if len(authModes) > 0 {
+		authMode = strings.Join(authModes, "+")
+	}
+
+	fields := map[string]interface{}{
+		"default_connection": c.DefaultConnection,
+		"broker_count":       len(c.Brokers),
+		"brokers":            strings.Join(brokers, ","),
+		"tls_enabled":        tlsEnabled,
+		"auth_mode":          authMode,
+		"api_key_count":      len(c.APIKeys),
+		"ip_allowlist":       len(c.IPAllowlist) > 0,
+		"rate_limit":         c.RateLimitRPS > 0,
+		"db_type":            "",
+		"webhook_enabled":    false,
+	}
+	if c.Database != nil {
+		fields["db_type"] = c.Database.Type
+	}
+	if c.Webhook != nil {
+		fields["webhook_enabled"] = c.Webhook.Enabled
+		fields["webhook_signed"] = c.Webhook.Secret != ""
+	}
+	return fields
+}
+
 // Validate checks if the broker configuration is valid
 func (b *BrokerConfig) Validate() error {
 	if b.Host == "" {
@@ -286,11 +938,151 @@ func (b *BrokerConfig) Validate() error {
 	if b.ClientID == "" {
 		return fmt.Errorf("client ID is required for broker '%s'", b.Name)
 	}
+	if b.ProbeInterval < 0 {
+		return fmt.Errorf("probe interval must not be negative for broker '%s'", b.Name)
+	}
+	if b.KeepAlive < 0 || b.PingTimeout < 0 || b.ReconnectInitialInterval < 0 || b.MaxReconnectInterval < 0 || b.WriteTimeout < 0 {
+		return fmt.Errorf("keepalive, ping timeout, reconnect intervals, and write timeout must not be negative for broker '%s'", b.Name)
+	}
+	if b.ReconnectJitter < 0 || b.ReconnectJitter > 1 {
+		return fmt.Errorf("reconnect jitter must be between 0 and 1 for broker '%s'", b.Name)
+	}
+	if b.MaxInflight < 0 || b.MaxInflight > MaxInflightLimit {
+		return fmt.Errorf("max in-flight messages must be between 0 and %d for broker '%s'", MaxInflightLimit, b.Name)
+	}
+	switch b.ProtocolVersion {
+	case 0, 3, 4:
+	case 5:
+		// The paho.mqtt.golang client only implements MQTT 3.1 and 3.1.1
+		return fmt.Errorf("protocol version 5 is not supported for broker '%s': the MQTT client only supports versions 3 and 4", b.Name)
+	default:
+		return fmt.Errorf("invalid protocol version %d for broker '%s': must be 3 or 4", b.ProtocolVersion, b.Name)
+	}
 	if b.TLSEnabled && b.TLSCAFile != "" {
 		// Check if the CA file exists
 		if _, err := os.Stat(b.TLSCAFile); os.IsNotExist(err) {
 			return fmt.Errorf("TLS CA file '%s' does not exist for broker '%s'", b.TLSCAFile, b.Name)
 		}
 	}
+	if b.StoreDir != "" {
+		if err := checkWritableDir(b.StoreDir); err != nil {
+			return fmt.Errorf("store directory '%s' is not writable for broker '%s': %w", b.StoreDir, b.Name, err)
+		}
+	}
 	return nil
 }
+
+// parsePrefixes parses an environment variable holding a comma-separated list of CIDR networks.
+// Plain IP addresses are taken as single-address networks.
+func parsePrefixes(key string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range splitList(os.Getenv(key)) {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", key, value)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// validHeaderName reports whether a string is a valid HTTP header name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		isAlphanumeric := ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+		if !isAlphanumeric && !strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientIDVariable matches a ${NAME} placeholder in a client ID template
+var clientIDVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// splitList splits a comma-separated setting into its non-empty, trimmed values
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// resolveClientID returns the client ID of a broker. An empty ID defaults to mqtt-microservice-<broker>-<hostname>-<pid>,
+// and ${NAME} placeholders in a configured ID are expanded: ${HOSTNAME}, ${PID}, and ${BROKER} to the host name,
+// process ID, and broker name, and any other name to the environment variable's value. IDs without placeholders are
+// used as they are.
+func resolveClientID(clientID, broker string) string {
+	if clientID == "" {
+		clientID = "mqtt-microservice-${BROKER}-${HOSTNAME}-${PID}"
+	}
+
+	return clientIDVariable.ReplaceAllStringFunc(clientID, func(placeholder string) string {
+		name := clientIDVariable.FindStringSubmatch(placeholder)[1]
+		switch name {
+		case "HOSTNAME":
+			if hostname, err := os.Hostname(); err == nil {
+				return hostname
+			}
+			return os.Getenv("HOSTNAME")
+		case "PID":
+			return strconv.Itoa(os.Getpid())
+		case "BROKER":
+			return broker
+		default:
+			return os.Getenv(name)
+		}
+	})
+}
+
+// parseQoS parses an environment variable holding a QoS level, returning 0 if it is unset
+func parseQoS(key string) (byte, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	qos, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || qos > 2 {
+		return 0, fmt.Errorf("invalid %s: %s (must be 0, 1, or 2)", key, value)
+	}
+	return byte(qos), nil
+}
+
+// parsePositiveSeconds parses an environment variable holding a positive number of seconds
+func parsePositiveSeconds(key string) (int, error) {
+	value := os.Getenv(key)
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s (must be a positive number of seconds)", key, value)
+	}
+	return seconds, nil
+}
+
+// checkWritableDir creates the directory if needed and verifies that files can be written to it
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
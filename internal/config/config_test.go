@@ -1,8 +1,14 @@
 ﻿package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -25,7 +31,14 @@ func TestLoadConfig(t *testing.T) {
 	os.Setenv("MQTT_TEST_PORT", "1883")
 	os.Setenv("MQTT_TEST_CLIENT_ID", "test-client")
 	os.Setenv("MQTT_TEST_CLEAN_SESSION", "true")
+	os.Setenv("MQTT_TEST_KEEPALIVE", "120")
+	os.Setenv("MQTT_TEST_MAX_INFLIGHT", "100")
 	os.Setenv("MQTT_TLS_ENABLED", "false")
+	os.Setenv("MQTT_STARTUP_CONNECT_ATTEMPTS", "3")
+	os.Setenv("DB_RECONNECT_MAX_WAIT", "10")
+	os.Setenv("TOPIC_NORMALIZE", "true")
+	os.Setenv("TOPIC_REWRITE_RULES", "raw/=>normalized/")
+	os.Setenv("DB_STORE_EXCLUDE_TOPICS", "cameras/#, logs/+")
 	
 	// Load configuration
 	cfg, err := LoadConfig()
@@ -60,9 +73,65 @@ func TestLoadConfig(t *testing.T) {
 		t.Error("Expected CleanSession to be true")
 	}
 	
+	if broker.KeepAlive != 120 {
+		t.Errorf("Expected KeepAlive to be 120, got %d", broker.KeepAlive)
+	}
+	
+	if broker.PingTimeout != 0 {
+		t.Errorf("Expected PingTimeout to be unset, got %d", broker.PingTimeout)
+	}
+
+	if broker.MaxInflight != 100 {
+		t.Errorf("Expected MaxInflight to be 100, got %d", broker.MaxInflight)
+	}
+	
 	if broker.TLSEnabled {
 		t.Error("Expected TLSEnabled to be false")
 	}
+	
+	if _, exists := cfg.Brokers["startup"]; exists {
+		t.Error("Expected startup settings not to be parsed as a broker")
+	}
+	
+	if cfg.StartupConnectAttempts != 3 {
+		t.Errorf("Expected StartupConnectAttempts to be 3, got %d", cfg.StartupConnectAttempts)
+	}
+	
+	if cfg.StartupConnectMaxWait != DefaultStartupConnectMaxWait {
+		t.Errorf("Expected StartupConnectMaxWait to default to %d, got %d", DefaultStartupConnectMaxWait, cfg.StartupConnectMaxWait)
+	}
+	
+	if cfg.Database.ConnectAttempts != DefaultDBConnectAttempts {
+		t.Errorf("Expected database ConnectAttempts to default to %d, got %d", DefaultDBConnectAttempts, cfg.Database.ConnectAttempts)
+	}
+	
+	if cfg.Database.ReconnectMaxWait != 10 {
+		t.Errorf("Expected database ReconnectMaxWait to be 10, got %d", cfg.Database.ReconnectMaxWait)
+	}
+	
+	if cfg.MemoryBufferSize != DefaultMemoryBufferSize {
+		t.Errorf("Expected MemoryBufferSize to default to %d, got %d", DefaultMemoryBufferSize, cfg.MemoryBufferSize)
+	}
+	
+	if !cfg.TopicNormalize {
+		t.Error("Expected TopicNormalize to be enabled")
+	}
+	
+	if topic := cfg.TopicRewrite.Rewrite("raw/foo"); topic != "normalized/foo" {
+		t.Errorf("Expected raw/foo to be rewritten to 'normalized/foo', got '%s'", topic)
+	}
+	
+	if excluded := cfg.Database.StoreExcludeTopics; len(excluded) != 2 || excluded[0] != "cameras/#" || excluded[1] != "logs/+" {
+		t.Errorf("Expected StoreExcludeTopics to be [cameras/# logs/+], got %v", excluded)
+	}
+	
+	if cfg.Database.StoreMaxPayloadBytes != 0 {
+		t.Errorf("Expected StoreMaxPayloadBytes to be unset, got %d", cfg.Database.StoreMaxPayloadBytes)
+	}
+	
+	if headers := cfg.APIKeyHeaders; len(headers) != 1 || headers[0] != "X-API-Key" {
+		t.Errorf("Expected APIKeyHeaders to default to [X-API-Key], got %v", headers)
+	}
 }
 
 func TestGetBrokerConfig(t *testing.T) {
@@ -157,6 +226,81 @@ func TestBrokerConfigValidate(t *testing.T) {
 	if err := invalidConfig.Validate(); err == nil {
 		t.Error("Expected error for missing client ID, got nil")
 	}
+
+	// Test unsupported protocol version
+	invalidConfig = &BrokerConfig{
+		Name:            "test",
+		Host:            "localhost",
+		Port:            1883,
+		ClientID:        "test-client",
+		ProtocolVersion: 5,
+	}
+
+	if err := invalidConfig.Validate(); err == nil {
+		t.Error("Expected error for protocol version 5, got nil")
+	}
+
+	// Test max in-flight messages beyond the packet identifiers
+	invalidConfig = &BrokerConfig{
+		Name:        "test",
+		Host:        "localhost",
+		Port:        1883,
+		ClientID:    "test-client",
+		MaxInflight: MaxInflightLimit + 1,
+	}
+
+	if err := invalidConfig.Validate(); err == nil {
+		t.Error("Expected error for max in-flight messages above the limit, got nil")
+	}
+
+	// Test writable store directory
+	storeConfig := &BrokerConfig{
+		Name:     "test",
+		Host:     "localhost",
+		Port:     1883,
+		ClientID: "test-client",
+		StoreDir: filepath.Join(t.TempDir(), "store"),
+	}
+
+	if err := storeConfig.Validate(); err != nil {
+		t.Errorf("Expected no error for writable store directory, got %v", err)
+	}
+
+	// Test store directory that is a file
+	storeFile := filepath.Join(t.TempDir(), "store")
+	if err := os.WriteFile(storeFile, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	storeConfig.StoreDir = storeFile
+
+	if err := storeConfig.Validate(); err == nil {
+		t.Error("Expected error for store directory that is a file, got nil")
+	}
+}
+
+func TestResolveClientID(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("Failed to get hostname: %v", err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	t.Setenv("POD_NAME", "pod-1")
+	
+	tests := []struct {
+		clientID string
+		want     string
+	}{
+		{"", "mqtt-microservice-hivemq-" + hostname + "-" + pid},
+		{"laravel-${HOSTNAME}", "laravel-" + hostname},
+		{"${BROKER}-${POD_NAME}", "hivemq-pod-1"},
+		{"laravel-backend", "laravel-backend"},
+		{"price$tracker", "price$tracker"},
+	}
+	for _, test := range tests {
+		if got := resolveClientID(test.clientID, "hivemq"); got != test.want {
+			t.Errorf("Expected client ID '%s' to resolve to '%s', got '%s'", test.clientID, test.want, got)
+		}
+	}
 }
 
 // Helper function to split environment variable string
@@ -167,4 +311,141 @@ func splitEnv(env string) (key, value string, found bool) {
 		}
 	}
 	return env, "", false
-}
\ No newline at end of file
+}
+
+func TestLoadConfigRequestDefaults(t *testing.T) {
+	t.Setenv("MQTT_DEFAULT_CONNECTION", "test")
+	t.Setenv("MQTT_TEST_HOST", "localhost")
+	t.Setenv("MQTT_TEST_PORT", "1883")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.DefaultPublishQoS != 0 || cfg.DefaultSubscribeQoS != 0 || cfg.DefaultRetained {
+		t.Errorf("Expected QoS 0 and not retained by default, got %d, %d, and %v", cfg.DefaultPublishQoS, cfg.DefaultSubscribeQoS, cfg.DefaultRetained)
+	}
+
+	t.Setenv("DEFAULT_PUBLISH_QOS", "1")
+	t.Setenv("DEFAULT_SUBSCRIBE_QOS", "2")
+	t.Setenv("DEFAULT_RETAINED", "true")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.DefaultPublishQoS != 1 || cfg.DefaultSubscribeQoS != 2 || !cfg.DefaultRetained {
+		t.Errorf("Expected QoS 1, QoS 2, and retained, got %d, %d, and %v", cfg.DefaultPublishQoS, cfg.DefaultSubscribeQoS, cfg.DefaultRetained)
+	}
+
+	for key, value := range map[string]string{"DEFAULT_PUBLISH_QOS": "3", "DEFAULT_SUBSCRIBE_QOS": "high", "DEFAULT_RETAINED": "maybe"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("Expected %s=%s to be rejected, got %v", key, value, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMetricsLatencyBuckets(t *testing.T) {
+	t.Setenv("MQTT_DEFAULT_CONNECTION", "test")
+	t.Setenv("MQTT_TEST_HOST", "localhost")
+	t.Setenv("MQTT_TEST_PORT", "1883")
+	t.Setenv("METRICS_LATENCY_BUCKETS", "0.5, 10,250")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []time.Duration{500 * time.Microsecond, 10 * time.Millisecond, 250 * time.Millisecond}
+	if !reflect.DeepEqual(cfg.MetricsLatencyBuckets, expected) {
+		t.Errorf("Expected buckets %v, got %v", expected, cfg.MetricsLatencyBuckets)
+	}
+
+	for _, buckets := range []string{"10,fast", "0,10", "10,10", "250,10"} {
+		t.Setenv("METRICS_LATENCY_BUCKETS", buckets)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "METRICS_LATENCY_BUCKETS") {
+			t.Errorf("Expected buckets %q to be rejected, got %v", buckets, err)
+		}
+	}
+}
+
+func TestLoadConfigSQLitePragmas(t *testing.T) {
+	t.Setenv("MQTT_DEFAULT_CONNECTION", "test")
+	t.Setenv("MQTT_TEST_HOST", "localhost")
+	t.Setenv("MQTT_TEST_PORT", "1883")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	sqlite := cfg.Database.SQLite
+	if sqlite.BusyTimeout != DefaultSQLiteBusyTimeout || sqlite.JournalMode != "wal" || sqlite.Synchronous != "normal" {
+		t.Errorf("Expected the default busy timeout, WAL, and normal synchronous, got %+v", sqlite)
+	}
+
+	t.Setenv("DB_SQLITE_BUSY_TIMEOUT", "250")
+	t.Setenv("DB_SQLITE_JOURNAL_MODE", "DELETE")
+	t.Setenv("DB_SQLITE_SYNCHRONOUS", "full")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	sqlite = cfg.Database.SQLite
+	if sqlite.BusyTimeout != 250 || sqlite.JournalMode != "delete" || sqlite.Synchronous != "full" {
+		t.Errorf("Expected a 250ms busy timeout, delete journal mode, and full synchronous, got %+v", sqlite)
+	}
+
+	for key, value := range map[string]string{"DB_SQLITE_BUSY_TIMEOUT": "0", "DB_SQLITE_JOURNAL_MODE": "wal2", "DB_SQLITE_SYNCHRONOUS": "sometimes"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("Expected %s=%s to be rejected, got %v", key, value, err)
+			}
+		})
+	}
+}
+
+func TestSummaryOmitsSecrets(t *testing.T) {
+	cfg := &Config{
+		DefaultConnection: "hivemq",
+		Brokers: map[string]*BrokerConfig{
+			"mosquitto": {Name: "mosquitto", Password: "broker-password"},
+			"hivemq":    {Name: "hivemq", Password: "broker-password", TLSEnabled: true},
+		},
+		EnableAPIKey: true,
+		APIKeys:      []string{"secret-key:admin"},
+		EnableJWT:    true,
+		JWTSecret:    "jwt-secret",
+		Database:     &DatabaseConfig{Type: "sqlite"},
+		Webhook:      &WebhookConfig{Enabled: true, Secret: "webhook-secret"},
+	}
+
+	summary := cfg.Summary()
+
+	expected := map[string]interface{}{
+		"default_connection": "hivemq",
+		"broker_count":       2,
+		"brokers":            "hivemq,mosquitto",
+		"tls_enabled":        true,
+		"auth_mode":          "api_key+jwt",
+		"api_key_count":      1,
+		"db_type":            "sqlite",
+		"webhook_enabled":    true,
+		"webhook_signed":     true,
+	}
+	for key, value := range expected {
+		if summary[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, summary[key])
+		}
+	}
+
+	for key, value := range summary {
+		text := fmt.Sprint(value)
+		for _, secret := range []string{"broker-password", "secret-key", "jwt-secret", "webhook-secret"} {
+			if strings.Contains(text, secret) {
+				t.Errorf("Expected %s not to reveal %s, got %v", key, secret, value)
+			}
+		}
+	}
+}
@@ -2,9 +2,11 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
 )
 
 // Message represents a message stored in the database
@@ -16,6 +18,61 @@ type Message struct {
 	Retained  bool        `json:"retained" bson:"retained"`
 	Timestamp time.Time   `json:"timestamp" bson:"timestamp"`
 	Confirmed bool        `json:"confirmed" bson:"confirmed"`
+	// Status is the delivery status of the message (pending, delivered, or failed)
+	Status string `json:"status" bson:"status"`
+	// ContentType records whether the payload is text, json, or binary
+	ContentType string `json:"content_type" bson:"content_type"`
+	// OriginalTopic is the topic the message was published to before a topic rewrite rule changed it to Topic
+	OriginalTopic string `json:"original_topic,omitempty" bson:"original_topic,omitempty"`
+	// Hash identifies the duplicates of the message when deduplication is enabled, see setMessageHash
+	Hash string `json:"-" bson:"hash,omitempty"`
+}
+
+// Message delivery statuses
+const (
+	// MessageStatusPending means the message is being published and the broker hasn't acknowledged it yet
+	MessageStatusPending = "pending"
+	// MessageStatusDelivered means the broker acknowledged the message (PUBACK for QoS 1, PUBCOMP for QoS 2)
+	MessageStatusDelivered = "delivered"
+	// MessageStatusFailed means publishing the message failed
+	MessageStatusFailed = "failed"
+)
+
+// MessageFilter selects the messages to export; its zero value selects every message
+type MessageFilter struct {
+	// Confirmed selects only confirmed or only unconfirmed messages; nil selects both
+	Confirmed *bool
+	// Since selects messages with a timestamp at or after it, unless it is zero
+	Since time.Time
+	// Topic is an MQTT topic filter, which may contain wildcards, that the topics of the messages must match
+	Topic string
+}
+
+// Matches reports whether a message is selected by the filter
+func (f MessageFilter) Matches(msg *Message) bool {
+	if f.Confirmed != nil && msg.Confirmed != *f.Confirmed {
+		return false
+	}
+	if !f.Since.IsZero() && msg.Timestamp.Before(f.Since) {
+		return false
+	}
+	return f.Topic == "" || utils.TopicMatchesFilter(msg.Topic, f.Topic)
+}
+
+// exportChunkSize is the number of messages read at a time when exporting messages
+const exportChunkSize = 500
+
+// IdempotencyRecord is the stored outcome of a request made with an idempotency key
+type IdempotencyRecord struct {
+	// Key is the idempotency key, scoped to the caller that made the request
+	Key string `bson:"_id"`
+	// RequestHash identifies the request the key was first used with
+	RequestHash string `bson:"request_hash"`
+	// StatusCode and Response are the HTTP status and body returned for the request
+	StatusCode int       `bson:"status_code"`
+	Response   string    `bson:"response"`
+	CreatedAt  time.Time `bson:"created_at"`
+	ExpiresAt  time.Time `bson:"expires_at"`
 }
 
 // Database is the interface that must be implemented by database providers
@@ -26,11 +83,33 @@ type Database interface {
 	// Close closes the database connection
 	Close(ctx context.Context) error
 
-	// StoreMessage stores a message in the database
+	// StoreMessage stores a message in the database. With deduplication, it returns ErrDuplicateMessage instead
+	// of storing a message identical to one already stored within the same window.
 	StoreMessage(ctx context.Context, msg *Message) error
 
-	// GetMessages retrieves messages from the database
-	GetMessages(ctx context.Context, confirmed bool, limit int) ([]*Message, error)
+	// StoreMessages stores several messages in one round-trip. SQLite stores all of them or none in a single
+	// transaction; MongoDB stores as many as it can and returns a *BatchError naming the messages that failed.
+	// With deduplication, duplicates are skipped and named in a *BatchError with ErrDuplicateMessage.
+	StoreMessages(ctx context.Context, msgs []*Message) error
+
+	// ImportMessages stores messages that already have IDs, such as those of an export. Messages whose ID is already
+	// stored are replaced if replace is true and skipped otherwise; it returns the number of skipped messages. SQLite
+	// imports all of them or none; the other providers import as many as they can and return a *BatchError naming the
+	// messages that failed.
+	ImportMessages(ctx context.Context, msgs []*Message, replace bool) (int, error)
+
+	// GetMessages retrieves messages from the database, optionally filtered by delivery status
+	GetMessages(ctx context.Context, confirmed bool, status string, limit int) ([]*Message, error)
+
+	// GetMessagesByTopicPrefix retrieves messages whose topic starts with the given prefix
+	GetMessagesByTopicPrefix(ctx context.Context, prefix string, confirmed bool, status string, limit int) ([]*Message, error)
+
+	// GetMessagesByTopicFilter retrieves messages whose topic matches an MQTT topic filter, which may contain wildcards
+	GetMessagesByTopicFilter(ctx context.Context, filter string, limit int) ([]*Message, error)
+
+	// ExportMessages calls fn with every message matching the filter, oldest first, reading them in chunks instead of
+	// all at once. It stops and returns the error if fn returns one.
+	ExportMessages(ctx context.Context, filter MessageFilter, fn func(*Message) error) error
 
 	// GetMessageByID retrieves a message by its ID
 	GetMessageByID(ctx context.Context, id string) (*Message, error)
@@ -38,6 +117,9 @@ type Database interface {
 	// ConfirmMessage marks a message as confirmed
 	ConfirmMessage(ctx context.Context, id string) error
 
+	// UpdateMessageStatus sets the delivery status of a message
+	UpdateMessageStatus(ctx context.Context, id string, status string) error
+
 	// DeleteMessage deletes a message from the database
 	DeleteMessage(ctx context.Context, id string) error
 
@@ -51,6 +133,38 @@ type Database interface {
 	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
 	DeleteWebhook(ctx context.Context, id string) error
 	GetWebhooksByTopicFilter(ctx context.Context, topic string) ([]*models.Webhook, error)
+	GetEnabledWebhooks(ctx context.Context) ([]*models.Webhook, error)
+
+	// Webhook delivery operations
+	StoreWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetWebhookDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*models.WebhookDelivery, error)
+	GetDueWebhookDeliveries(ctx context.Context, before time.Time, limit int) ([]*models.WebhookDelivery, error)
+	// DeleteWebhookDeliveriesBefore deletes delivered and failed deliveries last updated before the given time;
+	// pending deliveries are kept
+	DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error)
+
+	// Scheduled message operations
+	StoreScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error
+	UpdateScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error
+	GetScheduledMessageByID(ctx context.Context, id string) (*models.ScheduledMessage, error)
+	GetScheduledMessages(ctx context.Context, limit int) ([]*models.ScheduledMessage, error)
+	GetDueScheduledMessages(ctx context.Context, before time.Time, limit int) ([]*models.ScheduledMessage, error)
+	DeleteScheduledMessage(ctx context.Context, id string) error
+
+	// Idempotency key operations
+	// StoreIdempotencyRecord replaces any existing record with the same key
+	StoreIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error
+	// GetIdempotencyRecord returns ErrIdempotencyRecordNotFound if the key is unknown or expired
+	GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error)
+
+	// Subscription operations
+	// StoreSubscription replaces any existing subscription to the same topic on the same broker
+	StoreSubscription(ctx context.Context, subscription *models.Subscription) error
+	GetSubscriptions(ctx context.Context) ([]*models.Subscription, error)
+	// DeleteSubscription doesn't return an error if the subscription isn't stored
+	DeleteSubscription(ctx context.Context, broker, topic string) error
 
 	// Ping checks if the database is reachable
 	Ping(ctx context.Context) error
@@ -58,7 +172,7 @@ type Database interface {
 
 // Config holds the configuration for the database
 type Config struct {
-	// Type is the type of database to use (sqlite or mongodb)
+	// Type is the type of database to use (sqlite, mongodb, or memory)
 	Type string
 
 	// Connection is the connection string for the database
@@ -73,9 +187,20 @@ type Config struct {
 		Port     int
 	}
 
+	// Dedup skips storing messages identical to one stored within the same window of DedupWindow;
+	// a DedupWindow of 0 uses DefaultDedupWindow
+	Dedup       bool
+	DedupWindow time.Duration
+
 	// SQLite specific settings
 	SQLite struct {
 		Path string
+		// BusyTimeout is how long a connection waits for a lock held by another before failing; 0 uses the default
+		BusyTimeout time.Duration
+		// JournalMode is the journal_mode pragma; empty uses the default
+		JournalMode string
+		// Synchronous is the synchronous pragma; empty uses the default
+		Synchronous string
 	}
 }
 
@@ -102,9 +227,13 @@ func New(config *Config) (Database, error) {
 
 // Errors
 var (
-	ErrUnsupportedDatabaseType = NewError("unsupported database type")
-	ErrConnectionFailed        = NewError("failed to connect to database")
-	ErrMessageNotFound         = NewError("message not found")
+	ErrUnsupportedDatabaseType   = NewError("unsupported database type")
+	ErrConnectionFailed          = NewError("failed to connect to database")
+	ErrMessageNotFound           = NewError("message not found")
+	ErrDeliveryNotFound          = NewError("webhook delivery not found")
+	ErrIdempotencyRecordNotFound = NewError("idempotency record not found")
+	ErrScheduledMessageNotFound  = NewError("scheduled message not found")
+	ErrDuplicateMessage          = NewError("duplicate message")
 )
 
 // Error represents a database error
@@ -123,3 +252,14 @@ func NewError(message string) *Error {
 		Message: message,
 	}
 }
+
+// BatchError reports the messages of a batch that failed to store while the others were stored
+type BatchError struct {
+	// Failed maps the index of each message that wasn't stored to its error
+	Failed map[int]error
+}
+
+// Error returns the error message
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to store %d messages of the batch", len(e.Failed))
+}
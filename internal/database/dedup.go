@@ -0,0 +1,43 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// DefaultDedupWindow is the deduplication window used when none is configured
+const DefaultDedupWindow = time.Minute
+
+// setMessageHash sets the hash of a message when deduplication is enabled, filling in its timestamp if unset.
+// The hash covers the topic, QoS, and payload of the message and the window its timestamp falls in, so the
+// unique indexes on it reject identical messages stored within the same window. Windows are fixed intervals
+// of the configured length, which means identical messages on either side of a window boundary are both stored.
+func setMessageHash(config *Config, msg *Message) error {
+	if config == nil || !config.Dedup {
+		return nil
+	}
+
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	window := config.DedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	payload, _, err := EncodePayload(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	// Topics can't contain a null character, so it separates the topic from the rest
+	hash := sha256.New()
+	hash.Write([]byte(msg.Topic))
+	hash.Write([]byte{0, msg.QoS})
+	binary.Write(hash, binary.BigEndian, msg.Timestamp.UnixNano()/int64(window))
+	hash.Write(payload)
+	msg.Hash = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
@@ -0,0 +1,912 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/models"
+	"MQTTmicroService/internal/utils"
+)
+
+// MemoryDatabase implements the Database interface with in-memory maps, for tests and ephemeral deployments.
+// Everything it stores is lost when it is closed or the process exits.
+type MemoryDatabase struct {
+	config      *Config
+	mu          sync.RWMutex
+	connected   bool
+	lastID      int64
+	messages    map[string]*Message
+	webhooks    map[string]*models.Webhook
+	deliveries  map[string]*models.WebhookDelivery
+	scheduled   map[string]*models.ScheduledMessage
+	idempotency map[string]*IdempotencyRecord
+	// hashes maps the hash of each stored message that has one to its ID
+	hashes map[string]string
+	// subscriptions are keyed by broker and topic
+	subscriptions map[subscriptionKey]*models.Subscription
+}
+
+// subscriptionKey identifies a stored subscription
+type subscriptionKey struct {
+	broker string
+	topic  string
+}
+
+// NewMemoryDatabase creates a new in-memory database instance
+func NewMemoryDatabase(config *Config) (Database, error) {
+	return &MemoryDatabase{config: config}, nil
+}
+
+// init registers the in-memory database provider
+func init() {
+	Register("memory", NewMemoryDatabase)
+}
+
+// Connect initializes the in-memory store
+func (m *MemoryDatabase) Connect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		m.messages = make(map[string]*Message)
+		m.hashes = make(map[string]string)
+		m.webhooks = make(map[string]*models.Webhook)
+		m.deliveries = make(map[string]*models.WebhookDelivery)
+		m.scheduled = make(map[string]*models.ScheduledMessage)
+		m.idempotency = make(map[string]*IdempotencyRecord)
+		m.subscriptions = make(map[subscriptionKey]*models.Subscription)
+		m.connected = true
+	}
+	return nil
+}
+
+// Close discards everything stored in memory
+func (m *MemoryDatabase) Close(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connected = false
+	m.messages = nil
+	m.hashes = nil
+	m.webhooks = nil
+	m.deliveries = nil
+	m.scheduled = nil
+	m.idempotency = nil
+	return nil
+}
+
+// Ping checks if the database is connected
+func (m *MemoryDatabase) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+	return nil
+}
+
+// newID generates a unique ID in the same format as the SQLite provider; the caller must hold the write lock
+func (m *MemoryDatabase) newID() string {
+	id := time.Now().UnixNano()
+	if id <= m.lastID {
+		id = m.lastID + 1
+	}
+	m.lastID = id
+	return fmt.Sprintf("%d", id)
+}
+
+// StoreMessage stores a message in memory
+func (m *MemoryDatabase) StoreMessage(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	return m.storeMessage(msg)
+}
+
+// StoreMessages stores several messages in memory, removing the ones already stored if any of them fails
+// like the SQLite provider's transaction would. Duplicates are skipped and reported in a *BatchError.
+func (m *MemoryDatabase) StoreMessages(ctx context.Context, msgs []*Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	duplicates := make(map[int]error)
+	for i, msg := range msgs {
+		err := m.storeMessage(msg)
+		if err == ErrDuplicateMessage {
+			duplicates[i] = err
+			continue
+		}
+		if err != nil {
+			for j, stored := range msgs[:i] {
+				if duplicates[j] == nil {
+					m.deleteMessage(stored.ID)
+				}
+			}
+			return fmt.Errorf("failed to store message %d of the batch: %w", i, err)
+		}
+	}
+
+	if len(duplicates) > 0 {
+		return &BatchError{Failed: duplicates}
+	}
+	return nil
+}
+
+// ImportMessages stores messages that already have IDs, replacing those already stored if replace is true and
+// skipping them otherwise. Messages that fail don't stop the others from being stored; they are reported by index
+// in a *BatchError.
+func (m *MemoryDatabase) ImportMessages(ctx context.Context, msgs []*Message, replace bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return 0, ErrConnectionFailed
+	}
+
+	skipped := 0
+	failed := make(map[int]error)
+	for i, msg := range msgs {
+		existing, exists := m.messages[msg.ID]
+		if exists && !replace {
+			skipped++
+			continue
+		}
+
+		m.deleteMessage(msg.ID)
+		if err := m.storeMessage(msg); err != nil {
+			if exists {
+				m.messages[msg.ID] = existing
+				if existing.Hash != "" {
+					m.hashes[existing.Hash] = existing.ID
+				}
+			}
+			failed[i] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return skipped, &BatchError{Failed: failed}
+	}
+	return skipped, nil
+}
+
+// storeMessage stores a message; the caller must hold the write lock
+func (m *MemoryDatabase) storeMessage(msg *Message) error {
+	// Generate an ID if one is not provided
+	if msg.ID == "" {
+		msg.ID = m.newID()
+	}
+	if _, exists := m.messages[msg.ID]; exists {
+		return fmt.Errorf("failed to insert message: message %s already exists", msg.ID)
+	}
+	if err := setMessageHash(m.config, msg); err != nil {
+		return err
+	}
+	if _, exists := m.hashes[msg.Hash]; msg.Hash != "" && exists {
+		return ErrDuplicateMessage
+	}
+
+	// Set the timestamp if not already set
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	// Messages stored without a status were already delivered
+	if msg.Status == "" {
+		msg.Status = MessageStatusDelivered
+	}
+
+	// Keep the payload bytes, like the SQLite provider, so reads return the same values
+	payload, contentType, err := EncodePayload(msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.ContentType = contentType
+
+	// Copy the bytes, since a []byte payload shares the caller's slice
+	stored := *msg
+	stored.Payload = append([]byte(nil), payload...)
+	m.messages[msg.ID] = &stored
+	if msg.Hash != "" {
+		m.hashes[msg.Hash] = msg.ID
+	}
+
+	return nil
+}
+
+// copyMessage returns a copy of a stored message with its payload decoded
+func copyMessage(stored *Message) *Message {
+	msg := *stored
+	payload := append([]byte(nil), stored.Payload.([]byte)...)
+	msg.Payload, msg.ContentType = DecodePayload(payload, stored.ContentType)
+	return &msg
+}
+
+// findMessages returns the stored messages matching a predicate, newest first
+func (m *MemoryDatabase) findMessages(match func(msg *Message) bool, limit int) ([]*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var messages []*Message
+	for _, msg := range m.messages {
+		if match(msg) {
+			messages = append(messages, msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Timestamp.After(messages[j].Timestamp) })
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	for i, msg := range messages {
+		messages[i] = copyMessage(msg)
+	}
+
+	return messages, nil
+}
+
+// GetMessages retrieves messages from memory
+func (m *MemoryDatabase) GetMessages(ctx context.Context, confirmed bool, status string, limit int) ([]*Message, error) {
+	return m.findMessages(func(msg *Message) bool {
+		return msg.Confirmed == confirmed && (status == "" || msg.Status == status)
+	}, limit)
+}
+
+// GetMessagesByTopicPrefix retrieves messages whose topic starts with the given prefix
+func (m *MemoryDatabase) GetMessagesByTopicPrefix(ctx context.Context, prefix string, confirmed bool, status string, limit int) ([]*Message, error) {
+	return m.findMessages(func(msg *Message) bool {
+		return msg.Confirmed == confirmed && strings.HasPrefix(msg.Topic, prefix) && (status == "" || msg.Status == status)
+	}, limit)
+}
+
+// GetMessagesByTopicFilter retrieves messages whose topic matches an MQTT topic filter, which may contain wildcards
+func (m *MemoryDatabase) GetMessagesByTopicFilter(ctx context.Context, filter string, limit int) ([]*Message, error) {
+	return m.findMessages(func(msg *Message) bool {
+		return utils.TopicMatchesFilter(msg.Topic, filter)
+	}, limit)
+}
+
+// ExportMessages calls fn with every message matching the filter, oldest first
+func (m *MemoryDatabase) ExportMessages(ctx context.Context, filter MessageFilter, fn func(*Message) error) error {
+	m.mu.RLock()
+	if !m.connected {
+		m.mu.RUnlock()
+		return ErrConnectionFailed
+	}
+	var messages []*Message
+	for _, msg := range m.messages {
+		if filter.Matches(msg) {
+			messages = append(messages, copyMessage(msg))
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Timestamp.Before(messages[j].Timestamp) })
+	for _, msg := range messages {
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMessageByID retrieves a message by its ID
+func (m *MemoryDatabase) GetMessageByID(ctx context.Context, id string) (*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	msg, exists := m.messages[id]
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+	return copyMessage(msg), nil
+}
+
+// updateMessage applies an update to a stored message
+func (m *MemoryDatabase) updateMessage(id string, update func(msg *Message)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	msg, exists := m.messages[id]
+	if !exists {
+		return ErrMessageNotFound
+	}
+	update(msg)
+	return nil
+}
+
+// ConfirmMessage marks a message as confirmed
+func (m *MemoryDatabase) ConfirmMessage(ctx context.Context, id string) error {
+	return m.updateMessage(id, func(msg *Message) { msg.Confirmed = true })
+}
+
+// UpdateMessageStatus sets the delivery status of a message
+func (m *MemoryDatabase) UpdateMessageStatus(ctx context.Context, id string, status string) error {
+	return m.updateMessage(id, func(msg *Message) { msg.Status = status })
+}
+
+// DeleteMessage deletes a message from memory
+func (m *MemoryDatabase) DeleteMessage(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	if _, exists := m.messages[id]; !exists {
+		return ErrMessageNotFound
+	}
+	m.deleteMessage(id)
+	return nil
+}
+
+// deleteMessage deletes a stored message and its hash; the caller must hold the write lock
+func (m *MemoryDatabase) deleteMessage(id string) {
+	if msg, exists := m.messages[id]; exists && msg.Hash != "" {
+		delete(m.hashes, msg.Hash)
+	}
+	delete(m.messages, id)
+}
+
+// DeleteConfirmedMessages deletes all confirmed messages
+func (m *MemoryDatabase) DeleteConfirmedMessages(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return 0, ErrConnectionFailed
+	}
+
+	deleted := 0
+	for id, msg := range m.messages {
+		if msg.Confirmed {
+			m.deleteMessage(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// copyWebhook returns a copy of a webhook that doesn't share its headers or payload condition
+func copyWebhook(webhook *models.Webhook) *models.Webhook {
+	copied := *webhook
+	copied.Headers = make(map[string]string, len(webhook.Headers))
+	for name, value := range webhook.Headers {
+		copied.Headers[name] = value
+	}
+	if webhook.Condition != nil {
+		condition := *webhook.Condition
+		copied.Condition = &condition
+	}
+	return &copied
+}
+
+// StoreWebhook stores a webhook in memory
+func (m *MemoryDatabase) StoreWebhook(ctx context.Context, webhook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if webhook.ID == "" {
+		webhook.ID = m.newID()
+	}
+	if _, exists := m.webhooks[webhook.ID]; exists {
+		return fmt.Errorf("failed to insert webhook: webhook %s already exists", webhook.ID)
+	}
+
+	// Set timestamps if not already set
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = time.Now()
+	}
+	if webhook.UpdatedAt.IsZero() {
+		webhook.UpdatedAt = time.Now()
+	}
+
+	m.webhooks[webhook.ID] = copyWebhook(webhook)
+	return nil
+}
+
+// findWebhooks returns copies of the stored webhooks matching a predicate, newest first
+func (m *MemoryDatabase) findWebhooks(match func(webhook *models.Webhook) bool) ([]*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	var webhooks []*models.Webhook
+	for _, webhook := range m.webhooks {
+		if match(webhook) {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt.After(webhooks[j].CreatedAt) })
+
+	return webhooks, nil
+}
+
+// GetWebhooks retrieves webhooks from memory
+func (m *MemoryDatabase) GetWebhooks(ctx context.Context, limit int) ([]*models.Webhook, error) {
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	webhooks, err := m.findWebhooks(func(*models.Webhook) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) > limit {
+		webhooks = webhooks[:limit]
+	}
+	return webhooks, nil
+}
+
+// GetWebhookByID retrieves a webhook by its ID
+func (m *MemoryDatabase) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	webhook, exists := m.webhooks[id]
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+	return copyWebhook(webhook), nil
+}
+
+// UpdateWebhook updates a webhook in memory
+func (m *MemoryDatabase) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	stored, exists := m.webhooks[webhook.ID]
+	if !exists {
+		return ErrMessageNotFound
+	}
+
+	// Update the timestamp, keeping the creation time and owning namespace
+	webhook.UpdatedAt = time.Now()
+	updated := copyWebhook(webhook)
+	updated.CreatedAt = stored.CreatedAt
+	updated.Namespace = stored.Namespace
+	m.webhooks[webhook.ID] = updated
+
+	return nil
+}
+
+// DeleteWebhook deletes a webhook from memory
+func (m *MemoryDatabase) DeleteWebhook(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	if _, exists := m.webhooks[id]; !exists {
+		return ErrMessageNotFound
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+// GetWebhooksByTopicFilter retrieves enabled webhooks that match a topic
+func (m *MemoryDatabase) GetWebhooksByTopicFilter(ctx context.Context, topic string) ([]*models.Webhook, error) {
+	return m.findWebhooks(func(webhook *models.Webhook) bool {
+		return webhook.Enabled && utils.TopicMatchesFilter(topic, webhook.TopicFilter)
+	})
+}
+
+// GetEnabledWebhooks retrieves all enabled webhooks from memory, newest first
+func (m *MemoryDatabase) GetEnabledWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	return m.findWebhooks(func(webhook *models.Webhook) bool { return webhook.Enabled })
+}
+
+// StoreWebhookDelivery stores a webhook delivery record in memory
+func (m *MemoryDatabase) StoreWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if delivery.ID == "" {
+		delivery.ID = m.newID()
+	}
+	if _, exists := m.deliveries[delivery.ID]; exists {
+		return fmt.Errorf("failed to insert webhook delivery: delivery %s already exists", delivery.ID)
+	}
+
+	// Set timestamps if not already set
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	if delivery.UpdatedAt.IsZero() {
+		delivery.UpdatedAt = delivery.CreatedAt
+	}
+
+	stored := *delivery
+	m.deliveries[delivery.ID] = &stored
+	return nil
+}
+
+// UpdateWebhookDelivery updates the status of a webhook delivery record
+func (m *MemoryDatabase) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	stored, exists := m.deliveries[delivery.ID]
+	if !exists {
+		return ErrDeliveryNotFound
+	}
+
+	// Update the timestamp
+	delivery.UpdatedAt = time.Now()
+
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.LastError = delivery.LastError
+	stored.NextRetryAt = delivery.NextRetryAt
+	stored.UpdatedAt = delivery.UpdatedAt
+	return nil
+}
+
+// GetWebhookDeliveryByID retrieves a webhook delivery record by its ID
+func (m *MemoryDatabase) GetWebhookDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	delivery, exists := m.deliveries[id]
+	if !exists {
+		return nil, ErrDeliveryNotFound
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+// findDeliveries returns copies of the stored deliveries matching a predicate, sorted with less
+func (m *MemoryDatabase) findDeliveries(match func(delivery *models.WebhookDelivery) bool, less func(a, b *models.WebhookDelivery) bool, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var deliveries []*models.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if match(delivery) {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return less(deliveries[i], deliveries[j]) })
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDeliveries retrieves the most recent delivery records of a webhook
+func (m *MemoryDatabase) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	return m.findDeliveries(
+		func(delivery *models.WebhookDelivery) bool { return delivery.WebhookID == webhookID },
+		func(a, b *models.WebhookDelivery) bool { return a.CreatedAt.After(b.CreatedAt) },
+		limit)
+}
+
+// GetDueWebhookDeliveries retrieves pending deliveries whose next retry is due at or before the given time
+func (m *MemoryDatabase) GetDueWebhookDeliveries(ctx context.Context, before time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	return m.findDeliveries(
+		func(delivery *models.WebhookDelivery) bool {
+			return delivery.Status == models.DeliveryStatusPending && !delivery.NextRetryAt.After(before)
+		},
+		func(a, b *models.WebhookDelivery) bool { return a.NextRetryAt.Before(b.NextRetryAt) },
+		limit)
+}
+
+// DeleteWebhookDeliveriesBefore deletes delivered and failed deliveries last updated before the given time
+func (m *MemoryDatabase) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return 0, ErrConnectionFailed
+	}
+
+	count := 0
+	for id, delivery := range m.deliveries {
+		if delivery.Status != models.DeliveryStatusPending && delivery.UpdatedAt.Before(before) {
+			delete(m.deliveries, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// copyScheduledMessage returns a copy of a scheduled message that doesn't share its payload
+func copyScheduledMessage(msg *models.ScheduledMessage) *models.ScheduledMessage {
+	copied := *msg
+	copied.Payload = append(json.RawMessage(nil), msg.Payload...)
+	return &copied
+}
+
+// StoreScheduledMessage stores a message to be published later
+func (m *MemoryDatabase) StoreScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if msg.ID == "" {
+		msg.ID = m.newID()
+	}
+	if _, exists := m.scheduled[msg.ID]; exists {
+		return fmt.Errorf("failed to insert scheduled message: scheduled message %s already exists", msg.ID)
+	}
+
+	// Set timestamps if not already set
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	if msg.UpdatedAt.IsZero() {
+		msg.UpdatedAt = msg.CreatedAt
+	}
+
+	m.scheduled[msg.ID] = copyScheduledMessage(msg)
+	return nil
+}
+
+// UpdateScheduledMessage updates the status of a scheduled message
+func (m *MemoryDatabase) UpdateScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	stored, exists := m.scheduled[msg.ID]
+	if !exists {
+		return ErrScheduledMessageNotFound
+	}
+
+	// Update the timestamp
+	msg.UpdatedAt = time.Now()
+
+	stored.Status = msg.Status
+	stored.LastError = msg.LastError
+	stored.UpdatedAt = msg.UpdatedAt
+	return nil
+}
+
+// GetScheduledMessageByID retrieves a scheduled message by its ID
+func (m *MemoryDatabase) GetScheduledMessageByID(ctx context.Context, id string) (*models.ScheduledMessage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	msg, exists := m.scheduled[id]
+	if !exists {
+		return nil, ErrScheduledMessageNotFound
+	}
+	return copyScheduledMessage(msg), nil
+}
+
+// findScheduledMessages returns copies of the scheduled messages matching a predicate, soonest first
+func (m *MemoryDatabase) findScheduledMessages(match func(msg *models.ScheduledMessage) bool, limit int) ([]*models.ScheduledMessage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var messages []*models.ScheduledMessage
+	for _, msg := range m.scheduled {
+		if match(msg) {
+			messages = append(messages, copyScheduledMessage(msg))
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].PublishAt.Before(messages[j].PublishAt) })
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// GetScheduledMessages retrieves scheduled messages, soonest first
+func (m *MemoryDatabase) GetScheduledMessages(ctx context.Context, limit int) ([]*models.ScheduledMessage, error) {
+	return m.findScheduledMessages(func(*models.ScheduledMessage) bool { return true }, limit)
+}
+
+// GetDueScheduledMessages retrieves pending scheduled messages whose publish time is at or before the given time
+func (m *MemoryDatabase) GetDueScheduledMessages(ctx context.Context, before time.Time, limit int) ([]*models.ScheduledMessage, error) {
+	return m.findScheduledMessages(func(msg *models.ScheduledMessage) bool {
+		return msg.Status == models.ScheduledStatusPending && !msg.PublishAt.After(before)
+	}, limit)
+}
+
+// DeleteScheduledMessage deletes a scheduled message
+func (m *MemoryDatabase) DeleteScheduledMessage(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	if _, exists := m.scheduled[id]; !exists {
+		return ErrScheduledMessageNotFound
+	}
+	delete(m.scheduled, id)
+	return nil
+}
+
+// StoreIdempotencyRecord stores the outcome of a request made with an idempotency key, purging expired keys
+func (m *MemoryDatabase) StoreIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	// Set the timestamp if not already set
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	// Purge expired keys
+	now := time.Now()
+	for key, stored := range m.idempotency {
+		if !stored.ExpiresAt.After(now) {
+			delete(m.idempotency, key)
+		}
+	}
+
+	stored := *record
+	m.idempotency[record.Key] = &stored
+	return nil
+}
+
+// GetIdempotencyRecord retrieves the unexpired record of an idempotency key
+func (m *MemoryDatabase) GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	record, exists := m.idempotency[key]
+	if !exists || !record.ExpiresAt.After(time.Now()) {
+		return nil, ErrIdempotencyRecordNotFound
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// StoreSubscription stores a subscription in memory, replacing any existing one to the same topic on the same broker
+func (m *MemoryDatabase) StoreSubscription(ctx context.Context, subscription *models.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	// Set the timestamp if not already set
+	if subscription.CreatedAt.IsZero() {
+		subscription.CreatedAt = time.Now()
+	}
+
+	stored := *subscription
+	m.subscriptions[subscriptionKey{broker: subscription.Broker, topic: subscription.Topic}] = &stored
+	return nil
+}
+
+// GetSubscriptions retrieves all subscriptions from memory, oldest first
+func (m *MemoryDatabase) GetSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.connected {
+		return nil, ErrConnectionFailed
+	}
+
+	subscriptions := make([]*models.Subscription, 0, len(m.subscriptions))
+	for _, subscription := range m.subscriptions {
+		copied := *subscription
+		subscriptions = append(subscriptions, &copied)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt) })
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription deletes a subscription from memory
+func (m *MemoryDatabase) DeleteSubscription(ctx context.Context, broker, topic string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		return ErrConnectionFailed
+	}
+
+	delete(m.subscriptions, subscriptionKey{broker: broker, topic: topic})
+	return nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/models"
+)
+
+// newTestMemoryDatabase creates a connected in-memory database
+func newTestMemoryDatabase(t *testing.T) Database {
+	t.Helper()
+
+	db, err := New(&Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+	return db
+}
+
+func TestMemoryMessages(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i, topic := range []string{"sensors/a/temp", "sensors/b/temp", "sensors/a/humidity", "alerts/fire"} {
+		msg := &Message{Topic: topic, Payload: map[string]interface{}{"value": i}, Timestamp: start.Add(time.Duration(i) * time.Second)}
+		if err := db.StoreMessage(ctx, msg); err != nil {
+			t.Fatalf("Failed to store message: %v", err)
+		}
+		if msg.ID == "" || msg.Status != MessageStatusDelivered {
+			t.Errorf("Expected an ID and the delivered status, got '%s' and '%s'", msg.ID, msg.Status)
+		}
+	}
+
+	messages, err := db.GetMessages(ctx, false, "", 2)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Topic != "alerts/fire" {
+		t.Fatalf("Expected the 2 newest messages, got %+v", messages)
+	}
+
+	if err := db.ConfirmMessage(ctx, messages[0].ID); err != nil {
+		t.Fatalf("Failed to confirm message: %v", err)
+	}
+	if confirmed, _ := db.GetMessages(ctx, true, "", 0); len(confirmed) != 1 {
+		t.Errorf("Expected 1 confirmed message, got %d", len(confirmed))
+	}
+	if unconfirmed, _ := db.GetMessages(ctx, false, "", 0); len(unconfirmed) != 3 {
+		t.Errorf("Expected 3 unconfirmed messages, got %d", len(unconfirmed))
+	}
+
+	if matched, _ := db.GetMessagesByTopicFilter(ctx, "sensors/+/temp", 0); len(matched) != 2 {
+		t.Errorf("Expected 2 messages matching 'sensors/+/temp', got %d", len(matched))
+	}
+	if matched, _ := db.GetMessagesByTopicPrefix(ctx, "sensors/a/", false, "", 0); len(matched) != 2 {
+		t.Errorf("Expected 2 messages with prefix 'sensors/a/', got %d", len(matched))
+	}
+
+	if deleted, err := db.DeleteConfirmedMessages(ctx); err != nil || deleted != 1 {
+		t.Errorf("Expected 1 confirmed message to be deleted, got %d (%v)", deleted, err)
+	}
+	if _, err := db.GetMessageByID(ctx, messages[0].ID); err != ErrMessageNotFound {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+	if err := db.DeleteMessage(ctx, "missing"); err != ErrMessageNotFound {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+func TestMemoryMessagePayloads(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	ctx := context.Background()
+
+	binary := []byte{0x89, 'P', 'N', 'G', 0xff}
+	msg := &Message{Topic: "images/cam", Payload: binary}
+	if err := db.StoreMessage(ctx, msg); err != nil {
+		t.Fatalf("Failed to store message: %v", err)
+	}
+
+	// Modifying the caller's payload must not change the stored message
+	binary[0] = 0
+	stored, err := db.GetMessageByID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if stored.ContentType != ContentTypeBinary {
+		t.Errorf("Expected content type '%s', got '%s'", ContentTypeBinary, stored.ContentType)
+	}
+	if payload, _ := stored.PayloadBytes(); !bytes.Equal(payload, []byte{0x89, 'P', 'N', 'G', 0xff}) {
+		t.Errorf("Expected the stored payload to be unchanged, got %x", payload)
+	}
+}
+
+func TestMemoryWebhooks(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	ctx := context.Background()
+
+	enabled := &models.Webhook{Name: "enabled", URL: "http://example.com", TopicFilter: "sensors/#", Enabled: true}
+	disabled := &models.Webhook{Name: "disabled", URL: "http://example.com", TopicFilter: "sensors/#"}
+	for _, webhook := range []*models.Webhook{enabled, disabled} {
+		if err := db.StoreWebhook(ctx, webhook); err != nil {
+			t.Fatalf("Failed to store webhook: %v", err)
+		}
+	}
+
+	matched, err := db.GetWebhooksByTopicFilter(ctx, "sensors/a/temp")
+	if err != nil {
+		t.Fatalf("Failed to get webhooks: %v", err)
+	}
+	if len(matched) != 1 || matched[0].ID != enabled.ID {
+		t.Errorf("Expected only the enabled webhook to match, got %+v", matched)
+	}
+
+	all, err := db.GetEnabledWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get enabled webhooks: %v", err)
+	}
+	if len(all) != 1 || all[0].ID != enabled.ID {
+		t.Errorf("Expected only the enabled webhook, got %+v", all)
+	}
+
+	enabled.Name = "renamed"
+	if err := db.UpdateWebhook(ctx, enabled); err != nil {
+		t.Fatalf("Failed to update webhook: %v", err)
+	}
+	if webhook, _ := db.GetWebhookByID(ctx, enabled.ID); webhook.Name != "renamed" {
+		t.Errorf("Expected the webhook to be renamed, got '%s'", webhook.Name)
+	}
+
+	if err := db.DeleteWebhook(ctx, disabled.ID); err != nil {
+		t.Fatalf("Failed to delete webhook: %v", err)
+	}
+	if _, err := db.GetWebhookByID(ctx, disabled.ID); err != ErrMessageNotFound {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+func TestMemoryRequiresConnect(t *testing.T) {
+	db, err := New(&Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	if err := db.Ping(context.Background()); err != ErrConnectionFailed {
+		t.Errorf("Expected ErrConnectionFailed before connecting, got %v", err)
+	}
+	if err := db.StoreMessage(context.Background(), &Message{Topic: "data"}); err != ErrConnectionFailed {
+		t.Errorf("Expected ErrConnectionFailed before connecting, got %v", err)
+	}
+}
+
+func TestMemoryDeleteWebhookDeliveriesBefore(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	ctx := context.Background()
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, delivery := range []*models.WebhookDelivery{
+		{ID: "delivered", Status: models.DeliveryStatusDelivered, UpdatedAt: old},
+		{ID: "failed", Status: models.DeliveryStatusFailed, UpdatedAt: old},
+		{ID: "pending", Status: models.DeliveryStatusPending, UpdatedAt: old},
+		{ID: "recent", Status: models.DeliveryStatusDelivered},
+	} {
+		if err := db.StoreWebhookDelivery(ctx, delivery); err != nil {
+			t.Fatalf("Failed to store delivery: %v", err)
+		}
+	}
+
+	deleted, err := db.DeleteWebhookDeliveriesBefore(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to delete deliveries: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deliveries to be deleted, got %d", deleted)
+	}
+	for _, id := range []string{"pending", "recent"} {
+		if _, err := db.GetWebhookDeliveryByID(ctx, id); err != nil {
+			t.Errorf("Expected delivery %s to be kept, got %v", id, err)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"MQTTmicroService/internal/models"
@@ -15,7 +19,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-// MongoDBDatabase implements the Database interface for MongoDB
+// MongoDBDatabase implements the Database interface for MongoDB.
+//
+// Documents created by the service use the hex string of a new ObjectID as their _id, so IDs look the same as
+// ObjectIDs but are stored as strings. Documents inserted by other tools usually have a native ObjectID _id
+// instead, which decodes to the same hex string; lookups by ID match both forms, see idFilter.
 type MongoDBDatabase struct {
 	client     *mongo.Client
 	db         *mongo.Database
@@ -23,6 +31,23 @@ type MongoDBDatabase struct {
 	config     *Config
 }
 
+// messageHashIndex is the name of the unique index rejecting duplicate messages
+const messageHashIndex = "idx_messages_hash"
+
+// isDuplicateHash reports whether a write error is a duplicate key error of the message hash index
+func isDuplicateHash(code int, message string) bool {
+	return code == 11000 && strings.Contains(message, messageHashIndex)
+}
+
+// idFilter matches a document by ID. IDs that are valid ObjectID hex strings match both the string _id stored
+// by the service and a native ObjectID _id, so documents inserted by other tools can be found too.
+func idFilter(id string) bson.M {
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.M{"_id": bson.M{"$in": bson.A{id, oid}}}
+	}
+	return bson.M{"_id": id}
+}
+
 // NewMongoDBDatabase creates a new MongoDB database instance
 func NewMongoDBDatabase(config *Config) (Database, error) {
 	return &MongoDBDatabase{
@@ -97,6 +122,17 @@ func (m *MongoDBDatabase) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create index: %w", err)
 	}
 
+	// Reject duplicate messages; the index is sparse, so messages stored without a hash aren't compared
+	hashIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetName(messageHashIndex).SetUnique(true).SetSparse(true).SetBackground(true),
+	}
+	_, err = collection.Indexes().CreateOne(ctx, hashIndex)
+	if err != nil {
+		client.Disconnect(ctx)
+		return fmt.Errorf("failed to create hash index: %w", err)
+	}
+
 	// Create webhooks collection and indexes
 	webhooksCollection := db.Collection("webhooks")
 
@@ -122,6 +158,50 @@ func (m *MongoDBDatabase) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create enabled index: %w", err)
 	}
 
+	// Create index for looking up deliveries by webhook and finding due retries
+	deliveriesIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_retry_at", Value: 1}},
+		Options: options.Index().SetBackground(true),
+	}
+	_, err = db.Collection("webhook_deliveries").Indexes().CreateOne(ctx, deliveriesIndex)
+	if err != nil {
+		client.Disconnect(ctx)
+		return fmt.Errorf("failed to create webhook_deliveries index: %w", err)
+	}
+
+	// Create index for finding due scheduled messages
+	scheduledIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "publish_at", Value: 1}},
+		Options: options.Index().SetBackground(true),
+	}
+	_, err = db.Collection("scheduled_messages").Indexes().CreateOne(ctx, scheduledIndex)
+	if err != nil {
+		client.Disconnect(ctx)
+		return fmt.Errorf("failed to create scheduled_messages index: %w", err)
+	}
+
+	// Let MongoDB remove idempotency keys once they expire
+	idempotencyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetBackground(true),
+	}
+	_, err = db.Collection("idempotency_keys").Indexes().CreateOne(ctx, idempotencyIndex)
+	if err != nil {
+		client.Disconnect(ctx)
+		return fmt.Errorf("failed to create idempotency_keys index: %w", err)
+	}
+
+	// Allow a single subscription to a topic on each broker
+	subscriptionsIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "broker", Value: 1}, {Key: "topic", Value: 1}},
+		Options: options.Index().SetUnique(true).SetBackground(true),
+	}
+	_, err = db.Collection("subscriptions").Indexes().CreateOne(ctx, subscriptionsIndex)
+	if err != nil {
+		client.Disconnect(ctx)
+		return fmt.Errorf("failed to create subscriptions index: %w", err)
+	}
+
 	// Store client, database, and collection
 	m.client = client
 	m.db = db
@@ -144,6 +224,131 @@ func (m *MongoDBDatabase) StoreMessage(ctx context.Context, msg *Message) error
 		return ErrConnectionFailed
 	}
 
+	if err := setMessageHash(m.config, msg); err != nil {
+		return err
+	}
+	doc, err := messageDocument(msg)
+	if err != nil {
+		return err
+	}
+
+	// Insert the message
+	if _, err := m.collection.InsertOne(ctx, doc); err != nil {
+		var writeErr mongo.WriteException
+		if errors.As(err, &writeErr) && len(writeErr.WriteErrors) > 0 && isDuplicateHash(writeErr.WriteErrors[0].Code, writeErr.WriteErrors[0].Message) {
+			return ErrDuplicateMessage
+		}
+		return fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	return nil
+}
+
+// StoreMessages stores several messages with a single unordered insert. Messages that fail, including
+// duplicates, don't stop the others from being stored; they are reported by index in a *BatchError.
+func (m *MongoDBDatabase) StoreMessages(ctx context.Context, msgs []*Message) error {
+	if m.collection == nil {
+		return ErrConnectionFailed
+	}
+
+	failed := make(map[int]error)
+	docs := make([]interface{}, 0, len(msgs))
+	// indexes maps the position of each document to the position of its message in the batch
+	indexes := make([]int, 0, len(msgs))
+	for i, msg := range msgs {
+		if err := setMessageHash(m.config, msg); err != nil {
+			failed[i] = err
+			continue
+		}
+		doc, err := messageDocument(msg)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		docs = append(docs, doc)
+		indexes = append(indexes, i)
+	}
+
+	if len(docs) > 0 {
+		_, err := m.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		switch {
+		case errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0:
+			for _, writeErr := range bulkErr.WriteErrors {
+				if isDuplicateHash(writeErr.Code, writeErr.Message) {
+					failed[indexes[writeErr.Index]] = ErrDuplicateMessage
+					continue
+				}
+				failed[indexes[writeErr.Index]] = fmt.Errorf("failed to insert message: %s", writeErr.Message)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to insert messages: %w", err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// ImportMessages stores messages that already have IDs with a single unordered bulk write. Messages whose ID is
+// already stored are replaced if replace is true and skipped otherwise. Messages that fail don't stop the others
+// from being stored; they are reported by index in a *BatchError.
+func (m *MongoDBDatabase) ImportMessages(ctx context.Context, msgs []*Message, replace bool) (int, error) {
+	if m.collection == nil {
+		return 0, ErrConnectionFailed
+	}
+
+	failed := make(map[int]error)
+	writes := make([]mongo.WriteModel, 0, len(msgs))
+	// indexes maps the position of each write to the position of its message in the batch
+	indexes := make([]int, 0, len(msgs))
+	for i, msg := range msgs {
+		doc, err := messageDocument(msg)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		if replace {
+			writes = append(writes, mongo.NewReplaceOneModel().SetFilter(idFilter(doc.ID)).SetReplacement(doc).SetUpsert(true))
+		} else {
+			writes = append(writes, mongo.NewUpdateOneModel().SetFilter(idFilter(doc.ID)).SetUpdate(bson.M{"$setOnInsert": doc}).SetUpsert(true))
+		}
+		indexes = append(indexes, i)
+	}
+
+	skipped := 0
+	if len(writes) > 0 {
+		result, err := m.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		switch {
+		case errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0:
+			for _, writeErr := range bulkErr.WriteErrors {
+				failed[indexes[writeErr.Index]] = fmt.Errorf("failed to import message: %s", writeErr.Message)
+			}
+		case err != nil:
+			return 0, fmt.Errorf("failed to import messages: %w", err)
+		}
+
+		// Without replacing, messages that weren't upserted were already stored
+		if !replace && result != nil {
+			for j, i := range indexes {
+				if _, upserted := result.UpsertedIDs[int64(j)]; !upserted && failed[i] == nil {
+					skipped++
+				}
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return skipped, &BatchError{Failed: failed}
+	}
+	return skipped, nil
+}
+
+// messageDocument fills in the defaults of a message and returns the document stored for it
+func messageDocument(msg *Message) (*Message, error) {
 	// Generate an ID if one is not provided
 	if msg.ID == "" {
 		msg.ID = primitive.NewObjectID().Hex()
@@ -154,17 +359,60 @@ func (m *MongoDBDatabase) StoreMessage(ctx context.Context, msg *Message) error
 		msg.Timestamp = time.Now()
 	}
 
-	// Insert the message
-	_, err := m.collection.InsertOne(ctx, msg)
+	// Messages stored without a status were already delivered
+	if msg.Status == "" {
+		msg.Status = MessageStatusDelivered
+	}
+
+	// Text and binary payloads are stored byte-for-byte, JSON payloads as documents so they stay queryable
+	data, contentType, err := EncodePayload(msg.Payload)
 	if err != nil {
-		return fmt.Errorf("failed to insert message: %w", err)
+		return nil, err
+	}
+	msg.ContentType = contentType
+
+	doc := *msg
+	switch contentType {
+	case ContentTypeText:
+		doc.Payload = string(data)
+	case ContentTypeBinary:
+		doc.Payload = data
+	default:
+		doc.Payload = bsonNumbers(msg.Payload)
 	}
+	return &doc, nil
+}
 
-	return nil
+// bsonNumbers converts the json.Number values of a JSON payload to int64 or float64,
+// which BSON would otherwise store as strings
+func bsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = bsonNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = bsonNumbers(item)
+		}
+		return converted
+	}
+	return value
 }
 
 // GetMessages retrieves messages from the database
-func (m *MongoDBDatabase) GetMessages(ctx context.Context, confirmed bool, limit int) ([]*Message, error) {
+func (m *MongoDBDatabase) GetMessages(ctx context.Context, confirmed bool, status string, limit int) ([]*Message, error) {
 	if m.collection == nil {
 		return nil, ErrConnectionFailed
 	}
@@ -176,6 +424,49 @@ func (m *MongoDBDatabase) GetMessages(ctx context.Context, confirmed bool, limit
 
 	// Create filter
 	filter := bson.M{"confirmed": confirmed}
+	addStatusFilter(filter, status)
+
+	// Create options
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetLimit(int64(limit))
+
+	// Query the database
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	// Parse the results
+	var messages []*Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, fmt.Errorf("failed to decode messages: %w", err)
+	}
+	for _, msg := range messages {
+		normalizeMessage(msg)
+	}
+
+	return messages, nil
+}
+
+// GetMessagesByTopicPrefix retrieves messages whose topic starts with the given prefix
+func (m *MongoDBDatabase) GetMessagesByTopicPrefix(ctx context.Context, prefix string, confirmed bool, status string, limit int) ([]*Message, error) {
+	if m.collection == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Create filter
+	filter := bson.M{
+		"confirmed": confirmed,
+		"topic":     primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)},
+	}
+	addStatusFilter(filter, status)
 
 	// Create options
 	findOptions := options.Find().
@@ -194,6 +485,104 @@ func (m *MongoDBDatabase) GetMessages(ctx context.Context, confirmed bool, limit
 	if err := cursor.All(ctx, &messages); err != nil {
 		return nil, fmt.Errorf("failed to decode messages: %w", err)
 	}
+	for _, msg := range messages {
+		normalizeMessage(msg)
+	}
+
+	return messages, nil
+}
+
+// ExportMessages calls fn with every message matching the filter, oldest first. The cursor fetches the messages
+// from the server in batches as they are consumed.
+func (m *MongoDBDatabase) ExportMessages(ctx context.Context, filter MessageFilter, fn func(*Message) error) error {
+	if m.collection == nil {
+		return ErrConnectionFailed
+	}
+
+	query := bson.M{}
+	if filter.Confirmed != nil {
+		query["confirmed"] = *filter.Confirmed
+	}
+	if !filter.Since.IsZero() {
+		query["timestamp"] = bson.M{"$gte": filter.Since}
+	}
+	if filter.Topic != "" {
+		query["topic"] = primitive.Regex{Pattern: topicFilterRegex(filter.Topic)}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+		SetBatchSize(exportChunkSize)
+
+	cursor, err := m.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var msg Message
+		if err := cursor.Decode(&msg); err != nil {
+			return fmt.Errorf("failed to decode message: %w", err)
+		}
+		normalizeMessage(&msg)
+		// Apply the same wildcard semantics as webhook matching
+		if !filter.Matches(&msg) {
+			continue
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error iterating messages: %w", err)
+	}
+	return nil
+}
+
+// GetMessagesByTopicFilter retrieves messages whose topic matches an MQTT topic filter, which may contain wildcards
+func (m *MongoDBDatabase) GetMessagesByTopicFilter(ctx context.Context, filter string, limit int) ([]*Message, error) {
+	if m.collection == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Prefilter with a regex derived from the topic filter
+	query := bson.M{
+		"topic": primitive.Regex{Pattern: topicFilterRegex(filter)},
+	}
+
+	// Create options
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}})
+
+	// Query the database
+	cursor, err := m.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	// Apply the same wildcard semantics as webhook matching
+	var messages []*Message
+	for len(messages) < limit && cursor.Next(ctx) {
+		var msg Message
+		if err := cursor.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("failed to decode message: %w", err)
+		}
+		if utils.TopicMatchesFilter(msg.Topic, filter) {
+			normalizeMessage(&msg)
+			messages = append(messages, &msg)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating messages: %w", err)
+	}
 
 	return messages, nil
 }
@@ -205,7 +594,7 @@ func (m *MongoDBDatabase) GetMessageByID(ctx context.Context, id string) (*Messa
 	}
 
 	// Create filter
-	filter := bson.M{"_id": id}
+	filter := idFilter(id)
 
 	// Query the database
 	var msg Message
@@ -216,6 +605,7 @@ func (m *MongoDBDatabase) GetMessageByID(ctx context.Context, id string) (*Messa
 		}
 		return nil, fmt.Errorf("failed to query message: %w", err)
 	}
+	normalizeMessage(&msg)
 
 	return &msg, nil
 }
@@ -227,7 +617,7 @@ func (m *MongoDBDatabase) ConfirmMessage(ctx context.Context, id string) error {
 	}
 
 	// Create filter
-	filter := bson.M{"_id": id}
+	filter := idFilter(id)
 
 	// Create update
 	update := bson.M{"$set": bson.M{"confirmed": true}}
@@ -246,6 +636,57 @@ func (m *MongoDBDatabase) ConfirmMessage(ctx context.Context, id string) error {
 	return nil
 }
 
+// UpdateMessageStatus sets the delivery status of a message
+func (m *MongoDBDatabase) UpdateMessageStatus(ctx context.Context, id string, status string) error {
+	if m.collection == nil {
+		return ErrConnectionFailed
+	}
+
+	// Update the message
+	result, err := m.collection.UpdateOne(ctx, idFilter(id), bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+
+	// Check if the message was found
+	if result.MatchedCount == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
+
+// addStatusFilter restricts a message query to a delivery status.
+// Messages stored before statuses existed have no status field and count as delivered.
+func addStatusFilter(filter bson.M, status string) {
+	switch status {
+	case "":
+	case MessageStatusDelivered:
+		filter["status"] = bson.M{"$in": bson.A{MessageStatusDelivered, nil}}
+	default:
+		filter["status"] = status
+	}
+}
+
+// normalizeMessage marks messages stored before statuses existed as delivered and restores payloads
+// stored as strings or binary data to the value they were stored from
+func normalizeMessage(msg *Message) {
+	if msg.Status == "" {
+		msg.Status = MessageStatusDelivered
+	}
+
+	switch p := msg.Payload.(type) {
+	case string:
+		// Messages stored before content types existed kept only published strings as strings
+		if msg.ContentType == "" {
+			msg.ContentType = ContentTypeText
+		}
+		msg.Payload, msg.ContentType = DecodePayload([]byte(p), msg.ContentType)
+	case primitive.Binary:
+		msg.Payload, msg.ContentType = DecodePayload(p.Data, msg.ContentType)
+	}
+}
+
 // DeleteMessage deletes a message from the database
 func (m *MongoDBDatabase) DeleteMessage(ctx context.Context, id string) error {
 	if m.collection == nil {
@@ -253,7 +694,7 @@ func (m *MongoDBDatabase) DeleteMessage(ctx context.Context, id string) error {
 	}
 
 	// Create filter
-	filter := bson.M{"_id": id}
+	filter := idFilter(id)
 
 	// Delete the message
 	result, err := m.collection.DeleteOne(ctx, filter)
@@ -363,7 +804,7 @@ func (m *MongoDBDatabase) GetWebhookByID(ctx context.Context, id string) (*model
 	}
 
 	// Create filter
-	filter := bson.M{"_id": id}
+	filter := idFilter(id)
 
 	// Query the database
 	var webhook models.Webhook
@@ -388,21 +829,26 @@ func (m *MongoDBDatabase) UpdateWebhook(ctx context.Context, webhook *models.Web
 	webhook.UpdatedAt = time.Now()
 
 	// Create filter
-	filter := bson.M{"_id": webhook.ID}
+	filter := idFilter(webhook.ID)
 
 	// Create update
 	update := bson.M{
 		"$set": bson.M{
-			"name":         webhook.Name,
-			"url":          webhook.URL,
-			"method":       webhook.Method,
-			"topic_filter": webhook.TopicFilter,
-			"enabled":      webhook.Enabled,
-			"headers":      webhook.Headers,
-			"timeout":      webhook.Timeout,
-			"retry_count":  webhook.RetryCount,
-			"retry_delay":  webhook.RetryDelay,
-			"updated_at":   webhook.UpdatedAt,
+			"name":          webhook.Name,
+			"url":           webhook.URL,
+			"method":        webhook.Method,
+			"topic_filter":  webhook.TopicFilter,
+			"enabled":       webhook.Enabled,
+			"headers":       webhook.Headers,
+			"timeout":       webhook.Timeout,
+			"retry_count":   webhook.RetryCount,
+			"retry_delay":   webhook.RetryDelay,
+			"updated_at":    webhook.UpdatedAt,
+			"secret":        webhook.Secret,
+			"body_template": webhook.BodyTemplate,
+			"content_type":  webhook.ContentType,
+			"min_qos":       webhook.MinQoS,
+			"condition":     webhook.Condition,
 		},
 	}
 
@@ -427,7 +873,7 @@ func (m *MongoDBDatabase) DeleteWebhook(ctx context.Context, id string) error {
 	}
 
 	// Create filter
-	filter := bson.M{"_id": id}
+	filter := idFilter(id)
 
 	// Delete the webhook
 	result, err := m.db.Collection("webhooks").DeleteOne(ctx, filter)
@@ -445,30 +891,454 @@ func (m *MongoDBDatabase) DeleteWebhook(ctx context.Context, id string) error {
 
 // GetWebhooksByTopicFilter retrieves webhooks that match a topic
 func (m *MongoDBDatabase) GetWebhooksByTopicFilter(ctx context.Context, topic string) ([]*models.Webhook, error) {
+	allWebhooks, err := m.GetEnabledWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter webhooks by topic
+	var matchingWebhooks []*models.Webhook
+	for _, webhook := range allWebhooks {
+		if utils.TopicMatchesFilter(topic, webhook.TopicFilter) {
+			matchingWebhooks = append(matchingWebhooks, webhook)
+		}
+	}
+
+	return matchingWebhooks, nil
+}
+
+// GetEnabledWebhooks retrieves all enabled webhooks, newest first
+func (m *MongoDBDatabase) GetEnabledWebhooks(ctx context.Context) ([]*models.Webhook, error) {
 	if m.db == nil {
 		return nil, ErrConnectionFailed
 	}
 
-	// Get all enabled webhooks
-	cursor, err := m.db.Collection("webhooks").Find(ctx, bson.M{"enabled": true})
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.db.Collection("webhooks").Find(ctx, bson.M{"enabled": true}, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query webhooks: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	// Parse the results and filter by topic
-	var allWebhooks []*models.Webhook
-	if err := cursor.All(ctx, &allWebhooks); err != nil {
+	var webhooks []*models.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
 		return nil, fmt.Errorf("failed to decode webhooks: %w", err)
 	}
 
-	// Filter webhooks by topic
-	var matchingWebhooks []*models.Webhook
-	for _, webhook := range allWebhooks {
-		if utils.TopicMatchesFilter(topic, webhook.TopicFilter) {
-			matchingWebhooks = append(matchingWebhooks, webhook)
+	return webhooks, nil
+}
+
+// StoreWebhookDelivery stores a webhook delivery record in the database
+func (m *MongoDBDatabase) StoreWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if delivery.ID == "" {
+		delivery.ID = primitive.NewObjectID().Hex()
+	}
+
+	// Set timestamps if not already set
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	if delivery.UpdatedAt.IsZero() {
+		delivery.UpdatedAt = delivery.CreatedAt
+	}
+
+	// Insert the delivery
+	_, err := m.db.Collection("webhook_deliveries").InsertOne(ctx, delivery)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateWebhookDelivery updates the status of a webhook delivery record
+func (m *MongoDBDatabase) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Update the timestamp
+	delivery.UpdatedAt = time.Now()
+
+	// Create filter and update
+	filter := idFilter(delivery.ID)
+	update := bson.M{
+		"$set": bson.M{
+			"status":        delivery.Status,
+			"attempts":      delivery.Attempts,
+			"last_error":    delivery.LastError,
+			"next_retry_at": delivery.NextRetryAt,
+			"updated_at":    delivery.UpdatedAt,
+		},
+	}
+
+	// Update the delivery
+	result, err := m.db.Collection("webhook_deliveries").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	// Check if the delivery was found
+	if result.MatchedCount == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveryByID retrieves a webhook delivery record by its ID
+func (m *MongoDBDatabase) GetWebhookDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Query the database
+	var delivery models.WebhookDelivery
+	err := m.db.Collection("webhook_deliveries").FindOne(ctx, idFilter(id)).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDeliveryNotFound
 		}
+		return nil, fmt.Errorf("failed to query webhook delivery: %w", err)
 	}
 
-	return matchingWebhooks, nil
+	return &delivery, nil
+}
+
+// GetWebhookDeliveries retrieves the most recent delivery records of a webhook
+func (m *MongoDBDatabase) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Create options
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	return m.findWebhookDeliveries(ctx, bson.M{"webhook_id": webhookID}, findOptions)
+}
+
+// GetDueWebhookDeliveries retrieves pending deliveries whose next retry is due at or before the given time
+func (m *MongoDBDatabase) GetDueWebhookDeliveries(ctx context.Context, before time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Create filter and options, oldest retry first
+	filter := bson.M{
+		"status":        models.DeliveryStatusPending,
+		"next_retry_at": bson.M{"$lte": before},
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "next_retry_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	return m.findWebhookDeliveries(ctx, filter, findOptions)
+}
+
+// DeleteWebhookDeliveriesBefore deletes delivered and failed deliveries last updated before the given time
+func (m *MongoDBDatabase) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	if m.db == nil {
+		return 0, ErrConnectionFailed
+	}
+
+	// Create filter
+	filter := bson.M{
+		"status":     bson.M{"$in": []string{models.DeliveryStatusDelivered, models.DeliveryStatusFailed}},
+		"updated_at": bson.M{"$lt": before},
+	}
+
+	// Delete the deliveries
+	result, err := m.db.Collection("webhook_deliveries").DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	return int(result.DeletedCount), nil
+}
+
+// findWebhookDeliveries queries webhook delivery records
+func (m *MongoDBDatabase) findWebhookDeliveries(ctx context.Context, filter bson.M, findOptions *options.FindOptions) ([]*models.WebhookDelivery, error) {
+	cursor, err := m.db.Collection("webhook_deliveries").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	// Parse the results
+	var deliveries []*models.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// StoreScheduledMessage stores a message to be published later
+func (m *MongoDBDatabase) StoreScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if msg.ID == "" {
+		msg.ID = primitive.NewObjectID().Hex()
+	}
+
+	// Set timestamps if not already set
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	if msg.UpdatedAt.IsZero() {
+		msg.UpdatedAt = msg.CreatedAt
+	}
+
+	// Insert the scheduled message
+	_, err := m.db.Collection("scheduled_messages").InsertOne(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("failed to insert scheduled message: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateScheduledMessage updates the status of a scheduled message
+func (m *MongoDBDatabase) UpdateScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Update the timestamp
+	msg.UpdatedAt = time.Now()
+
+	// Create filter and update
+	filter := idFilter(msg.ID)
+	update := bson.M{
+		"$set": bson.M{
+			"status":     msg.Status,
+			"last_error": msg.LastError,
+			"updated_at": msg.UpdatedAt,
+		},
+	}
+
+	// Update the scheduled message
+	result, err := m.db.Collection("scheduled_messages").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update scheduled message: %w", err)
+	}
+
+	// Check if the scheduled message was found
+	if result.MatchedCount == 0 {
+		return ErrScheduledMessageNotFound
+	}
+
+	return nil
+}
+
+// GetScheduledMessageByID retrieves a scheduled message by its ID
+func (m *MongoDBDatabase) GetScheduledMessageByID(ctx context.Context, id string) (*models.ScheduledMessage, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Query the database
+	var msg models.ScheduledMessage
+	err := m.db.Collection("scheduled_messages").FindOne(ctx, idFilter(id)).Decode(&msg)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrScheduledMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to query scheduled message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// GetScheduledMessages retrieves scheduled messages, soonest first
+func (m *MongoDBDatabase) GetScheduledMessages(ctx context.Context, limit int) ([]*models.ScheduledMessage, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "publish_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	return m.findScheduledMessages(ctx, bson.M{}, findOptions)
+}
+
+// GetDueScheduledMessages retrieves pending scheduled messages whose publish time is at or before the given time
+func (m *MongoDBDatabase) GetDueScheduledMessages(ctx context.Context, before time.Time, limit int) ([]*models.ScheduledMessage, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Create filter and options, soonest first
+	filter := bson.M{
+		"status":     models.ScheduledStatusPending,
+		"publish_at": bson.M{"$lte": before},
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "publish_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	return m.findScheduledMessages(ctx, filter, findOptions)
+}
+
+// DeleteScheduledMessage deletes a scheduled message
+func (m *MongoDBDatabase) DeleteScheduledMessage(ctx context.Context, id string) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Delete the scheduled message
+	result, err := m.db.Collection("scheduled_messages").DeleteOne(ctx, idFilter(id))
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+
+	// Check if the scheduled message was found
+	if result.DeletedCount == 0 {
+		return ErrScheduledMessageNotFound
+	}
+
+	return nil
+}
+
+// findScheduledMessages queries scheduled messages
+func (m *MongoDBDatabase) findScheduledMessages(ctx context.Context, filter bson.M, findOptions *options.FindOptions) ([]*models.ScheduledMessage, error) {
+	cursor, err := m.db.Collection("scheduled_messages").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	// Parse the results
+	var messages []*models.ScheduledMessage
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, fmt.Errorf("failed to decode scheduled messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// StoreIdempotencyRecord stores the outcome of a request made with an idempotency key
+func (m *MongoDBDatabase) StoreIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Set the timestamp if not already set
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	// Insert the record, replacing any previous one with the same key
+	_, err := m.db.Collection("idempotency_keys").ReplaceOne(ctx, bson.M{"_id": record.Key}, record, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to insert idempotency record: %w", err)
+	}
+
+	return nil
+}
+
+// GetIdempotencyRecord retrieves the unexpired record of an idempotency key
+func (m *MongoDBDatabase) GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// The TTL monitor only runs periodically, so expired records are filtered out explicitly
+	var record IdempotencyRecord
+	filter := bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}
+	err := m.db.Collection("idempotency_keys").FindOne(ctx, filter).Decode(&record)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrIdempotencyRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to query idempotency record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// StoreSubscription stores a subscription, replacing any existing one to the same topic on the same broker
+func (m *MongoDBDatabase) StoreSubscription(ctx context.Context, subscription *models.Subscription) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Set the timestamp if not already set
+	if subscription.CreatedAt.IsZero() {
+		subscription.CreatedAt = time.Now()
+	}
+
+	filter := bson.M{"broker": subscription.Broker, "topic": subscription.Topic}
+	_, err := m.db.Collection("subscriptions").ReplaceOne(ctx, filter, subscription, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to insert subscription: %w", err)
+	}
+
+	return nil
+}
+
+// GetSubscriptions retrieves all stored subscriptions, oldest first
+func (m *MongoDBDatabase) GetSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	if m.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := m.db.Collection("subscriptions").Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []*models.Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to decode subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription deletes a stored subscription
+func (m *MongoDBDatabase) DeleteSubscription(ctx context.Context, broker, topic string) error {
+	if m.db == nil {
+		return ErrConnectionFailed
+	}
+
+	_, err := m.db.Collection("subscriptions").DeleteOne(ctx, bson.M{"broker": broker, "topic": topic})
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIDFilterMatchesBothIDForms(t *testing.T) {
+	oid := primitive.NewObjectID()
+
+	filter := idFilter(oid.Hex())
+	want := bson.M{"_id": bson.M{"$in": bson.A{oid.Hex(), oid}}}
+	if fmt.Sprint(filter) != fmt.Sprint(want) {
+		t.Errorf("Expected an ObjectID hex string to match both forms, got %v", filter)
+	}
+
+	// IDs generated by the other providers aren't ObjectIDs
+	if filter := idFilter("1718000000000000001"); fmt.Sprint(filter) != fmt.Sprint(bson.M{"_id": "1718000000000000001"}) {
+		t.Errorf("Expected a plain string match, got %v", filter)
+	}
+}
+
+func TestMessageDocumentStoresJSONNumbersAsNumbers(t *testing.T) {
+	msg := &Message{Payload: map[string]interface{}{
+		"id":       json.Number("9007199254740993"),
+		"readings": []interface{}{json.Number("21.5"), "text"},
+	}}
+
+	doc, err := messageDocument(msg)
+	if err != nil {
+		t.Fatalf("Failed to build document: %v", err)
+	}
+
+	payload := doc.Payload.(map[string]interface{})
+	if id, ok := payload["id"].(int64); !ok || id != 9007199254740993 {
+		t.Errorf("Expected the ID to be stored as an int64, got %T %v", payload["id"], payload["id"])
+	}
+	readings := payload["readings"].([]interface{})
+	if reading, ok := readings[0].(float64); !ok || reading != 21.5 {
+		t.Errorf("Expected the reading to be stored as a float64, got %T %v", readings[0], readings[0])
+	}
+	if readings[1] != "text" {
+		t.Errorf("Expected strings to be kept, got %v", readings[1])
+	}
+}
+
+// TestMongoDBFindsMessagesByEitherIDForm runs against a real server when MONGODB_TEST_URI is set
+func TestMongoDBFindsMessagesByEitherIDForm(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	config := &Config{Type: "mongodb"}
+	config.MongoDB.URI = uri
+	config.MongoDB.Database = fmt.Sprintf("mqtt_test_%d", time.Now().UnixNano())
+	db, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	ctx := context.Background()
+	if err := db.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	mongoDB := db.(*MongoDBDatabase)
+	t.Cleanup(func() {
+		mongoDB.db.Drop(ctx)
+		db.Close(ctx)
+	})
+
+	// A message stored by the service has a string _id
+	stored := &Message{Topic: "sensors/service", Payload: "hello"}
+	if err := db.StoreMessage(ctx, stored); err != nil {
+		t.Fatalf("Failed to store message: %v", err)
+	}
+
+	// A message inserted by another tool has a native ObjectID _id
+	oid := primitive.NewObjectID()
+	if _, err := mongoDB.collection.InsertOne(ctx, bson.M{
+		"_id": oid, "topic": "sensors/external", "payload": "hello", "timestamp": time.Now(), "status": MessageStatusDelivered,
+	}); err != nil {
+		t.Fatalf("Failed to insert message: %v", err)
+	}
+
+	for _, id := range []string{stored.ID, oid.Hex()} {
+		msg, err := db.GetMessageByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get message %s: %v", id, err)
+		}
+		if msg.ID != id {
+			t.Errorf("Expected message ID %s, got %s", id, msg.ID)
+		}
+		if err := db.ConfirmMessage(ctx, id); err != nil {
+			t.Errorf("Failed to confirm message %s: %v", id, err)
+		}
+	}
+
+	messages, err := db.GetMessages(ctx, true, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("Expected both messages to be confirmed, got %d", len(messages))
+	}
+}
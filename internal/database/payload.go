@@ -0,0 +1,74 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Payload content types recorded with stored messages
+const (
+	// ContentTypeText is a UTF-8 text payload
+	ContentTypeText = "text"
+	// ContentTypeJSON is a payload that was published as a JSON value
+	ContentTypeJSON = "json"
+	// ContentTypeBinary is a payload that isn't valid UTF-8, such as an image
+	ContentTypeBinary = "binary"
+)
+
+// EncodePayload converts a message payload to the bytes stored for it and its content type.
+// Strings and byte slices are kept byte-for-byte, other values are marshaled to JSON. A nil
+// payload is stored as empty text, matching the empty payload it is published as.
+func EncodePayload(payload interface{}) ([]byte, string, error) {
+	switch p := payload.(type) {
+	case nil:
+		return []byte{}, ContentTypeText, nil
+	case json.RawMessage:
+		return p, ContentTypeJSON, nil
+	case string:
+		return []byte(p), textOrBinary([]byte(p)), nil
+	case []byte:
+		return p, textOrBinary(p), nil
+	default:
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal payload to JSON: %w", err)
+		}
+		return data, ContentTypeJSON, nil
+	}
+}
+
+// textOrBinary returns the content type of payload bytes that weren't published as JSON
+func textOrBinary(data []byte) string {
+	if utf8.Valid(data) {
+		return ContentTypeText
+	}
+	return ContentTypeBinary
+}
+
+// DecodePayload converts stored payload bytes back to a value that marshals to JSON faithfully: JSON payloads
+// as raw JSON, text as a string, and binary payloads as a byte slice, which marshals to base64. Messages stored
+// before content types were recorded have theirs detected from the payload. It returns the value and content type.
+func DecodePayload(data []byte, contentType string) (interface{}, string) {
+	if contentType == "" {
+		contentType = textOrBinary(data)
+		if contentType == ContentTypeText && json.Valid(data) {
+			contentType = ContentTypeJSON
+		}
+	}
+
+	switch {
+	case contentType == ContentTypeJSON && json.Valid(data):
+		return json.RawMessage(data), contentType
+	case contentType == ContentTypeBinary:
+		return data, contentType
+	default:
+		return string(data), contentType
+	}
+}
+
+// PayloadBytes returns the raw bytes of a message's payload
+func (m *Message) PayloadBytes() ([]byte, error) {
+	data, _, err := EncodePayload(m.Payload)
+	return data, err
+}
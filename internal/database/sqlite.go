@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"MQTTmicroService/internal/models"
@@ -15,6 +17,17 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Defaults for SQLite connections whose settings aren't configured
+const (
+	DefaultSQLiteBusyTimeout = 5 * time.Second
+	DefaultSQLiteJournalMode = "wal"
+	DefaultSQLiteSynchronous = "normal"
+)
+
+// sqliteMaxOpenConns limits the connections to the database file. Writes are serialized by SQLite
+// whatever the number of connections, so a few are enough for reads to proceed alongside a write.
+const sqliteMaxOpenConns = 4
+
 // SQLiteDatabase implements the Database interface for SQLite
 type SQLiteDatabase struct {
 	db     *sql.DB
@@ -33,6 +46,37 @@ func init() {
 	Register("sqlite", NewSQLiteDatabase)
 }
 
+// sqliteDSN returns the data source name of the database file, with the pragmas applied to every connection:
+// a busy timeout so that concurrent writes wait for each other instead of failing with "database is locked",
+// the journal and synchronous modes, and immediate transactions, which take the write lock up front instead
+// of failing when a read turns into a write while another connection writes
+func sqliteDSN(path string, config *Config) string {
+	busyTimeout := config.SQLite.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = DefaultSQLiteBusyTimeout
+	}
+	journalMode := config.SQLite.JournalMode
+	if journalMode == "" {
+		journalMode = DefaultSQLiteJournalMode
+	}
+	synchronous := config.SQLite.Synchronous
+	if synchronous == "" {
+		synchronous = DefaultSQLiteSynchronous
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	params.Add("_pragma", fmt.Sprintf("journal_mode(%s)", journalMode))
+	params.Add("_pragma", fmt.Sprintf("synchronous(%s)", synchronous))
+	params.Set("_txlock", "immediate")
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + params.Encode()
+}
+
 // Connect establishes a connection to the SQLite database
 func (s *SQLiteDatabase) Connect(ctx context.Context) error {
 	// Ensure the directory exists
@@ -50,14 +94,14 @@ func (s *SQLiteDatabase) Connect(ctx context.Context) error {
 	}
 
 	// Open the database
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath, s.config))
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(sqliteMaxOpenConns)
+	db.SetMaxIdleConns(sqliteMaxOpenConns)
 	db.SetConnMaxLifetime(time.Hour)
 
 	// Check if the connection is working
@@ -75,7 +119,11 @@ func (s *SQLiteDatabase) Connect(ctx context.Context) error {
 			qos INTEGER NOT NULL,
 			retained INTEGER NOT NULL,
 			timestamp DATETIME NOT NULL,
-			confirmed INTEGER NOT NULL
+			confirmed INTEGER NOT NULL,
+			status TEXT NOT NULL DEFAULT 'delivered',
+			content_type TEXT NOT NULL DEFAULT '',
+			original_topic TEXT NOT NULL DEFAULT '',
+			hash TEXT
 		)
 	`)
 	if err != nil {
@@ -83,6 +131,40 @@ func (s *SQLiteDatabase) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create messages table: %w", err)
 	}
 
+	// Add the status column to messages tables created before it existed; those messages were all delivered
+	if err := addColumnIfMissing(ctx, db, "messages", "status", "TEXT NOT NULL DEFAULT 'delivered'"); err != nil {
+		db.Close()
+		return err
+	}
+
+	// Add the content_type column to messages tables created before it existed; those messages have it detected on read
+	if err := addColumnIfMissing(ctx, db, "messages", "content_type", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return err
+	}
+
+	// Add the original_topic column to messages tables created before it existed
+	if err := addColumnIfMissing(ctx, db, "messages", "original_topic", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return err
+	}
+
+	// Add the hash column to messages tables created before it existed; their messages aren't deduplicated
+	if err := addColumnIfMissing(ctx, db, "messages", "hash", "TEXT"); err != nil {
+		db.Close()
+		return err
+	}
+
+	// Create a unique index on the hash column to reject duplicates; messages without a hash have a NULL one,
+	// which the index doesn't compare
+	_, err = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_hash ON messages(hash)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
 	// Create an index on the confirmed column
 	_, err = db.ExecContext(ctx, `
 		CREATE INDEX IF NOT EXISTS idx_messages_confirmed ON messages(confirmed)
@@ -106,7 +188,13 @@ func (s *SQLiteDatabase) Connect(ctx context.Context) error {
 			retry_count INTEGER NOT NULL,
 			retry_delay INTEGER NOT NULL,
 			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
+			updated_at DATETIME NOT NULL,
+			secret TEXT,
+			body_template TEXT,
+			content_type TEXT,
+			min_qos INTEGER NOT NULL DEFAULT 0,
+			payload_condition TEXT,
+			namespace TEXT
 		)
 	`)
 	if err != nil {
@@ -114,6 +202,115 @@ func (s *SQLiteDatabase) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create webhooks table: %w", err)
 	}
 
+	// Add the columns of webhooks tables created before they existed
+	for _, column := range []string{"secret", "body_template", "content_type", "payload_condition", "namespace"} {
+		if err := addColumnIfMissing(ctx, db, "webhooks", column, "TEXT"); err != nil {
+			db.Close()
+			return err
+		}
+	}
+	if err := addColumnIfMissing(ctx, db, "webhooks", "min_qos", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return err
+	}
+
+	// Create the webhook deliveries table if it doesn't exist
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			webhook_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT,
+			next_retry_at DATETIME,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create webhook_deliveries table: %w", err)
+	}
+
+	// Create indexes for looking up deliveries by webhook and finding due retries
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status, next_retry_at)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	// Create the scheduled messages table if it doesn't exist
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS scheduled_messages (
+			id TEXT PRIMARY KEY,
+			topic TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			qos INTEGER NOT NULL,
+			retained INTEGER NOT NULL,
+			broker TEXT NOT NULL,
+			publish_at DATETIME NOT NULL,
+			status TEXT NOT NULL,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create scheduled_messages table: %w", err)
+	}
+
+	// Create an index for finding due scheduled messages
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_scheduled_messages_status ON scheduled_messages(status, publish_at)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	// Create the idempotency keys table if it doesn't exist; expires_at is a Unix timestamp so expired keys can be purged with a comparison
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			key TEXT PRIMARY KEY,
+			request_hash TEXT NOT NULL,
+			status_code INTEGER NOT NULL,
+			response TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create idempotency_keys table: %w", err)
+	}
+
+	// Create the subscriptions table if it doesn't exist, allowing a single subscription to a topic on each broker
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS subscriptions (
+			broker TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			qos INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (broker, topic)
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create subscriptions table: %w", err)
+	}
+
 	// Create an index on the topic_filter column
 	_, err = db.ExecContext(ctx, `
 		CREATE INDEX IF NOT EXISTS idx_webhooks_topic_filter ON webhooks(topic_filter)
@@ -154,42 +351,180 @@ func (s *SQLiteDatabase) StoreMessage(ctx context.Context, msg *Message) error {
 	if msg.ID == "" {
 		msg.ID = fmt.Sprintf("%d", time.Now().UnixNano())
 	}
+	if err := setMessageHash(s.config, msg); err != nil {
+		return err
+	}
+
+	written, err := writeMessage(ctx, s.db, "INSERT", msg)
+	if err == nil && !written {
+		return ErrDuplicateMessage
+	}
+	return err
+}
+
+// StoreMessages stores several messages in a single transaction, which is rolled back if any of them fails.
+// Duplicates are skipped and reported in a *BatchError once the others are stored.
+func (s *SQLiteDatabase) StoreMessages(ctx context.Context, msgs []*Message) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Generated IDs must stay unique even when several are created within the same nanosecond
+	var lastID int64
+	duplicates := make(map[int]error)
+	for i, msg := range msgs {
+		if msg.ID == "" {
+			id := time.Now().UnixNano()
+			if id <= lastID {
+				id = lastID + 1
+			}
+			lastID = id
+			msg.ID = fmt.Sprintf("%d", id)
+		}
+		if err := setMessageHash(s.config, msg); err != nil {
+			return fmt.Errorf("failed to store message %d of the batch: %w", i, err)
+		}
+
+		written, err := writeMessage(ctx, tx, "INSERT", msg)
+		if err != nil {
+			return fmt.Errorf("failed to store message %d of the batch: %w", i, err)
+		}
+		if !written {
+			duplicates[i] = ErrDuplicateMessage
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if len(duplicates) > 0 {
+		return &BatchError{Failed: duplicates}
+	}
+	return nil
+}
+
+// ImportMessages stores messages that already have IDs in a single transaction, which is rolled back if any of
+// them fails. Messages whose ID is already stored are replaced if replace is true and skipped otherwise.
+func (s *SQLiteDatabase) ImportMessages(ctx context.Context, msgs []*Message, replace bool) (int, error) {
+	if s.db == nil {
+		return 0, ErrConnectionFailed
+	}
+
+	insert := "INSERT OR IGNORE"
+	if replace {
+		insert = "INSERT OR REPLACE"
+	}
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	skipped := 0
+	for i, msg := range msgs {
+		written, err := writeMessage(ctx, tx, insert, msg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store message %d of the batch: %w", i, err)
+		}
+		if !written {
+			skipped++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return skipped, nil
+}
+
+// sqlExecer executes statements on a database or within a transaction
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// writeMessage stores a message that already has an ID with an INSERT statement, such as INSERT OR IGNORE,
+// filling in its defaults. A message with the hash of a stored one is skipped. It reports whether a row was written.
+func writeMessage(ctx context.Context, db sqlExecer, insert string, msg *Message) (bool, error) {
 	// Set the timestamp if not already set
 	if msg.Timestamp.IsZero() {
 		msg.Timestamp = time.Now()
 	}
 
-	// Convert payload to JSON if it's not a string or []byte
-	var payload interface{}
-	switch p := msg.Payload.(type) {
-	case string:
-		payload = p
-	case []byte:
-		payload = p
-	default:
-		// For other types, convert to JSON
-		jsonBytes, err := json.Marshal(p)
-		if err != nil {
-			return fmt.Errorf("failed to marshal payload to JSON: %w", err)
-		}
-		payload = jsonBytes
+	// Messages stored without a status were already delivered
+	if msg.Status == "" {
+		msg.Status = MessageStatusDelivered
+	}
+
+	// Strings and byte slices are stored byte-for-byte, other payloads as JSON
+	payload, contentType, err := EncodePayload(msg.Payload)
+	if err != nil {
+		return false, err
+	}
+	msg.ContentType = contentType
+
+	// Messages without a hash aren't deduplicated
+	var hash sql.NullString
+	if msg.Hash != "" {
+		hash = sql.NullString{String: msg.Hash, Valid: true}
 	}
 
 	// Insert the message
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO messages (id, topic, payload, qos, retained, timestamp, confirmed) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		msg.ID, msg.Topic, payload, msg.QoS, boolToInt(msg.Retained), msg.Timestamp, boolToInt(msg.Confirmed))
+	result, err := db.ExecContext(ctx,
+		insert+` INTO messages (id, topic, payload, qos, retained, timestamp, confirmed, status, content_type, original_topic, hash) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) 
+		 ON CONFLICT(hash) DO NOTHING`,
+		msg.ID, msg.Topic, payload, msg.QoS, boolToInt(msg.Retained), msg.Timestamp, boolToInt(msg.Confirmed), msg.Status, msg.ContentType, msg.OriginalTopic, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to insert message: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already present
+func addColumnIfMissing(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return fmt.Errorf("failed to insert message: %w", err)
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect %s table: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
 	}
 
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s column to %s table: %w", column, table, err)
+	}
 	return nil
 }
 
 // GetMessages retrieves messages from the database
-func (s *SQLiteDatabase) GetMessages(ctx context.Context, confirmed bool, limit int) ([]*Message, error) {
+func (s *SQLiteDatabase) GetMessages(ctx context.Context, confirmed bool, status string, limit int) ([]*Message, error) {
 	if s.db == nil {
 		return nil, ErrConnectionFailed
 	}
@@ -201,44 +536,165 @@ func (s *SQLiteDatabase) GetMessages(ctx context.Context, confirmed bool, limit
 
 	// Query the database
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, topic, payload, qos, retained, timestamp, confirmed 
+		`SELECT id, topic, payload, qos, retained, timestamp, confirmed, status, content_type, original_topic 
 		 FROM messages 
-		 WHERE confirmed = ? 
+		 WHERE confirmed = ? AND (? = '' OR status = ?) 
 		 ORDER BY timestamp DESC 
 		 LIMIT ?`,
-		boolToInt(confirmed), limit)
+		boolToInt(confirmed), status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetMessagesByTopicPrefix retrieves messages whose topic starts with the given prefix
+func (s *SQLiteDatabase) GetMessagesByTopicPrefix(ctx context.Context, prefix string, confirmed bool, status string, limit int) ([]*Message, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Query the database, comparing the prefix exactly since LIKE is case-insensitive in SQLite
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, topic, payload, qos, retained, timestamp, confirmed, status, content_type, original_topic 
+		 FROM messages 
+		 WHERE confirmed = ? AND substr(topic, 1, ?) = ? AND (? = '' OR status = ?) 
+		 ORDER BY timestamp DESC 
+		 LIMIT ?`,
+		boolToInt(confirmed), len([]rune(prefix)), prefix, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetMessagesByTopicFilter retrieves messages whose topic matches an MQTT topic filter, which may contain wildcards
+func (s *SQLiteDatabase) GetMessagesByTopicFilter(ctx context.Context, filter string, limit int) ([]*Message, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Fetch candidates sharing the filter's literal prefix and match the wildcards in Go
+	prefix := topicFilterPrefix(filter)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, topic, payload, qos, retained, timestamp, confirmed, status, content_type, original_topic 
+		 FROM messages 
+		 WHERE substr(topic, 1, ?) = ? 
+		 ORDER BY timestamp DESC`,
+		len([]rune(prefix)), prefix)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
 	defer rows.Close()
 
-	// Parse the results
 	var messages []*Message
-	for rows.Next() {
-		var msg Message
-		var retained, confirmed int
-		var payload []byte
-		var timestamp string
+	for len(messages) < limit && rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		if utils.TopicMatchesFilter(msg.Topic, filter) {
+			messages = append(messages, msg)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// ExportMessages calls fn with every message matching the filter in the order they were stored, querying them in
+// chunks. Each chunk is read completely before fn is called, so a slow consumer doesn't hold the database open.
+func (s *SQLiteDatabase) ExportMessages(ctx context.Context, filter MessageFilter, fn func(*Message) error) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Confirmation and the topic filter's literal prefix are checked in the query, the rest in Go
+	confirmed := -1
+	if filter.Confirmed != nil {
+		confirmed = boolToInt(*filter.Confirmed)
+	}
+	prefix := topicFilterPrefix(filter.Topic)
 
-		if err := rows.Scan(&msg.ID, &msg.Topic, &payload, &msg.QoS, &retained, &timestamp, &confirmed); err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
+	var lastRowID int64
+	for {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT rowid, id, topic, payload, qos, retained, timestamp, confirmed, status, content_type, original_topic 
+			 FROM messages 
+			 WHERE rowid > ? AND (? = -1 OR confirmed = ?) AND substr(topic, 1, ?) = ? 
+			 ORDER BY rowid 
+			 LIMIT ?`,
+			lastRowID, confirmed, confirmed, len([]rune(prefix)), prefix, exportChunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to query messages: %w", err)
 		}
 
-		// Parse the timestamp
-		t, err := time.Parse("2006-01-02 15:04:05", timestamp)
+		var chunk []*Message
+		for rows.Next() {
+			msg, err := scanMessage(rowIDScanner{rows: rows, rowID: &lastRowID})
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			chunk = append(chunk, msg)
+		}
+		err = rows.Err()
+		rows.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+			return fmt.Errorf("error iterating messages: %w", err)
 		}
-		msg.Timestamp = t
 
-		// Set the boolean fields
-		msg.Retained = intToBool(retained)
-		msg.Confirmed = intToBool(confirmed)
+		for _, msg := range chunk {
+			if !filter.Matches(msg) {
+				continue
+			}
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		if len(chunk) < exportChunkSize {
+			return nil
+		}
+	}
+}
+
+// rowIDScanner scans a message row preceded by its rowid
+type rowIDScanner struct {
+	rows  *sql.Rows
+	rowID *int64
+}
 
-		// Set the payload
-		msg.Payload = payload
+// Scan scans the rowid, then the message columns into dest
+func (r rowIDScanner) Scan(dest ...interface{}) error {
+	return r.rows.Scan(append([]interface{}{r.rowID}, dest...)...)
+}
 
-		messages = append(messages, &msg)
+// scanMessages parses message rows
+func scanMessages(rows *sql.Rows) ([]*Message, error) {
+	var messages []*Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -248,26 +704,19 @@ func (s *SQLiteDatabase) GetMessages(ctx context.Context, confirmed bool, limit
 	return messages, nil
 }
 
-// GetMessageByID retrieves a message by its ID
-func (s *SQLiteDatabase) GetMessageByID(ctx context.Context, id string) (*Message, error) {
-	if s.db == nil {
-		return nil, ErrConnectionFailed
-	}
-
-	// Query the database
-	row := s.db.QueryRowContext(ctx,
-		`SELECT id, topic, payload, qos, retained, timestamp, confirmed 
-		 FROM messages 
-		 WHERE id = ?`,
-		id)
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	// Parse the result
+// scanMessage parses the current message row
+func scanMessage(row rowScanner) (*Message, error) {
 	var msg Message
 	var retained, confirmed int
 	var payload []byte
 	var timestamp string
 
-	if err := row.Scan(&msg.ID, &msg.Topic, &payload, &msg.QoS, &retained, &timestamp, &confirmed); err != nil {
+	if err := row.Scan(&msg.ID, &msg.Topic, &payload, &msg.QoS, &retained, &timestamp, &confirmed, &msg.Status, &msg.ContentType, &msg.OriginalTopic); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrMessageNotFound
 		}
@@ -275,7 +724,7 @@ func (s *SQLiteDatabase) GetMessageByID(ctx context.Context, id string) (*Messag
 	}
 
 	// Parse the timestamp
-	t, err := time.Parse("2006-01-02 15:04:05", timestamp)
+	t, err := parseTimestamp(timestamp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
 	}
@@ -286,11 +735,47 @@ func (s *SQLiteDatabase) GetMessageByID(ctx context.Context, id string) (*Messag
 	msg.Confirmed = intToBool(confirmed)
 
 	// Set the payload
-	msg.Payload = payload
+	msg.Payload, msg.ContentType = DecodePayload(payload, msg.ContentType)
 
 	return &msg, nil
 }
 
+// timestampLayouts are the formats message timestamps may be stored in
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+}
+
+// parseTimestamp parses a stored message timestamp
+func parseTimestamp(value string) (time.Time, error) {
+	var err error
+	for _, layout := range timestampLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// GetMessageByID retrieves a message by its ID
+func (s *SQLiteDatabase) GetMessageByID(ctx context.Context, id string) (*Message, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Query the database
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, topic, payload, qos, retained, timestamp, confirmed, status, content_type, original_topic 
+		 FROM messages 
+		 WHERE id = ?`,
+		id)
+
+	// Parse the result
+	return scanMessage(row)
+}
+
 // ConfirmMessage marks a message as confirmed
 func (s *SQLiteDatabase) ConfirmMessage(ctx context.Context, id string) error {
 	if s.db == nil {
@@ -317,6 +802,32 @@ func (s *SQLiteDatabase) ConfirmMessage(ctx context.Context, id string) error {
 	return nil
 }
 
+// UpdateMessageStatus sets the delivery status of a message
+func (s *SQLiteDatabase) UpdateMessageStatus(ctx context.Context, id string, status string) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Update the message
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE messages SET status = ? WHERE id = ?`,
+		status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+
+	// Check if the message was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
+
 // DeleteMessage deletes a message from the database
 func (s *SQLiteDatabase) DeleteMessage(ctx context.Context, id string) error {
 	if s.db == nil {
@@ -413,13 +924,18 @@ func (s *SQLiteDatabase) StoreWebhook(ctx context.Context, webhook *models.Webho
 	if err != nil {
 		return fmt.Errorf("failed to marshal headers to JSON: %w", err)
 	}
+	conditionJSON, err := json.Marshal(webhook.Condition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload condition to JSON: %w", err)
+	}
 
 	// Insert the webhook
 	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO webhooks (id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO webhooks (id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at, secret, body_template, content_type, min_qos, payload_condition, namespace) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		webhook.ID, webhook.Name, webhook.URL, webhook.Method, webhook.TopicFilter, boolToInt(webhook.Enabled),
-		headersJSON, webhook.Timeout, webhook.RetryCount, webhook.RetryDelay, webhook.CreatedAt, webhook.UpdatedAt)
+		headersJSON, webhook.Timeout, webhook.RetryCount, webhook.RetryDelay, webhook.CreatedAt, webhook.UpdatedAt, webhook.Secret,
+		webhook.BodyTemplate, webhook.ContentType, webhook.MinQoS, conditionJSON, webhook.Namespace)
 	if err != nil {
 		return fmt.Errorf("failed to insert webhook: %w", err)
 	}
@@ -440,7 +956,7 @@ func (s *SQLiteDatabase) GetWebhooks(ctx context.Context, limit int) ([]*models.
 
 	// Query the database
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at 
+		`SELECT id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at, COALESCE(secret, ''), COALESCE(body_template, ''), COALESCE(content_type, ''), min_qos, COALESCE(payload_condition, ''), COALESCE(namespace, '') 
 		 FROM webhooks 
 		 ORDER BY created_at DESC 
 		 LIMIT ?`,
@@ -455,11 +971,12 @@ func (s *SQLiteDatabase) GetWebhooks(ctx context.Context, limit int) ([]*models.
 	for rows.Next() {
 		var webhook models.Webhook
 		var enabled int
-		var headersJSON []byte
+		var headersJSON, conditionJSON []byte
 		var createdAt, updatedAt string
 
 		if err := rows.Scan(&webhook.ID, &webhook.Name, &webhook.URL, &webhook.Method, &webhook.TopicFilter, &enabled,
-			&headersJSON, &webhook.Timeout, &webhook.RetryCount, &webhook.RetryDelay, &createdAt, &updatedAt); err != nil {
+			&headersJSON, &webhook.Timeout, &webhook.RetryCount, &webhook.RetryDelay, &createdAt, &updatedAt, &webhook.Secret, &webhook.BodyTemplate, &webhook.ContentType,
+			&webhook.MinQoS, &conditionJSON, &webhook.Namespace); err != nil {
 			return nil, fmt.Errorf("failed to scan webhook: %w", err)
 		}
 
@@ -492,6 +1009,13 @@ func (s *SQLiteDatabase) GetWebhooks(ctx context.Context, limit int) ([]*models.
 			}
 		}
 
+		// Parse the payload condition
+		if len(conditionJSON) > 0 {
+			if err := json.Unmarshal(conditionJSON, &webhook.Condition); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal payload condition: %w", err)
+			}
+		}
+
 		webhooks = append(webhooks, &webhook)
 	}
 
@@ -510,7 +1034,7 @@ func (s *SQLiteDatabase) GetWebhookByID(ctx context.Context, id string) (*models
 
 	// Query the database
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at 
+		`SELECT id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at, COALESCE(secret, ''), COALESCE(body_template, ''), COALESCE(content_type, ''), min_qos, COALESCE(payload_condition, ''), COALESCE(namespace, '') 
 		 FROM webhooks 
 		 WHERE id = ?`,
 		id)
@@ -518,11 +1042,12 @@ func (s *SQLiteDatabase) GetWebhookByID(ctx context.Context, id string) (*models
 	// Parse the result
 	var webhook models.Webhook
 	var enabled int
-	var headersJSON []byte
+	var headersJSON, conditionJSON []byte
 	var createdAt, updatedAt string
 
 	if err := row.Scan(&webhook.ID, &webhook.Name, &webhook.URL, &webhook.Method, &webhook.TopicFilter, &enabled,
-		&headersJSON, &webhook.Timeout, &webhook.RetryCount, &webhook.RetryDelay, &createdAt, &updatedAt); err != nil {
+		&headersJSON, &webhook.Timeout, &webhook.RetryCount, &webhook.RetryDelay, &createdAt, &updatedAt, &webhook.Secret, &webhook.BodyTemplate, &webhook.ContentType,
+		&webhook.MinQoS, &conditionJSON, &webhook.Namespace); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrMessageNotFound
 		}
@@ -559,6 +1084,13 @@ func (s *SQLiteDatabase) GetWebhookByID(ctx context.Context, id string) (*models
 		}
 	}
 
+	// Parse the payload condition
+	if len(conditionJSON) > 0 {
+		if err := json.Unmarshal(conditionJSON, &webhook.Condition); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payload condition: %w", err)
+		}
+	}
+
 	return &webhook, nil
 }
 
@@ -576,15 +1108,21 @@ func (s *SQLiteDatabase) UpdateWebhook(ctx context.Context, webhook *models.Webh
 	if err != nil {
 		return fmt.Errorf("failed to marshal headers to JSON: %w", err)
 	}
+	conditionJSON, err := json.Marshal(webhook.Condition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload condition to JSON: %w", err)
+	}
 
 	// Update the webhook
 	result, err := s.db.ExecContext(ctx,
 		`UPDATE webhooks 
 		 SET name = ?, url = ?, method = ?, topic_filter = ?, enabled = ?, headers = ?, 
-		     timeout = ?, retry_count = ?, retry_delay = ?, updated_at = ? 
+		     timeout = ?, retry_count = ?, retry_delay = ?, updated_at = ?, secret = ?, 
+		     body_template = ?, content_type = ?, min_qos = ?, payload_condition = ? 
 		 WHERE id = ?`,
 		webhook.Name, webhook.URL, webhook.Method, webhook.TopicFilter, boolToInt(webhook.Enabled),
-		headersJSON, webhook.Timeout, webhook.RetryCount, webhook.RetryDelay, webhook.UpdatedAt, webhook.ID)
+		headersJSON, webhook.Timeout, webhook.RetryCount, webhook.RetryDelay, webhook.UpdatedAt, webhook.Secret,
+		webhook.BodyTemplate, webhook.ContentType, webhook.MinQoS, conditionJSON, webhook.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update webhook: %w", err)
 	}
@@ -629,13 +1167,25 @@ func (s *SQLiteDatabase) DeleteWebhook(ctx context.Context, id string) error {
 
 // GetWebhooksByTopicFilter retrieves webhooks that match a topic
 func (s *SQLiteDatabase) GetWebhooksByTopicFilter(ctx context.Context, topic string) ([]*models.Webhook, error) {
+	return s.getEnabledWebhooks(ctx, func(topicFilter string) bool {
+		return utils.TopicMatchesFilter(topic, topicFilter)
+	})
+}
+
+// GetEnabledWebhooks retrieves all enabled webhooks, newest first
+func (s *SQLiteDatabase) GetEnabledWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	return s.getEnabledWebhooks(ctx, nil)
+}
+
+// getEnabledWebhooks retrieves the enabled webhooks whose topic filter is accepted by match, or all of them if match is nil
+func (s *SQLiteDatabase) getEnabledWebhooks(ctx context.Context, match func(topicFilter string) bool) ([]*models.Webhook, error) {
 	if s.db == nil {
 		return nil, ErrConnectionFailed
 	}
 
 	// Get all enabled webhooks
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at 
+		`SELECT id, name, url, method, topic_filter, enabled, headers, timeout, retry_count, retry_delay, created_at, updated_at, COALESCE(secret, ''), COALESCE(body_template, ''), COALESCE(content_type, ''), min_qos, COALESCE(payload_condition, ''), COALESCE(namespace, '') 
 		 FROM webhooks 
 		 WHERE enabled = 1
 		 ORDER BY created_at DESC`)
@@ -649,16 +1199,17 @@ func (s *SQLiteDatabase) GetWebhooksByTopicFilter(ctx context.Context, topic str
 	for rows.Next() {
 		var webhook models.Webhook
 		var enabled int
-		var headersJSON []byte
+		var headersJSON, conditionJSON []byte
 		var createdAt, updatedAt string
 
 		if err := rows.Scan(&webhook.ID, &webhook.Name, &webhook.URL, &webhook.Method, &webhook.TopicFilter, &enabled,
-			&headersJSON, &webhook.Timeout, &webhook.RetryCount, &webhook.RetryDelay, &createdAt, &updatedAt); err != nil {
+			&headersJSON, &webhook.Timeout, &webhook.RetryCount, &webhook.RetryDelay, &createdAt, &updatedAt, &webhook.Secret, &webhook.BodyTemplate, &webhook.ContentType,
+			&webhook.MinQoS, &conditionJSON, &webhook.Namespace); err != nil {
 			return nil, fmt.Errorf("failed to scan webhook: %w", err)
 		}
 
 		// Check if the topic matches the filter
-		if !utils.TopicMatchesFilter(topic, webhook.TopicFilter) {
+		if match != nil && !match(webhook.TopicFilter) {
 			continue
 		}
 
@@ -691,6 +1242,13 @@ func (s *SQLiteDatabase) GetWebhooksByTopicFilter(ctx context.Context, topic str
 			}
 		}
 
+		// Parse the payload condition
+		if len(conditionJSON) > 0 {
+			if err := json.Unmarshal(conditionJSON, &webhook.Condition); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal payload condition: %w", err)
+			}
+		}
+
 		webhooks = append(webhooks, &webhook)
 	}
 
@@ -700,3 +1258,581 @@ func (s *SQLiteDatabase) GetWebhooksByTopicFilter(ctx context.Context, topic str
 
 	return webhooks, nil
 }
+
+// StoreWebhookDelivery stores a webhook delivery record in the database
+func (s *SQLiteDatabase) StoreWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if delivery.ID == "" {
+		delivery.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	// Set timestamps if not already set
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	if delivery.UpdatedAt.IsZero() {
+		delivery.UpdatedAt = delivery.CreatedAt
+	}
+
+	// Insert the delivery
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (id, webhook_id, topic, payload, status, attempts, last_error, next_retry_at, created_at, updated_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID, delivery.WebhookID, delivery.Topic, delivery.Payload, delivery.Status, delivery.Attempts,
+		delivery.LastError, nullableTime(delivery.NextRetryAt), delivery.CreatedAt.UTC(), delivery.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateWebhookDelivery updates the status of a webhook delivery record
+func (s *SQLiteDatabase) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Update the timestamp
+	delivery.UpdatedAt = time.Now()
+
+	// Update the delivery
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries 
+		 SET status = ?, attempts = ?, last_error = ?, next_retry_at = ?, updated_at = ? 
+		 WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.LastError, nullableTime(delivery.NextRetryAt),
+		delivery.UpdatedAt.UTC(), delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	// Check if the delivery was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveryByID retrieves a webhook delivery record by its ID
+func (s *SQLiteDatabase) GetWebhookDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Query the database
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, webhook_id, topic, payload, status, attempts, COALESCE(last_error, ''), next_retry_at, created_at, updated_at 
+		 FROM webhook_deliveries 
+		 WHERE id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook delivery: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+
+	return deliveries[0], nil
+}
+
+// GetWebhookDeliveries retrieves the most recent delivery records of a webhook
+func (s *SQLiteDatabase) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Query the database
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, webhook_id, topic, payload, status, attempts, COALESCE(last_error, ''), next_retry_at, created_at, updated_at 
+		 FROM webhook_deliveries 
+		 WHERE webhook_id = ? 
+		 ORDER BY created_at DESC 
+		 LIMIT ?`,
+		webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// GetDueWebhookDeliveries retrieves pending deliveries whose next retry is due at or before the given time
+func (s *SQLiteDatabase) GetDueWebhookDeliveries(ctx context.Context, before time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Query the database, oldest retry first
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, webhook_id, topic, payload, status, attempts, COALESCE(last_error, ''), next_retry_at, created_at, updated_at 
+		 FROM webhook_deliveries 
+		 WHERE status = ? 
+		 ORDER BY next_retry_at ASC 
+		 LIMIT ?`,
+		models.DeliveryStatusPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only deliveries that are due
+	due := make([]*models.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if !delivery.NextRetryAt.After(before) {
+			due = append(due, delivery)
+		}
+	}
+
+	return due, nil
+}
+
+// DeleteWebhookDeliveriesBefore deletes delivered and failed deliveries last updated before the given time
+func (s *SQLiteDatabase) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	if s.db == nil {
+		return 0, ErrConnectionFailed
+	}
+
+	// Delete the deliveries
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM webhook_deliveries WHERE status IN (?, ?) AND updated_at < ?`,
+		models.DeliveryStatusDelivered, models.DeliveryStatusFailed, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	// Get the number of deleted deliveries
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// scanWebhookDeliveries parses webhook delivery rows
+func scanWebhookDeliveries(rows *sql.Rows) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var nextRetryAt sql.NullString
+		var createdAt, updatedAt string
+
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Topic, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &delivery.LastError, &nextRetryAt, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+
+		// Parse timestamps
+		var err error
+		if nextRetryAt.Valid && nextRetryAt.String != "" {
+			if delivery.NextRetryAt, err = parseTimestamp(nextRetryAt.String); err != nil {
+				return nil, fmt.Errorf("failed to parse next_retry_at timestamp: %w", err)
+			}
+		}
+		if delivery.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at timestamp: %w", err)
+		}
+		if delivery.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse updated_at timestamp: %w", err)
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// nullableTime converts a zero time to NULL and stores other times in UTC
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// StoreScheduledMessage stores a message to be published later
+func (s *SQLiteDatabase) StoreScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Generate an ID if one is not provided
+	if msg.ID == "" {
+		msg.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	// Set timestamps if not already set
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	if msg.UpdatedAt.IsZero() {
+		msg.UpdatedAt = msg.CreatedAt
+	}
+
+	// Insert the scheduled message
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO scheduled_messages (id, topic, payload, qos, retained, broker, publish_at, status, last_error, created_at, updated_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.ID, msg.Topic, string(msg.Payload), msg.QoS, boolToInt(msg.Retained), msg.Broker, msg.PublishAt.UTC(),
+		msg.Status, msg.LastError, msg.CreatedAt.UTC(), msg.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert scheduled message: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateScheduledMessage updates the status of a scheduled message
+func (s *SQLiteDatabase) UpdateScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Update the timestamp
+	msg.UpdatedAt = time.Now()
+
+	// Update the scheduled message
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_messages 
+		 SET status = ?, last_error = ?, updated_at = ? 
+		 WHERE id = ?`,
+		msg.Status, msg.LastError, msg.UpdatedAt.UTC(), msg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update scheduled message: %w", err)
+	}
+
+	// Check if the scheduled message was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrScheduledMessageNotFound
+	}
+
+	return nil
+}
+
+// GetScheduledMessageByID retrieves a scheduled message by its ID
+func (s *SQLiteDatabase) GetScheduledMessageByID(ctx context.Context, id string) (*models.ScheduledMessage, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Query the database
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, topic, payload, qos, retained, broker, publish_at, status, COALESCE(last_error, ''), created_at, updated_at 
+		 FROM scheduled_messages 
+		 WHERE id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled message: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanScheduledMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrScheduledMessageNotFound
+	}
+
+	return messages[0], nil
+}
+
+// GetScheduledMessages retrieves scheduled messages, soonest first
+func (s *SQLiteDatabase) GetScheduledMessages(ctx context.Context, limit int) ([]*models.ScheduledMessage, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Query the database
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, topic, payload, qos, retained, broker, publish_at, status, COALESCE(last_error, ''), created_at, updated_at 
+		 FROM scheduled_messages 
+		 ORDER BY publish_at ASC 
+		 LIMIT ?`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+// GetDueScheduledMessages retrieves pending scheduled messages whose publish time is at or before the given time
+func (s *SQLiteDatabase) GetDueScheduledMessages(ctx context.Context, before time.Time, limit int) ([]*models.ScheduledMessage, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Default limit if not specified
+	if limit <= 0 {
+		limit = 100
+	}
+
+	// Query the database, soonest first
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, topic, payload, qos, retained, broker, publish_at, status, COALESCE(last_error, ''), created_at, updated_at 
+		 FROM scheduled_messages 
+		 WHERE status = ? 
+		 ORDER BY publish_at ASC 
+		 LIMIT ?`,
+		models.ScheduledStatusPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanScheduledMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only messages that are due
+	due := make([]*models.ScheduledMessage, 0, len(messages))
+	for _, msg := range messages {
+		if !msg.PublishAt.After(before) {
+			due = append(due, msg)
+		}
+	}
+
+	return due, nil
+}
+
+// DeleteScheduledMessage deletes a scheduled message
+func (s *SQLiteDatabase) DeleteScheduledMessage(ctx context.Context, id string) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Delete the scheduled message
+	result, err := s.db.ExecContext(ctx, `DELETE FROM scheduled_messages WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+
+	// Check if the scheduled message was found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrScheduledMessageNotFound
+	}
+
+	return nil
+}
+
+// scanScheduledMessages parses scheduled message rows
+func scanScheduledMessages(rows *sql.Rows) ([]*models.ScheduledMessage, error) {
+	var messages []*models.ScheduledMessage
+	for rows.Next() {
+		var msg models.ScheduledMessage
+		var payload string
+		var retained int
+		var publishAt, createdAt, updatedAt string
+
+		if err := rows.Scan(&msg.ID, &msg.Topic, &payload, &msg.QoS, &retained, &msg.Broker, &publishAt,
+			&msg.Status, &msg.LastError, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled message: %w", err)
+		}
+
+		msg.Payload = json.RawMessage(payload)
+		msg.Retained = intToBool(retained)
+
+		// Parse timestamps
+		var err error
+		if msg.PublishAt, err = parseTimestamp(publishAt); err != nil {
+			return nil, fmt.Errorf("failed to parse publish_at timestamp: %w", err)
+		}
+		if msg.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at timestamp: %w", err)
+		}
+		if msg.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse updated_at timestamp: %w", err)
+		}
+
+		messages = append(messages, &msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// StoreIdempotencyRecord stores the outcome of a request made with an idempotency key, purging expired keys
+func (s *SQLiteDatabase) StoreIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Set the timestamp if not already set
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	// Purge expired keys
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to purge expired idempotency keys: %w", err)
+	}
+
+	// Insert the record, replacing any previous one with the same key
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO idempotency_keys (key, request_hash, status_code, response, created_at, expires_at) 
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		record.Key, record.RequestHash, record.StatusCode, record.Response, record.CreatedAt.UTC(), record.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to insert idempotency record: %w", err)
+	}
+
+	return nil
+}
+
+// GetIdempotencyRecord retrieves the unexpired record of an idempotency key
+func (s *SQLiteDatabase) GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	// Query the database
+	var record IdempotencyRecord
+	var createdAt string
+	var expiresAt int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT key, request_hash, status_code, response, created_at, expires_at 
+		 FROM idempotency_keys 
+		 WHERE key = ? AND expires_at > ?`,
+		key, time.Now().Unix()).Scan(&record.Key, &record.RequestHash, &record.StatusCode, &record.Response, &createdAt, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrIdempotencyRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to query idempotency record: %w", err)
+	}
+
+	if record.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("failed to parse created_at timestamp: %w", err)
+	}
+	record.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return &record, nil
+}
+
+// StoreSubscription stores a subscription, replacing any existing one to the same topic on the same broker
+func (s *SQLiteDatabase) StoreSubscription(ctx context.Context, subscription *models.Subscription) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	// Set the timestamp if not already set
+	if subscription.CreatedAt.IsZero() {
+		subscription.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO subscriptions (broker, topic, qos, created_at) 
+		 VALUES (?, ?, ?, ?)`,
+		subscription.Broker, subscription.Topic, subscription.QoS, subscription.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert subscription: %w", err)
+	}
+
+	return nil
+}
+
+// GetSubscriptions retrieves all stored subscriptions, oldest first
+func (s *SQLiteDatabase) GetSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	if s.db == nil {
+		return nil, ErrConnectionFailed
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT broker, topic, qos, created_at 
+		 FROM subscriptions 
+		 ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.Subscription
+	for rows.Next() {
+		var subscription models.Subscription
+		var createdAt string
+
+		if err := rows.Scan(&subscription.Broker, &subscription.Topic, &subscription.QoS, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		if subscription.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at timestamp: %w", err)
+		}
+
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription deletes a stored subscription
+func (s *SQLiteDatabase) DeleteSubscription(ctx context.Context, broker, topic string) error {
+	if s.db == nil {
+		return ErrConnectionFailed
+	}
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE broker = ? AND topic = ?`, broker, topic)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteDatabase creates a connected SQLite database in a temporary directory
+func newTestSQLiteDatabase(tb testing.TB) Database {
+	tb.Helper()
+	return connectTestDatabase(tb, &Config{Type: "sqlite"})
+}
+
+// connectTestDatabase creates a connected database, with its SQLite file in a temporary directory
+func connectTestDatabase(tb testing.TB, config *Config) Database {
+	tb.Helper()
+
+	config.SQLite.Path = filepath.Join(tb.TempDir(), "messages.db")
+	db, err := New(config)
+	if err != nil {
+		tb.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Connect(context.Background()); err != nil {
+		tb.Fatalf("Failed to connect to database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close(context.Background()) })
+	return db
+}
+
+// testMessages returns n messages to store
+func testMessages(n int) []*Message {
+	msgs := make([]*Message, n)
+	for i := range msgs {
+		msgs[i] = &Message{Topic: fmt.Sprintf("sensors/%d/temp", i), Payload: map[string]interface{}{"value": i}, QoS: 1}
+	}
+	return msgs
+}
+
+func TestSQLiteStoreMessages(t *testing.T) {
+	db := newTestSQLiteDatabase(t)
+	ctx := context.Background()
+
+	msgs := testMessages(50)
+	if err := db.StoreMessages(ctx, msgs); err != nil {
+		t.Fatalf("Failed to store messages: %v", err)
+	}
+
+	ids := make(map[string]bool)
+	for _, msg := range msgs {
+		if msg.ID == "" || ids[msg.ID] {
+			t.Fatalf("Expected every message to get a unique ID, got '%s'", msg.ID)
+		}
+		ids[msg.ID] = true
+	}
+
+	stored, err := db.GetMessages(ctx, false, "", 100)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(stored) != len(msgs) {
+		t.Errorf("Expected %d stored messages, got %d", len(msgs), len(stored))
+	}
+}
+
+func TestSQLiteExportMessagesAcrossChunks(t *testing.T) {
+	db := newTestSQLiteDatabase(t)
+	ctx := context.Background()
+
+	// Enough messages to span several chunks, every tenth one confirmed
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := testMessages(2*exportChunkSize + 50)
+	for i, msg := range msgs {
+		msg.Timestamp = start.Add(time.Duration(i) * time.Second)
+		msg.Confirmed = i%10 == 0
+	}
+	msgs[151].Topic = "alerts/151"
+	if err := db.StoreMessages(ctx, msgs); err != nil {
+		t.Fatalf("Failed to store messages: %v", err)
+	}
+
+	unconfirmed := false
+	filter := MessageFilter{Confirmed: &unconfirmed, Since: start.Add(100 * time.Second), Topic: "sensors/+/temp"}
+	var exported []*Message
+	err := db.ExportMessages(ctx, filter, func(msg *Message) error {
+		exported = append(exported, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to export messages: %v", err)
+	}
+
+	var expected []string
+	for _, msg := range msgs[100:] {
+		if !msg.Confirmed && msg.Topic != "alerts/151" {
+			expected = append(expected, msg.ID)
+		}
+	}
+	if len(exported) != len(expected) {
+		t.Fatalf("Expected %d exported messages, got %d", len(expected), len(exported))
+	}
+	for i, msg := range exported {
+		if msg.ID != expected[i] {
+			t.Fatalf("Expected message %s at position %d of the export, got %s", expected[i], i, msg.ID)
+		}
+	}
+
+	// Errors from the callback stop the export
+	stop := errors.New("stop")
+	calls := 0
+	err = db.ExportMessages(ctx, MessageFilter{}, func(msg *Message) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Expected the export to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestSQLiteStoreMessagesRollsBackOnFailure(t *testing.T) {
+	db := newTestSQLiteDatabase(t)
+	ctx := context.Background()
+
+	existing := &Message{ID: "duplicate", Topic: "sensors/temp", Payload: "21.5"}
+	if err := db.StoreMessage(ctx, existing); err != nil {
+		t.Fatalf("Failed to store message: %v", err)
+	}
+
+	// The last message reuses an existing ID, so the whole batch must be rolled back
+	msgs := append(testMessages(3), &Message{ID: "duplicate", Topic: "sensors/temp", Payload: "22.0"})
+	if err := db.StoreMessages(ctx, msgs); err == nil {
+		t.Fatal("Expected storing a duplicate ID to fail")
+	}
+
+	stored, err := db.GetMessages(ctx, false, "", 100)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Errorf("Expected only the existing message after the rollback, got %d messages", len(stored))
+	}
+}
+
+func TestSQLiteDeduplicatesMessages(t *testing.T) {
+	config := &Config{Type: "sqlite", Dedup: true, DedupWindow: time.Minute}
+	db := connectTestDatabase(t, config)
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.StoreMessage(ctx, &Message{Topic: "sensors/temp", Payload: "21.5", QoS: 1, Timestamp: start}); err != nil {
+		t.Fatalf("Failed to store message: %v", err)
+	}
+
+	// The same message stored again within the window is skipped
+	duplicate := &Message{Topic: "sensors/temp", Payload: "21.5", QoS: 1, Timestamp: start.Add(10 * time.Second)}
+	if err := db.StoreMessage(ctx, duplicate); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("Expected a duplicate message error, got %v", err)
+	}
+
+	// In a batch, duplicates are skipped and the other messages stored
+	batch := []*Message{
+		{Topic: "sensors/temp", Payload: "21.5", QoS: 1, Timestamp: start.Add(20 * time.Second)},
+		{Topic: "sensors/temp", Payload: "21.5", QoS: 2, Timestamp: start.Add(20 * time.Second)},
+		{Topic: "sensors/temp", Payload: "22.0", QoS: 1, Timestamp: start.Add(20 * time.Second)},
+		{Topic: "sensors/temp", Payload: "21.5", QoS: 1, Timestamp: start.Add(time.Minute)},
+	}
+	var batchErr *BatchError
+	if err := db.StoreMessages(ctx, batch); !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a batch error, got %v", err)
+	}
+	if len(batchErr.Failed) != 1 || !errors.Is(batchErr.Failed[0], ErrDuplicateMessage) {
+		t.Errorf("Expected only the first message of the batch to be a duplicate, got %v", batchErr.Failed)
+	}
+
+	stored, err := db.GetMessages(ctx, false, "", 100)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(stored) != 4 {
+		t.Errorf("Expected 4 stored messages, got %d", len(stored))
+	}
+
+	// Without deduplication, identical messages are all stored
+	db = newTestSQLiteDatabase(t)
+	for i := 0; i < 2; i++ {
+		if err := db.StoreMessage(ctx, &Message{Topic: "sensors/temp", Payload: "21.5", QoS: 1, Timestamp: start}); err != nil {
+			t.Fatalf("Failed to store message: %v", err)
+		}
+	}
+	if stored, err := db.GetMessages(ctx, false, "", 100); err != nil || len(stored) != 2 {
+		t.Errorf("Expected 2 stored messages without deduplication, got %d (%v)", len(stored), err)
+	}
+}
+
+func TestSQLiteConcurrentWritesAndDeletes(t *testing.T) {
+	db := newTestSQLiteDatabase(t)
+	ctx := context.Background()
+
+	var journalMode string
+	if err := db.(*SQLiteDatabase).db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatalf("Failed to read the journal mode: %v", err)
+	}
+	if journalMode != DefaultSQLiteJournalMode {
+		t.Errorf("Expected journal mode %s, got %s", DefaultSQLiteJournalMode, journalMode)
+	}
+
+	// Writers store, confirm, and batch messages while a purger deletes the confirmed ones, as a publish storm
+	// racing DELETE /messages/confirmed would
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter+1)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				msg := &Message{ID: fmt.Sprintf("%d-%d", w, i), Topic: "sensors/temp", Payload: i}
+				if err := db.StoreMessage(ctx, msg); err != nil {
+					errs <- fmt.Errorf("store: %w", err)
+					return
+				}
+				if i%2 == 0 {
+					if err := db.ConfirmMessage(ctx, msg.ID); err != nil {
+						errs <- fmt.Errorf("confirm: %w", err)
+						return
+					}
+				}
+				if i%10 == 0 {
+					if err := db.StoreMessages(ctx, testMessages(5)); err != nil {
+						errs <- fmt.Errorf("store batch: %w", err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	purged := make(chan struct{})
+	go func() {
+		defer close(purged)
+		for {
+			if _, err := db.DeleteConfirmedMessages(ctx); err != nil {
+				errs <- fmt.Errorf("delete: %w", err)
+				return
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	<-purged
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Only the unconfirmed messages and batches are left once the last purge has run
+	if _, err := db.DeleteConfirmedMessages(ctx); err != nil {
+		t.Fatalf("Failed to delete confirmed messages: %v", err)
+	}
+	stored, err := db.GetMessages(ctx, false, "", writers*perWriter*2)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if expected := writers * (perWriter/2 + perWriter/10*5); len(stored) != expected {
+		t.Errorf("Expected %d unconfirmed messages, got %d", expected, len(stored))
+	}
+}
+
+// BenchmarkSQLiteStoreMessage stores a batch of messages one insert at a time
+func BenchmarkSQLiteStoreMessage(b *testing.B) {
+	db := newTestSQLiteDatabase(b)
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		for _, msg := range testMessages(100) {
+			if err := db.StoreMessage(ctx, msg); err != nil {
+				b.Fatalf("Failed to store message: %v", err)
+			}
+		}
+	}
+}
+
+// BenchmarkSQLiteStoreMessages stores the same batch of messages in a single transaction
+func BenchmarkSQLiteStoreMessages(b *testing.B) {
+	db := newTestSQLiteDatabase(b)
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		if err := db.StoreMessages(ctx, testMessages(100)); err != nil {
+			b.Fatalf("Failed to store messages: %v", err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"MQTTmicroService/internal/models"
+)
+
+func TestSubscriptionStorage(t *testing.T) {
+	memory, err := New(&Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := memory.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	for name, db := range map[string]Database{"memory": memory, "sqlite": newTestSQLiteDatabase(t)} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, subscription := range []*models.Subscription{
+				{Broker: "local", Topic: "sensors/#", QoS: 0},
+				{Broker: "local", Topic: "alerts/+", QoS: 1},
+				{Broker: "remote", Topic: "sensors/#", QoS: 2},
+				// Subscribing again replaces the stored subscription
+				{Broker: "local", Topic: "sensors/#", QoS: 1},
+			} {
+				if err := db.StoreSubscription(ctx, subscription); err != nil {
+					t.Fatalf("Failed to store subscription: %v", err)
+				}
+			}
+
+			subscriptions, err := db.GetSubscriptions(ctx)
+			if err != nil {
+				t.Fatalf("Failed to get subscriptions: %v", err)
+			}
+			stored := make(map[string]byte)
+			for _, subscription := range subscriptions {
+				stored[subscription.Broker+" "+subscription.Topic] = subscription.QoS
+			}
+			if len(subscriptions) != 3 || stored["local sensors/#"] != 1 || stored["local alerts/+"] != 1 || stored["remote sensors/#"] != 2 {
+				t.Errorf("Expected 3 subscriptions with the latest QoS, got %v", stored)
+			}
+
+			if err := db.DeleteSubscription(ctx, "local", "sensors/#"); err != nil {
+				t.Fatalf("Failed to delete subscription: %v", err)
+			}
+			if err := db.DeleteSubscription(ctx, "local", "unknown"); err != nil {
+				t.Errorf("Expected deleting an unknown subscription to succeed, got %v", err)
+			}
+
+			subscriptions, err = db.GetSubscriptions(ctx)
+			if err != nil {
+				t.Fatalf("Failed to get subscriptions: %v", err)
+			}
+			if len(subscriptions) != 2 {
+				t.Errorf("Expected 2 subscriptions after deleting one, got %d", len(subscriptions))
+			}
+		})
+	}
+}
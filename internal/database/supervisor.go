@@ -0,0 +1,458 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/models"
+)
+
+const (
+	// DefaultConnectAttempts is the number of initial connection attempts when none is configured
+	DefaultConnectAttempts = 5
+	// DefaultReconnectMaxWait is the maximum delay between connection attempts when none is configured
+	DefaultReconnectMaxWait = 30 * time.Second
+	// connectAttemptTimeout bounds a single connection attempt
+	connectAttemptTimeout = 10 * time.Second
+	// healthCheckTimeout bounds the ping made after an unexpected error
+	healthCheckTimeout = 5 * time.Second
+)
+
+// ErrReconnecting is returned by Ping while the connection is being re-established
+var ErrReconnecting = NewError("database connection lost, reconnecting")
+
+// RetryConfig controls how a Supervisor connects and reconnects
+type RetryConfig struct {
+	// Attempts is the number of initial connection attempts (0 uses DefaultConnectAttempts)
+	Attempts int
+	// MaxWait is the maximum delay between connection attempts (0 uses DefaultReconnectMaxWait)
+	MaxWait time.Duration
+}
+
+// Supervisor is a Database that retries its initial connection and reconnects in the background when the
+// connection is lost. Each reconnect creates a fresh provider instance, so in-flight calls keep using the old
+// one until the new connection is ready.
+type Supervisor struct {
+	config *Config
+	retry  RetryConfig
+	logger *logger.Logger
+
+	mu           sync.RWMutex
+	db           Database
+	reconnecting bool
+	checking     bool
+	lastErr      error
+	stop         chan struct{}
+}
+
+// NewSupervisor creates a supervised database for the configured provider
+func NewSupervisor(config *Config, retry RetryConfig, log *logger.Logger) (*Supervisor, error) {
+	db, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if retry.Attempts <= 0 {
+		retry.Attempts = DefaultConnectAttempts
+	}
+	if retry.MaxWait <= 0 {
+		retry.MaxWait = DefaultReconnectMaxWait
+	}
+
+	return &Supervisor{
+		config: config,
+		retry:  retry,
+		logger: log,
+		db:     db,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Connect connects to the database, retrying failed attempts with exponential backoff
+func (s *Supervisor) Connect(ctx context.Context) error {
+	wait := time.Second
+	var err error
+	for attempt := 1; attempt <= s.retry.Attempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, connectAttemptTimeout)
+		err = s.current().Connect(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		fields := map[string]interface{}{
+			"type":         s.config.Type,
+			"attempt":      attempt,
+			"max_attempts": s.retry.Attempts,
+		}
+		if attempt == s.retry.Attempts {
+			s.logger.WithError(err).WithFields(fields).Error("Database connection attempt failed, giving up")
+			break
+		}
+
+		fields["retry_in"] = wait.String()
+		s.logger.WithError(err).WithFields(fields).Warn("Database connection attempt failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > s.retry.MaxWait {
+			wait = s.retry.MaxWait
+		}
+	}
+	return err
+}
+
+// Close stops any reconnect in progress and closes the database connection
+func (s *Supervisor) Close(ctx context.Context) error {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	db := s.db
+	s.mu.Unlock()
+
+	return db.Close(ctx)
+}
+
+// Ping checks if the database is reachable, reporting ErrReconnecting while a reconnect is in progress
+func (s *Supervisor) Ping(ctx context.Context) error {
+	s.mu.RLock()
+	reconnecting, lastErr := s.reconnecting, s.lastErr
+	s.mu.RUnlock()
+
+	if reconnecting {
+		return fmt.Errorf("%w: %v", ErrReconnecting, lastErr)
+	}
+
+	err := s.current().Ping(ctx)
+	if err != nil {
+		s.reconnect(err)
+	}
+	return err
+}
+
+// current returns the database currently in use
+func (s *Supervisor) current() Database {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db
+}
+
+// observe inspects the error of a database call, reconnecting when the connection is gone and checking the
+// connection after other unexpected errors
+func (s *Supervisor) observe(err error) error {
+	switch {
+	case err == nil || isNotFound(err) || errors.Is(err, ErrDuplicateMessage):
+	case errors.Is(err, ErrConnectionFailed):
+		s.reconnect(err)
+	default:
+		s.checkHealth()
+	}
+	return err
+}
+
+// isNotFound reports whether an error only means that a record doesn't exist
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrMessageNotFound) || errors.Is(err, ErrDeliveryNotFound) ||
+		errors.Is(err, ErrScheduledMessageNotFound) || errors.Is(err, ErrIdempotencyRecordNotFound)
+}
+
+// checkHealth pings the database in the background and reconnects if it is unreachable
+func (s *Supervisor) checkHealth() {
+	s.mu.Lock()
+	if s.checking || s.reconnecting {
+		s.mu.Unlock()
+		return
+	}
+	s.checking = true
+	db := s.db
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := db.Ping(ctx)
+		cancel()
+
+		s.mu.Lock()
+		s.checking = false
+		s.mu.Unlock()
+
+		if err != nil {
+			s.reconnect(err)
+		}
+	}()
+}
+
+// reconnect starts reconnecting in the background unless a reconnect is already in progress
+func (s *Supervisor) reconnect(cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastErr = cause
+	if s.reconnecting {
+		return
+	}
+	s.reconnecting = true
+
+	s.logger.WithError(cause).WithField("type", s.config.Type).Warn("Database connection lost, reconnecting")
+	go s.reconnectLoop()
+}
+
+// reconnectLoop connects fresh provider instances with exponential backoff until one succeeds or the supervisor is closed
+func (s *Supervisor) reconnectLoop() {
+	wait := time.Second
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > s.retry.MaxWait {
+			wait = s.retry.MaxWait
+		}
+
+		db, err := New(s.config)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), connectAttemptTimeout)
+			err = db.Connect(ctx)
+			cancel()
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.lastErr = err
+			s.mu.Unlock()
+			s.logger.WithError(err).WithField("attempt", attempt).Warn("Database reconnect attempt failed")
+			continue
+		}
+
+		s.mu.Lock()
+		select {
+		case <-s.stop:
+			// Closed while connecting, so the new connection isn't needed
+			s.mu.Unlock()
+			db.Close(context.Background())
+			return
+		default:
+		}
+		old := s.db
+		s.db = db
+		s.reconnecting = false
+		s.lastErr = nil
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), connectAttemptTimeout)
+		old.Close(ctx)
+		cancel()
+
+		s.logger.WithField("type", s.config.Type).Info("Reconnected to database")
+		return
+	}
+}
+
+// StoreMessage stores a message in the database
+func (s *Supervisor) StoreMessage(ctx context.Context, msg *Message) error {
+	return s.observe(s.current().StoreMessage(ctx, msg))
+}
+
+// StoreMessages stores several messages in one round-trip
+func (s *Supervisor) StoreMessages(ctx context.Context, msgs []*Message) error {
+	return s.observe(s.current().StoreMessages(ctx, msgs))
+}
+
+// ImportMessages stores messages that already have IDs, replacing or skipping those already stored
+func (s *Supervisor) ImportMessages(ctx context.Context, msgs []*Message, replace bool) (int, error) {
+	skipped, err := s.current().ImportMessages(ctx, msgs, replace)
+	return skipped, s.observe(err)
+}
+
+// GetMessages retrieves messages from the database, optionally filtered by delivery status
+func (s *Supervisor) GetMessages(ctx context.Context, confirmed bool, status string, limit int) ([]*Message, error) {
+	messages, err := s.current().GetMessages(ctx, confirmed, status, limit)
+	return messages, s.observe(err)
+}
+
+// GetMessagesByTopicPrefix retrieves messages whose topic starts with the given prefix
+func (s *Supervisor) GetMessagesByTopicPrefix(ctx context.Context, prefix string, confirmed bool, status string, limit int) ([]*Message, error) {
+	messages, err := s.current().GetMessagesByTopicPrefix(ctx, prefix, confirmed, status, limit)
+	return messages, s.observe(err)
+}
+
+// GetMessagesByTopicFilter retrieves messages whose topic matches an MQTT topic filter
+func (s *Supervisor) GetMessagesByTopicFilter(ctx context.Context, filter string, limit int) ([]*Message, error) {
+	messages, err := s.current().GetMessagesByTopicFilter(ctx, filter, limit)
+	return messages, s.observe(err)
+}
+
+// ExportMessages calls fn with every message matching the filter, oldest first
+func (s *Supervisor) ExportMessages(ctx context.Context, filter MessageFilter, fn func(*Message) error) error {
+	return s.observe(s.current().ExportMessages(ctx, filter, fn))
+}
+
+// GetMessageByID retrieves a message by its ID
+func (s *Supervisor) GetMessageByID(ctx context.Context, id string) (*Message, error) {
+	msg, err := s.current().GetMessageByID(ctx, id)
+	return msg, s.observe(err)
+}
+
+// ConfirmMessage marks a message as confirmed
+func (s *Supervisor) ConfirmMessage(ctx context.Context, id string) error {
+	return s.observe(s.current().ConfirmMessage(ctx, id))
+}
+
+// UpdateMessageStatus sets the delivery status of a message
+func (s *Supervisor) UpdateMessageStatus(ctx context.Context, id string, status string) error {
+	return s.observe(s.current().UpdateMessageStatus(ctx, id, status))
+}
+
+// DeleteMessage deletes a message from the database
+func (s *Supervisor) DeleteMessage(ctx context.Context, id string) error {
+	return s.observe(s.current().DeleteMessage(ctx, id))
+}
+
+// DeleteConfirmedMessages deletes all confirmed messages
+func (s *Supervisor) DeleteConfirmedMessages(ctx context.Context) (int, error) {
+	deleted, err := s.current().DeleteConfirmedMessages(ctx)
+	return deleted, s.observe(err)
+}
+
+// StoreWebhook stores a webhook in the database
+func (s *Supervisor) StoreWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return s.observe(s.current().StoreWebhook(ctx, webhook))
+}
+
+// GetWebhooks retrieves webhooks from the database
+func (s *Supervisor) GetWebhooks(ctx context.Context, limit int) ([]*models.Webhook, error) {
+	webhooks, err := s.current().GetWebhooks(ctx, limit)
+	return webhooks, s.observe(err)
+}
+
+// GetWebhookByID retrieves a webhook by its ID
+func (s *Supervisor) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	webhook, err := s.current().GetWebhookByID(ctx, id)
+	return webhook, s.observe(err)
+}
+
+// UpdateWebhook updates a webhook in the database
+func (s *Supervisor) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return s.observe(s.current().UpdateWebhook(ctx, webhook))
+}
+
+// DeleteWebhook deletes a webhook from the database
+func (s *Supervisor) DeleteWebhook(ctx context.Context, id string) error {
+	return s.observe(s.current().DeleteWebhook(ctx, id))
+}
+
+// GetWebhooksByTopicFilter retrieves webhooks that match a topic
+func (s *Supervisor) GetWebhooksByTopicFilter(ctx context.Context, topic string) ([]*models.Webhook, error) {
+	webhooks, err := s.current().GetWebhooksByTopicFilter(ctx, topic)
+	return webhooks, s.observe(err)
+}
+
+// GetEnabledWebhooks retrieves all enabled webhooks
+func (s *Supervisor) GetEnabledWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	webhooks, err := s.current().GetEnabledWebhooks(ctx)
+	return webhooks, s.observe(err)
+}
+
+// StoreWebhookDelivery stores a webhook delivery record in the database
+func (s *Supervisor) StoreWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return s.observe(s.current().StoreWebhookDelivery(ctx, delivery))
+}
+
+// UpdateWebhookDelivery updates the status of a webhook delivery record
+func (s *Supervisor) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return s.observe(s.current().UpdateWebhookDelivery(ctx, delivery))
+}
+
+// GetWebhookDeliveryByID retrieves a webhook delivery record by its ID
+func (s *Supervisor) GetWebhookDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	delivery, err := s.current().GetWebhookDeliveryByID(ctx, id)
+	return delivery, s.observe(err)
+}
+
+// GetWebhookDeliveries retrieves the most recent delivery records of a webhook
+func (s *Supervisor) GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	deliveries, err := s.current().GetWebhookDeliveries(ctx, webhookID, limit)
+	return deliveries, s.observe(err)
+}
+
+// GetDueWebhookDeliveries retrieves pending deliveries whose next retry is due
+func (s *Supervisor) GetDueWebhookDeliveries(ctx context.Context, before time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	deliveries, err := s.current().GetDueWebhookDeliveries(ctx, before, limit)
+	return deliveries, s.observe(err)
+}
+
+// DeleteWebhookDeliveriesBefore deletes finished deliveries last updated before the given time
+func (s *Supervisor) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	count, err := s.current().DeleteWebhookDeliveriesBefore(ctx, before)
+	return count, s.observe(err)
+}
+
+// StoreScheduledMessage stores a message to be published later
+func (s *Supervisor) StoreScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	return s.observe(s.current().StoreScheduledMessage(ctx, msg))
+}
+
+// UpdateScheduledMessage updates the status of a scheduled message
+func (s *Supervisor) UpdateScheduledMessage(ctx context.Context, msg *models.ScheduledMessage) error {
+	return s.observe(s.current().UpdateScheduledMessage(ctx, msg))
+}
+
+// GetScheduledMessageByID retrieves a scheduled message by its ID
+func (s *Supervisor) GetScheduledMessageByID(ctx context.Context, id string) (*models.ScheduledMessage, error) {
+	msg, err := s.current().GetScheduledMessageByID(ctx, id)
+	return msg, s.observe(err)
+}
+
+// GetScheduledMessages retrieves scheduled messages, soonest first
+func (s *Supervisor) GetScheduledMessages(ctx context.Context, limit int) ([]*models.ScheduledMessage, error) {
+	messages, err := s.current().GetScheduledMessages(ctx, limit)
+	return messages, s.observe(err)
+}
+
+// GetDueScheduledMessages retrieves pending scheduled messages whose publish time has come
+func (s *Supervisor) GetDueScheduledMessages(ctx context.Context, before time.Time, limit int) ([]*models.ScheduledMessage, error) {
+	messages, err := s.current().GetDueScheduledMessages(ctx, before, limit)
+	return messages, s.observe(err)
+}
+
+// DeleteScheduledMessage deletes a scheduled message
+func (s *Supervisor) DeleteScheduledMessage(ctx context.Context, id string) error {
+	return s.observe(s.current().DeleteScheduledMessage(ctx, id))
+}
+
+// StoreIdempotencyRecord stores the outcome of a request made with an idempotency key
+func (s *Supervisor) StoreIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	return s.observe(s.current().StoreIdempotencyRecord(ctx, record))
+}
+
+// GetIdempotencyRecord retrieves the unexpired record of an idempotency key
+func (s *Supervisor) GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	record, err := s.current().GetIdempotencyRecord(ctx, key)
+	return record, s.observe(err)
+}
+
+// StoreSubscription stores a subscription so it can be restored after a restart
+func (s *Supervisor) StoreSubscription(ctx context.Context, subscription *models.Subscription) error {
+	return s.observe(s.current().StoreSubscription(ctx, subscription))
+}
+
+// GetSubscriptions retrieves all stored subscriptions
+func (s *Supervisor) GetSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	subscriptions, err := s.current().GetSubscriptions(ctx)
+	return subscriptions, s.observe(err)
+}
+
+// DeleteSubscription deletes a stored subscription
+func (s *Supervisor) DeleteSubscription(ctx context.Context, broker, topic string) error {
+	return s.observe(s.current().DeleteSubscription(ctx, broker, topic))
+}
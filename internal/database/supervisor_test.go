@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/logger"
+)
+
+// flakyDatabase is an in-memory database whose first connection attempts fail
+type flakyDatabase struct {
+	Database
+	failures *int32
+}
+
+// Connect fails while failures remain
+func (f *flakyDatabase) Connect(ctx context.Context) error {
+	if atomic.AddInt32(f.failures, -1) >= 0 {
+		return errors.New("connection refused")
+	}
+	return f.Database.Connect(ctx)
+}
+
+// newTestSupervisor creates a supervisor whose database is a flaky in-memory database
+func newTestSupervisor(t *testing.T, failures int32, attempts int) *Supervisor {
+	t.Helper()
+
+	name := "flaky-" + t.Name()
+	Register(name, func(config *Config) (Database, error) {
+		db, err := NewMemoryDatabase(config)
+		if err != nil {
+			return nil, err
+		}
+		return &flakyDatabase{Database: db, failures: &failures}, nil
+	})
+
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	s, err := NewSupervisor(&Config{Type: name}, RetryConfig{Attempts: attempts, MaxWait: time.Second}, log)
+	if err != nil {
+		t.Fatalf("Failed to create supervisor: %v", err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func TestSupervisorConnectRetries(t *testing.T) {
+	if err := newTestSupervisor(t, 1, 1).Connect(context.Background()); err == nil {
+		t.Error("Expected the connection to fail without retries")
+	}
+
+	s := newTestSupervisor(t, 1, 2)
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("Expected the second attempt to connect, got %v", err)
+	}
+	if err := s.Ping(context.Background()); err != nil {
+		t.Errorf("Expected the database to be reachable, got %v", err)
+	}
+}
+
+func TestSupervisorReconnectsAfterConnectionLoss(t *testing.T) {
+	s := newTestSupervisor(t, 0, 1)
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	// Drop the underlying connection
+	s.current().Close(ctx)
+
+	if err := s.StoreMessage(ctx, &Message{Topic: "sensors/temp", Payload: "21.5"}); !errors.Is(err, ErrConnectionFailed) {
+		t.Fatalf("Expected ErrConnectionFailed, got %v", err)
+	}
+	if err := s.Ping(ctx); !errors.Is(err, ErrReconnecting) {
+		t.Fatalf("Expected ErrReconnecting while reconnecting, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Ping(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the database to reconnect")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if err := s.StoreMessage(ctx, &Message{Topic: "sensors/temp", Payload: "21.5"}); err != nil {
+		t.Errorf("Expected the message to be stored after reconnecting, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+// topicFilterPrefix returns the literal part of a topic filter before its first wildcard,
+// which every matching topic starts with
+func topicFilterPrefix(filter string) string {
+	if i := strings.IndexAny(filter, "+#"); i >= 0 {
+		return filter[:i]
+	}
+	return filter
+}
+
+// topicFilterRegex returns a regular expression matching the topics a topic filter matches
+func topicFilterRegex(filter string) string {
+	levels := strings.Split(filter, "/")
+	parts := make([]string, 0, len(levels))
+	for i, level := range levels {
+		switch level {
+		case "#":
+			// '#' also matches the parent level, so the separator before it is optional
+			if i == 0 {
+				return "^.*$"
+			}
+			return "^" + strings.Join(parts, "/") + "(/.*)?$"
+		case "+":
+			parts = append(parts, "[^/]*")
+		default:
+			parts = append(parts, regexp.QuoteMeta(level))
+		}
+	}
+	return "^" + strings.Join(parts, "/") + "$"
+}
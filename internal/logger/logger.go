@@ -18,6 +18,14 @@ type Config struct {
 	Format     string
 	Output     io.Writer
 	TimeFormat string
+	// MaxSizeMB is the size in megabytes at which the log file is rotated (0 disables rotation)
+	MaxSizeMB int
+	// MaxBackups is the number of rotated log files to keep (0 keeps them all)
+	MaxBackups int
+	// MaxAgeDays is the number of days to keep rotated log files (0 keeps them regardless of age)
+	MaxAgeDays int
+	// Compress enables gzip compression of rotated log files
+	Compress bool
 }
 
 // DefaultConfig returns the default logger configuration
@@ -71,6 +79,17 @@ func NewFileLogger(filename string, config *Config) (*Logger, error) {
 		config = DefaultConfig()
 	}
 
+	// Rotate the file once it reaches the maximum size if rotation is configured
+	if config.MaxSizeMB > 0 {
+		file, err := NewRotatingFile(filename, config.MaxSizeMB, config.MaxBackups, config.MaxAgeDays, config.Compress)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Output = file
+		return New(config), nil
+	}
+
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp format embedded in the names of rotated log files
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile is an io.Writer that writes to a log file and rotates it once it exceeds a maximum size.
+// Rotated files are renamed to <name>-<timestamp><ext>, optionally gzip-compressed, and removed once
+// there are more than MaxBackups of them or they are older than MaxAge.
+// The active file always keeps its original name.
+type RotatingFile struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+
+	file *os.File
+	size int64
+	mu   sync.Mutex
+}
+
+// NewRotatingFile opens a log file for appending that rotates once it grows beyond maxSizeMB megabytes.
+// maxBackups and maxAgeDays limit how many rotated files are kept and for how long (0 keeps them all).
+func NewRotatingFile(filename string, maxSizeMB, maxBackups, maxAgeDays int, compress bool) (*RotatingFile, error) {
+	r := &RotatingFile{
+		filename:   filename,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		compress:   compress,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write writes data to the active log file, rotating it first if the data would exceed the maximum size
+func (r *RotatingFile) Write(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(data)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the active log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// open opens the active log file for appending
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate renames the active log file to a timestamped backup, opens a new one, and cleans up old backups
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	if err := os.Rename(r.filename, r.backupName(time.Now())); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.cleanup()
+	return nil
+}
+
+// backupName returns the name of a backup rotated at the given time
+func (r *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.filename)
+	base := strings.TrimSuffix(r.filename, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.Format(backupTimeFormat), ext)
+}
+
+// logBackup is a rotated log file
+type logBackup struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups returns the rotated log files, newest first
+func (r *RotatingFile) backups() []logBackup {
+	ext := filepath.Ext(r.filename)
+	prefix := filepath.Base(strings.TrimSuffix(r.filename, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(r.filename))
+	if err != nil {
+		return nil
+	}
+
+	var backups []logBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		timestamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		rotatedAt, err := time.ParseInLocation(backupTimeFormat, timestamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, logBackup{path: filepath.Join(filepath.Dir(r.filename), name), rotatedAt: rotatedAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotatedAt.After(backups[j].rotatedAt)
+	})
+	return backups
+}
+
+// cleanup removes backups beyond the configured count or age and compresses the remaining ones if enabled
+func (r *RotatingFile) cleanup() {
+	cutoff := time.Now().Add(-r.maxAge)
+	for i, backup := range r.backups() {
+		if (r.maxBackups > 0 && i >= r.maxBackups) || (r.maxAge > 0 && backup.rotatedAt.Before(cutoff)) {
+			os.Remove(backup.path)
+			continue
+		}
+		if r.compress && !strings.HasSuffix(backup.path, ".gz") {
+			compressFile(backup.path)
+		}
+	}
+}
+
+// compressFile gzips a file to <path>.gz and removes the original
+func compressFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(target)
+	if _, err := io.Copy(gz, source); err != nil {
+		target.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		target.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := target.Close(); err != nil {
+		return err
+	}
+
+	source.Close()
+	return os.Remove(path)
+}
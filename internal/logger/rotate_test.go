@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "service.log")
+
+	file, err := NewRotatingFile(filename, 1, 2, 0, true)
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	defer file.Close()
+
+	// Each chunk fills more than half the maximum size, so every write after the first rotates
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 4; i++ {
+		if _, err := file.Write(chunk); err != nil {
+			t.Fatalf("Failed to write chunk %d: %v", i, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Expected the active log file to exist: %v", err)
+	}
+	if info.Size() != int64(len(chunk)) {
+		t.Errorf("Expected the active log file to hold only the last chunk, got %d bytes", info.Size())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if entry.Name() != "service.log" {
+			backups = append(backups, entry.Name())
+		}
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups to be kept, got %v", backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasPrefix(backup, "service-") || !strings.HasSuffix(backup, ".log.gz") {
+			t.Errorf("Expected a compressed backup named service-<timestamp>.log.gz, got '%s'", backup)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram buckets used unless configured otherwise
+var DefaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// LatencyBucket is a histogram bucket counting the measurements at or below its upper bound
+type LatencyBucket struct {
+	// UpperBoundMs is the bucket's inclusive upper bound in milliseconds
+	UpperBoundMs float64 `json:"le_ms"`
+	// Count is cumulative: it includes the measurements of every lower bucket
+	Count int64 `json:"count"`
+}
+
+// LatencyHistogram is the distribution of latency measurements since the last reset. Measurements above
+// the highest bucket are only included in Count, which acts as the bucket without an upper bound.
+type LatencyHistogram struct {
+	Buckets []LatencyBucket `json:"buckets"`
+	Count   int64           `json:"count"`
+	SumMs   float64         `json:"sum_ms"`
+}
+
+// latencyHistogram accumulates latency measurements into fixed buckets
+type latencyHistogram struct {
+	bounds []time.Duration
+	// counts holds the measurements of each bucket alone, plus those above the highest bound last
+	counts []int64
+	count  int64
+	sum    time.Duration
+}
+
+// newLatencyHistogram creates a histogram with buckets of the given increasing upper bounds
+func newLatencyHistogram(bounds []time.Duration) *latencyHistogram {
+	return &latencyHistogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// observe adds a measurement to the bucket with the lowest upper bound not below it
+func (h *latencyHistogram) observe(latency time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return latency <= h.bounds[i] })
+	h.counts[i]++
+	h.count++
+	h.sum += latency
+}
+
+// snapshot returns the histogram with cumulative bucket counts
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	histogram := LatencyHistogram{
+		Buckets: make([]LatencyBucket, len(h.bounds)),
+		Count:   h.count,
+		SumMs:   milliseconds(h.sum),
+	}
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		histogram.Buckets[i] = LatencyBucket{UpperBoundMs: milliseconds(bound), Count: cumulative}
+	}
+	return histogram
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -14,6 +14,9 @@ type Metrics struct {
 	PublishedMessages   int64
 	ReceivedMessages    int64
 	FailedPublishes     int64
+	ConfirmedMessages   int64
+	StoreDroppedMessages int64
+	DeduplicatedMessages int64
 	SubscriptionCount   int64
 	
 	// Connection metrics
@@ -21,18 +24,39 @@ type Metrics struct {
 	ConnectionFailures  int64
 	ConnectionSuccesses int64
 	Disconnections      int64
+	ProbeSuccesses      int64
+	ProbeFailures       int64
 	
 	// API metrics
 	APIRequests         int64
 	APIErrors           int64
 	
+	// Webhook metrics
+	WebhooksSkipped     int64
+	WebhooksDeadLettered int64
+	WebhooksDropped     int64
+	WebhooksShortCircuited int64
+	
 	// Performance metrics
 	PublishLatency      []time.Duration
 	SubscribeLatency    []time.Duration
 	
+	// Latency distributions since the last reset
+	publishHistogram    *latencyHistogram
+	subscribeHistogram  *latencyHistogram
+	latencyBuckets      []time.Duration
+	
+	// Per-topic and per-broker message counts
+	topicCounts         map[string]*MessageCounts
+	brokerCounts        map[string]*MessageCounts
+	maxTopics           int
+	
 	// Last updated timestamp
 	LastUpdated         time.Time
 	
+	// StartTime is when the service started; it isn't cleared by a reset
+	StartTime           time.Time
+	
 	// Mutex for thread safety
 	mu                  sync.RWMutex
 	
@@ -40,16 +64,55 @@ type Metrics struct {
 	logger              *logger.Logger
 }
 
+// DefaultMaxTopics is the default number of topics tracked individually in the per-topic breakdown
+const DefaultMaxTopics = 100
+
+// OtherTopics is the bucket aggregating the counts of topics beyond the tracked maximum
+const OtherTopics = "other"
+
+// MessageCounts holds the number of messages published and received on a topic or broker
+type MessageCounts struct {
+	Published int64 `json:"published"`
+	Received  int64 `json:"received"`
+	// Failed counts failed publishes; it is only tracked per broker
+	Failed int64 `json:"failed,omitempty"`
+}
+
 // New creates a new metrics instance
 func New(log *logger.Logger) *Metrics {
 	return &Metrics{
-		PublishLatency:   make([]time.Duration, 0, 100),
-		SubscribeLatency: make([]time.Duration, 0, 100),
-		LastUpdated:      time.Now(),
-		logger:           log,
+		PublishLatency:     make([]time.Duration, 0, 100),
+		SubscribeLatency:   make([]time.Duration, 0, 100),
+		publishHistogram:   newLatencyHistogram(DefaultLatencyBuckets),
+		subscribeHistogram: newLatencyHistogram(DefaultLatencyBuckets),
+		latencyBuckets:     DefaultLatencyBuckets,
+		topicCounts:        make(map[string]*MessageCounts),
+		brokerCounts:       make(map[string]*MessageCounts),
+		maxTopics:          DefaultMaxTopics,
+		LastUpdated:        time.Now(),
+		StartTime:          time.Now(),
+		logger:             log,
 	}
 }
 
+// SetMaxTopics sets the number of topics tracked individually; counts for further topics
+// are aggregated under the OtherTopics bucket
+func (m *Metrics) SetMaxTopics(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxTopics = max
+}
+
+// SetLatencyBuckets sets the increasing upper bounds of the latency histogram buckets,
+// discarding the measurements accumulated so far
+func (m *Metrics) SetLatencyBuckets(buckets []time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencyBuckets = buckets
+	m.publishHistogram = newLatencyHistogram(buckets)
+	m.subscribeHistogram = newLatencyHistogram(buckets)
+}
+
 // IncrementPublishedMessages increments the published messages counter
 func (m *Metrics) IncrementPublishedMessages() {
 	m.mu.Lock()
@@ -66,6 +129,55 @@ func (m *Metrics) IncrementReceivedMessages() {
 	m.LastUpdated = time.Now()
 }
 
+// IncrementPublishedMessagesForTopic increments the published messages counter,
+// along with the counters of the topic and broker the message was published to
+func (m *Metrics) IncrementPublishedMessagesForTopic(topic, broker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.PublishedMessages++
+	m.topicCountsFor(topic).Published++
+	m.brokerCountsFor(broker).Published++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementReceivedMessagesForTopic increments the received messages counter,
+// along with the counters of the topic and broker the message was received from
+func (m *Metrics) IncrementReceivedMessagesForTopic(topic, broker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ReceivedMessages++
+	m.topicCountsFor(topic).Received++
+	m.brokerCountsFor(broker).Received++
+	m.LastUpdated = time.Now()
+}
+
+// topicCountsFor returns the counters of a topic, falling back to the OtherTopics bucket
+// once the maximum number of topics is tracked. The caller must hold the lock.
+func (m *Metrics) topicCountsFor(topic string) *MessageCounts {
+	if counts, ok := m.topicCounts[topic]; ok {
+		return counts
+	}
+	if len(m.topicCounts) >= m.maxTopics {
+		topic = OtherTopics
+		if counts, ok := m.topicCounts[topic]; ok {
+			return counts
+		}
+	}
+	counts := &MessageCounts{}
+	m.topicCounts[topic] = counts
+	return counts
+}
+
+// brokerCountsFor returns the counters of a broker. The caller must hold the lock.
+func (m *Metrics) brokerCountsFor(broker string) *MessageCounts {
+	counts, ok := m.brokerCounts[broker]
+	if !ok {
+		counts = &MessageCounts{}
+		m.brokerCounts[broker] = counts
+	}
+	return counts
+}
+
 // IncrementFailedPublishes increments the failed publishes counter
 func (m *Metrics) IncrementFailedPublishes() {
 	m.mu.Lock()
@@ -74,6 +186,16 @@ func (m *Metrics) IncrementFailedPublishes() {
 	m.LastUpdated = time.Now()
 }
 
+// IncrementFailedPublishesForBroker increments the failed publishes counter, along with the counter of the
+// broker the message failed to be published to
+func (m *Metrics) IncrementFailedPublishesForBroker(broker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.FailedPublishes++
+	m.brokerCountsFor(broker).Failed++
+	m.LastUpdated = time.Now()
+}
+
 // SetSubscriptionCount sets the subscription count
 func (m *Metrics) SetSubscriptionCount(count int64) {
 	m.mu.Lock()
@@ -114,6 +236,22 @@ func (m *Metrics) IncrementDisconnections() {
 	m.LastUpdated = time.Now()
 }
 
+// IncrementProbeSuccesses increments the successful connection probes counter
+func (m *Metrics) IncrementProbeSuccesses() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ProbeSuccesses++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementProbeFailures increments the failed connection probes counter
+func (m *Metrics) IncrementProbeFailures() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ProbeFailures++
+	m.LastUpdated = time.Now()
+}
+
 // IncrementAPIRequests increments the API requests counter
 func (m *Metrics) IncrementAPIRequests() {
 	m.mu.Lock()
@@ -130,7 +268,69 @@ func (m *Metrics) IncrementAPIErrors() {
 	m.LastUpdated = time.Now()
 }
 
-// AddPublishLatency adds a publish latency measurement
+// IncrementConfirmedMessages increments the counter of stored messages confirmed through the API
+func (m *Metrics) IncrementConfirmedMessages() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ConfirmedMessages++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementStoreDroppedMessages increments the counter of published messages not stored because the
+// queue of the asynchronous storage writer was full
+func (m *Metrics) IncrementStoreDroppedMessages() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.StoreDroppedMessages++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementDeduplicatedMessages increments the counter of published messages not stored because an
+// identical message was stored within the same deduplication window
+func (m *Metrics) IncrementDeduplicatedMessages() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.DeduplicatedMessages++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementWebhooksSkipped increments the counter of webhook notifications skipped because the
+// message's QoS or payload didn't satisfy the webhook's filters
+func (m *Metrics) IncrementWebhooksSkipped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.WebhooksSkipped++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementWebhooksDeadLettered increments the counter of failed webhook notifications
+// republished to the dead-letter topic
+func (m *Metrics) IncrementWebhooksDeadLettered() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.WebhooksDeadLettered++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementWebhooksDropped increments the counter of webhook notifications dropped because the
+// delivery queue was full or the service was shutting down
+func (m *Metrics) IncrementWebhooksDropped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.WebhooksDropped++
+	m.LastUpdated = time.Now()
+}
+
+// IncrementWebhooksShortCircuited increments the counter of webhook delivery attempts skipped because
+// the circuit of the receiver was open
+func (m *Metrics) IncrementWebhooksShortCircuited() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.WebhooksShortCircuited++
+	m.LastUpdated = time.Now()
+}
+
+// AddPublishLatency adds a publish latency measurement to the rolling average and the histogram
 func (m *Metrics) AddPublishLatency(latency time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -141,10 +341,11 @@ func (m *Metrics) AddPublishLatency(latency time.Duration) {
 	}
 	
 	m.PublishLatency = append(m.PublishLatency, latency)
+	m.publishHistogram.observe(latency)
 	m.LastUpdated = time.Now()
 }
 
-// AddSubscribeLatency adds a subscribe latency measurement
+// AddSubscribeLatency adds a subscribe latency measurement to the rolling average and the histogram
 func (m *Metrics) AddSubscribeLatency(latency time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -155,6 +356,7 @@ func (m *Metrics) AddSubscribeLatency(latency time.Duration) {
 	}
 	
 	m.SubscribeLatency = append(m.SubscribeLatency, latency)
+	m.subscribeHistogram.observe(latency)
 	m.LastUpdated = time.Now()
 }
 
@@ -163,6 +365,11 @@ func (m *Metrics) GetMetrics() map[string]interface{} {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	
+	return m.snapshot()
+}
+
+// snapshot builds the metrics output. The caller must hold the lock.
+func (m *Metrics) snapshot() map[string]interface{} {
 	// Calculate average latencies
 	var avgPublishLatency, avgSubscribeLatency time.Duration
 	
@@ -182,12 +389,26 @@ func (m *Metrics) GetMetrics() map[string]interface{} {
 		avgSubscribeLatency = total / time.Duration(len(m.SubscribeLatency))
 	}
 	
+	topics := make(map[string]MessageCounts, len(m.topicCounts))
+	for topic, counts := range m.topicCounts {
+		topics[topic] = *counts
+	}
+	brokers := make(map[string]MessageCounts, len(m.brokerCounts))
+	for broker, counts := range m.brokerCounts {
+		brokers[broker] = *counts
+	}
+	
 	return map[string]interface{}{
 		"messages": map[string]int64{
-			"published": m.PublishedMessages,
-			"received":  m.ReceivedMessages,
-			"failed":    m.FailedPublishes,
+			"published":     m.PublishedMessages,
+			"received":      m.ReceivedMessages,
+			"failed":        m.FailedPublishes,
+			"confirmed":     m.ConfirmedMessages,
+			"store_dropped": m.StoreDroppedMessages,
+			"deduplicated":  m.DeduplicatedMessages,
 		},
+		"topics":        topics,
+		"brokers":       brokers,
 		"subscriptions": m.SubscriptionCount,
 		"connections": map[string]int64{
 			"attempts":  m.ConnectionAttempts,
@@ -195,15 +416,31 @@ func (m *Metrics) GetMetrics() map[string]interface{} {
 			"successes": m.ConnectionSuccesses,
 			"disconnections": m.Disconnections,
 		},
+		"probes": map[string]int64{
+			"successes": m.ProbeSuccesses,
+			"failures":  m.ProbeFailures,
+		},
 		"api": map[string]int64{
 			"requests": m.APIRequests,
 			"errors":   m.APIErrors,
 		},
+		"webhooks": map[string]int64{
+			"skipped":         m.WebhooksSkipped,
+			"dead_lettered":   m.WebhooksDeadLettered,
+			"dropped":         m.WebhooksDropped,
+			"short_circuited": m.WebhooksShortCircuited,
+		},
 		"latency": map[string]string{
 			"publish":   avgPublishLatency.String(),
 			"subscribe": avgSubscribeLatency.String(),
 		},
-		"last_updated": m.LastUpdated.Format(time.RFC3339),
+		"latency_histograms": map[string]LatencyHistogram{
+			"publish":   m.publishHistogram.snapshot(),
+			"subscribe": m.subscribeHistogram.snapshot(),
+		},
+		"last_updated":   m.LastUpdated.Format(time.RFC3339),
+		"start_time":     m.StartTime.Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(m.StartTime).Seconds()),
 	}
 }
 
@@ -220,18 +457,46 @@ func (m *Metrics) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
+	m.reset()
+}
+
+// GetMetricsAndReset returns the current metrics and resets them, without losing updates in between
+func (m *Metrics) GetMetricsAndReset() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	snapshot := m.snapshot()
+	m.reset()
+	return snapshot
+}
+
+// reset zeroes all metrics. The caller must hold the lock.
+func (m *Metrics) reset() {
 	m.PublishedMessages = 0
 	m.ReceivedMessages = 0
 	m.FailedPublishes = 0
+	m.ConfirmedMessages = 0
+	m.StoreDroppedMessages = 0
+	m.DeduplicatedMessages = 0
 	m.SubscriptionCount = 0
 	m.ConnectionAttempts = 0
 	m.ConnectionFailures = 0
 	m.ConnectionSuccesses = 0
 	m.Disconnections = 0
+	m.ProbeSuccesses = 0
+	m.ProbeFailures = 0
 	m.APIRequests = 0
 	m.APIErrors = 0
+	m.WebhooksSkipped = 0
+	m.WebhooksDeadLettered = 0
+	m.WebhooksDropped = 0
+	m.WebhooksShortCircuited = 0
 	m.PublishLatency = make([]time.Duration, 0, 100)
 	m.SubscribeLatency = make([]time.Duration, 0, 100)
+	m.publishHistogram = newLatencyHistogram(m.latencyBuckets)
+	m.subscribeHistogram = newLatencyHistogram(m.latencyBuckets)
+	m.topicCounts = make(map[string]*MessageCounts)
+	m.brokerCounts = make(map[string]*MessageCounts)
 	m.LastUpdated = time.Now()
 	
 	m.logger.Info("Metrics reset")
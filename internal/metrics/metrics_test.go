@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/logger"
+)
+
+func TestTopicBreakdownAggregatesBeyondMaxTopics(t *testing.T) {
+	m := New(logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+	m.SetMaxTopics(2)
+
+	m.IncrementPublishedMessagesForTopic("a", "local")
+	m.IncrementPublishedMessagesForTopic("b", "local")
+	m.IncrementPublishedMessagesForTopic("a", "remote")
+	m.IncrementReceivedMessagesForTopic("c", "remote")
+	m.IncrementPublishedMessagesForTopic("d", "local")
+
+	snapshot := m.GetMetrics()
+
+	topics := snapshot["topics"].(map[string]MessageCounts)
+	expectedTopics := map[string]MessageCounts{
+		"a":         {Published: 2},
+		"b":         {Published: 1},
+		OtherTopics: {Published: 1, Received: 1},
+	}
+	if len(topics) != len(expectedTopics) {
+		t.Errorf("Expected %d topics, got %v", len(expectedTopics), topics)
+	}
+	for topic, expected := range expectedTopics {
+		if topics[topic] != expected {
+			t.Errorf("Expected counts %+v for topic '%s', got %+v", expected, topic, topics[topic])
+		}
+	}
+
+	brokers := snapshot["brokers"].(map[string]MessageCounts)
+	if brokers["local"] != (MessageCounts{Published: 3}) {
+		t.Errorf("Expected 3 messages published to 'local', got %+v", brokers["local"])
+	}
+	if brokers["remote"] != (MessageCounts{Published: 1, Received: 1}) {
+		t.Errorf("Expected 1 message published to and received from 'remote', got %+v", brokers["remote"])
+	}
+
+	messages := snapshot["messages"].(map[string]int64)
+	if messages["published"] != 4 || messages["received"] != 1 {
+		t.Errorf("Expected totals of 4 published and 1 received, got %v", messages)
+	}
+}
+
+func TestUptimeSurvivesReset(t *testing.T) {
+	m := New(logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+	m.StartTime = time.Now().Add(-90 * time.Second)
+	m.Reset()
+
+	snapshot := m.GetMetrics()
+	if uptime := snapshot["uptime_seconds"].(int64); uptime < 90 || uptime > 95 {
+		t.Errorf("Expected an uptime of about 90 seconds, got %d", uptime)
+	}
+	if startTime := snapshot["start_time"]; startTime != m.StartTime.Format(time.RFC3339) {
+		t.Errorf("Expected start time %s, got %v", m.StartTime.Format(time.RFC3339), startTime)
+	}
+}
+
+func TestLatencyHistogramsCountEveryMeasurement(t *testing.T) {
+	m := New(logger.New(&logger.Config{Level: "error", Output: io.Discard}))
+	m.SetLatencyBuckets([]time.Duration{10 * time.Millisecond, 100 * time.Millisecond})
+
+	// More measurements than the rolling average keeps, all of which the histogram counts
+	for i := 0; i < 150; i++ {
+		m.AddPublishLatency(5 * time.Millisecond)
+	}
+	m.AddPublishLatency(10 * time.Millisecond)
+	m.AddPublishLatency(50 * time.Millisecond)
+	m.AddPublishLatency(time.Second)
+
+	histograms := m.GetMetrics()["latency_histograms"].(map[string]LatencyHistogram)
+	publish := histograms["publish"]
+	expected := []LatencyBucket{{UpperBoundMs: 10, Count: 151}, {UpperBoundMs: 100, Count: 152}}
+	if len(publish.Buckets) != len(expected) || publish.Buckets[0] != expected[0] || publish.Buckets[1] != expected[1] {
+		t.Errorf("Expected cumulative buckets %v, got %v", expected, publish.Buckets)
+	}
+	if publish.Count != 153 || publish.SumMs != 1810 {
+		t.Errorf("Expected 153 measurements summing to 1810ms, got %d summing to %vms", publish.Count, publish.SumMs)
+	}
+	if subscribe := histograms["subscribe"]; subscribe.Count != 0 || len(subscribe.Buckets) != 2 {
+		t.Errorf("Expected an empty subscribe histogram with 2 buckets, got %+v", subscribe)
+	}
+
+	m.Reset()
+	publish = m.GetMetrics()["latency_histograms"].(map[string]LatencyHistogram)["publish"]
+	if publish.Count != 0 || len(publish.Buckets) != 2 || publish.Buckets[1].Count != 0 {
+		t.Errorf("Expected the reset to empty the histogram and keep its buckets, got %+v", publish)
+	}
+}
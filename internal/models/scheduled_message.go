@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Scheduled message statuses
+const (
+	// ScheduledStatusPending means the message is waiting for its publish time
+	ScheduledStatusPending = "pending"
+	// ScheduledStatusPublished means the message was published
+	ScheduledStatusPublished = "published"
+	// ScheduledStatusFailed means publishing the message failed when it was due
+	ScheduledStatusFailed = "failed"
+)
+
+// ScheduledMessage is a message to be published at a future time
+type ScheduledMessage struct {
+	ID    string `json:"id" bson:"_id,omitempty"`
+	Topic string `json:"topic" bson:"topic"`
+	// Payload is the JSON encoding of the payload, decoded again when the message is published
+	Payload   json.RawMessage `json:"payload" bson:"payload"`
+	QoS       byte            `json:"qos" bson:"qos"`
+	Retained  bool            `json:"retained" bson:"retained"`
+	Broker    string          `json:"broker" bson:"broker"`
+	PublishAt time.Time       `json:"publish_at" bson:"publish_at"`
+	Status    string          `json:"status" bson:"status"`
+	LastError string          `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Subscription is a subscription made through the API, stored so it can be restored after a restart
+type Subscription struct {
+	// Broker is the name of the broker the subscription is made on
+	Broker string `json:"broker" bson:"broker"`
+	// Topic is the subscribed topic filter, including any tenant namespace or $share/<group>/ prefix
+	Topic     string    `json:"topic" bson:"topic"`
+	QoS       byte      `json:"qos" bson:"qos"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -1,7 +1,15 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
 	"time"
+
+	"MQTTmicroService/internal/utils"
 )
 
 // Webhook represents a webhook configuration
@@ -16,8 +24,21 @@ type Webhook struct {
 	Timeout     int               `json:"timeout" bson:"timeout"`
 	RetryCount  int               `json:"retry_count" bson:"retry_count"`
 	RetryDelay  int               `json:"retry_delay" bson:"retry_delay"`
-	CreatedAt   time.Time         `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time         `json:"updated_at" bson:"updated_at"`
+	// MinQoS is the lowest QoS of the messages the webhook is notified of
+	MinQoS byte `json:"min_qos,omitempty" bson:"min_qos,omitempty"`
+	// Condition, when set, restricts notifications to messages whose JSON payload satisfies it
+	Condition *PayloadCondition `json:"condition,omitempty" bson:"condition,omitempty"`
+	// BodyTemplate is a text/template rendering the request body instead of the default JSON payload
+	BodyTemplate string `json:"body_template,omitempty" bson:"body_template,omitempty"`
+	// ContentType is the Content-Type of notification requests; empty means application/json
+	ContentType string `json:"content_type,omitempty" bson:"content_type,omitempty"`
+	// Namespace is the tenant namespace of the API key that created the webhook, stripped from the topics of its
+	// notifications; it is set at creation and never returned by the API
+	Namespace string `json:"-" bson:"namespace,omitempty"`
+	// Secret is used to sign notification payloads; it is write-only and never returned by the API
+	Secret    string    `json:"-" bson:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
 }
 
 // NewWebhook creates a new webhook with default values
@@ -39,12 +60,18 @@ func (w *Webhook) Validate() error {
 	if w.URL == "" {
 		return NewValidationError("URL is required")
 	}
+	if _, err := validateURLSyntax(w.URL); err != nil {
+		return err
+	}
 	if w.Method == "" {
 		return NewValidationError("Method is required")
 	}
 	if w.TopicFilter == "" {
 		return NewValidationError("Topic filter is required")
 	}
+	if err := utils.ValidateFilter(w.TopicFilter); err != nil {
+		return NewValidationError(fmt.Sprintf("Invalid topic filter: %v", err))
+	}
 	if w.Timeout <= 0 {
 		return NewValidationError("Timeout must be greater than 0")
 	}
@@ -54,9 +81,59 @@ func (w *Webhook) Validate() error {
 	if w.RetryDelay <= 0 {
 		return NewValidationError("Retry delay must be greater than 0")
 	}
+	if w.MinQoS > 2 {
+		return NewValidationError("Minimum QoS must be 0, 1, or 2")
+	}
+	if w.Condition != nil {
+		if err := w.Condition.Validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.ParseBodyTemplate(); err != nil {
+		return NewValidationError(fmt.Sprintf("Invalid body template: %v", err))
+	}
+	if w.BodyTemplate != "" && w.UsesQueryParameters() {
+		return NewValidationError(fmt.Sprintf("Body templates can't be used with %s webhooks, which send no body", strings.ToUpper(w.Method)))
+	}
+	if w.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(w.ContentType); err != nil {
+			return NewValidationError(fmt.Sprintf("Invalid content type: %v", err))
+		}
+	}
 	return nil
 }
 
+// UsesQueryParameters reports whether notifications are sent as query parameters rather than a request body,
+// which is the case for GET and HEAD webhooks
+func (w *Webhook) UsesQueryParameters() bool {
+	return strings.EqualFold(w.Method, http.MethodGet) || strings.EqualFold(w.Method, http.MethodHead)
+}
+
+// Accepts reports whether the webhook should be notified of a message with a QoS and decoded payload
+func (w *Webhook) Accepts(qos byte, payload interface{}) bool {
+	if qos < w.MinQoS {
+		return false
+	}
+	return w.Condition == nil || w.Condition.Matches(payload)
+}
+
+// bodyTemplateFuncs are the functions available to body templates besides the text/template builtins
+var bodyTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, for embedding payloads or quoted strings in JSON bodies
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// ParseBodyTemplate parses the webhook's body template, returning nil if it has none
+func (w *Webhook) ParseBodyTemplate() (*template.Template, error) {
+	if w.BodyTemplate == "" {
+		return nil, nil
+	}
+	return template.New("body").Funcs(bodyTemplateFuncs).Parse(w.BodyTemplate)
+}
+
 // ValidationError represents a validation error
 type ValidationError struct {
 	Message string
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"MQTTmicroService/internal/utils"
+)
+
+// Payload condition operators
+const (
+	OperatorEqual          = "=="
+	OperatorNotEqual       = "!="
+	OperatorGreater        = ">"
+	OperatorGreaterOrEqual = ">="
+	OperatorLess           = "<"
+	OperatorLessOrEqual    = "<="
+)
+
+// PayloadCondition compares a field of JSON message payloads with a value, such as $.temperature > 30
+type PayloadCondition struct {
+	// Path is the JSON path of the compared field, written like $.sensor.temperature or readings[0].value
+	Path string `json:"path" bson:"path"`
+	// Operator is one of ==, !=, >, >=, <, and <=
+	Operator string `json:"operator" bson:"operator"`
+	// Value is what the field is compared with; ordering operators need a number or a string
+	Value interface{} `json:"value" bson:"value"`
+}
+
+// Validate validates the payload condition
+func (c *PayloadCondition) Validate() error {
+	levels := utils.SplitJSONPath(c.Path)
+	if len(levels) == 0 {
+		return NewValidationError("Condition path is required")
+	}
+	for _, level := range levels {
+		if level == "*" {
+			return NewValidationError("Condition path can't contain wildcards")
+		}
+	}
+
+	switch c.Operator {
+	case OperatorEqual, OperatorNotEqual:
+		return nil
+	case OperatorGreater, OperatorGreaterOrEqual, OperatorLess, OperatorLessOrEqual:
+		if _, ok := toNumber(c.Value); ok {
+			return nil
+		}
+		if _, ok := c.Value.(string); ok {
+			return nil
+		}
+		return NewValidationError(fmt.Sprintf("Condition operator '%s' needs a number or string value", c.Operator))
+	default:
+		return NewValidationError(fmt.Sprintf("Condition operator must be one of ==, !=, >, >=, <, <=, got '%s'", c.Operator))
+	}
+}
+
+// Matches reports whether a decoded JSON payload satisfies the condition. Payloads without the field,
+// and fields that can't be ordered against the value, don't match.
+func (c *PayloadCondition) Matches(payload interface{}) bool {
+	field, ok := lookupPath(payload, utils.SplitJSONPath(c.Path))
+	if !ok {
+		return false
+	}
+
+	switch c.Operator {
+	case OperatorEqual:
+		return valuesEqual(field, c.Value)
+	case OperatorNotEqual:
+		return !valuesEqual(field, c.Value)
+	}
+
+	cmp, ok := compareValues(field, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case OperatorGreater:
+		return cmp > 0
+	case OperatorGreaterOrEqual:
+		return cmp >= 0
+	case OperatorLess:
+		return cmp < 0
+	case OperatorLessOrEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+// lookupPath returns the value at a path within a decoded JSON value
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	for _, level := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[level]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(level)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// valuesEqual compares two JSON values, comparing numbers by value whatever their Go type
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case nil:
+		return b == nil
+	}
+	return false
+}
+
+// compareValues orders two numbers or two strings, reporting false for any other pair
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+// toNumber converts the numeric types produced by the JSON and BSON decoders to a float64
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
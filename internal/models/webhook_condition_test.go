@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decodePayload(t *testing.T, payload string) interface{} {
+	t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	return value
+}
+
+func TestWebhookAcceptsMinQoS(t *testing.T) {
+	webhook := &Webhook{MinQoS: 1}
+
+	for qos, want := range map[byte]bool{0: false, 1: true, 2: true} {
+		if got := webhook.Accepts(qos, "alert"); got != want {
+			t.Errorf("Accepts(qos %d) = %v, want %v", qos, got, want)
+		}
+	}
+}
+
+func TestWebhookAcceptsNumericThreshold(t *testing.T) {
+	webhook := &Webhook{Condition: &PayloadCondition{Path: "$.sensor.temperature", Operator: ">=", Value: 30.0}}
+
+	tests := []struct {
+		payload string
+		want    bool
+	}{
+		{`{"sensor": {"temperature": 35}}`, true},
+		{`{"sensor": {"temperature": 30}}`, true},
+		{`{"sensor": {"temperature": 29.5}}`, false},
+		{`{"sensor": {"temperature": "hot"}}`, false},
+		{`{"sensor": {}}`, false},
+		{`"not an object"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := webhook.Accepts(0, decodePayload(t, tt.payload)); got != tt.want {
+			t.Errorf("Accepts(%s) = %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestPayloadConditionEquality(t *testing.T) {
+	tests := []struct {
+		condition PayloadCondition
+		payload   string
+		want      bool
+	}{
+		{PayloadCondition{Path: "status", Operator: "==", Value: "alarm"}, `{"status": "alarm"}`, true},
+		{PayloadCondition{Path: "status", Operator: "!=", Value: "ok"}, `{"status": "ok"}`, false},
+		{PayloadCondition{Path: "readings[1]", Operator: "==", Value: 2}, `{"readings": [1, 2]}`, true},
+		{PayloadCondition{Path: "armed", Operator: "==", Value: true}, `{"armed": true}`, true},
+		{PayloadCondition{Path: "armed", Operator: "==", Value: true}, `{"armed": "true"}`, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.condition.Matches(decodePayload(t, tt.payload)); got != tt.want {
+			t.Errorf("%s %s %v on %s = %v, want %v", tt.condition.Path, tt.condition.Operator, tt.condition.Value, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestPayloadConditionValidate(t *testing.T) {
+	invalid := []PayloadCondition{
+		{Path: "", Operator: "==", Value: 1},
+		{Path: "items[*].price", Operator: "==", Value: 1},
+		{Path: "temperature", Operator: "~", Value: 1},
+		{Path: "temperature", Operator: ">", Value: true},
+	}
+	for _, condition := range invalid {
+		if err := condition.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", condition)
+		}
+	}
+
+	valid := PayloadCondition{Path: "$.temperature", Operator: "<", Value: 0}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected %+v to be accepted, got %v", valid, err)
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	// DeliveryStatusDelivered means the receiver accepted the notification
+	DeliveryStatusDelivered = "delivered"
+	// DeliveryStatusPending means delivery failed and will be retried
+	DeliveryStatusPending = "pending"
+	// DeliveryStatusFailed means delivery was abandoned after exceeding the maximum age
+	DeliveryStatusFailed = "failed"
+)
+
+// GlobalWebhookID is the webhook ID recorded for deliveries to the globally configured webhook
+const GlobalWebhookID = "global"
+
+// ConfirmWebhookID is the webhook ID recorded for deliveries to the configured confirmation webhook
+const ConfirmWebhookID = "confirm"
+
+// WebhookDelivery records the delivery of a notification to a webhook
+type WebhookDelivery struct {
+	ID          string    `json:"id" bson:"_id,omitempty"`
+	WebhookID   string    `json:"webhook_id" bson:"webhook_id"`
+	Topic       string    `json:"topic" bson:"topic"`
+	Payload     string    `json:"payload" bson:"payload"`
+	Status      string    `json:"status" bson:"status"`
+	Attempts    int       `json:"attempts" bson:"attempts"`
+	LastError   string    `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextRetryAt time.Time `json:"next_retry_at,omitempty" bson:"next_retry_at,omitempty"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
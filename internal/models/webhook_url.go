@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// validateURLSyntax checks that a webhook URL is an absolute http or https URL
+func validateURLSyntax(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, NewValidationError(fmt.Sprintf("URL is invalid: %v", err))
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, NewValidationError("URL must use the http or https scheme")
+	}
+	if u.Hostname() == "" {
+		return nil, NewValidationError("URL must include a host")
+	}
+	return u, nil
+}
+
+// ValidateURL checks the webhook URL and, unless private destinations are allowed, resolves its host
+// and rejects loopback, link-local, private, and unspecified addresses
+func (w *Webhook) ValidateURL(allowPrivate bool) error {
+	u, err := validateURLSyntax(w.URL)
+	if err != nil {
+		return err
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return checkPublicIP(host, ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return NewValidationError(fmt.Sprintf("URL host %s could not be resolved: %v", host, err))
+	}
+	for _, addr := range addrs {
+		if err := checkPublicIP(host, addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPublicIP returns a validation error if an address of the host is not publicly routable
+func checkPublicIP(host string, ip net.IP) error {
+	if kind := PrivateAddressKind(ip); kind != "" {
+		return NewValidationError(fmt.Sprintf("URL host %s resolves to %s address %s, which is not allowed", host, kind, ip))
+	}
+	return nil
+}
+
+// Address ranges that are not publicly routable but are not covered by the net.IP predicates
+var (
+	// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+	// thisNetwork is the "this network" range of RFC 1122, which some systems route to the local host
+	thisNetwork = &net.IPNet{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+)
+
+// PrivateAddressKind describes why an IP address is not publicly routable,
+// or returns "" for public addresses
+func PrivateAddressKind(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "a loopback"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return "a link-local"
+	case ip.IsPrivate():
+		return "a private"
+	case sharedAddressSpace.Contains(ip):
+		return "a shared (carrier-grade NAT)"
+	case ip.IsUnspecified(), thisNetwork.Contains(ip):
+		return "an unspecified"
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestValidateURLRejectsPrivateAddresses(t *testing.T) {
+	urls := []string{
+		"http://127.0.0.1:8080/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.1.10/hook",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://0.1.2.3/hook",
+		"http://100.64.0.1/hook",
+		"http://100.127.255.254/hook",
+		"http://[::ffff:100.64.0.1]/hook",
+	}
+
+	for _, rawURL := range urls {
+		webhook := &Webhook{URL: rawURL}
+		if err := webhook.ValidateURL(false); err == nil {
+			t.Errorf("Expected %s to be rejected", rawURL)
+		}
+		if err := webhook.ValidateURL(true); err != nil {
+			t.Errorf("Expected %s to be allowed when private addresses are allowed, got %v", rawURL, err)
+		}
+	}
+}
+
+func TestValidateURLAcceptsPublicAddresses(t *testing.T) {
+	for _, rawURL := range []string{"https://93.184.216.34/hook", "http://100.63.255.254/hook", "http://100.128.0.1/hook", "http://1.0.0.1/hook"} {
+		webhook := &Webhook{URL: rawURL}
+		if err := webhook.ValidateURL(false); err != nil {
+			t.Errorf("Expected public address %s to be accepted, got %v", rawURL, err)
+		}
+	}
+}
+
+func TestValidateURLRequiresHTTP(t *testing.T) {
+	for _, rawURL := range []string{"ftp://example.com/hook", "file:///etc/passwd", "example.com/hook"} {
+		webhook := &Webhook{URL: rawURL}
+		if err := webhook.ValidateURL(true); err == nil {
+			t.Errorf("Expected %s to be rejected", rawURL)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"math/rand"
+	"time"
+
+	"MQTTmicroService/internal/config"
+)
+
+// reconnectBackoff computes the delays between attempts to reconnect a lost connection
+type reconnectBackoff struct {
+	// initial is the delay before the first attempt
+	initial time.Duration
+	// max caps the delay
+	max time.Duration
+	// jitter is the fraction by which each delay is randomly shortened
+	jitter float64
+	// random returns a number in [0, 1)
+	random func() float64
+}
+
+// newReconnectBackoff creates the reconnect backoff of a broker, using the defaults for unset intervals
+func newReconnectBackoff(cfg *config.BrokerConfig) reconnectBackoff {
+	return reconnectBackoff{
+		initial: secondsOrDefault(cfg.ReconnectInitialInterval, config.DefaultReconnectInitialInterval),
+		max:     secondsOrDefault(cfg.MaxReconnectInterval, config.DefaultMaxReconnectInterval),
+		jitter:  cfg.ReconnectJitter,
+		random:  rand.Float64,
+	}
+}
+
+// delay returns how long to wait before the given reconnect attempt, counting from 1. The delay starts at the
+// initial interval and doubles with every attempt up to the maximum, then is shortened by a random fraction of
+// up to the jitter, so clients that lost their connection together spread their attempts out.
+func (b reconnectBackoff) delay(attempt int) time.Duration {
+	delay := b.initial
+	for i := 1; i < attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+
+	if b.jitter > 0 {
+		delay -= time.Duration(float64(delay) * b.jitter * b.random())
+	}
+	return delay
+}
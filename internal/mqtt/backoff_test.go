@@ -0,0 +1,53 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+)
+
+func TestReconnectBackoffDelay(t *testing.T) {
+	backoff := newReconnectBackoff(&config.BrokerConfig{MaxReconnectInterval: 10})
+	backoff.random = func() float64 { return 0 }
+
+	expected := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		if got := backoff.delay(i + 1); got != want {
+			t.Errorf("Expected attempt %d to wait %v, got %v", i+1, want, got)
+		}
+	}
+
+	// Far-off attempts stay at the maximum without overflowing
+	if got := backoff.delay(1000); got != 10*time.Second {
+		t.Errorf("Expected attempt 1000 to wait 10s, got %v", got)
+	}
+}
+
+func TestReconnectBackoffJitter(t *testing.T) {
+	backoff := newReconnectBackoff(&config.BrokerConfig{ReconnectInitialInterval: 4, MaxReconnectInterval: 60, ReconnectJitter: 0.5})
+
+	tests := []struct {
+		random   float64
+		expected time.Duration
+	}{
+		{0, 8 * time.Second},
+		{0.5, 6 * time.Second},
+		{0.999, 4*time.Second + 4*time.Millisecond},
+	}
+
+	for _, test := range tests {
+		backoff.random = func() float64 { return test.random }
+		if got := backoff.delay(2); got != test.expected {
+			t.Errorf("Expected a delay of %v with random %v, got %v", test.expected, test.random, got)
+		}
+	}
+}
+
+func TestReconnectBackoffInitialAboveMax(t *testing.T) {
+	backoff := newReconnectBackoff(&config.BrokerConfig{ReconnectInitialInterval: 30, MaxReconnectInterval: 5})
+
+	if got := backoff.delay(1); got != 5*time.Second {
+		t.Errorf("Expected the first delay to be capped at 5s, got %v", got)
+	}
+}
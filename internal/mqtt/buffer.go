@@ -0,0 +1,139 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"MQTTmicroService/internal/database"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Directions of buffered messages
+const (
+	// DirectionPublished is a message published by the service
+	DirectionPublished = "published"
+	// DirectionReceived is a message received on a subscription
+	DirectionReceived = "received"
+)
+
+// BufferedMessage is a message kept in the recent messages buffer
+type BufferedMessage struct {
+	Direction   string      `json:"direction"`
+	Broker      string      `json:"broker"`
+	Topic       string      `json:"topic"`
+	Payload     interface{} `json:"payload"`
+	ContentType string      `json:"content_type"`
+	QoS         byte        `json:"qos"`
+	Retained    bool        `json:"retained"`
+	Timestamp   time.Time   `json:"timestamp"`
+}
+
+// MessageBuffer is a fixed-size ring buffer of the most recent messages, overwriting the oldest when full
+type MessageBuffer struct {
+	mu       sync.Mutex
+	messages []BufferedMessage
+	// payloads holds the raw payload of each message, decoded only when the buffer is read
+	payloads [][]byte
+	next     int
+	count    int
+}
+
+// NewMessageBuffer creates a buffer holding up to size messages
+func NewMessageBuffer(size int) *MessageBuffer {
+	return &MessageBuffer{
+		messages: make([]BufferedMessage, size),
+		payloads: make([][]byte, size),
+	}
+}
+
+// Add adds a message to the buffer, copying its payload
+func (b *MessageBuffer) Add(msg BufferedMessage, payload []byte) {
+	if len(b.messages) == 0 {
+		return
+	}
+	payload = append([]byte(nil), payload...)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.messages[b.next] = msg
+	b.payloads[b.next] = payload
+	b.next = (b.next + 1) % len(b.messages)
+	if b.count < len(b.messages) {
+		b.count++
+	}
+}
+
+// Recent returns up to limit messages, newest first; a limit of 0 or less returns every buffered message
+func (b *MessageBuffer) Recent(limit int) []BufferedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if limit <= 0 || limit > b.count {
+		limit = b.count
+	}
+
+	messages := make([]BufferedMessage, 0, limit)
+	for i := 1; i <= limit; i++ {
+		index := (b.next - i + len(b.messages)) % len(b.messages)
+		msg := b.messages[index]
+		msg.Payload, msg.ContentType = database.DecodePayload(b.payloads[index], "")
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// RecentMessages returns up to limit of the most recently published and received messages, newest first
+func (m *Manager) RecentMessages(limit int) []BufferedMessage {
+	if m.buffer == nil {
+		return []BufferedMessage{}
+	}
+	return m.buffer.Recent(limit)
+}
+
+// bufferPublished adds a published message to the manager's buffer if it has one
+func (c *Client) bufferPublished(topic string, qos byte, retained bool, payload interface{}) {
+	if c.manager == nil || c.manager.buffer == nil {
+		return
+	}
+
+	var data []byte
+	switch p := payload.(type) {
+	case string:
+		data = []byte(p)
+	case []byte:
+		data = p
+	}
+
+	c.manager.buffer.Add(BufferedMessage{
+		Direction: DirectionPublished,
+		Broker:    c.config.Name,
+		Topic:     topic,
+		QoS:       qos,
+		Retained:  retained,
+		Timestamp: time.Now(),
+	}, data)
+}
+
+// bufferReceived wraps a subscription callback so received messages are added to the manager's buffer
+func (c *Client) bufferReceived(callback mqtt.MessageHandler) mqtt.MessageHandler {
+	if c.manager == nil || c.manager.buffer == nil {
+		return callback
+	}
+
+	return func(client mqtt.Client, msg mqtt.Message) {
+		c.manager.buffer.Add(BufferedMessage{
+			Direction: DirectionReceived,
+			Broker:    c.config.Name,
+			Topic:     msg.Topic(),
+			QoS:       msg.Qos(),
+			Retained:  msg.Retained(),
+			Timestamp: time.Now(),
+		}, msg.Payload())
+
+		if callback != nil {
+			callback(client, msg)
+		}
+	}
+}
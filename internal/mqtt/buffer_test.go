@@ -0,0 +1,42 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestMessageBufferKeepsLastMessages(t *testing.T) {
+	buffer := NewMessageBuffer(3)
+	for i := 1; i <= 5; i++ {
+		buffer.Add(BufferedMessage{Topic: fmt.Sprintf("sensors/%d", i)}, []byte(fmt.Sprintf(`{"value":%d}`, i)))
+	}
+
+	messages := buffer.Recent(0)
+	if len(messages) != 3 {
+		t.Fatalf("Expected the buffer to hold 3 messages, got %d", len(messages))
+	}
+	for i, want := range []string{"sensors/5", "sensors/4", "sensors/3"} {
+		if messages[i].Topic != want {
+			t.Errorf("Expected message %d on '%s', got '%s'", i, want, messages[i].Topic)
+		}
+	}
+	if payload, ok := messages[0].Payload.(json.RawMessage); !ok || string(payload) != `{"value":5}` {
+		t.Errorf("Expected the newest payload as raw JSON, got %#v", messages[0].Payload)
+	}
+
+	if messages := buffer.Recent(2); len(messages) != 2 || messages[1].Topic != "sensors/4" {
+		t.Errorf("Expected the 2 newest messages, got %+v", messages)
+	}
+}
+
+func TestMessageBufferCopiesPayloads(t *testing.T) {
+	buffer := NewMessageBuffer(1)
+	payload := []byte("hello")
+	buffer.Add(BufferedMessage{Topic: "sensors/temp"}, payload)
+	payload[0] = 'j'
+
+	if got := buffer.Recent(1)[0].Payload; got != "hello" {
+		t.Errorf("Expected the buffered payload to be unaffected by the caller, got %v", got)
+	}
+}
@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// Machine-readable reasons for a failed connection attempt
+const (
+	ReasonUnacceptableProtocolVersion = "unacceptable_protocol_version"
+	ReasonIdentifierRejected          = "identifier_rejected"
+	ReasonServerUnavailable           = "server_unavailable"
+	ReasonBadUsernameOrPassword       = "bad_username_or_password"
+	ReasonNotAuthorized               = "not_authorized"
+	ReasonNetworkError                = "network_error"
+	ReasonUnknown                     = "unknown"
+)
+
+// connackReasons maps CONNACK return codes to machine-readable reasons
+var connackReasons = map[byte]string{
+	packets.ErrRefusedBadProtocolVersion:    ReasonUnacceptableProtocolVersion,
+	packets.ErrRefusedIDRejected:            ReasonIdentifierRejected,
+	packets.ErrRefusedServerUnavailable:     ReasonServerUnavailable,
+	packets.ErrRefusedBadUsernameOrPassword: ReasonBadUsernameOrPassword,
+	packets.ErrRefusedNotAuthorised:         ReasonNotAuthorized,
+	packets.ErrNetworkError:                 ReasonNetworkError,
+}
+
+// ErrSubscriptionRefused is returned when the broker refuses a subscription with the SUBACK failure code 0x80,
+// typically because an ACL denies it
+var ErrSubscriptionRefused = errors.New("subscription refused by broker")
+
+// ConnectError represents a failed connection attempt, including the broker's CONNACK return code
+type ConnectError struct {
+	// Broker is the name of the broker the connection attempt was made to
+	Broker string
+	// ReturnCode is the CONNACK return code reported by paho
+	ReturnCode byte
+	// Reason is a machine-readable description of the return code
+	Reason string
+	// Err is the underlying paho error
+	Err error
+}
+
+// Error returns the error message
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("failed to connect to MQTT broker: %v", e.Err)
+}
+
+// Unwrap returns the underlying paho error
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// newConnectError creates a ConnectError from a failed connect token
+func newConnectError(broker string, token mqtt.Token) *ConnectError {
+	connErr := &ConnectError{
+		Broker: broker,
+		Reason: ReasonUnknown,
+		Err:    token.Error(),
+	}
+
+	if connectToken, ok := token.(*mqtt.ConnectToken); ok {
+		connErr.ReturnCode = connectToken.ReturnCode()
+	}
+
+	if reason, exists := connackReasons[connErr.ReturnCode]; exists {
+		connErr.Reason = reason
+	}
+
+	return connErr
+}
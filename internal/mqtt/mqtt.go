@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -15,17 +16,30 @@ import (
 	"MQTTmicroService/internal/database"
 	"MQTTmicroService/internal/logger"
 	"MQTTmicroService/internal/metrics"
+	"MQTTmicroService/internal/utils"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// DefaultPublishTimeout is how long Publish and PublishMessage wait for the broker to acknowledge a message
+const DefaultPublishTimeout = 30 * time.Second
+
 // Client represents an MQTT client
 type Client struct {
 	config     *config.BrokerConfig
 	client     mqtt.Client
 	logger     *logger.Logger
-	subscriptions map[string]mqtt.MessageHandler
+	subscriptions map[string]Subscription
 	manager    *Manager
+	lastConnectErr *ConnectError
+	// connectedAt is when the client last connected, including automatic reconnects
+	connectedAt time.Time
+	proberStop chan struct{}
+	// reconnectStop stops the running reconnect loop, nil when none is running
+	reconnectStop chan struct{}
+	// lastProbe caches the latest latency probe, guarded by probeMu
+	lastProbe  *ProbeResult
+	probeMu    sync.Mutex
 	mu         sync.RWMutex
 }
 
@@ -36,6 +50,14 @@ type Manager struct {
 	logger     *logger.Logger
 	metrics    *metrics.Metrics
 	db         database.Database
+	// buffer keeps the most recent messages, nil when disabled
+	buffer     *MessageBuffer
+	// storeTransforms are applied to the stored copies of published messages
+	storeTransforms []StoreTransform
+	// connectHooks are run every time a client connects
+	connectHooks []ConnectHook
+	// storeWriter stores published messages in the background, nil when they are stored in the publish path
+	storeWriter *storeWriter
 	mu         sync.RWMutex
 }
 
@@ -55,13 +77,73 @@ func (m *Manager) GetAllClients() map[string]*Client {
 
 // NewManager creates a new MQTT client manager
 func NewManager(cfg *config.Config, log *logger.Logger, metricsCollector *metrics.Metrics, db database.Database) *Manager {
-	return &Manager{
+	m := &Manager{
 		config:  cfg,
 		clients: make(map[string]*Client),
 		logger:  log,
 		metrics: metricsCollector,
 		db:      db,
 	}
+	if cfg.MemoryBufferSize > 0 {
+		m.buffer = NewMessageBuffer(cfg.MemoryBufferSize)
+	}
+	if cfg.Database != nil {
+		m.storeTransforms = NewStoreTransforms(cfg.Database)
+		if db != nil && cfg.Database.StoreAsync {
+			m.storeWriter = newStoreWriter(cfg.Database, db, log, metricsCollector)
+		}
+	}
+	return m
+}
+
+// StopStorageWriter waits until the messages queued for asynchronous storage are stored or the context expires.
+// Messages published afterwards are stored in the publish path.
+func (m *Manager) StopStorageWriter(ctx context.Context) {
+	if m.storeWriter != nil {
+		m.storeWriter.stop(ctx)
+	}
+}
+
+// AddStoreTransform adds a transform applied to the stored copies of published messages, after the configured ones
+func (m *Manager) AddStoreTransform(transform StoreTransform) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storeTransforms = append(m.storeTransforms, transform)
+}
+
+// ConnectHook is run every time a client connects to its broker, including automatic reconnects
+type ConnectHook func(broker string, client *Client)
+
+// AddConnectHook adds a hook run every time a client connects. Hooks run after the connection is made,
+// outside the goroutine that made it, so they may subscribe.
+func (m *Manager) AddConnectHook(hook ConnectHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connectHooks = append(m.connectHooks, hook)
+}
+
+// runConnectHooks runs the connect hooks for a client that just connected
+func (m *Manager) runConnectHooks(broker string, client *Client) {
+	m.mu.RLock()
+	hooks := m.connectHooks
+	m.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(broker, client)
+	}
+}
+
+// transformForStorage applies the store transforms to a message about to be stored, reporting whether to store it
+func (m *Manager) transformForStorage(msg *database.Message) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, transform := range m.storeTransforms {
+		if !transform(msg) {
+			return false
+		}
+	}
+	return true
 }
 
 // GetClient returns an MQTT client for the specified broker
@@ -110,6 +192,9 @@ func (m *Manager) createClient(cfg *config.BrokerConfig) (*Client, error) {
 		return nil, err
 	}
 
+	// The wrapper is created last, but the handlers below only run once it exists
+	var wrapper *Client
+
 	// Create options
 	opts := mqtt.NewClientOptions()
 
@@ -121,32 +206,41 @@ func (m *Manager) createClient(cfg *config.BrokerConfig) (*Client, error) {
 	opts.AddBroker(fmt.Sprintf("%s://%s:%d", protocol, cfg.Host, cfg.Port))
 	opts.SetClientID(cfg.ClientID)
 	opts.SetCleanSession(cfg.CleanSession)
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(1 * time.Minute)
-	opts.SetKeepAlive(30 * time.Second)
-	opts.SetPingTimeout(10 * time.Second)
-	opts.SetWriteTimeout(10 * time.Second)
+	// Lost connections are re-established by the client's own reconnect loop, which adds jitter to paho's backoff
+	opts.SetAutoReconnect(false)
+	opts.SetKeepAlive(secondsOrDefault(cfg.KeepAlive, config.DefaultKeepAlive))
+	opts.SetPingTimeout(secondsOrDefault(cfg.PingTimeout, config.DefaultPingTimeout))
+	opts.SetWriteTimeout(secondsOrDefault(cfg.WriteTimeout, config.DefaultWriteTimeout))
+	opts.SetConnectTimeout(secondsOrDefault(cfg.ConnectTimeout, config.DefaultConnectTimeout))
 	opts.SetOrderMatters(false)
+	if cfg.ProtocolVersion != 0 {
+		opts.SetProtocolVersion(uint(cfg.ProtocolVersion))
+	}
+
+	// Persist in-flight QoS 1/2 messages so they survive restarts when clean session is disabled
+	if cfg.StoreDir != "" {
+		opts.SetStore(mqtt.NewFileStore(cfg.StoreDir))
+	}
+	// Resend the in-flight messages of a resumed session a few at a time instead of flooding the broker
+	opts.SetMaxResumePubInFlight(cfg.MaxInflight)
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		m.logger.WithError(err).Error("MQTT connection lost")
 		// Update metrics if available
 		if m.metrics != nil {
 			m.metrics.IncrementDisconnections()
 		}
-	})
-	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
-		m.logger.Info("MQTT reconnecting")
-		// Update metrics if available
-		if m.metrics != nil {
-			m.metrics.IncrementConnectionAttempts()
-		}
+		wrapper.startReconnecting()
 	})
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		m.logger.WithField("broker", cfg.Name).Info("MQTT connected")
+		wrapper.mu.Lock()
+		wrapper.connectedAt = time.Now()
+		wrapper.mu.Unlock()
 		// Update metrics if available
 		if m.metrics != nil {
 			m.metrics.IncrementConnectionSuccesses()
 		}
+		m.runConnectHooks(cfg.Name, wrapper)
 	})
 
 	// Set credentials if provided
@@ -186,25 +280,121 @@ func (m *Manager) createClient(cfg *config.BrokerConfig) (*Client, error) {
 	client := mqtt.NewClient(opts)
 
 	// Create client wrapper
-	return &Client{
+	wrapper = &Client{
 		config:     cfg,
 		client:     client,
 		logger:     m.logger,
-		subscriptions: make(map[string]mqtt.MessageHandler),
+		subscriptions: make(map[string]Subscription),
 		manager:    m,
-	}, nil
+	}
+	return wrapper, nil
+}
+
+// secondsOrDefault converts a configured number of seconds to a duration, using the default when unset
+func secondsOrDefault(seconds, defaultSeconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = defaultSeconds
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // Connect connects to the MQTT broker
+// On failure the returned error is a *ConnectError carrying the broker's CONNACK return code
 func (c *Client) Connect() error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	c.startProber()
+	return nil
+}
+
+// ConnectWithRetry connects to the MQTT broker, retrying failed attempts with exponential backoff
+// capped at maxWait. It returns the last connection error once all attempts have failed.
+func (c *Client) ConnectWithRetry(ctx context.Context, attempts int, maxWait time.Duration) error {
+	wait := time.Second
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = c.Connect(); err == nil {
+			return nil
+		}
+
+		fields := map[string]interface{}{
+			"broker":       c.config.Name,
+			"attempt":      attempt,
+			"max_attempts": attempts,
+		}
+		if attempt == attempts {
+			c.logger.WithError(err).WithFields(fields).Error("Connection attempt failed, giving up")
+			break
+		}
+
+		if wait > maxWait {
+			wait = maxWait
+		}
+		fields["retry_in"] = wait.String()
+		c.logger.WithError(err).WithFields(fields).Warn("Connection attempt failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	return err
+}
+
+// connect performs a single connection attempt and records its outcome
+func (c *Client) connect() error {
+	// Successes are counted by the OnConnect handler, which also sees automatic reconnects
+	if c.manager != nil && c.manager.metrics != nil {
+		c.manager.metrics.IncrementConnectionAttempts()
+	}
+
 	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+		if c.manager != nil && c.manager.metrics != nil {
+			c.manager.metrics.IncrementConnectionFailures()
+		}
+
+		connErr := newConnectError(c.config.Name, token)
+		c.mu.Lock()
+		c.lastConnectErr = connErr
+		c.mu.Unlock()
+		return connErr
 	}
+
+	// The OnConnect handler records automatic reconnects, but runs asynchronously
+	c.mu.Lock()
+	c.lastConnectErr = nil
+	c.connectedAt = time.Now()
+	c.mu.Unlock()
 	return nil
 }
 
+// LastConnectError returns the error from the most recent failed connection attempt, or nil
+func (c *Client) LastConnectError() *ConnectError {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastConnectErr
+}
+
+// ConnectedAt returns when the client last connected to the broker, or the zero time if it never did
+func (c *Client) ConnectedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connectedAt
+}
+
 // Disconnect disconnects from the MQTT broker
 func (c *Client) Disconnect() {
+	c.stopProber()
+	c.stopReconnecting()
+
+	// paho doesn't call the connection lost handler for requested disconnects
+	if c.client.IsConnected() && c.manager != nil && c.manager.metrics != nil {
+		c.manager.metrics.IncrementDisconnections()
+	}
 	c.client.Disconnect(250)
 }
 
@@ -215,89 +405,521 @@ func (c *Client) IsConnected() bool {
 
 // Publish publishes a message to the specified topic
 func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultPublishTimeout)
+	defer cancel()
+
+	return c.PublishContext(ctx, topic, qos, retained, payload)
+}
+
+// PublishContext publishes a message like Publish, but waits for the broker's acknowledgement only until the
+// context is done. A message that wasn't acknowledged in time is recorded as failed, although the client may
+// still deliver it later.
+func (c *Client) PublishContext(ctx context.Context, topic string, qos byte, retained bool, payload interface{}) error {
+	_, err := c.PublishMessageContext(ctx, topic, qos, retained, payload)
+	return err
+}
+
+// PublishResult describes a published message
+type PublishResult struct {
+	// ID is the ID of the stored message, empty if no database is configured or storing it failed
+	ID string
+	// Timestamp is when the message was published
+	Timestamp time.Time
+}
+
+// PublishMessage publishes a message to the specified topic like Publish, and returns the ID and timestamp
+// of the stored message. The result is also returned when the publish fails after the message was stored.
+func (c *Client) PublishMessage(topic string, qos byte, retained bool, payload interface{}) (*PublishResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultPublishTimeout)
+	defer cancel()
+
+	return c.PublishMessageContext(ctx, topic, qos, retained, payload)
+}
+
+// PublishMessageContext publishes a message like PublishMessage, waiting for the broker's acknowledgement only
+// until the context is done
+func (c *Client) PublishMessageContext(ctx context.Context, topic string, qos byte, retained bool, payload interface{}) (*PublishResult, error) {
 	if !c.IsConnected() {
-		return fmt.Errorf("client is not connected")
+		return nil, fmt.Errorf("client is not connected")
 	}
 
+	finalPayload, err := mqttPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Publish to the normalized or rewritten topic, keeping the requested one for the stored message
+	originalTopic := topic
+	if topic, err = c.rewriteTopic(topic); err != nil {
+		return nil, err
+	}
+
+	// Record the message before publishing so failed deliveries are tracked too
+	result := &PublishResult{Timestamp: time.Now()}
+	dbMsg := c.storePendingMessage(topic, originalTopic, qos, retained, payload)
+	if dbMsg != nil {
+		result.ID = dbMsg.ID
+		result.Timestamp = dbMsg.Timestamp
+	}
+
+	// Wait for the broker's acknowledgement: PUBACK for QoS 1, PUBCOMP for QoS 2
+	token := c.client.Publish(topic, qos, retained, finalPayload)
+	if err := waitToken(ctx, token); err != nil {
+		c.updateMessageStatus(dbMsg, database.MessageStatusFailed)
+		return result, fmt.Errorf("failed to publish message: %w", err)
+	}
+	c.updateMessageStatus(dbMsg, database.MessageStatusDelivered)
+	c.bufferPublished(topic, qos, retained, finalPayload)
+
+	c.logger.WithFields(map[string]interface{}{
+		"topic":    topic,
+		"qos":      qos,
+		"retained": retained,
+	}).Debug("Message published")
+
+	return result, nil
+}
+
+// waitToken waits for a token to complete or the context to be done, returning the token's error or the context's
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rewriteTopic normalizes a topic if enabled and applies the configured topic rewrite rules to it, checking that a
+// rewritten topic can be published to
+func (c *Client) rewriteTopic(topic string) (string, error) {
+	if c.manager == nil {
+		return topic, nil
+	}
+
+	rewritten := topic
+	if c.manager.config.TopicNormalize {
+		rewritten = utils.NormalizeTopic(rewritten)
+	}
+	if c.manager.config.TopicRewrite != nil {
+		rewritten = c.manager.config.TopicRewrite.Rewrite(rewritten)
+	}
+	if rewritten != topic {
+		if err := utils.ValidatePublishTopic(rewritten); err != nil {
+			return "", fmt.Errorf("topic %s was rewritten to the invalid topic %s: %w", topic, rewritten, err)
+		}
+	}
+	return rewritten, nil
+}
+
+// mqttPayload converts a payload to the format sent to the broker
+func mqttPayload(payload interface{}) (interface{}, error) {
 	// Convert payload to appropriate format based on type
-	var finalPayload interface{}
 	switch p := payload.(type) {
+	case nil:
+		// Publish a missing payload as an empty one, not as the JSON null
+		return []byte{}, nil
 	case string:
-		finalPayload = p
+		return p, nil
 	case []byte:
-		finalPayload = p
+		return p, nil
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
 		// For primitive types, convert to string
-		finalPayload = fmt.Sprintf("%v", p)
+		return fmt.Sprintf("%v", p), nil
 	default:
 		// For complex types (maps, structs, etc.), convert to JSON string
 		jsonBytes, err := json.Marshal(p)
 		if err != nil {
-			return fmt.Errorf("failed to marshal payload to JSON: %w", err)
+			return nil, fmt.Errorf("failed to marshal payload to JSON: %w", err)
 		}
-		finalPayload = jsonBytes
+		return jsonBytes, nil
 	}
+}
 
-	token := c.client.Publish(topic, qos, retained, finalPayload)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish message: %w", token.Error())
+// BatchMessage is a single message of a batch publish
+type BatchMessage struct {
+	Topic    string
+	Payload  interface{}
+	QoS      byte
+	Retained bool
+	// originalTopic is the requested topic of a message whose topic was rewritten
+	originalTopic string
+}
+
+// BatchResult is the outcome of publishing a single message of a batch
+type BatchResult struct {
+	// ID is the ID of the stored message, empty if it wasn't stored
+	ID string
+	// Err is the reason the message wasn't delivered, nil if the broker acknowledged it
+	Err error
+}
+
+// PublishBatch publishes several messages without waiting for each acknowledgement before sending the next,
+// then stores them with their delivery status in a single database call. Unlike Publish, messages are only
+// recorded once the broker has acknowledged them, so the batch costs one database round-trip instead of several
+// per message. It returns the outcome of each message in order.
+func (c *Client) PublishBatch(msgs []BatchMessage) ([]BatchResult, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("client is not connected")
 	}
 
-	// Store message in database if available
-	if c.manager != nil && c.manager.db != nil {
-		// Create a context with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	results := make([]BatchResult, len(msgs))
+	tokens := make([]mqtt.Token, len(msgs))
+	payloads := make([]interface{}, len(msgs))
+	// Rewrite topics on a copy, so the caller's messages are left as they are
+	msgs = append([]BatchMessage(nil), msgs...)
+	for i := range msgs {
+		msg := &msgs[i]
+		payload, err := mqttPayload(msg.Payload)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
 
-		// Create a database message
-		dbMsg := &database.Message{
-			Topic:     topic,
-			Payload:   payload,
-			QoS:       qos,
-			Retained:  retained,
-			Timestamp: time.Now(),
-			Confirmed: false,
+		msg.originalTopic = msg.Topic
+		if msg.Topic, err = c.rewriteTopic(msg.Topic); err != nil {
+			results[i].Err = err
+			continue
 		}
 
-		// Store the message in the database
-		if err := c.manager.db.StoreMessage(ctx, dbMsg); err != nil {
-			c.logger.WithError(err).Error("Failed to store message in database")
-			// Don't return error here, as the message was successfully published to MQTT
-		} else {
-			c.logger.WithField("id", dbMsg.ID).Debug("Message stored in database")
+		payloads[i] = payload
+		tokens[i] = c.client.Publish(msg.Topic, msg.QoS, msg.Retained, payload)
+	}
+
+	// Wait for the broker's acknowledgements: PUBACK for QoS 1, PUBCOMP for QoS 2
+	for i, token := range tokens {
+		if token == nil {
+			continue
+		}
+		if token.Wait() && token.Error() != nil {
+			results[i].Err = fmt.Errorf("failed to publish message: %w", token.Error())
+			continue
 		}
+		c.bufferPublished(msgs[i].Topic, msgs[i].QoS, msgs[i].Retained, payloads[i])
 	}
 
+	c.storeBatch(msgs, tokens, results)
+
 	c.logger.WithFields(map[string]interface{}{
-		"topic":    topic,
-		"qos":      qos,
-		"retained": retained,
-	}).Debug("Message published")
+		"messages": len(msgs),
+	}).Debug("Message batch published")
+
+	return results, nil
+}
+
+// storeBatch stores the published messages of a batch with their delivery status if a database is available,
+// recording the IDs of the stored messages in their results. Messages whose payload couldn't be converted or
+// whose topic couldn't be rewritten, and so were never sent, aren't stored, nor are messages a store transform excludes.
+func (c *Client) storeBatch(msgs []BatchMessage, tokens []mqtt.Token, results []BatchResult) {
+	if c.manager == nil || c.manager.db == nil {
+		return
+	}
+
+	now := time.Now()
+	dbMsgs := make([]*database.Message, 0, len(msgs))
+	// indexes maps the position of each stored message to its position in the batch
+	indexes := make([]int, 0, len(msgs))
+	for i, msg := range msgs {
+		if tokens[i] == nil {
+			continue
+		}
+
+		dbMsg := &database.Message{
+			Topic:     msg.Topic,
+			Payload:   msg.Payload,
+			QoS:       msg.QoS,
+			Retained:  msg.Retained,
+			Timestamp: now,
+			Status:    database.MessageStatusDelivered,
+		}
+		if msg.originalTopic != msg.Topic {
+			dbMsg.OriginalTopic = msg.originalTopic
+		}
+		if !c.manager.transformForStorage(dbMsg) {
+			continue
+		}
+		if results[i].Err != nil {
+			dbMsg.Status = database.MessageStatusFailed
+		} else if msg.QoS == 2 {
+			// QoS 2 messages are confirmed once the broker completes the exchange, like single publishes
+			dbMsg.Confirmed = true
+		}
+		dbMsgs = append(dbMsgs, dbMsg)
+		indexes = append(indexes, i)
+	}
+	if len(dbMsgs) == 0 {
+		return
+	}
+
+	// Queue the messages for the background writer, which stores them as soon as the database is free
+	if c.manager.storeWriter != nil {
+		for j, dbMsg := range dbMsgs {
+			dbMsg.ID = newMessageID()
+			c.manager.storeWriter.write(dbMsg)
+			results[indexes[j]].ID = dbMsg.ID
+		}
+		return
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Don't fail the publish if storing fails, the messages were already delivered to MQTT
+	err := c.manager.db.StoreMessages(ctx, dbMsgs)
+	var batchErr *database.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		c.logger.WithError(err).Error("Failed to store message batch in database")
+		return
+	}
+
+	for j, dbMsg := range dbMsgs {
+		if batchErr != nil && batchErr.Failed[j] != nil {
+			logStoreError(c.logger, c.manager.metrics, dbMsg, batchErr.Failed[j])
+			continue
+		}
+		results[indexes[j]].ID = dbMsg.ID
+	}
+}
+
+// logStoreError logs the failure to store a message, or counts it as deduplicated if the database skipped it
+// as a duplicate of a message already stored
+func logStoreError(log *logger.Logger, metricsCollector *metrics.Metrics, msg *database.Message, err error) {
+	if errors.Is(err, database.ErrDuplicateMessage) {
+		if metricsCollector != nil {
+			metricsCollector.IncrementDeduplicatedMessages()
+		}
+		log.WithField("topic", msg.Topic).Debug("Message not stored, an identical message was stored recently")
+		return
+	}
+	log.WithError(err).WithFields(map[string]interface{}{
+		"id":    msg.ID,
+		"topic": msg.Topic,
+	}).Error("Failed to store message in database")
+}
+
+// storePendingMessage stores an outgoing message with the pending status if a database is available.
+// The originalTopic is recorded if the topic was rewritten from it. With asynchronous storage, the message
+// is only given its ID, and is stored by updateMessageStatus once the outcome of the publish is known.
+func (c *Client) storePendingMessage(topic, originalTopic string, qos byte, retained bool, payload interface{}) *database.Message {
+	if c.manager == nil || c.manager.db == nil {
+		return nil
+	}
+
+	// Create a database message
+	dbMsg := &database.Message{
+		Topic:     topic,
+		Payload:   payload,
+		QoS:       qos,
+		Retained:  retained,
+		Timestamp: time.Now(),
+		Confirmed: false,
+		Status:    database.MessageStatusPending,
+	}
+	if originalTopic != topic {
+		dbMsg.OriginalTopic = originalTopic
+	}
+
+	// Only the stored copy is transformed, the payload is published as it is
+	if !c.manager.transformForStorage(dbMsg) {
+		c.logger.WithField("topic", topic).Debug("Message excluded from database storage")
+		return nil
+	}
+
+	if c.manager.storeWriter != nil {
+		dbMsg.ID = newMessageID()
+		return dbMsg
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Store the message in the database
+	if err := c.manager.db.StoreMessage(ctx, dbMsg); err != nil {
+		logStoreError(c.logger, c.manager.metrics, dbMsg, err)
+		// Don't fail the publish, the message can still be delivered to MQTT
+		return nil
+	}
+
+	c.logger.WithField("id", dbMsg.ID).Debug("Message stored in database")
+	return dbMsg
+}
+
+// updateMessageStatus records the delivery outcome of a stored message, or queues the message with its
+// outcome for the background writer with asynchronous storage.
+// QoS 2 messages are confirmed automatically once the broker completes the exchange with PUBCOMP.
+func (c *Client) updateMessageStatus(dbMsg *database.Message, status string) {
+	if dbMsg == nil {
+		return
+	}
 
+	if c.manager.storeWriter != nil {
+		dbMsg.Status = status
+		dbMsg.Confirmed = status == database.MessageStatusDelivered && dbMsg.QoS == 2
+		c.manager.storeWriter.write(dbMsg)
+		return
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.manager.db.UpdateMessageStatus(ctx, dbMsg.ID, status); err != nil {
+		c.logger.WithError(err).WithField("id", dbMsg.ID).Error("Failed to update message status")
+		return
+	}
+	dbMsg.Status = status
+
+	if status == database.MessageStatusDelivered && dbMsg.QoS == 2 {
+		if err := c.manager.db.ConfirmMessage(ctx, dbMsg.ID); err != nil {
+			c.logger.WithError(err).WithField("id", dbMsg.ID).Error("Failed to confirm message")
+			return
+		}
+		dbMsg.Confirmed = true
+	}
+}
+
+// Subscription is an active subscription of a client
+type Subscription struct {
+	// ShareGroup is the share group of a shared subscription, empty for a regular one
+	ShareGroup string
+	// Filter is the topic filter messages are matched against, without the $share/<group>/ prefix
+	Filter string
+	// QoS is the QoS the subscription was requested with, and is restored with after a reconnect
+	QoS byte
+	// GrantedQoS is the QoS the broker granted, which may be lower than requested
+	GrantedQoS byte
+	// SubscribedAt is when the subscription was last made, including restorations after a reconnect
+	SubscribedAt time.Time
+	// Handler receives the subscription's messages
+	Handler mqtt.MessageHandler
+}
+
+// newSubscription describes a subscription to a topic made now, splitting shared subscription topics into their group and filter
+func newSubscription(topic string, qos byte, handler mqtt.MessageHandler) Subscription {
+	subscription := Subscription{Filter: topic, QoS: qos, GrantedQoS: qos, SubscribedAt: time.Now(), Handler: handler}
+	if group, filter, ok := utils.ParseSharedSubscription(topic); ok {
+		subscription.ShareGroup = group
+		subscription.Filter = filter
+	}
+	return subscription
+}
+
+// Topic returns the topic the subscription is made on, including the $share/<group>/ prefix of a shared subscription
+func (s Subscription) Topic() string {
+	return utils.SharedSubscriptionTopic(s.ShareGroup, s.Filter)
+}
+
+// Shared reports whether the subscription is a shared subscription
+func (s Subscription) Shared() bool {
+	return s.ShareGroup != ""
+}
+
+// checkSharedSubscription rejects shared subscriptions on brokers connected with MQTT 3.1,
+// which predates them; brokers supporting shared subscriptions accept them from MQTT 3.1.1 clients
+func (c *Client) checkSharedSubscription(topic string) error {
+	if _, _, ok := utils.ParseSharedSubscription(topic); ok && c.config.ProtocolVersion == 3 {
+		return fmt.Errorf("shared subscription %s is not supported with MQTT 3.1 (protocol version 3) on broker %s", topic, c.config.Name)
+	}
 	return nil
 }
 
-// Subscribe subscribes to the specified topic
+// Subscribe subscribes to the specified topic, which may be a shared subscription ($share/<group>/<filter>)
 func (c *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) error {
+	_, err := c.SubscribeGranted(topic, qos, callback)
+	return err
+}
+
+// SubscribeGranted subscribes to the specified topic like Subscribe, and returns the QoS the broker granted in its
+// SUBACK, which may be lower than requested. A refused subscription returns ErrSubscriptionRefused and isn't recorded.
+func (c *Client) SubscribeGranted(topic string, qos byte, callback mqtt.MessageHandler) (byte, error) {
 	if !c.IsConnected() {
-		return fmt.Errorf("client is not connected")
+		return 0, fmt.Errorf("client is not connected")
+	}
+	if err := c.checkSharedSubscription(topic); err != nil {
+		return 0, err
+	}
+
+	token := c.client.Subscribe(topic, qos, c.bufferReceived(callback))
+	if token.Wait() && token.Error() != nil {
+		return 0, fmt.Errorf("failed to subscribe to topic: %w", token.Error())
+	}
+
+	fields := map[string]interface{}{
+		"topic": topic,
+		"qos":   qos,
+	}
+
+	granted, ok := token.(*mqtt.SubscribeToken).Result()[topic]
+	if !ok {
+		// Brokers answer every subscription, but don't fail one that was acknowledged without a code
+		granted = qos
+	}
+	if granted == subscribeFailure {
+		c.logger.WithFields(fields).Warn("Subscription refused by broker")
+		return subscribeFailure, fmt.Errorf("%w: %s", ErrSubscriptionRefused, topic)
 	}
+	fields["granted_qos"] = granted
 
-	token := c.client.Subscribe(topic, qos, callback)
+	subscription := newSubscription(topic, qos, callback)
+	subscription.GrantedQoS = granted
+	c.mu.Lock()
+	c.subscriptions[topic] = subscription
+	c.mu.Unlock()
+
+	if subscription.Shared() {
+		fields["share_group"] = subscription.ShareGroup
+		fields["filter"] = subscription.Filter
+	}
+	if granted < qos {
+		c.logger.WithFields(fields).Warn("Subscribed to topic with a lower QoS than requested")
+	} else {
+		c.logger.WithFields(fields).Info("Subscribed to topic")
+	}
+
+	return granted, nil
+}
+
+// subscribeFailure is the SUBACK return code of a rejected subscription
+const subscribeFailure = 0x80
+
+// SubscribeMultiple subscribes to several topic filters in a single round-trip, all sharing one callback.
+// It returns the QoS the broker granted for each filter; rejected filters are missing from the result.
+func (c *Client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) (map[string]byte, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("client is not connected")
+	}
+	for topic := range filters {
+		if err := c.checkSharedSubscription(topic); err != nil {
+			return nil, err
+		}
+	}
+
+	token := c.client.SubscribeMultiple(filters, c.bufferReceived(callback))
 	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to subscribe to topic: %w", token.Error())
+		return nil, fmt.Errorf("failed to subscribe to topics: %w", token.Error())
 	}
 
+	granted := make(map[string]byte, len(filters))
 	c.mu.Lock()
-	c.subscriptions[topic] = callback
+	for topic, qos := range token.(*mqtt.SubscribeToken).Result() {
+		if qos == subscribeFailure {
+			continue
+		}
+		granted[topic] = qos
+		subscription := newSubscription(topic, filters[topic], callback)
+		subscription.GrantedQoS = qos
+		c.subscriptions[topic] = subscription
+	}
 	c.mu.Unlock()
 
 	c.logger.WithFields(map[string]interface{}{
-		"topic": topic,
-		"qos":   qos,
-	}).Info("Subscribed to topic")
+		"requested": len(filters),
+		"granted":   len(granted),
+	}).Info("Subscribed to topics")
 
-	return nil
+	return granted, nil
 }
 
 // Unsubscribe unsubscribes from the specified topic
@@ -320,31 +942,31 @@ func (c *Client) Unsubscribe(topic string) error {
 	return nil
 }
 
-// GetSubscriptions returns all active subscriptions
-func (c *Client) GetSubscriptions() map[string]mqtt.MessageHandler {
+// GetSubscriptions returns all active subscriptions by topic
+func (c *Client) GetSubscriptions() map[string]Subscription {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	// Create a copy to avoid race conditions
-	subscriptions := make(map[string]mqtt.MessageHandler, len(c.subscriptions))
-	for topic, handler := range c.subscriptions {
-		subscriptions[topic] = handler
+	subscriptions := make(map[string]Subscription, len(c.subscriptions))
+	for topic, subscription := range c.subscriptions {
+		subscriptions[topic] = subscription
 	}
 
 	return subscriptions
 }
 
-// ResubscribeAll resubscribes to all topics
-func (c *Client) ResubscribeAll() error {
-	c.mu.RLock()
-	subscriptions := make(map[string]mqtt.MessageHandler, len(c.subscriptions))
-	for topic, handler := range c.subscriptions {
-		subscriptions[topic] = handler
-	}
-	c.mu.RUnlock()
+// ClearSubscriptions forgets all subscriptions without unsubscribing from the broker
+func (c *Client) ClearSubscriptions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions = make(map[string]Subscription)
+}
 
-	for topic, handler := range subscriptions {
-		if err := c.Subscribe(topic, 1, handler); err != nil {
+// ResubscribeAll resubscribes to all topics with their QoS, restoring shared subscriptions in their $share/<group>/<filter> form
+func (c *Client) ResubscribeAll() error {
+	for _, subscription := range c.GetSubscriptions() {
+		if err := c.Subscribe(subscription.Topic(), subscription.QoS, subscription.Handler); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,567 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/metrics"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+	"MQTTmicroService/internal/utils"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// testBrokerConfig returns a configuration for the test broker with credentials the broker may reject
+func testBrokerConfig(broker *mqtttest.Broker) *config.BrokerConfig {
+	brokerConfig := broker.BrokerConfig("test")
+	brokerConfig.Username = "user"
+	brokerConfig.Password = "wrong-password"
+	return brokerConfig
+}
+
+// newTestManager creates a manager for a single broker configuration
+func newTestManager(brokerConfig *config.BrokerConfig) *Manager {
+	cfg := &config.Config{
+		DefaultConnection: brokerConfig.Name,
+		Brokers: map[string]*config.BrokerConfig{
+			brokerConfig.Name: brokerConfig,
+		},
+	}
+	log := logger.New(&logger.Config{Level: "error", Output: io.Discard})
+	return NewManager(cfg, log, metrics.New(log), nil)
+}
+
+func TestConnectNotAuthorized(t *testing.T) {
+	broker := mqtttest.Start(t, packets.ErrRefusedNotAuthorised)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+
+	err = client.Connect()
+	if err == nil {
+		t.Fatal("Expected connect to fail, got nil")
+	}
+
+	var connErr *ConnectError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("Expected a *ConnectError, got %T", err)
+	}
+
+	if connErr.Reason != ReasonNotAuthorized {
+		t.Errorf("Expected reason '%s', got '%s'", ReasonNotAuthorized, connErr.Reason)
+	}
+
+	if connErr.ReturnCode != packets.ErrRefusedNotAuthorised {
+		t.Errorf("Expected return code %d, got %d", packets.ErrRefusedNotAuthorised, connErr.ReturnCode)
+	}
+
+	if client.LastConnectError() != connErr {
+		t.Error("Expected LastConnectError to return the failed attempt")
+	}
+}
+
+func TestFailedConnectUpdatesMetrics(t *testing.T) {
+	broker := mqtttest.Start(t, packets.ErrRefusedNotAuthorised)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := client.Connect(); err == nil {
+			t.Fatal("Expected connect to fail, got nil")
+		}
+	}
+
+	if attempts := manager.metrics.ConnectionAttempts; attempts != 2 {
+		t.Errorf("Expected 2 connection attempts, got %d", attempts)
+	}
+	if failures := manager.metrics.ConnectionFailures; failures != 2 {
+		t.Errorf("Expected 2 connection failures, got %d", failures)
+	}
+	if successes := manager.metrics.ConnectionSuccesses; successes != 0 {
+		t.Errorf("Expected no connection successes, got %d", successes)
+	}
+}
+
+func TestConnectWithRetryGivesUp(t *testing.T) {
+	broker := mqtttest.Start(t, packets.ErrRefusedServerUnavailable)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+
+	var connErr *ConnectError
+	if err := client.ConnectWithRetry(context.Background(), 3, 10*time.Millisecond); !errors.As(err, &connErr) {
+		t.Fatalf("Expected a *ConnectError, got %v", err)
+	}
+
+	if attempts := manager.metrics.ConnectionAttempts; attempts != 3 {
+		t.Errorf("Expected 3 connection attempts, got %d", attempts)
+	}
+	if connErr.Reason != ReasonServerUnavailable {
+		t.Errorf("Expected reason '%s', got '%s'", ReasonServerUnavailable, connErr.Reason)
+	}
+}
+
+func TestConnectWithRetryStopsWhenCancelled(t *testing.T) {
+	broker := mqtttest.Start(t, packets.ErrRefusedServerUnavailable)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := client.ConnectWithRetry(ctx, 3, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if attempts := manager.metrics.ConnectionAttempts; attempts != 1 {
+		t.Errorf("Expected 1 connection attempt, got %d", attempts)
+	}
+}
+
+func TestConnectBadCredentials(t *testing.T) {
+	broker := mqtttest.Start(t, packets.ErrRefusedBadUsernameOrPassword)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+
+	var connErr *ConnectError
+	if err := client.Connect(); !errors.As(err, &connErr) {
+		t.Fatalf("Expected a *ConnectError, got %v", err)
+	}
+
+	if connErr.Reason != ReasonBadUsernameOrPassword {
+		t.Errorf("Expected reason '%s', got '%s'", ReasonBadUsernameOrPassword, connErr.Reason)
+	}
+}
+
+func TestFailingProbeTriggersReconnect(t *testing.T) {
+	// The test broker doesn't acknowledge publishes by default, so every probe times out
+	broker := mqtttest.Start(t, packets.Accepted)
+	brokerConfig := testBrokerConfig(broker)
+	brokerConfig.ProbeInterval = 1
+	manager := newTestManager(brokerConfig)
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.probeOnce(100 * time.Millisecond); err == nil {
+		t.Fatal("Expected probe to fail, got nil")
+	}
+
+	if connects := broker.Connects(); connects != 2 {
+		t.Errorf("Expected 2 connection attempts after a failed probe, got %d", connects)
+	}
+
+	if !client.IsConnected() {
+		t.Error("Expected client to be reconnected after a failed probe")
+	}
+
+	if manager.metrics.ProbeFailures != 1 {
+		t.Errorf("Expected 1 probe failure in metrics, got %d", manager.metrics.ProbeFailures)
+	}
+}
+
+func TestSuccessfulProbe(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.probeOnce(time.Second); err != nil {
+		t.Fatalf("Expected probe to succeed, got %v", err)
+	}
+
+	if connects := broker.Connects(); connects != 1 {
+		t.Errorf("Expected no reconnect after a successful probe, got %d connection attempts", connects)
+	}
+
+	if manager.metrics.ProbeSuccesses != 1 {
+		t.Errorf("Expected 1 probe success in metrics, got %d", manager.metrics.ProbeSuccesses)
+	}
+}
+
+func TestProbeLatencyReusesRecentResult(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	if client.ConnectedAt().IsZero() {
+		t.Error("Expected the connection time to be recorded")
+	}
+
+	first := client.ProbeLatency(time.Second, time.Minute)
+	if first.Err != nil || first.Latency <= 0 {
+		t.Fatalf("Expected probe to succeed with a latency, got %+v", first)
+	}
+	if second := client.ProbeLatency(time.Second, time.Minute); second != first {
+		t.Errorf("Expected the recent result to be reused, got %+v", second)
+	}
+	if published := len(broker.Published()); published != 1 {
+		t.Errorf("Expected a single probe message, got %d", published)
+	}
+
+	// Results older than the maximum age are refreshed
+	client.ProbeLatency(time.Second, 0)
+	if published := len(broker.Published()); published != 2 {
+		t.Errorf("Expected a second probe message, got %d", published)
+	}
+}
+
+func TestPublishQoS2ConfirmsStoredMessage(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+
+	dbConfig := &database.Config{Type: "sqlite"}
+	dbConfig.SQLite.Path = filepath.Join(t.TempDir(), "messages.db")
+	db, err := database.New(dbConfig)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	ctx := context.Background()
+	if err := db.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close(ctx)
+
+	manager := newTestManager(testBrokerConfig(broker))
+	manager.db = db
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.Publish("sensors/exactly-once", 2, false, "21.5"); err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+	if err := client.Publish("sensors/at-least-once", 1, false, "21.5"); err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+
+	confirmed, err := db.GetMessages(ctx, true, database.MessageStatusDelivered, 10)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(confirmed) != 1 || confirmed[0].Topic != "sensors/exactly-once" {
+		t.Errorf("Expected only the QoS 2 message to be confirmed, got %d messages", len(confirmed))
+	}
+
+	unconfirmed, err := db.GetMessages(ctx, false, database.MessageStatusDelivered, 10)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	if len(unconfirmed) != 1 || unconfirmed[0].Topic != "sensors/at-least-once" {
+		t.Errorf("Expected the QoS 1 message to be delivered but unconfirmed, got %d messages", len(unconfirmed))
+	}
+}
+
+func TestPublishRewritesTopic(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+
+	dbConfig := &database.Config{Type: "sqlite"}
+	dbConfig.SQLite.Path = filepath.Join(t.TempDir(), "messages.db")
+	db, err := database.New(dbConfig)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	ctx := context.Background()
+	if err := db.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close(ctx)
+
+	manager := newTestManager(testBrokerConfig(broker))
+	manager.db = db
+	manager.config.TopicRewrite, err = utils.ParseTopicRewriteRules("raw/=>normalized/")
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	result, err := client.PublishMessage("raw/foo", 0, false, "hello")
+	if err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+
+	published := broker.WaitForPublished(t, 1)
+	if published[0].TopicName != "normalized/foo" {
+		t.Errorf("Expected the message to be published to normalized/foo, got %s", published[0].TopicName)
+	}
+
+	msg, err := db.GetMessageByID(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if msg.Topic != "normalized/foo" || msg.OriginalTopic != "raw/foo" {
+		t.Errorf("Expected the stored message to record both topics, got %s from %s", msg.Topic, msg.OriginalTopic)
+	}
+}
+
+func TestPublishNormalizesTopicBeforeRewriting(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+
+	manager := newTestManager(testBrokerConfig(broker))
+	manager.config.TopicNormalize = true
+	var err error
+	manager.config.TopicRewrite, err = utils.ParseTopicRewriteRules("raw/=>normalized/")
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.Publish("raw//foo/", 0, false, "hello"); err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+
+	published := broker.WaitForPublished(t, 1)
+	if published[0].TopicName != "normalized/foo" {
+		t.Errorf("Expected the message to be published to normalized/foo, got %s", published[0].TopicName)
+	}
+}
+
+func TestResubscribeAllRestoresSharedSubscriptions(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+
+	manager := newTestManager(testBrokerConfig(broker))
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	handler := func(mqtt.Client, mqtt.Message) {}
+	if err := client.Subscribe("$share/workers/sensors/#", 1, handler); err != nil {
+		t.Fatalf("Expected subscribe to succeed, got %v", err)
+	}
+
+	subscription, ok := client.GetSubscriptions()["$share/workers/sensors/#"]
+	if !ok {
+		t.Fatal("Expected the shared subscription to be recorded")
+	}
+	if !subscription.Shared() || subscription.ShareGroup != "workers" || subscription.Filter != "sensors/#" {
+		t.Errorf("Expected group 'workers' and filter 'sensors/#', got %q and %q", subscription.ShareGroup, subscription.Filter)
+	}
+
+	if err := client.ResubscribeAll(); err != nil {
+		t.Fatalf("Expected resubscribe to succeed, got %v", err)
+	}
+	subscribed := broker.Subscribed()
+	if len(subscribed) != 2 || subscribed[1] != "$share/workers/sensors/#" {
+		t.Errorf("Expected the shared subscription to be restored in full, got %v", subscribed)
+	}
+}
+
+func TestSharedSubscriptionsRequireMQTT311(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+
+	brokerConfig := testBrokerConfig(broker)
+	brokerConfig.ProtocolVersion = 3
+	manager := newTestManager(brokerConfig)
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.Subscribe("$share/workers/sensors/#", 1, func(mqtt.Client, mqtt.Message) {}); err == nil {
+		t.Error("Expected a shared subscription to be rejected with MQTT 3.1")
+	}
+	if len(broker.Subscribed()) != 0 {
+		t.Error("Expected no subscription to be sent to the broker")
+	}
+}
+
+func TestLostConnectionIsReestablished(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckSubscribes = true
+	brokerConfig := broker.BrokerConfig("test")
+	brokerConfig.ReconnectInitialInterval = 1
+	brokerConfig.ReconnectJitter = 0.9
+	manager := newTestManager(brokerConfig)
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+	if err := client.Subscribe("sensors/#", 1, func(mqtt.Client, mqtt.Message) {}); err != nil {
+		t.Fatalf("Expected subscribe to succeed, got %v", err)
+	}
+
+	broker.DropConnections()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for broker.Connects() < 2 || !client.IsConnected() || len(broker.Subscribed()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the client to reconnect and resubscribe, got %d connects and subscriptions %v", broker.Connects(), broker.Subscribed())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if attempts := manager.metrics.ConnectionAttempts; attempts != 2 {
+		t.Errorf("Expected 2 connection attempts in metrics, got %d", attempts)
+	}
+}
+
+func TestDisconnectStopsReconnecting(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	brokerConfig := broker.BrokerConfig("test")
+	brokerConfig.ReconnectInitialInterval = 1
+	manager := newTestManager(brokerConfig)
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+
+	broker.DropConnections()
+	deadline := time.Now().Add(time.Second)
+	for client.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the dropped connection to be noticed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Wait for the connection lost handler to start the reconnect loop
+	time.Sleep(50 * time.Millisecond)
+	client.Disconnect()
+
+	time.Sleep(1500 * time.Millisecond)
+	if connects := broker.Connects(); connects != 1 {
+		t.Errorf("Expected no reconnect after Disconnect, got %d connects", connects)
+	}
+}
+
+func TestPublishContextReturnsWithoutAcknowledgement(t *testing.T) {
+	// The broker never acknowledges publishes
+	broker := mqtttest.Start(t, packets.Accepted)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.PublishContext(ctx, "sensors/temp", 1, false, "21.5")
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the publish to fail with the context's deadline, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the publish to return when the context expired")
+	}
+}
+
+func TestPublishContextCancelled(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	manager := newTestManager(testBrokerConfig(broker))
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if err := client.PublishContext(ctx, "sensors/temp", 2, false, "21.5"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the publish to stop when the context was cancelled, got %v", err)
+	}
+}
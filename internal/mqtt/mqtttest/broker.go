@@ -0,0 +1,231 @@
+// Package mqtttest provides a minimal in-process MQTT broker for tests.
+package mqtttest
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// Broker is a minimal MQTT 3.1.1 broker used to exercise clients against specific broker behaviour.
+// It acknowledges CONNECT with a configurable return code, answers pings, records publishes and
+// subscriptions, and delegates every other packet to Handle.
+type Broker struct {
+	listener net.Listener
+	// ConnackCode is the return code sent in response to CONNECT
+	ConnackCode byte
+	// AckPublishes controls whether QoS 1 publishes are acknowledged with PUBACK
+	// and QoS 2 publishes complete the PUBREC/PUBREL/PUBCOMP exchange
+	AckPublishes bool
+	// AckSubscribes controls whether SUBSCRIBE is acknowledged with SUBACK, granting the requested QoS
+	// unless the filter is listed in RejectSubscriptions or DowngradeSubscriptions, and UNSUBSCRIBE with UNSUBACK
+	AckSubscribes bool
+	// RejectSubscriptions lists topic filters whose subscription is refused
+	RejectSubscriptions []string
+	// DowngradeSubscriptions maps topic filters to the QoS granted to them when lower than requested
+	DowngradeSubscriptions map[string]byte
+	// Handle is called for every packet not handled by the broker itself
+	Handle func(conn net.Conn, packet packets.ControlPacket)
+
+	connects   int32
+	published  []*packets.PublishPacket
+	subscribed []string
+	conns      map[net.Conn]struct{}
+	mu         sync.Mutex
+}
+
+// Start starts a broker on a random local port that is closed when the test finishes
+func Start(t *testing.T, connackCode byte) *Broker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test broker: %v", err)
+	}
+
+	broker := &Broker{
+		listener:    listener,
+		ConnackCode: connackCode,
+		conns:       make(map[net.Conn]struct{}),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+
+	return broker
+}
+
+// Connects returns the number of CONNECT packets received
+func (b *Broker) Connects() int {
+	return int(atomic.LoadInt32(&b.connects))
+}
+
+// Published returns the PUBLISH packets received so far
+func (b *Broker) Published() []*packets.PublishPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	published := make([]*packets.PublishPacket, len(b.published))
+	copy(published, b.published)
+	return published
+}
+
+// Subscribed returns the topic filters of the SUBSCRIBE packets received so far, in order
+func (b *Broker) Subscribed() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscribed := make([]string, len(b.subscribed))
+	copy(subscribed, b.subscribed)
+	return subscribed
+}
+
+// WaitForPublished waits until at least n PUBLISH packets were received and returns them,
+// failing the test if that doesn't happen within a second
+func (b *Broker) WaitForPublished(t *testing.T, n int) []*packets.PublishPacket {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		published := b.Published()
+		if len(published) >= n {
+			return published
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d published messages, got %d", n, len(published))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// DropConnections closes every client connection without a DISCONNECT, as a crashing broker would
+func (b *Broker) DropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for conn := range b.conns {
+		conn.Close()
+	}
+}
+
+// BrokerConfig returns a broker configuration pointing at the test broker
+func (b *Broker) BrokerConfig(name string) *config.BrokerConfig {
+	addr := b.listener.Addr().(*net.TCPAddr)
+	return &config.BrokerConfig{
+		Name:     name,
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		ClientID: name + "-client",
+	}
+}
+
+// serve handles a single client connection
+func (b *Broker) serve(conn net.Conn) {
+	b.mu.Lock()
+	b.conns[conn] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			atomic.AddInt32(&b.connects, 1)
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.ReturnCode = b.ConnackCode
+			if err := connack.Write(conn); err != nil {
+				return
+			}
+			if b.ConnackCode != packets.Accepted {
+				return
+			}
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			b.published = append(b.published, p)
+			b.mu.Unlock()
+
+			if b.Handle != nil {
+				b.Handle(conn, p)
+			} else if b.AckPublishes && p.Qos == 1 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				puback.Write(conn)
+			} else if b.AckPublishes && p.Qos == 2 {
+				pubrec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				pubrec.MessageID = p.MessageID
+				pubrec.Write(conn)
+			}
+		case *packets.SubscribePacket:
+			b.mu.Lock()
+			b.subscribed = append(b.subscribed, p.Topics...)
+			b.mu.Unlock()
+
+			if b.Handle != nil {
+				b.Handle(conn, p)
+			} else if b.AckSubscribes {
+				suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+				suback.MessageID = p.MessageID
+				for i, topic := range p.Topics {
+					code := p.Qoss[i]
+					if qos, ok := b.DowngradeSubscriptions[topic]; ok && qos < code {
+						code = qos
+					}
+					for _, rejected := range b.RejectSubscriptions {
+						if topic == rejected {
+							code = 0x80
+						}
+					}
+					suback.ReturnCodes = append(suback.ReturnCodes, code)
+				}
+				suback.Write(conn)
+			}
+		case *packets.UnsubscribePacket:
+			if b.Handle != nil {
+				b.Handle(conn, p)
+			} else if b.AckSubscribes {
+				unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+				unsuback.MessageID = p.MessageID
+				unsuback.Write(conn)
+			}
+		case *packets.PubrelPacket:
+			if b.Handle != nil {
+				b.Handle(conn, p)
+			} else if b.AckPublishes {
+				pubcomp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+				pubcomp.MessageID = p.MessageID
+				pubcomp.Write(conn)
+			}
+		default:
+			if b.Handle != nil {
+				b.Handle(conn, p)
+			}
+		}
+	}
+}
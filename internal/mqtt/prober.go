@@ -0,0 +1,158 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultProbeTimeout is the maximum time a connection probe waits for the broker to acknowledge it
+const defaultProbeTimeout = 10 * time.Second
+
+// probeTopic returns the topic connection probes are published to
+func (c *Client) probeTopic() string {
+	if c.config.ProbeTopic != "" {
+		return c.config.ProbeTopic
+	}
+	return fmt.Sprintf("mqtt-microservice/health/%s", c.config.ClientID)
+}
+
+// probeTimeout returns how long a probe waits for an acknowledgement
+func (c *Client) probeTimeout() time.Duration {
+	interval := time.Duration(c.config.ProbeInterval) * time.Second
+	if interval > 0 && interval < defaultProbeTimeout {
+		return interval
+	}
+	return defaultProbeTimeout
+}
+
+// startProber starts the periodic connection prober if probing is enabled and it isn't already running
+func (c *Client) startProber() {
+	if c.config.ProbeInterval <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.proberStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	c.proberStop = stop
+	go c.runProber(time.Duration(c.config.ProbeInterval)*time.Second, stop)
+
+	c.logger.WithFields(map[string]interface{}{
+		"broker":   c.config.Name,
+		"interval": c.config.ProbeInterval,
+		"topic":    c.probeTopic(),
+	}).Info("Connection prober started")
+}
+
+// stopProber stops the periodic connection prober if it is running
+func (c *Client) stopProber() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.proberStop != nil {
+		close(c.proberStop)
+		c.proberStop = nil
+	}
+}
+
+// runProber probes the connection at the given interval until stopped
+func (c *Client) runProber(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// Leave connections that are known to be down to the reconnect loop
+			if !c.IsConnected() {
+				continue
+			}
+			c.probeOnce(c.probeTimeout())
+		}
+	}
+}
+
+// probeOnce publishes a probe message and forces a reconnect if the broker doesn't acknowledge it in time
+func (c *Client) probeOnce(timeout time.Duration) error {
+	err := c.probe(timeout)
+	if err == nil {
+		if c.manager != nil && c.manager.metrics != nil {
+			c.manager.metrics.IncrementProbeSuccesses()
+		}
+		return nil
+	}
+
+	if c.manager != nil && c.manager.metrics != nil {
+		c.manager.metrics.IncrementProbeFailures()
+	}
+	c.logger.WithError(err).WithField("broker", c.config.Name).Warn("Connection probe failed, forcing reconnect")
+
+	if reconnectErr := c.reconnect(); reconnectErr != nil {
+		c.logger.WithError(reconnectErr).WithField("broker", c.config.Name).Error("Forced reconnect failed")
+		c.startReconnecting()
+	}
+
+	return err
+}
+
+// probe publishes a single QoS 1 probe message and waits for the broker's acknowledgement
+func (c *Client) probe(timeout time.Duration) error {
+	payload := time.Now().Format(time.RFC3339Nano)
+	token := c.client.Publish(c.probeTopic(), 1, false, payload)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("probe not acknowledged within %s", timeout)
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("probe failed: %w", token.Error())
+	}
+	return nil
+}
+
+// ProbeResult is the outcome of a round-trip latency probe of a broker connection
+type ProbeResult struct {
+	// Latency is how long the broker took to acknowledge the probe
+	Latency time.Duration
+	// Err is set if the probe wasn't acknowledged
+	Err error
+	// CheckedAt is when the probe was made
+	CheckedAt time.Time
+}
+
+// ProbeLatency measures the round trip to the broker by publishing a QoS 1 probe message and waiting for its
+// PUBACK. A result younger than maxAge is reused, so frequent callers don't flood the broker with probes.
+// Unlike the periodic prober, a failed probe doesn't force a reconnect.
+func (c *Client) ProbeLatency(timeout, maxAge time.Duration) ProbeResult {
+	// Concurrent callers wait for a single probe and share its result
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+
+	if c.lastProbe != nil && time.Since(c.lastProbe.CheckedAt) < maxAge {
+		return *c.lastProbe
+	}
+
+	start := time.Now()
+	err := c.probe(timeout)
+	c.lastProbe = &ProbeResult{
+		Latency:   time.Since(start),
+		Err:       err,
+		CheckedAt: start,
+	}
+	return *c.lastProbe
+}
+
+// reconnect drops the current connection, connects again, and restores subscriptions
+func (c *Client) reconnect() error {
+	c.client.Disconnect(250)
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	return c.ResubscribeAll()
+}
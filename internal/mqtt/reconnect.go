@@ -0,0 +1,85 @@
+package mqtt
+
+import "time"
+
+// startReconnecting starts re-establishing a lost connection in the background, unless a reconnect loop is
+// already running
+func (c *Client) startReconnecting() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reconnectStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	c.reconnectStop = stop
+	go c.runReconnect(stop)
+}
+
+// stopReconnecting stops the reconnect loop if it is running
+func (c *Client) stopReconnecting() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reconnectStop != nil {
+		close(c.reconnectStop)
+		c.reconnectStop = nil
+	}
+}
+
+// runReconnect attempts to reconnect with backoff until it succeeds or is stopped, then restores subscriptions.
+// Every attempt is counted in the connection attempt metrics.
+func (c *Client) runReconnect(stop chan struct{}) {
+	defer func() {
+		c.mu.Lock()
+		if c.reconnectStop == stop {
+			c.reconnectStop = nil
+		}
+		c.mu.Unlock()
+	}()
+
+	backoff := newReconnectBackoff(c.config)
+	for attempt := 1; ; attempt++ {
+		delay := backoff.delay(attempt)
+		c.logger.WithFields(map[string]interface{}{
+			"broker":  c.config.Name,
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}).Info("MQTT reconnecting")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// The connection may have been re-established meanwhile, e.g. through the API
+		if c.IsConnected() {
+			return
+		}
+
+		if err := c.connect(); err != nil {
+			c.logger.WithError(err).WithFields(map[string]interface{}{
+				"broker":  c.config.Name,
+				"attempt": attempt,
+			}).Warn("MQTT reconnect attempt failed")
+			continue
+		}
+
+		// Don't keep a connection that was asked to close while it was being made
+		select {
+		case <-stop:
+			c.client.Disconnect(250)
+			return
+		default:
+		}
+
+		if err := c.ResubscribeAll(); err != nil {
+			c.logger.WithError(err).WithField("broker", c.config.Name).Error("Failed to restore subscriptions after reconnecting")
+		}
+		return
+	}
+}
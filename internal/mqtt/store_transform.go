@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/utils"
+)
+
+// RedactedValue replaces the values of redacted payload fields in stored messages
+const RedactedValue = "[REDACTED]"
+
+// StoreTransform changes the copy of a published message that is stored in the database, before it is stored.
+// The published message is never changed. It returns false to skip storing the message.
+type StoreTransform func(msg *database.Message) bool
+
+// NewStoreTransforms returns the transforms configured for stored messages: topic exclusion, then field
+// redaction, then payload truncation, so fields are redacted before the payload is cut short
+func NewStoreTransforms(cfg *config.DatabaseConfig) []StoreTransform {
+	var transforms []StoreTransform
+	if len(cfg.StoreExcludeTopics) > 0 {
+		transforms = append(transforms, ExcludeTopics(cfg.StoreExcludeTopics))
+	}
+	if len(cfg.StoreRedactFields) > 0 {
+		transforms = append(transforms, RedactFields(cfg.StoreRedactFields))
+	}
+	if cfg.StoreMaxPayloadBytes > 0 {
+		transforms = append(transforms, TruncatePayload(cfg.StoreMaxPayloadBytes))
+	}
+	return transforms
+}
+
+// ExcludeTopics skips storing messages published to topics matching any of the topic filters
+func ExcludeTopics(filters []string) StoreTransform {
+	return func(msg *database.Message) bool {
+		for _, filter := range filters {
+			if utils.TopicMatchesFilter(msg.Topic, filter) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// RedactFields replaces the values of JSON payload fields matching any of the paths with RedactedValue.
+// Paths are written like $.user.password or data.items[*].content: levels are separated by dots,
+// '*' matches every field of an object or element of an array, and a number matches an array index.
+// Payloads that aren't JSON are stored unchanged.
+func RedactFields(paths []string) StoreTransform {
+	parsed := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		parsed = append(parsed, utils.SplitJSONPath(path))
+	}
+
+	return func(msg *database.Message) bool {
+		data, contentType, err := database.EncodePayload(msg.Payload)
+		if err != nil || contentType == database.ContentTypeBinary || !json.Valid(data) {
+			return true
+		}
+
+		// Keep numbers as they were published
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return true
+		}
+
+		redacted := false
+		for _, path := range parsed {
+			if redactPath(value, path) {
+				redacted = true
+			}
+		}
+		if !redacted {
+			return true
+		}
+
+		data, err = json.Marshal(value)
+		if err != nil {
+			return true
+		}
+		// JSON published as a string is stored as text, like the unredacted payload would be
+		if contentType == database.ContentTypeText {
+			msg.Payload = string(data)
+		} else {
+			msg.Payload = json.RawMessage(data)
+		}
+		return true
+	}
+}
+
+// redactPath redacts the values at a path within a decoded JSON value, reporting whether any was found
+func redactPath(value interface{}, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	level, rest := path[0], path[1:]
+
+	redacted := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if level != "*" && level != key {
+				continue
+			}
+			if len(rest) == 0 {
+				v[key] = RedactedValue
+				redacted = true
+			} else if redactPath(child, rest) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if level != "*" && level != strconv.Itoa(i) {
+				continue
+			}
+			if len(rest) == 0 {
+				v[i] = RedactedValue
+				redacted = true
+			} else if redactPath(child, rest) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// TruncatePayload cuts payloads longer than maxBytes down to their first maxBytes bytes. Truncated text and JSON
+// payloads are cut at a character boundary and stored as text, since cut JSON is no longer valid.
+func TruncatePayload(maxBytes int) StoreTransform {
+	return func(msg *database.Message) bool {
+		data, contentType, err := database.EncodePayload(msg.Payload)
+		if err != nil || len(data) <= maxBytes {
+			return true
+		}
+
+		data = data[:maxBytes]
+		if contentType == database.ContentTypeBinary {
+			// Copy so the stored payload doesn't share memory with the published one
+			msg.Payload = append([]byte(nil), data...)
+			return true
+		}
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+		msg.Payload = string(data)
+		return true
+	}
+}
@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestTruncatePayload(t *testing.T) {
+	truncate := TruncatePayload(8)
+
+	tests := []struct {
+		payload interface{}
+		want    interface{}
+	}{
+		{"short", "short"},
+		{"a long text payload", "a long t"},
+		// Text is cut at a character boundary: "é" takes two bytes
+		{"1234567é", "1234567"},
+		{map[string]interface{}{"image": "aGVsbG8gd29ybGQ="}, `{"image"`},
+		{[]byte{0xff, 0xfe, 1, 2, 3, 4, 5, 6, 7, 8}, []byte{0xff, 0xfe, 1, 2, 3, 4, 5, 6}},
+	}
+
+	for _, test := range tests {
+		msg := &database.Message{Topic: "sensors/camera", Payload: test.payload}
+		if !truncate(msg) {
+			t.Fatal("Expected truncated messages to be stored")
+		}
+		got, _, _ := database.EncodePayload(msg.Payload)
+		want, _, _ := database.EncodePayload(test.want)
+		if string(got) != string(want) {
+			t.Errorf("Expected payload %q, got %q", want, got)
+		}
+	}
+}
+
+func TestExcludeTopics(t *testing.T) {
+	exclude := ExcludeTopics([]string{"cameras/#", "sensors/+/raw"})
+
+	for topic, stored := range map[string]bool{
+		"cameras/front":         false,
+		"cameras":               false,
+		"sensors/kitchen/raw":   false,
+		"sensors/kitchen/temp":  true,
+		"sensors/kitchen/raw/1": true,
+	} {
+		if got := exclude(&database.Message{Topic: topic, Payload: "hello"}); got != stored {
+			t.Errorf("Expected storing %s to be %v, got %v", topic, stored, got)
+		}
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	redact := RedactFields([]string{"$.password", "attachments[*].content", "meta.*.token"})
+
+	published := map[string]interface{}{
+		"user":        "alice",
+		"password":    "secret",
+		"reading":     json.Number("21.50"),
+		"attachments": []interface{}{map[string]interface{}{"name": "a.png", "content": "aGVsbG8="}},
+		"meta":        map[string]interface{}{"auth": map[string]interface{}{"token": "abc"}},
+	}
+	msg := &database.Message{Topic: "users/1", Payload: published}
+	redact(msg)
+
+	data, _, _ := database.EncodePayload(msg.Payload)
+	want := `{"attachments":[{"content":"[REDACTED]","name":"a.png"}],"meta":{"auth":{"token":"[REDACTED]"}},"password":"[REDACTED]","reading":21.50,"user":"alice"}`
+	if string(data) != want {
+		t.Errorf("Expected payload %s, got %s", want, data)
+	}
+	if published["password"] != "secret" {
+		t.Error("Expected the published payload to be left unchanged")
+	}
+
+	// Payloads that aren't JSON are stored as they are
+	msg = &database.Message{Topic: "users/1", Payload: "password=secret"}
+	redact(msg)
+	if msg.Payload != "password=secret" {
+		t.Errorf("Expected a text payload to be unchanged, got %v", msg.Payload)
+	}
+}
+
+func TestStoreTransformsOnlyChangeStoredCopy(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+
+	dbConfig := &database.Config{Type: "sqlite"}
+	dbConfig.SQLite.Path = filepath.Join(t.TempDir(), "messages.db")
+	db, err := database.New(dbConfig)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	ctx := context.Background()
+	if err := db.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close(ctx)
+
+	manager := newTestManager(testBrokerConfig(broker))
+	manager.db = db
+	manager.storeTransforms = NewStoreTransforms(&config.DatabaseConfig{
+		StoreMaxPayloadBytes: 5,
+		StoreExcludeTopics:   []string{"cameras/#"},
+	})
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	payload := strings.Repeat("x", 20)
+	result, err := client.PublishMessage("sensors/blob", 0, false, payload)
+	if err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+	excluded, err := client.PublishMessage("cameras/front", 0, false, payload)
+	if err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+
+	published := broker.WaitForPublished(t, 2)
+	for _, packet := range published {
+		if string(packet.Payload) != payload {
+			t.Errorf("Expected the full payload to be published to %s, got %q", packet.TopicName, packet.Payload)
+		}
+	}
+
+	msg, err := db.GetMessageByID(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if msg.Payload != "xxxxx" {
+		t.Errorf("Expected the stored payload to be truncated, got %v", msg.Payload)
+	}
+	if excluded.ID != "" {
+		t.Errorf("Expected the excluded message not to be stored, got ID %s", excluded.ID)
+	}
+}
@@ -0,0 +1,183 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/logger"
+	"MQTTmicroService/internal/metrics"
+)
+
+const (
+	// storeWriterBatchSize is the maximum number of queued messages stored in a single database call
+	storeWriterBatchSize = 100
+	// storeWriterTimeout is how long the writer waits for the database to store a batch
+	storeWriterTimeout = 5 * time.Second
+)
+
+// lastMessageID is the last ID given to a message stored asynchronously
+var lastMessageID int64
+
+// newMessageID returns a unique message ID in the format the databases generate, so a message stored
+// asynchronously can be identified before it is written
+func newMessageID() string {
+	for {
+		last := atomic.LoadInt64(&lastMessageID)
+		id := time.Now().UnixNano()
+		if id <= last {
+			id = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastMessageID, last, id) {
+			return fmt.Sprintf("%d", id)
+		}
+	}
+}
+
+// storeWriter stores published messages from a background goroutine reading a bounded queue, so a slow
+// database doesn't delay publishes. Messages waiting in the queue are stored together in batches.
+type storeWriter struct {
+	db           database.Database
+	logger       *logger.Logger
+	metrics      *metrics.Metrics
+	queue        chan *database.Message
+	dropWhenFull bool
+	// done is closed once the writer has stored every message queued before it was stopped
+	done chan struct{}
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// newStoreWriter creates and starts a writer configured by the database settings, using the defaults for unset ones
+func newStoreWriter(cfg *config.DatabaseConfig, db database.Database, log *logger.Logger, metricsCollector *metrics.Metrics) *storeWriter {
+	queueSize := cfg.StoreQueueSize
+	if queueSize <= 0 {
+		queueSize = config.DefaultStoreQueueSize
+	}
+
+	w := &storeWriter{
+		db:           db,
+		logger:       log,
+		metrics:      metricsCollector,
+		queue:        make(chan *database.Message, queueSize),
+		dropWhenFull: cfg.StoreQueueFullPolicy == config.StoreQueueFullDrop,
+		done:         make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// run stores queued messages until the queue is closed and drained
+func (w *storeWriter) run() {
+	defer close(w.done)
+
+	batch := make([]*database.Message, 0, storeWriterBatchSize)
+	for msg := range w.queue {
+		// Store the messages already waiting along with this one
+		batch = append(batch[:0], msg)
+	drain:
+		for len(batch) < storeWriterBatchSize {
+			select {
+			case next, ok := <-w.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		w.store(batch)
+	}
+}
+
+// store writes a batch of messages. If the batch is rejected as a whole, the messages are stored one at
+// a time, so a single bad message doesn't lose the others.
+func (w *storeWriter) store(batch []*database.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeWriterTimeout)
+	defer cancel()
+
+	err := w.db.StoreMessages(ctx, batch)
+	var batchErr *database.BatchError
+	switch {
+	case err == nil:
+		return
+	case errors.As(err, &batchErr):
+		for i, msg := range batch {
+			if failure := batchErr.Failed[i]; failure != nil {
+				logStoreError(w.logger, w.metrics, msg, failure)
+			}
+		}
+		return
+	case len(batch) == 1:
+		logStoreError(w.logger, w.metrics, batch[0], err)
+		return
+	}
+
+	for _, msg := range batch {
+		ctx, cancel := context.WithTimeout(context.Background(), storeWriterTimeout)
+		if err := w.db.StoreMessage(ctx, msg); err != nil {
+			logStoreError(w.logger, w.metrics, msg, err)
+		}
+		cancel()
+	}
+}
+
+// write queues a message to be stored. If the queue is full, it waits for room or, with the drop policy,
+// drops the message right away. Once the writer is stopped, messages are stored directly instead.
+func (w *storeWriter) write(msg *database.Message) {
+	w.mu.RLock()
+	if w.stopped {
+		w.mu.RUnlock()
+		ctx, cancel := context.WithTimeout(context.Background(), storeWriterTimeout)
+		defer cancel()
+		if err := w.db.StoreMessage(ctx, msg); err != nil {
+			logStoreError(w.logger, w.metrics, msg, err)
+		}
+		return
+	}
+	defer w.mu.RUnlock()
+
+	select {
+	case w.queue <- msg:
+		return
+	default:
+	}
+
+	if !w.dropWhenFull {
+		w.queue <- msg
+		return
+	}
+
+	if w.metrics != nil {
+		w.metrics.IncrementStoreDroppedMessages()
+	}
+	w.logger.WithFields(map[string]interface{}{
+		"id":    msg.ID,
+		"topic": msg.Topic,
+	}).Warn("Message storage queue is full, dropping the stored copy of a published message")
+}
+
+// stop stops accepting messages and waits until the queued ones are stored or the context expires
+func (w *storeWriter) stop(ctx context.Context) {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	w.stopped = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.logger.WithField("queued", len(w.queue)).Warn("Queued messages weren't stored before shutdown")
+	}
+}
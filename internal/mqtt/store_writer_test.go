@@ -0,0 +1,128 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/mqtt/mqtttest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// slowDatabase is an in-memory database whose writes wait until it is released
+type slowDatabase struct {
+	database.Database
+	// storing receives a value whenever a write starts waiting
+	storing chan struct{}
+	release chan struct{}
+}
+
+// newSlowDatabase creates a connected slow database
+func newSlowDatabase(t *testing.T) *slowDatabase {
+	t.Helper()
+
+	db, err := database.New(&database.Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	return &slowDatabase{Database: db, storing: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (d *slowDatabase) StoreMessage(ctx context.Context, msg *database.Message) error {
+	d.storing <- struct{}{}
+	<-d.release
+	return d.Database.StoreMessage(ctx, msg)
+}
+
+func (d *slowDatabase) StoreMessages(ctx context.Context, msgs []*database.Message) error {
+	d.storing <- struct{}{}
+	<-d.release
+	return d.Database.StoreMessages(ctx, msgs)
+}
+
+func TestAsyncStorageDoesNotDelayPublish(t *testing.T) {
+	broker := mqtttest.Start(t, packets.Accepted)
+	broker.AckPublishes = true
+
+	db := newSlowDatabase(t)
+	manager := newTestManager(testBrokerConfig(broker))
+	manager.db = db
+	manager.storeWriter = newStoreWriter(&config.DatabaseConfig{StoreQueueSize: 10}, db, manager.logger, manager.metrics)
+
+	client, err := manager.GetDefaultClient()
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatalf("Expected connect to succeed, got %v", err)
+	}
+	defer client.Disconnect()
+
+	// The publish returns the message's ID while the database is still busy
+	result, err := client.PublishMessage("sensors/exactly-once", 2, false, "21.5")
+	if err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+	if result.ID == "" {
+		t.Fatal("Expected the ID of the message to be stored")
+	}
+	ctx := context.Background()
+	if _, err := db.GetMessageByID(ctx, result.ID); err != database.ErrMessageNotFound {
+		t.Fatalf("Expected the message not to be stored yet, got %v", err)
+	}
+
+	// Stopping the writer stores the queued message with its delivery outcome
+	close(db.release)
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	manager.StopStorageWriter(stopCtx)
+
+	msg, err := db.GetMessageByID(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("Expected the message to be stored, got %v", err)
+	}
+	if msg.Status != database.MessageStatusDelivered || !msg.Confirmed {
+		t.Errorf("Expected a delivered and confirmed message, got status %s and confirmed %v", msg.Status, msg.Confirmed)
+	}
+}
+
+func TestStoreWriterDropsWhenFull(t *testing.T) {
+	db := newSlowDatabase(t)
+	manager := newTestManager(&config.BrokerConfig{Name: "test"})
+	writer := newStoreWriter(&config.DatabaseConfig{StoreQueueSize: 1, StoreQueueFullPolicy: config.StoreQueueFullDrop}, db, manager.logger, manager.metrics)
+
+	msgs := make([]*database.Message, 4)
+	for i := range msgs {
+		msgs[i] = &database.Message{ID: newMessageID(), Topic: "sensors/temp", Payload: "21.5", Timestamp: time.Now()}
+	}
+
+	// The first message is being stored, the second fills the queue, and the third is dropped
+	writer.write(msgs[0])
+	<-db.storing
+	writer.write(msgs[1])
+	writer.write(msgs[2])
+	if dropped := manager.metrics.StoreDroppedMessages; dropped != 1 {
+		t.Errorf("Expected 1 dropped message, got %d", dropped)
+	}
+
+	close(db.release)
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	writer.stop(stopCtx)
+
+	// Once the writer is stopped, messages are stored directly
+	writer.write(msgs[3])
+
+	for i, msg := range msgs {
+		_, err := db.GetMessageByID(context.Background(), msg.ID)
+		if stored := err == nil; stored != (i != 2) {
+			t.Errorf("Expected message %d to be stored: %v, got %v", i, i != 2, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "strings"
+
+// SplitJSONPath splits a JSON path written like $.user.name or items[0].price into its levels,
+// dropping the optional $ root. Array indices become levels of their own.
+func SplitJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var levels []string
+	for _, level := range strings.Split(path, ".") {
+		if level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
@@ -6,15 +6,22 @@ import (
 
 // TopicMatchesFilter checks if a topic matches a filter
 // The filter can contain wildcards:
-// - '+' matches exactly one level
-// - '#' matches zero or more levels (must be the last character)
+// - '+' matches exactly one level, which may be empty
+// - '#' matches zero or more levels (must be the last level), including the parent level
+// As required by the MQTT specification, a filter starting with a wildcard does not match
+// topics beginning with '$', such as the broker's $SYS topics.
 func TopicMatchesFilter(topic, filter string) bool {
+	// Wildcards at the first level must not match $-prefixed topics
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
 	// Split the topic and filter into levels
 	topicLevels := strings.Split(topic, "/")
 	filterLevels := strings.Split(filter, "/")
 
-	// If the filter ends with #, it matches any number of levels
-	if strings.HasSuffix(filter, "#") {
+	// If the last filter level is #, it matches any number of levels
+	if filterLevels[len(filterLevels)-1] == "#" {
 		// Remove the # from the filter
 		filterLevels = filterLevels[:len(filterLevels)-1]
 
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"testing"
+)
+
+// topicMatchTests lists topics and filters along with whether they match
+var topicMatchTests = []struct {
+	topic  string
+	filter string
+	match  bool
+}{
+	// Exact matches
+	{"sport/tennis/player1", "sport/tennis/player1", true},
+	{"sport/tennis/player1", "sport/tennis/player2", false},
+	{"sport/tennis", "sport/tennis/player1", false},
+
+	// Multi-level wildcard
+	{"sport/tennis/player1", "sport/#", true},
+	{"sport/tennis/player1/ranking", "sport/tennis/#", true},
+	{"sport", "sport/#", true},
+	{"sport/", "sport/#", true},
+	{"sports", "sport/#", false},
+	{"sport/tennis", "#", true},
+	{"/sport", "#", true},
+
+	// Single-level wildcard
+	{"sport/tennis/player1", "sport/+/player1", true},
+	{"sport/tennis/player1", "sport/+", false},
+	{"sport", "sport/+", false},
+	{"sport/", "sport/+", true},
+	{"sport", "+", true},
+	{"/sport", "+/+", true},
+	{"/sport", "+", false},
+	{"sport/tennis/player1", "+/+/#", true},
+	{"sport/tennis", "+/tennis/#", true},
+
+	// Empty levels
+	{"a//b", "a/+/b", true},
+	{"a//b", "a/b", false},
+	{"a//b", "a//b", true},
+	{"a/b/", "a/b/+", true},
+	{"a/b", "a/b/", false},
+	{"/", "+/+", true},
+
+	// $-prefixed topics
+	{"$SYS/broker/uptime", "#", false},
+	{"$SYS/broker/uptime", "+/broker/uptime", false},
+	{"$SYS/broker/uptime", "+/#", false},
+	{"$SYS/broker/uptime", "$SYS/#", true},
+	{"$SYS/broker/uptime", "$SYS/+/uptime", true},
+	{"$SYS/broker/uptime", "$SYS/broker/uptime", true},
+	{"sport/$score", "sport/+", true},
+}
+
+func TestTopicMatchesFilter(t *testing.T) {
+	for _, test := range topicMatchTests {
+		if match := TopicMatchesFilter(test.topic, test.filter); match != test.match {
+			t.Errorf("TopicMatchesFilter(%q, %q) = %v, expected %v", test.topic, test.filter, match, test.match)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"strings"
+)
+
+// ApplyNamespace prefixes a topic or topic filter with a tenant namespace.
+// The namespace of a shared subscription goes in front of its filter, after the share group.
+// An empty namespace leaves the topic unchanged.
+func ApplyNamespace(namespace, topic string) string {
+	if namespace == "" {
+		return topic
+	}
+	if group, filter, ok := ParseSharedSubscription(topic); ok {
+		return SharedSubscriptionTopic(group, namespace+"/"+filter)
+	}
+	return namespace + "/" + topic
+}
+
+// StripNamespace removes a tenant namespace prefix from a topic, or from the filter of a shared subscription.
+// It reports false if the topic doesn't belong to the namespace.
+func StripNamespace(namespace, topic string) (string, bool) {
+	if namespace == "" {
+		return topic, true
+	}
+	if group, filter, ok := ParseSharedSubscription(topic); ok {
+		filter, ok := StripNamespace(namespace, filter)
+		if !ok {
+			return "", false
+		}
+		return SharedSubscriptionTopic(group, filter), true
+	}
+
+	prefix := namespace + "/"
+	if !strings.HasPrefix(topic, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(topic, prefix), true
+}
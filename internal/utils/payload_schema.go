@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// PayloadSchemaRule constrains the payloads published to topics matching a topic filter
+type PayloadSchemaRule struct {
+	// Filter is the topic filter of the topics the rule applies to
+	Filter string
+	// Path is the file the schema was loaded from
+	Path string
+	// Schema is the compiled JSON Schema payloads must conform to
+	Schema *jsonschema.Schema
+}
+
+// PayloadSchemas validates published payloads against JSON Schemas chosen by topic; the first matching rule wins
+type PayloadSchemas struct {
+	Rules []PayloadSchemaRule
+}
+
+// SchemaViolation is a single way in which a payload doesn't conform to its schema
+type SchemaViolation struct {
+	// Path is the JSON pointer of the offending value within the payload, empty for the payload itself
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// PayloadSchemaError is returned for payloads that don't conform to the schema of their topic
+type PayloadSchemaError struct {
+	// Filter is the topic filter of the rule whose schema the payload violates
+	Filter     string
+	Violations []SchemaViolation
+}
+
+func (e *PayloadSchemaError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		if violation.Path == "" {
+			messages[i] = violation.Message
+			continue
+		}
+		messages[i] = violation.Path + ": " + violation.Message
+	}
+	return fmt.Sprintf("payload doesn't conform to the schema for %s: %s", e.Filter, strings.Join(messages, "; "))
+}
+
+// ParsePayloadSchemaRules parses schema rules separated by semicolons, each written as filter=>file,
+// and compiles the JSON Schema in each file. For example "sensors/+/temperature=>schemas/temperature.json"
+// requires payloads published to sensors/kitchen/temperature to conform to schemas/temperature.json.
+func ParsePayloadSchemaRules(rules string) (*PayloadSchemas, error) {
+	schemas := &PayloadSchemas{}
+	compiler := jsonschema.NewCompiler()
+	for _, rule := range strings.Split(rules, ";") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+
+		filter, path, ok := strings.Cut(rule, "=>")
+		filter, path = strings.TrimSpace(filter), strings.TrimSpace(path)
+		if !ok || filter == "" || path == "" {
+			return nil, fmt.Errorf("rule '%s' must be written as filter=>file", rule)
+		}
+		if err := ValidateFilter(filter); err != nil {
+			return nil, fmt.Errorf("rule '%s' has an invalid topic filter: %w", rule, err)
+		}
+
+		schema, err := compiler.Compile(path)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s' has an invalid schema: %w", rule, err)
+		}
+		schemas.Rules = append(schemas.Rules, PayloadSchemaRule{Filter: filter, Path: path, Schema: schema})
+	}
+	return schemas, nil
+}
+
+// Validate checks a payload against the schema of the first rule matching its topic, returning a
+// *PayloadSchemaError if it doesn't conform. Payloads of topics no rule matches are accepted as they are.
+// Raw payloads given as bytes must be JSON; any other payload must be a value decoded from JSON.
+func (p *PayloadSchemas) Validate(topic string, payload interface{}) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, rule := range p.Rules {
+		if !TopicMatchesFilter(topic, rule.Filter) {
+			continue
+		}
+
+		value := payload
+		raw, isRaw := payload.([]byte)
+		if message, ok := payload.(json.RawMessage); ok {
+			raw, isRaw = message, true
+		}
+		if isRaw {
+			decoder := json.NewDecoder(bytes.NewReader(raw))
+			decoder.UseNumber()
+			if err := decoder.Decode(&value); err != nil {
+				return &PayloadSchemaError{
+					Filter:     rule.Filter,
+					Violations: []SchemaViolation{{Message: "payload is not valid JSON"}},
+				}
+			}
+		}
+
+		err := rule.Schema.Validate(value)
+		var validationErr *jsonschema.ValidationError
+		if errors.As(err, &validationErr) {
+			return &PayloadSchemaError{Filter: rule.Filter, Violations: schemaViolations(validationErr, nil)}
+		}
+		return err
+	}
+	return nil
+}
+
+// schemaViolations flattens a validation error into its innermost causes, which say what is wrong;
+// the errors wrapping them only say which schema failed
+func schemaViolations(err *jsonschema.ValidationError, violations []SchemaViolation) []SchemaViolation {
+	if len(err.Causes) == 0 {
+		return append(violations, SchemaViolation{Path: err.InstanceLocation, Message: err.Message})
+	}
+	for _, cause := range err.Causes {
+		violations = schemaViolations(cause, violations)
+	}
+	return violations
+}
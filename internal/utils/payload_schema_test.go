@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const temperatureSchema = `{
+	"type": "object",
+	"properties": {
+		"value": {"type": "number"},
+		"unit": {"enum": ["C", "F"]}
+	},
+	"required": ["value"]
+}`
+
+// writeSchema writes a schema to a temporary file and returns its path
+func writeSchema(t *testing.T, schema string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	return path
+}
+
+func TestPayloadSchemas(t *testing.T) {
+	path := writeSchema(t, temperatureSchema)
+	schemas, err := ParsePayloadSchemaRules("sensors/+/temperature=>" + path + "; sensors/#=>" + writeSchema(t, `{"type": "object"}`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		topic      string
+		payload    interface{}
+		violations []SchemaViolation
+	}{
+		{"conforming payload", "sensors/kitchen/temperature", map[string]interface{}{"value": 21.5, "unit": "C"}, nil},
+		{"conforming raw payload", "sensors/kitchen/temperature", []byte(`{"value": 21.5}`), nil},
+		{"unmatched topic", "alerts/door", "open", nil},
+		{"later rule", "sensors/kitchen/humidity", map[string]interface{}{}, nil},
+		{
+			"missing property", "sensors/kitchen/temperature", map[string]interface{}{"unit": "C"},
+			[]SchemaViolation{{Path: "", Message: "missing properties: 'value'"}},
+		},
+		{
+			"wrong types", "sensors/kitchen/temperature", []byte(`{"value": "hot", "unit": "K"}`),
+			[]SchemaViolation{
+				{Path: "/value", Message: "expected number, but got string"},
+				{Path: "/unit", Message: `value must be one of "C", "F"`},
+			},
+		},
+		{
+			"invalid JSON", "sensors/kitchen/temperature", []byte(`{"value":`),
+			[]SchemaViolation{{Message: "payload is not valid JSON"}},
+		},
+		{
+			"first matching rule wins", "sensors/kitchen/temperature", "hot",
+			[]SchemaViolation{{Path: "", Message: "expected object, but got string"}},
+		},
+	}
+
+	for _, test := range tests {
+		err := schemas.Validate(test.topic, test.payload)
+		if test.violations == nil {
+			if err != nil {
+				t.Errorf("%s: expected the payload to be accepted, got %v", test.name, err)
+			}
+			continue
+		}
+
+		var schemaErr *PayloadSchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Errorf("%s: expected a schema error, got %v", test.name, err)
+			continue
+		}
+		if schemaErr.Filter != "sensors/+/temperature" {
+			t.Errorf("%s: expected the error to name the violated rule, got %s", test.name, schemaErr.Filter)
+		}
+		if !sameViolations(schemaErr.Violations, test.violations) {
+			t.Errorf("%s: expected violations %v, got %v", test.name, test.violations, schemaErr.Violations)
+		}
+	}
+}
+
+func TestParsePayloadSchemaRulesRejectsInvalidRules(t *testing.T) {
+	path := writeSchema(t, temperatureSchema)
+
+	for _, rules := range []string{
+		"sensors/#",
+		"=>" + path,
+		"sensors/#=>",
+		"sensors/#/temperature=>" + path,
+		"sensors/#=>" + filepath.Join(t.TempDir(), "missing.json"),
+		"sensors/#=>" + writeSchema(t, `{"type": "unknown"}`),
+	} {
+		if _, err := ParsePayloadSchemaRules(rules); err == nil {
+			t.Errorf("Expected rules %q to be rejected", rules)
+		}
+	}
+}
+
+// sameViolations reports whether two lists hold the same violations, in any order
+func sameViolations(got, expected []SchemaViolation) bool {
+	if len(got) != len(expected) {
+		return false
+	}
+	remaining := make(map[SchemaViolation]int)
+	for _, violation := range expected {
+		remaining[violation]++
+	}
+	for _, violation := range got {
+		if remaining[violation] == 0 {
+			return false
+		}
+		remaining[violation]--
+	}
+	return true
+}
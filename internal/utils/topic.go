@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTopicLength is the maximum length of an MQTT topic or topic filter in bytes
+const MaxTopicLength = 65535
+
+// validateTopicString checks the rules shared by topics and topic filters
+func validateTopicString(topic string) error {
+	if topic == "" {
+		return errors.New("topic must not be empty")
+	}
+	if len(topic) > MaxTopicLength {
+		return fmt.Errorf("topic must not be longer than %d bytes", MaxTopicLength)
+	}
+	if !utf8.ValidString(topic) {
+		return errors.New("topic must be valid UTF-8")
+	}
+	if strings.ContainsRune(topic, 0) {
+		return errors.New("topic must not contain null characters")
+	}
+	return nil
+}
+
+// ValidatePublishTopic checks that a topic can be published to: it must be a non-empty
+// UTF-8 string without null characters or wildcards, within the MQTT length limit
+func ValidatePublishTopic(topic string) error {
+	if err := validateTopicString(topic); err != nil {
+		return err
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return errors.New("topic must not contain wildcards ('+' or '#')")
+	}
+	return nil
+}
+
+// NormalizeTopic collapses the empty levels of a topic or topic filter and strips a trailing slash, so
+// sensors//temp and sensors/temp/ both become sensors/temp. A leading slash is kept, since topics such as
+// /sensors/temp are a common convention, and a topic of only slashes becomes /. MQTT treats empty levels
+// as significant, so the topics normalization merges are distinct topics to brokers and normalizing is opt-in.
+func NormalizeTopic(topic string) string {
+	if !strings.Contains(topic, "//") && (len(topic) < 2 || !strings.HasSuffix(topic, "/")) {
+		return topic
+	}
+
+	levels := strings.Split(topic, "/")
+	normalized := make([]string, 1, len(levels))
+	normalized[0] = levels[0]
+	for _, level := range levels[1:] {
+		if level != "" {
+			normalized = append(normalized, level)
+		}
+	}
+	if len(normalized) == 1 && normalized[0] == "" {
+		return "/"
+	}
+	return strings.Join(normalized, "/")
+}
+
+// SharedSubscriptionPrefix starts the topic of a shared subscription, $share/<group>/<filter>
+const SharedSubscriptionPrefix = "$share/"
+
+// ValidateFilter checks that a topic filter can be subscribed to. Besides the rules for topics,
+// '+' must occupy a whole level and '#' must occupy the last level. Shared subscription topics
+// are checked with ValidateSharedSubscription.
+func ValidateFilter(filter string) error {
+	if strings.HasPrefix(filter, SharedSubscriptionPrefix) {
+		return ValidateSharedSubscription(filter)
+	}
+	return validateFilterLevels(filter)
+}
+
+// ParseSharedSubscription splits a $share/<group>/<filter> topic into its share group and topic filter.
+// It reports false if the topic isn't a shared subscription.
+func ParseSharedSubscription(topic string) (group, filter string, ok bool) {
+	if !strings.HasPrefix(topic, SharedSubscriptionPrefix) {
+		return "", "", false
+	}
+	group, filter, ok = strings.Cut(strings.TrimPrefix(topic, SharedSubscriptionPrefix), "/")
+	return group, filter, ok
+}
+
+// SharedSubscriptionTopic builds the topic subscribing to a filter as a member of a share group.
+// An empty group returns the filter unchanged.
+func SharedSubscriptionTopic(group, filter string) string {
+	if group == "" {
+		return filter
+	}
+	return SharedSubscriptionPrefix + group + "/" + filter
+}
+
+// ValidateSharedSubscription checks a $share/<group>/<filter> topic: the group must be a non-empty
+// name without '/', '+', or '#', and the filter a valid topic filter
+func ValidateSharedSubscription(topic string) error {
+	if err := validateTopicString(topic); err != nil {
+		return err
+	}
+
+	group, filter, ok := ParseSharedSubscription(topic)
+	if !ok {
+		return errors.New("shared subscription must be written as $share/<group>/<filter>")
+	}
+	if group == "" {
+		return errors.New("shared subscription group must not be empty")
+	}
+	if strings.ContainsAny(group, "+#") {
+		return errors.New("shared subscription group must not contain wildcards ('+' or '#')")
+	}
+	if err := validateFilterLevels(filter); err != nil {
+		return fmt.Errorf("invalid shared subscription filter: %w", err)
+	}
+	return nil
+}
+
+// validateFilterLevels checks the rules for a topic filter without a share prefix
+func validateFilterLevels(filter string) error {
+	if err := validateTopicString(filter); err != nil {
+		return err
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return errors.New("'#' wildcard must be the last level of a topic filter")
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return errors.New("'+' wildcard must occupy an entire level of a topic filter")
+		}
+	}
+	return nil
+}
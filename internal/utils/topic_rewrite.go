@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TopicRewriteRule rewrites topics that match it, either by prefix or by regular expression
+type TopicRewriteRule struct {
+	// Prefix is replaced with Replacement in topics starting with it, unless Pattern is set
+	Prefix string
+	// Pattern is a regular expression replaced with Replacement, which may reference its capture groups as $1 or ${name}
+	Pattern *regexp.Regexp
+	// Replacement is what the matched prefix or pattern is replaced with
+	Replacement string
+}
+
+// TopicRewriter applies an ordered list of rewrite rules to topics; the first matching rule wins
+type TopicRewriter struct {
+	Rules []TopicRewriteRule
+}
+
+// ParseTopicRewriteRules parses rewrite rules separated by semicolons, each written as from=>to.
+// A from starting with ^ is a regular expression; any other from is a topic prefix.
+// For example "raw/=>normalized/;^devices/([^/]+)/data$=>telemetry/$1" rewrites raw/foo to normalized/foo
+// and devices/42/data to telemetry/42.
+func ParseTopicRewriteRules(rules string) (*TopicRewriter, error) {
+	rewriter := &TopicRewriter{}
+	for _, rule := range strings.Split(rules, ";") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+
+		from, to, ok := strings.Cut(rule, "=>")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("rule '%s' must be written as from=>to", rule)
+		}
+
+		if !strings.HasPrefix(from, "^") {
+			rewriter.Rules = append(rewriter.Rules, TopicRewriteRule{Prefix: from, Replacement: to})
+			continue
+		}
+
+		pattern, err := regexp.Compile(from)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s' has an invalid regular expression: %w", rule, err)
+		}
+		rewriter.Rules = append(rewriter.Rules, TopicRewriteRule{Pattern: pattern, Replacement: to})
+	}
+	return rewriter, nil
+}
+
+// Rewrite returns the topic rewritten by the first matching rule, or the topic unchanged if no rule matches
+func (r *TopicRewriter) Rewrite(topic string) string {
+	if r == nil {
+		return topic
+	}
+
+	for _, rule := range r.Rules {
+		if rule.Pattern != nil {
+			if match := rule.Pattern.FindStringSubmatchIndex(topic); match != nil {
+				// Only the matched part is replaced, like a prefix rule replaces only the prefix
+				expanded := rule.Pattern.ExpandString(nil, rule.Replacement, topic, match)
+				return topic[:match[0]] + string(expanded) + topic[match[1]:]
+			}
+			continue
+		}
+		if strings.HasPrefix(topic, rule.Prefix) {
+			return rule.Replacement + strings.TrimPrefix(topic, rule.Prefix)
+		}
+	}
+	return topic
+}
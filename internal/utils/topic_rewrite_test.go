@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestTopicRewriter(t *testing.T) {
+	rewriter, err := ParseTopicRewriteRules("raw/=>normalized/; ^devices/([^/]+)/data$=>telemetry/$1; ^(?P<site>[^/]+)/legacy/=>${site}/v2/; raw/special=>never/")
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		// Prefix rewrites
+		{"raw/foo", "normalized/foo"},
+		{"raw/foo/bar", "normalized/foo/bar"},
+
+		// Capture group rewrites
+		{"devices/42/data", "telemetry/42"},
+		{"plant1/legacy/pump", "plant1/v2/pump"},
+
+		// The first matching rule wins
+		{"raw/special", "normalized/special"},
+
+		// Passthrough when no rule matches
+		{"devices/42/data/extra", "devices/42/data/extra"},
+		{"sensors/temperature", "sensors/temperature"},
+		{"rawfoo", "rawfoo"},
+	}
+
+	for _, test := range tests {
+		if got := rewriter.Rewrite(test.topic); got != test.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", test.topic, got, test.want)
+		}
+	}
+}
+
+func TestNilTopicRewriterPassesThrough(t *testing.T) {
+	var rewriter *TopicRewriter
+	if got := rewriter.Rewrite("raw/foo"); got != "raw/foo" {
+		t.Errorf("Expected the topic to pass through, got %q", got)
+	}
+}
+
+func TestParseTopicRewriteRulesInvalid(t *testing.T) {
+	for _, rules := range []string{"raw/", "=>normalized/", "^devices/(=>telemetry/"} {
+		if _, err := ParseTopicRewriteRules(rules); err == nil {
+			t.Errorf("Expected an error for rules %q", rules)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePublishTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"sensors/temperature", true},
+		{"/leading/slash", true},
+		{"trailing/slash/", true},
+		{"sensors//empty-level", true},
+		{"$SYS/broker/uptime", true},
+		{"capteurs/température", true},
+		{"", false},
+		{"sensors/+/temperature", false},
+		{"sensors/#", false},
+		{"#", false},
+		{"sport+", false},
+		{"sensors/\x00/temperature", false},
+		{"sensors/\xff", false},
+		{strings.Repeat("a", MaxTopicLength), true},
+		{strings.Repeat("a", MaxTopicLength+1), false},
+	}
+
+	for _, test := range tests {
+		err := ValidatePublishTopic(test.topic)
+		if test.valid && err != nil {
+			t.Errorf("Expected topic %q to be valid, got %v", truncate(test.topic), err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Expected topic %q to be invalid", truncate(test.topic))
+		}
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		valid  bool
+	}{
+		{"sensors/temperature", true},
+		{"#", true},
+		{"+", true},
+		{"+/+", true},
+		{"/+", true},
+		{"sport/#", true},
+		{"sport/+/player1", true},
+		{"+/tennis/#", true},
+		{"$share/workers/sensors/#", true},
+		{"$share/workers/+", true},
+		{"", false},
+		{"sport/#/x", false},
+		{"sport#", false},
+		{"sport/tennis#", false},
+		{"#/", false},
+		{"sport+", false},
+		{"sport/+player1", false},
+		{"sensors/\x00", false},
+		{"sensors/\xff", false},
+		{strings.Repeat("a", MaxTopicLength+1), false},
+		{"$share/workers", false},
+		{"$share//sensors/#", false},
+		{"$share/work+ers/sensors", false},
+		{"$share/workers/sensors/#/x", false},
+		{"$share/workers/", false},
+	}
+
+	for _, test := range tests {
+		err := ValidateFilter(test.filter)
+		if test.valid && err != nil {
+			t.Errorf("Expected filter %q to be valid, got %v", truncate(test.filter), err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Expected filter %q to be invalid", truncate(test.filter))
+		}
+	}
+}
+
+func TestParseSharedSubscription(t *testing.T) {
+	group, filter, ok := ParseSharedSubscription("$share/workers/sensors/+/temperature")
+	if !ok || group != "workers" || filter != "sensors/+/temperature" {
+		t.Fatalf("Expected group 'workers' and filter 'sensors/+/temperature', got %q and %q", group, filter)
+	}
+	if topic := SharedSubscriptionTopic(group, filter); topic != "$share/workers/sensors/+/temperature" {
+		t.Errorf("Expected the topic to round-trip, got %q", topic)
+	}
+
+	if _, _, ok := ParseSharedSubscription("sensors/#"); ok {
+		t.Error("Expected a regular filter not to be a shared subscription")
+	}
+	if topic := SharedSubscriptionTopic("", "sensors/#"); topic != "sensors/#" {
+		t.Errorf("Expected a filter without a group to be unchanged, got %q", topic)
+	}
+}
+
+func TestSharedSubscriptionNamespace(t *testing.T) {
+	topic := ApplyNamespace("tenant-a", "$share/workers/sensors/#")
+	if topic != "$share/workers/tenant-a/sensors/#" {
+		t.Fatalf("Expected the namespace to prefix the filter, got %q", topic)
+	}
+
+	stripped, ok := StripNamespace("tenant-a", topic)
+	if !ok || stripped != "$share/workers/sensors/#" {
+		t.Errorf("Expected the namespace to be stripped from the filter, got %q", stripped)
+	}
+	if _, ok := StripNamespace("tenant-b", topic); ok {
+		t.Error("Expected the subscription not to belong to another namespace")
+	}
+}
+
+func TestNormalizeTopic(t *testing.T) {
+	tests := []struct {
+		topic    string
+		expected string
+	}{
+		{"sensors/temp", "sensors/temp"},
+		{"sensors//temp", "sensors/temp"},
+		{"sensors///temp", "sensors/temp"},
+		{"sensors/temp/", "sensors/temp"},
+		{"sensors/temp//", "sensors/temp"},
+		{"sensors//temp/", "sensors/temp"},
+		{"/sensors/temp", "/sensors/temp"},
+		{"//sensors/temp", "/sensors/temp"},
+		{"/", "/"},
+		{"//", "/"},
+		{"sensors", "sensors"},
+		{"", ""},
+		{"sensors/+/", "sensors/+"},
+		{"sensors//#", "sensors/#"},
+		{"$share/workers//sensors/#", "$share/workers/sensors/#"},
+	}
+
+	for _, test := range tests {
+		if normalized := NormalizeTopic(test.topic); normalized != test.expected {
+			t.Errorf("Expected %q to be normalized to %q, got %q", test.topic, test.expected, normalized)
+		}
+	}
+
+	// Normalized topics match the filters they were meant for
+	if !TopicMatchesFilter(NormalizeTopic("sensors//temp/"), "sensors/temp") {
+		t.Error("Expected the normalized topic to match sensors/temp")
+	}
+}
+
+// truncate shortens long topics in test failure messages
+func truncate(topic string) string {
+	if len(topic) > 40 {
+		return topic[:40] + "..."
+	}
+	return topic
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"strings"
+)
+
+// TopicTrie indexes values by MQTT topic filter so that the values whose filters match a topic
+// can be found in time proportional to the number of topic levels rather than the number of filters.
+// Filters are interpreted exactly as by TopicMatchesFilter. A TopicTrie is not safe for concurrent
+// use while values are being added, but any number of goroutines may call Match once it is built.
+type TopicTrie struct {
+	root *topicTrieNode
+	size int
+}
+
+// topicTrieNode is one filter level in a TopicTrie
+type topicTrieNode struct {
+	children map[string]*topicTrieNode
+	// values holds the values of filters ending at this level
+	values []interface{}
+	// multiLevel holds the values of filters ending with '#' directly below this level
+	multiLevel []interface{}
+}
+
+// NewTopicTrie creates an empty TopicTrie
+func NewTopicTrie() *TopicTrie {
+	return &TopicTrie{root: newTopicTrieNode()}
+}
+
+func newTopicTrieNode() *topicTrieNode {
+	return &topicTrieNode{children: make(map[string]*topicTrieNode)}
+}
+
+// Add indexes a value under a topic filter. The same filter may be added several times.
+func (t *TopicTrie) Add(filter string, value interface{}) {
+	levels := strings.Split(filter, "/")
+
+	// '#' is only a wildcard as the last level, as in TopicMatchesFilter
+	multiLevel := levels[len(levels)-1] == "#"
+	if multiLevel {
+		levels = levels[:len(levels)-1]
+	}
+
+	node := t.root
+	for _, level := range levels {
+		child, ok := node.children[level]
+		if !ok {
+			child = newTopicTrieNode()
+			node.children[level] = child
+		}
+		node = child
+	}
+
+	if multiLevel {
+		node.multiLevel = append(node.multiLevel, value)
+	} else {
+		node.values = append(node.values, value)
+	}
+	t.size++
+}
+
+// Len returns the number of values in the trie
+func (t *TopicTrie) Len() int {
+	return t.size
+}
+
+// Match returns the values of every filter that matches the topic, in no particular order.
+// A value added under several matching filters is returned once for each of them.
+func (t *TopicTrie) Match(topic string) []interface{} {
+	var matches []interface{}
+	levels := strings.Split(topic, "/")
+
+	// Wildcards at the first level must not match $-prefixed topics
+	if strings.HasPrefix(topic, "$") {
+		if child, ok := t.root.children[levels[0]]; ok {
+			matches = child.match(levels[1:], matches)
+		}
+		return matches
+	}
+
+	return t.root.match(levels, matches)
+}
+
+// match appends the values below this node whose filters match the remaining topic levels
+func (n *topicTrieNode) match(levels []string, matches []interface{}) []interface{} {
+	// A trailing '#' matches the parent level and any number of levels below it
+	matches = append(matches, n.multiLevel...)
+
+	if len(levels) == 0 {
+		return append(matches, n.values...)
+	}
+
+	if child, ok := n.children[levels[0]]; ok {
+		matches = child.match(levels[1:], matches)
+	}
+	if levels[0] != "+" {
+		if child, ok := n.children["+"]; ok {
+			matches = child.match(levels[1:], matches)
+		}
+	}
+	return matches
+}
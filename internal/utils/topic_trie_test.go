@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestTopicTrieMatchesLikeTopicMatchesFilter(t *testing.T) {
+	for _, test := range topicMatchTests {
+		trie := NewTopicTrie()
+		trie.Add(test.filter, test.filter)
+
+		if match := len(trie.Match(test.topic)) == 1; match != test.match {
+			t.Errorf("TopicTrie with %q matching %q = %v, expected %v", test.filter, test.topic, match, test.match)
+		}
+	}
+}
+
+func TestTopicTrieReturnsEveryMatchingFilter(t *testing.T) {
+	filters := []string{"#", "sport/#", "sport/+", "sport/tennis", "sport/+/player1", "+/tennis/#", "sport/tennis/#", "$SYS/#", "other", "sport/tennis"}
+	topics := []string{"sport", "sport/tennis", "sport/tennis/player1", "sport/golf", "$SYS/uptime", "other", "", "/"}
+
+	trie := NewTopicTrie()
+	for i, filter := range filters {
+		trie.Add(filter, i)
+	}
+	if trie.Len() != len(filters) {
+		t.Errorf("Expected %d values, got %d", len(filters), trie.Len())
+	}
+
+	for _, topic := range topics {
+		var expected []int
+		for i, filter := range filters {
+			if TopicMatchesFilter(topic, filter) {
+				expected = append(expected, i)
+			}
+		}
+
+		var matched []int
+		for _, value := range trie.Match(topic) {
+			matched = append(matched, value.(int))
+		}
+		sort.Ints(matched)
+
+		if fmt.Sprint(matched) != fmt.Sprint(expected) {
+			t.Errorf("Match(%q) = %v, expected %v", topic, matched, expected)
+		}
+	}
+}
+
+// benchmarkFilters returns n filters spread over a few thousand devices, a tenth of them with wildcards
+func benchmarkFilters(n int) []string {
+	filters := make([]string, n)
+	for i := range filters {
+		switch i % 10 {
+		case 0:
+			filters[i] = fmt.Sprintf("site%d/+/temperature", i%50)
+		case 1:
+			filters[i] = fmt.Sprintf("site%d/device%d/#", i%50, i)
+		default:
+			filters[i] = fmt.Sprintf("site%d/device%d/temperature", i%50, i)
+		}
+	}
+	return filters
+}
+
+const benchmarkTopic = "site7/device1007/temperature"
+
+func BenchmarkTopicTrieMatch10k(b *testing.B) {
+	trie := NewTopicTrie()
+	for _, filter := range benchmarkFilters(10000) {
+		trie.Add(filter, filter)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Match(benchmarkTopic)
+	}
+}
+
+func BenchmarkTopicMatchesFilterLinear10k(b *testing.B) {
+	filters := benchmarkFilters(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var matches []string
+		for _, filter := range filters {
+			if TopicMatchesFilter(benchmarkTopic, filter) {
+				matches = append(matches, filter)
+			}
+		}
+	}
+}
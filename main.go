@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"sort"
 	"syscall"
 	"time"
 
@@ -18,15 +20,39 @@ import (
 	"MQTTmicroService/internal/mqtt"
 )
 
+// Build information, injected at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
 func main() {
 	// Parse command line flags
 	httpAddr := flag.String("http-addr", ":8080", "HTTP server address")
+	httpReadTimeout := flag.Duration("http-read-timeout", api.DefaultHTTPReadTimeout, "Maximum duration for reading an HTTP request, including its body (0 disables it)")
+	httpWriteTimeout := flag.Duration("http-write-timeout", api.DefaultHTTPWriteTimeout, "Maximum duration for writing an HTTP response (0 disables it); streaming responses are exempt")
+	httpIdleTimeout := flag.Duration("http-idle-timeout", api.DefaultHTTPIdleTimeout, "How long idle keep-alive HTTP connections are kept open (0 uses the read timeout)")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	logFormat := flag.String("log-format", "text", "Log format (text, json)")
 	logFile := flag.String("log-file", "mqtt-service.log", "Log file path")
 	enableFileLogging := flag.Bool("file-logging", true, "Enable logging to file")
+	logMaxSize := flag.Int("log-max-size", 0, "Rotate the log file once it reaches this size in megabytes (0 disables rotation)")
+	logMaxBackups := flag.Int("log-max-backups", 0, "Number of rotated log files to keep (0 keeps all)")
+	logMaxAge := flag.Int("log-max-age", 0, "Number of days to keep rotated log files (0 keeps them regardless of age)")
+	logCompress := flag.Bool("log-compress", false, "Compress rotated log files with gzip")
+	validate := flag.Bool("validate", false, "Validate the configuration, print a report, and exit without starting the service")
+	allowDegradedStart := flag.Bool("allow-degraded-start", false, "Keep running when no MQTT broker can be connected at startup")
+	requireDefaultBroker := flag.Bool("require-default-broker", false, "Exit when the default MQTT broker can't be connected at startup, even if other brokers can")
+	enablePprof := flag.Bool("enable-pprof", false, "Serve runtime profiles under /debug/pprof/ to admin API keys, or only to localhost when authentication is disabled")
 	flag.Parse()
 
+	// Check the configuration without starting anything, exiting non-zero on any problem
+	if *validate {
+		os.Exit(writeValidationReport(os.Stdout, validateConfig()))
+	}
+
 	// Initialize logger
 	var log *logger.Logger
 	var err error
@@ -37,6 +63,10 @@ func main() {
 			Level:      *logLevel,
 			Format:     *logFormat,
 			TimeFormat: "2006-01-02 15:04:05",
+			MaxSizeMB:  *logMaxSize,
+			MaxBackups: *logMaxBackups,
+			MaxAgeDays: *logMaxAge,
+			Compress:   *logCompress,
 		}
 		log, err = logger.NewFileLogger(*logFile, logConfig)
 		if err != nil {
@@ -61,25 +91,55 @@ func main() {
 		log = logger.New(logConfig)
 	}
 
-	log.Info("Starting MQTT microservice")
+	log.WithFields(map[string]interface{}{
+		"version":    version,
+		"commit":     commit,
+		"build_date": buildDate,
+		"go_version": runtime.Version(),
+	}).Info("Starting MQTT microservice")
 
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.WithError(err).Fatal("Failed to load configuration")
 	}
+	log.WithFields(cfg.Summary()).Debug("Configuration loaded")
 
 	// Initialize metrics collector
 	metricsCollector := metrics.New(log)
+	if cfg.MetricsMaxTopics > 0 {
+		metricsCollector.SetMaxTopics(cfg.MetricsMaxTopics)
+	}
+	if cfg.MetricsLatencyBuckets != nil {
+		metricsCollector.SetLatencyBuckets(cfg.MetricsLatencyBuckets)
+	}
 	log.Info("Metrics collector initialized")
 
 	// Initialize authentication service
+	apiKeys := auth.ParseAPIKeys(cfg.APIKeys)
+	if err := auth.ValidateScopes(apiKeys); err != nil {
+		log.WithError(err).Fatal("Invalid API key configuration")
+	}
+	if err := auth.ValidateJWTDefaultScopes(cfg.JWTDefaultScopes); err != nil {
+		log.WithError(err).Fatal("Invalid JWT configuration")
+	}
 	authConfig := &auth.Config{
-		EnableAPIKey: cfg.EnableAPIKey,
-		APIKeys:      cfg.APIKeys,
+		EnableAPIKey:     cfg.EnableAPIKey,
+		APIKeys:          apiKeys,
+		APIKeyHeaders:    cfg.APIKeyHeaders,
+		BasicAuthField:   cfg.APIKeyBasicAuthField,
+		EnableJWT:        cfg.EnableJWT,
+		JWTSecret:        cfg.JWTSecret,
+		JWTJWKSURL:       cfg.JWTJWKSURL,
+		JWTAudience:      cfg.JWTAudience,
+		JWTIssuer:        cfg.JWTIssuer,
+		JWTDefaultScopes: cfg.JWTDefaultScopes,
 	}
 	authService := auth.New(authConfig, log)
-	log.WithField("enableAPIKey", cfg.EnableAPIKey).Info("Authentication service initialized")
+	log.WithFields(map[string]interface{}{
+		"enableAPIKey": cfg.EnableAPIKey,
+		"enableJWT":    cfg.EnableJWT,
+	}).Info("Authentication service initialized")
 
 	// Initialize database
 	var db database.Database
@@ -88,31 +148,19 @@ func main() {
 
 		// Create database instance
 		var err error
-		dbConfig := &database.Config{
-			Type:       cfg.Database.Type,
-			Connection: cfg.Database.Connection,
-		}
-
-		// Copy MongoDB settings
-		dbConfig.MongoDB.URI = cfg.Database.MongoDB.URI
-		dbConfig.MongoDB.Database = cfg.Database.MongoDB.Database
-		dbConfig.MongoDB.Username = cfg.Database.MongoDB.Username
-		dbConfig.MongoDB.Password = cfg.Database.MongoDB.Password
-		dbConfig.MongoDB.Port = cfg.Database.MongoDB.Port
+		dbConfig := databaseConfig(cfg.Database)
 
-		// Copy SQLite settings
-		dbConfig.SQLite.Path = cfg.Database.SQLite.Path
-
-		db, err = database.New(dbConfig)
+		// Supervise the connection, so it is retried at startup and re-established if it drops later
+		db, err = database.NewSupervisor(dbConfig, database.RetryConfig{
+			Attempts: cfg.Database.ConnectAttempts,
+			MaxWait:  time.Duration(cfg.Database.ReconnectMaxWait) * time.Second,
+		}, log)
 		if err != nil {
 			log.WithError(err).Fatal("Failed to create database instance")
 		}
 
 		// Connect to database
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		if err := db.Connect(ctx); err != nil {
+		if err := db.Connect(context.Background()); err != nil {
 			log.WithError(err).Fatal("Failed to connect to database")
 		}
 		defer func() {
@@ -125,29 +173,26 @@ func main() {
 
 		log.Info("Connected to database")
 	} else {
-		log.Warn("No database configuration found, messages will not be stored")
+		log.WithField("buffer_size", cfg.MemoryBufferSize).Warn("No database configuration found, only recent messages will be kept in memory")
 	}
 
 	// Initialize MQTT client manager
 	mqttManager := mqtt.NewManager(cfg, log, metricsCollector, db)
 
-	// Connect to default MQTT broker
-	defaultClient, err := mqttManager.GetDefaultClient()
-	if err != nil {
-		log.WithError(err).Fatal("Failed to get default MQTT client")
+	// Initialize HTTP API server
+	httpTimeouts := api.HTTPTimeouts{
+		Read:  *httpReadTimeout,
+		Write: *httpWriteTimeout,
+		Idle:  *httpIdleTimeout,
 	}
-
-	if err := defaultClient.Connect(); err != nil {
-		log.WithError(err).Fatal("Failed to connect to default MQTT broker")
+	apiServer := api.NewServer(mqttManager, log, metricsCollector, authService, db, cfg, *httpAddr, httpTimeouts)
+	apiServer.SetBuildInfo(api.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate})
+	if *enablePprof {
+		apiServer.EnableProfiling()
+		log.Warn("Profiling enabled: runtime profiles are served under /debug/pprof/")
 	}
-	defer defaultClient.Disconnect()
-
-	log.WithField("broker", cfg.DefaultConnection).Info("Connected to default MQTT broker")
 
-	// Initialize HTTP API server
-	apiServer := api.NewServer(mqttManager, log, metricsCollector, authService, db, cfg, *httpAddr)
-
-	// Start HTTP server in a goroutine
+	// Start HTTP server in a goroutine, so /readyz reports the broker connection while it is being retried
 	go func() {
 		if err := apiServer.Start(); err != nil {
 			log.WithError(err).Fatal("Failed to start HTTP server")
@@ -156,23 +201,116 @@ func main() {
 
 	log.WithField("addr", *httpAddr).Info("HTTP server started")
 
+	// Connect to default MQTT broker, retrying while it may still be starting up
+	defaultClient, err := mqttManager.GetDefaultClient()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to get default MQTT client")
+	}
+
+	// Stop retrying when the service is asked to shut down
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	maxWait := time.Duration(cfg.StartupConnectMaxWait) * time.Second
+	err = defaultClient.ConnectWithRetry(signalCtx, cfg.StartupConnectAttempts, maxWait)
+	switch {
+	case signalCtx.Err() != nil:
+		log.Info("Interrupted while connecting to default MQTT broker")
+	case err != nil && *requireDefaultBroker:
+		log.WithError(err).Fatal("Failed to connect to default MQTT broker")
+	case err != nil:
+		// Keep serving the brokers that work; /readyz reports the default broker as unavailable
+		// until it is reconnected through POST /brokers/{name}/connect
+		connected := connectOtherBrokers(mqttManager, cfg, log)
+		if len(connected) == 0 && !*allowDegradedStart {
+			log.WithError(err).Fatal("Failed to connect to default MQTT broker, and no other broker is reachable")
+		}
+		log.WithError(err).WithFields(map[string]interface{}{
+			"broker":            cfg.DefaultConnection,
+			"connected_brokers": connected,
+		}).Warn("Failed to connect to default MQTT broker, starting degraded")
+	default:
+		log.WithField("broker", cfg.DefaultConnection).Info("Connected to default MQTT broker")
+	}
+	defer func() {
+		for _, client := range mqttManager.GetAllClients() {
+			client.Disconnect()
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shut down the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	<-signalCtx.Done()
 
 	log.Info("Shutting down...")
 
-	// Create a deadline to wait for (not used in this simple implementation)
-	// but would be used in a more complex shutdown process
-	_, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Give in-flight requests up to 10 seconds to finish
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline
-	if err := apiServer.Stop(); err != nil {
+	if err := apiServer.Stop(ctx); err != nil {
 		log.WithError(err).Error("Error shutting down HTTP server")
 	}
 
+	// Store the messages still queued for asynchronous storage before the database is closed
+	storeCtx, cancelStore := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelStore()
+	mqttManager.StopStorageWriter(storeCtx)
+
 	log.Info("Server gracefully stopped")
 }
+
+// connectOtherBrokers attempts once to connect every configured broker other than the default one,
+// returning the names of those that connected
+func connectOtherBrokers(manager *mqtt.Manager, cfg *config.Config, log *logger.Logger) []string {
+	names := make([]string, 0, len(cfg.Brokers))
+	for name := range cfg.Brokers {
+		if name != cfg.DefaultConnection {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	connected := make([]string, 0, len(names))
+	for _, name := range names {
+		client, err := manager.GetClient(name)
+		if err == nil {
+			err = client.Connect()
+		}
+		if err != nil {
+			log.WithError(err).WithField("broker", name).Warn("Failed to connect to MQTT broker")
+			continue
+		}
+		log.WithField("broker", name).Info("Connected to MQTT broker")
+		connected = append(connected, name)
+	}
+	return connected
+}
+
+// databaseConfig converts the database settings of the service configuration to a database provider configuration
+func databaseConfig(cfg *config.DatabaseConfig) *database.Config {
+	dbConfig := &database.Config{
+		Type:       cfg.Type,
+		Connection: cfg.Connection,
+	}
+
+	// Copy MongoDB settings
+	dbConfig.MongoDB.URI = cfg.MongoDB.URI
+	dbConfig.MongoDB.Database = cfg.MongoDB.Database
+	dbConfig.MongoDB.Username = cfg.MongoDB.Username
+	dbConfig.MongoDB.Password = cfg.MongoDB.Password
+	dbConfig.MongoDB.Port = cfg.MongoDB.Port
+
+	// Copy SQLite settings
+	dbConfig.SQLite.Path = cfg.SQLite.Path
+	dbConfig.SQLite.BusyTimeout = time.Duration(cfg.SQLite.BusyTimeout) * time.Millisecond
+	dbConfig.SQLite.JournalMode = cfg.SQLite.JournalMode
+	dbConfig.SQLite.Synchronous = cfg.SQLite.Synchronous
+
+	// Copy deduplication settings
+	dbConfig.Dedup = cfg.Dedup
+	dbConfig.DedupWindow = time.Duration(cfg.DedupWindow) * time.Second
+
+	return dbConfig
+}
@@ -0,0 +1,269 @@
+// Package client is a Go client for the HTTP API of the MQTT microservice. It wraps the endpoints with typed
+// requests and responses, sends the API key with every request, and takes a context for cancellation.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultAPIKeyHeader is the header the API key is sent in unless the client is configured otherwise
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// maxErrorBodyBytes limits how much of a response that isn't a JSON error is kept in the error message
+const maxErrorBodyBytes = 4096
+
+// Client calls the HTTP API of the MQTT microservice. Its fields can be changed after New and before the
+// client is used; it is safe for concurrent use afterwards.
+type Client struct {
+	// BaseURL is the URL of the service, such as http://localhost:8080
+	BaseURL string
+	// APIKey is sent in the APIKeyHeader header of every request, unless it is empty
+	APIKey string
+	// APIKeyHeader is the header the API key is sent in, matching one of the service's API_KEY_HEADERS
+	APIKeyHeader string
+	// HTTPClient makes the requests; timeouts are usually better set on the context of each call
+	HTTPClient *http.Client
+}
+
+// New creates a client for the service at baseURL, authenticating with the API key
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		APIKey:       apiKey,
+		APIKeyHeader: DefaultAPIKeyHeader,
+		HTTPClient:   http.DefaultClient,
+	}
+}
+
+// Error is an error response of the API
+type Error struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int `json:"-"`
+	// Code is the machine-readable error code, such as not_found or invalid_topic; it is empty for
+	// responses that weren't sent by the service, such as those of a proxy
+	Code string `json:"code"`
+	// Message describes the error for humans and may change; branch on Code instead
+	Message string `json:"message"`
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API request failed with status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Publish publishes a message
+func (c *Client) Publish(ctx context.Context, req *PublishRequest) (*PublishResponse, error) {
+	var response PublishResponse
+	if err := c.do(ctx, http.MethodPost, "/publish", nil, req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Subscribe subscribes the service to a topic filter. Messages received on it are forwarded to the
+// matching webhooks, not to the client.
+func (c *Client) Subscribe(ctx context.Context, req *SubscribeRequest) (*SubscribeResponse, error) {
+	var response SubscribeResponse
+	if err := c.do(ctx, http.MethodPost, "/subscribe", nil, req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Unsubscribe unsubscribes the service from a topic filter; the QoS of the request is ignored
+func (c *Client) Unsubscribe(ctx context.Context, req *SubscribeRequest) error {
+	return c.do(ctx, http.MethodPost, "/unsubscribe", nil, req, nil)
+}
+
+// Status returns the connection status of the brokers
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	var response StatusResponse
+	if err := c.do(ctx, http.MethodGet, "/status", nil, nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetMessages returns stored messages, newest first. A nil query returns the first 100 unconfirmed messages.
+func (c *Client) GetMessages(ctx context.Context, query *MessageQuery) ([]Message, error) {
+	params := url.Values{}
+	if query != nil {
+		if query.Confirmed {
+			params.Set("confirmed", "true")
+		}
+		if query.Topic != "" {
+			params.Set("topic", query.Topic)
+		}
+		if query.Status != "" {
+			params.Set("status", query.Status)
+		}
+		if query.Limit > 0 {
+			params.Set("limit", strconv.Itoa(query.Limit))
+		}
+	}
+
+	var response struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/messages", params, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Messages, nil
+}
+
+// GetMessage returns a stored message
+func (c *Client) GetMessage(ctx context.Context, id string) (*Message, error) {
+	var response struct {
+		Message *Message `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/messages/"+url.PathEscape(id), nil, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Message, nil
+}
+
+// ConfirmMessage marks a stored message as confirmed
+func (c *Client) ConfirmMessage(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/messages/"+url.PathEscape(id)+"/confirm", nil, nil, nil)
+}
+
+// DeleteMessage deletes a stored message
+func (c *Client) DeleteMessage(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/messages/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// GetWebhooks returns the webhooks; a limit of 0 uses the service's default of 100
+func (c *Client) GetWebhooks(ctx context.Context, limit int) ([]Webhook, error) {
+	params := url.Values{}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	var response struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/webhooks", params, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Webhooks, nil
+}
+
+// GetWebhook returns a webhook
+func (c *Client) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	var response struct {
+		Webhook *Webhook `json:"webhook"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/webhooks/"+url.PathEscape(id), nil, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Webhook, nil
+}
+
+// CreateWebhook creates a webhook and returns it with its ID
+func (c *Client) CreateWebhook(ctx context.Context, req *WebhookRequest) (*Webhook, error) {
+	var response struct {
+		Webhook *Webhook `json:"webhook"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/webhooks", nil, req, &response); err != nil {
+		return nil, err
+	}
+	return response.Webhook, nil
+}
+
+// UpdateWebhook updates a webhook and returns it. Empty fields of the request are left unchanged, see WebhookRequest.
+func (c *Client) UpdateWebhook(ctx context.Context, id string, req *WebhookRequest) (*Webhook, error) {
+	var response struct {
+		Webhook *Webhook `json:"webhook"`
+	}
+	if err := c.do(ctx, http.MethodPut, "/webhooks/"+url.PathEscape(id), nil, req, &response); err != nil {
+		return nil, err
+	}
+	return response.Webhook, nil
+}
+
+// DeleteWebhook deletes a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/webhooks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// do sends a request with the body encoded as JSON, unless it is nil, and decodes the response into out,
+// unless it is nil. Responses with a status other than 2xx are returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, body, out interface{}) error {
+	endpoint := c.BaseURL + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		header := c.APIKeyHeader
+		if header == "" {
+			header = DefaultAPIKeyHeader
+		}
+		req.Header.Set(header, c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// responseError returns the error of a response with a status other than 2xx, keeping the start of the
+// body as the message if it isn't a JSON error of the service
+func responseError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Code = ""
+		apiErr.Message = strings.TrimSpace(string(data))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	return apiErr
+}
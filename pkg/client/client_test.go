@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"MQTTmicroService/internal/api"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+)
+
+// newTestClient starts a server calling handler and returns a client of it with the API key "secret-key"
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get(DefaultAPIKeyHeader); key != "secret-key" {
+			t.Errorf("Expected the API key to be sent, got %q", key)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "secret-key")
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func TestPublish(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/publish" {
+			t.Errorf("Expected POST /publish, got %s %s", r.Method, r.URL.Path)
+		}
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		expected := map[string]interface{}{"topic": "sensors/temp", "payload": map[string]interface{}{"value": 21.5}, "qos": 1.0}
+		if !reflect.DeepEqual(req, expected) {
+			t.Errorf("Expected request %v, got %v", expected, req)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success", "message": "Message published successfully", "id": "42", "timestamp": timestamp,
+		})
+	})
+
+	response, err := c.Publish(context.Background(), &PublishRequest{
+		Topic:   "sensors/temp",
+		Payload: map[string]interface{}{"value": 21.5},
+		QoS:     QoS(1),
+	})
+	if err != nil {
+		t.Fatalf("Expected publish to succeed, got %v", err)
+	}
+	if response.ID != "42" || !response.Timestamp.Equal(timestamp) {
+		t.Errorf("Expected the ID and timestamp of the message, got %+v", response)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/missing":
+			writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "code": "not_found", "message": "Message not found"})
+		default:
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		}
+	})
+
+	_, err := c.GetMessage(context.Background(), "missing")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an API error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "not_found" || apiErr.Message != "Message not found" {
+		t.Errorf("Expected a not_found error, got %+v", apiErr)
+	}
+
+	// Responses that aren't errors of the service keep their body as the message
+	err = c.DeleteWebhook(context.Background(), "1")
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an API error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != "" || apiErr.Message != "upstream unavailable" {
+		t.Errorf("Expected the body of the response as the message, got %+v", apiErr)
+	}
+}
+
+func TestGetMessages(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.RawQuery; query != "limit=10&status=delivered&topic=sensors%2F%2B%2Ftemp" {
+			t.Errorf("Unexpected query %s", query)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"count":  1,
+			"messages": []map[string]interface{}{
+				{"id": "1", "topic": "sensors/kitchen/temp", "payload": map[string]interface{}{"value": 21.5}, "content_type": "json", "status": "delivered"},
+			},
+		})
+	})
+
+	messages, err := c.GetMessages(context.Background(), &MessageQuery{Topic: "sensors/+/temp", Status: "delivered", Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected to get messages, got %v", err)
+	}
+	if len(messages) != 1 || messages[0].Topic != "sensors/kitchen/temp" || string(messages[0].Payload) != `{"value":21.5}` {
+		t.Errorf("Unexpected messages %+v", messages)
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/webhooks" {
+			t.Errorf("Expected POST /webhooks, got %s %s", r.Method, r.URL.Path)
+		}
+		var req WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"status":  "success",
+			"message": "Webhook created successfully",
+			"webhook": Webhook{ID: "7", URL: req.URL, TopicFilter: req.TopicFilter, Enabled: req.Enabled, MinQoS: *req.MinQoS},
+		})
+	})
+
+	webhook, err := c.CreateWebhook(context.Background(), &WebhookRequest{
+		URL:         "https://example.com/hook",
+		TopicFilter: "sensors/#",
+		Enabled:     true,
+		MinQoS:      QoS(1),
+	})
+	if err != nil {
+		t.Fatalf("Expected the webhook to be created, got %v", err)
+	}
+	if webhook.ID != "7" || webhook.TopicFilter != "sensors/#" || webhook.MinQoS != 1 {
+		t.Errorf("Unexpected webhook %+v", webhook)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request with a cancelled context")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Status(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the request to be cancelled, got %v", err)
+	}
+}
+
+// TestTypesMatchTheAPI guards against the types of the client drifting from those of the service
+func TestTypesMatchTheAPI(t *testing.T) {
+	types := [][2]interface{}{
+		{PublishRequest{}, api.PublishRequest{}},
+		{SubscribeRequest{}, api.SubscribeRequest{}},
+		{StatusResponse{}, api.StatusResponse{}},
+		{BrokerStatus{}, api.BrokerStatus{}},
+		{SharedSubscription{}, api.SharedSubscription{}},
+		{ConnectionError{}, api.ConnectionError{}},
+		{BrokerHealth{}, api.BrokerHealth{}},
+		{WebhookRequest{}, api.WebhookRequest{}},
+		{PayloadCondition{}, models.PayloadCondition{}},
+		{Webhook{}, models.Webhook{}},
+		{Message{}, database.Message{}},
+	}
+
+	for _, pair := range types {
+		clientType, apiType := pair[0], pair[1]
+		fields, expected := jsonTags(reflect.TypeOf(clientType)), jsonTags(reflect.TypeOf(apiType))
+		if !reflect.DeepEqual(fields, expected) {
+			t.Errorf("Expected %T to have the JSON fields of %T %v, got %v", clientType, apiType, expected, fields)
+		}
+	}
+}
+
+// jsonTags returns the JSON tags of the fields of a struct that are encoded
+func jsonTags(typ reflect.Type) map[string]bool {
+	tags := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		if tag := typ.Field(i).Tag.Get("json"); tag != "" && tag != "-" {
+			tags[tag] = true
+		}
+	}
+	return tags
+}
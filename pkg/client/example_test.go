@@ -0,0 +1,40 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"MQTTmicroService/pkg/client"
+)
+
+func Example() {
+	c := client.New("http://localhost:8080", "your-api-key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Publish a JSON payload with QoS 1, which the broker acknowledges before Publish returns
+	response, err := c.Publish(ctx, &client.PublishRequest{
+		Topic:   "sensors/temperature",
+		Payload: map[string]interface{}{"value": 21.5, "unit": "C"},
+		QoS:     client.QoS(1),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Look up the stored message, branching on the error code if it wasn't stored
+	msg, err := c.GetMessage(ctx, response.ID)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Code == "not_found" {
+		fmt.Println("The message wasn't stored")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(msg.Topic, msg.Status)
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PublishRequest is a request to publish a message
+type PublishRequest struct {
+	Topic string `json:"topic"`
+	// Payload is published as it is if it is a string, and as JSON otherwise. A nil payload publishes an empty
+	// one, which the service rejects for retained messages; use "" to clear a retained message.
+	Payload interface{} `json:"payload"`
+	// PayloadEncoding is base64 for a binary payload sent as a base64 string, or empty
+	PayloadEncoding string `json:"payload_encoding,omitempty"`
+	// QoS defaults to the service's DEFAULT_PUBLISH_QOS when nil
+	QoS *byte `json:"qos,omitempty"`
+	// Retained defaults to the service's DEFAULT_RETAINED when nil
+	Retained *bool  `json:"retained,omitempty"`
+	Broker   string `json:"broker,omitempty"`
+	// Brokers publishes the message to several brokers instead of one, ["*"] to every configured broker
+	Brokers []string `json:"brokers,omitempty"`
+	// IdempotencyKey makes retries of the request publish the message only once
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// PublishResponse is the outcome of a publish
+type PublishResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// ID is the ID of the stored message; it is empty if the message wasn't stored
+	ID        string    `json:"id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SubscribeRequest is a request to subscribe to or unsubscribe from a topic filter
+type SubscribeRequest struct {
+	Topic string `json:"topic"`
+	// QoS defaults to the service's DEFAULT_SUBSCRIBE_QOS when nil
+	QoS    *byte  `json:"qos,omitempty"`
+	Broker string `json:"broker,omitempty"`
+}
+
+// SubscribeResponse is the outcome of a subscription
+type SubscribeResponse struct {
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	GrantedQoS byte   `json:"granted_qos"`
+	// Warning is set when the broker granted a lower QoS than requested
+	Warning string `json:"warning,omitempty"`
+}
+
+// StatusResponse is the connection status of the brokers
+type StatusResponse struct {
+	Status    string                  `json:"status"`
+	Brokers   map[string]BrokerStatus `json:"brokers"`
+	Timestamp string                  `json:"timestamp"`
+}
+
+// BrokerStatus is the status of a single broker
+type BrokerStatus struct {
+	Connected           bool                 `json:"connected"`
+	Subscriptions       []string             `json:"subscriptions"`
+	SharedSubscriptions []SharedSubscription `json:"shared_subscriptions,omitempty"`
+	LastError           *ConnectionError     `json:"last_error,omitempty"`
+	Health              *BrokerHealth        `json:"health,omitempty"`
+}
+
+// SharedSubscription describes a shared subscription of a broker
+type SharedSubscription struct {
+	Topic  string `json:"topic"`
+	Group  string `json:"group"`
+	Filter string `json:"filter"`
+}
+
+// ConnectionError describes a failed broker connection attempt
+type ConnectionError struct {
+	Message    string `json:"message"`
+	Reason     string `json:"reason"`
+	ReturnCode byte   `json:"return_code"`
+}
+
+// BrokerHealth is the connection quality of a broker, only reported for GET /status?detail=full
+type BrokerHealth struct {
+	Latency         string `json:"latency,omitempty"`
+	ProbeError      string `json:"probe_error,omitempty"`
+	CheckedAt       string `json:"checked_at,omitempty"`
+	LastConnectedAt string `json:"last_connected_at,omitempty"`
+}
+
+// MessageQuery selects the stored messages returned by GetMessages
+type MessageQuery struct {
+	// Confirmed selects confirmed messages instead of unconfirmed ones; it is ignored when Topic is set
+	Confirmed bool
+	// Topic is a topic filter, which may contain wildcards, that the topics of the messages must match
+	Topic string
+	// Status selects messages with a delivery status: pending, delivered, or failed
+	Status string
+	// Limit is the maximum number of messages returned; 0 uses the service's default of 100
+	Limit int
+}
+
+// Message is a stored message
+type Message struct {
+	ID    string `json:"id"`
+	Topic string `json:"topic"`
+	// Payload is a JSON string for text payloads, a JSON value for JSON payloads, and a base64 JSON string
+	// for binary payloads, as told by ContentType
+	Payload   json.RawMessage `json:"payload"`
+	QoS       byte            `json:"qos"`
+	Retained  bool            `json:"retained"`
+	Timestamp time.Time       `json:"timestamp"`
+	Confirmed bool            `json:"confirmed"`
+	// Status is the delivery status of the message: pending, delivered, or failed
+	Status string `json:"status"`
+	// ContentType is text, json, or binary
+	ContentType string `json:"content_type"`
+	// OriginalTopic is the topic the message was published to before a topic rewrite rule changed it
+	OriginalTopic string `json:"original_topic,omitempty"`
+}
+
+// WebhookRequest is a request to create or update a webhook. When updating, empty fields are left unchanged,
+// except for the pointer fields, which are only left unchanged when nil.
+type WebhookRequest struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	TopicFilter string            `json:"topic_filter"`
+	Enabled     bool              `json:"enabled"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Timeout     int               `json:"timeout"`
+	RetryCount  int               `json:"retry_count"`
+	RetryDelay  int               `json:"retry_delay"`
+	Secret      string            `json:"secret,omitempty"`
+	// BodyTemplate and ContentType are pointers so an update can clear them with an empty string
+	BodyTemplate *string `json:"body_template,omitempty"`
+	ContentType  *string `json:"content_type,omitempty"`
+	// MinQoS is a pointer so an update can lower it back to 0
+	MinQoS *byte `json:"min_qos,omitempty"`
+	// Condition replaces the webhook's payload condition; an update with an empty condition removes it
+	Condition *PayloadCondition `json:"condition,omitempty"`
+}
+
+// PayloadCondition restricts the notifications of a webhook to messages whose JSON payload satisfies it
+type PayloadCondition struct {
+	// Path is the JSON path of the compared field, written like $.sensor.temperature or readings[0].value
+	Path string `json:"path"`
+	// Operator is one of ==, !=, >, >=, <, and <=
+	Operator string `json:"operator"`
+	// Value is what the field is compared with
+	Value interface{} `json:"value"`
+}
+
+// Webhook is a webhook; its secret is never returned
+type Webhook struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	URL          string            `json:"url"`
+	Method       string            `json:"method"`
+	TopicFilter  string            `json:"topic_filter"`
+	Enabled      bool              `json:"enabled"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Timeout      int               `json:"timeout"`
+	RetryCount   int               `json:"retry_count"`
+	RetryDelay   int               `json:"retry_delay"`
+	MinQoS       byte              `json:"min_qos,omitempty"`
+	Condition    *PayloadCondition `json:"condition,omitempty"`
+	BodyTemplate string            `json:"body_template,omitempty"`
+	ContentType  string            `json:"content_type,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// QoS returns a pointer to a QoS level, for the QoS fields of requests
+func QoS(level byte) *byte {
+	return &level
+}
+
+// Bool returns a pointer to a boolean, for the Retained field of publish requests
+func Bool(value bool) *bool {
+	return &value
+}
+
+// String returns a pointer to a string, for the optional string fields of webhook requests
+func String(value string) *string {
+	return &value
+}
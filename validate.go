@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"MQTTmicroService/internal/auth"
+	"MQTTmicroService/internal/config"
+	"MQTTmicroService/internal/database"
+	"MQTTmicroService/internal/models"
+)
+
+// validationCheck is the outcome of a single check of the configuration report
+type validationCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// validationReport is the configuration report printed by the -validate flag
+type validationReport struct {
+	Status string            `json:"status"`
+	Checks []validationCheck `json:"checks"`
+}
+
+// add records the outcome of a check, marking the report as failed on error
+func (r *validationReport) add(name string, err error) {
+	check := validationCheck{Name: name, Status: "ok"}
+	if err != nil {
+		check.Status = "error"
+		check.Error = err.Error()
+		r.Status = "error"
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// validateConfig loads the configuration like a normal start and checks every broker, the API keys, the webhook
+// settings, and that the database is reachable, without connecting to any broker or starting servers
+func validateConfig() *validationReport {
+	report := &validationReport{Status: "ok"}
+
+	cfg, err := config.LoadConfig()
+	report.add("config", err)
+	if err != nil {
+		return report
+	}
+
+	// Check brokers in a stable order
+	names := make([]string, 0, len(cfg.Brokers))
+	for name := range cfg.Brokers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report.add("broker:"+name, cfg.Brokers[name].Validate())
+	}
+
+	report.add("api_keys", auth.ValidateScopes(auth.ParseAPIKeys(cfg.APIKeys)))
+
+	if cfg.Webhook != nil && cfg.Webhook.Enabled {
+		// Validate the global webhook like a webhook created through the API
+		webhook := &models.Webhook{
+			URL:         cfg.Webhook.URL,
+			Method:      cfg.Webhook.Method,
+			TopicFilter: "#",
+			Timeout:     cfg.Webhook.Timeout,
+			RetryCount:  cfg.Webhook.RetryCount,
+			RetryDelay:  cfg.Webhook.RetryDelay,
+		}
+		report.add("webhook", webhook.Validate())
+	}
+
+	if cfg.Webhook != nil && cfg.Webhook.ConfirmURL != "" {
+		webhook := &models.Webhook{
+			URL:         cfg.Webhook.ConfirmURL,
+			Method:      "POST",
+			TopicFilter: "#",
+			Timeout:     cfg.Webhook.Timeout,
+			RetryCount:  cfg.Webhook.RetryCount,
+			RetryDelay:  cfg.Webhook.RetryDelay,
+		}
+		report.add("confirm_webhook", webhook.Validate())
+	}
+
+	if cfg.Database != nil && cfg.Database.Type != "" {
+		report.add("database", checkDatabase(cfg.Database))
+	}
+
+	return report
+}
+
+// checkDatabase connects to the configured database once and pings it
+func checkDatabase(cfg *config.DatabaseConfig) error {
+	db, err := database.New(databaseConfig(cfg))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.Connect(ctx); err != nil {
+		return err
+	}
+	defer db.Close(ctx)
+
+	return db.Ping(ctx)
+}
+
+// writeValidationReport prints the report as indented JSON and returns the process exit code
+func writeValidationReport(w io.Writer, report *validationReport) int {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "Failed to encode validation report: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(w, string(data))
+
+	if report.Status != "ok" {
+		return 1
+	}
+	return 0
+}